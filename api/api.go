@@ -91,6 +91,7 @@ func (srv *Server) initAPI() {
 
 	// Renter API Calls
 	if srv.renter != nil {
+		router.GET("/renter/contracts", srv.renterContractsHandler)
 		router.GET("/renter/downloads", srv.renterDownloadsHandler)
 		router.GET("/renter/files", srv.renterFilesHandler)
 
@@ -101,11 +102,14 @@ func (srv *Server) initAPI() {
 
 		router.POST("/renter/delete/*siapath", srv.renterDeleteHandler)
 		router.GET("/renter/download/*siapath", srv.renterDownloadHandler)
+		router.GET("/renter/filehosts/*siapath", srv.renterFileHostsHandler)
+		router.POST("/renter/priority/*siapath", srv.renterPriorityHandler)
 		router.POST("/renter/rename/*siapath", srv.renterRenameHandler)
 		router.POST("/renter/upload/*siapath", srv.renterUploadHandler)
 
 		router.GET("/renter/hosts/active", srv.renterHostsActiveHandler)
 		router.GET("/renter/hosts/all", srv.renterHostsAllHandler)
+		router.GET("/renter/hosts/scanqueue", srv.renterHostsScanQueueHandler)
 	}
 
 	// TransactionPool API Calls
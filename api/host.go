@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -14,14 +16,21 @@ type (
 	// HostGET contains the information that is returned after a GET request to
 	// /host.
 	HostGET struct {
-		Collateral   types.Currency     `json:"collateral"`
-		NetAddress   modules.NetAddress `json:"netaddress"`
-		MaxDuration  types.BlockHeight  `json:"maxduration"`
-		MinDuration  types.BlockHeight  `json:"minduration"`
-		Price        types.Currency     `json:"price"`
-		TotalStorage int64              `json:"totalstorage"`
-		UnlockHash   types.UnlockHash   `json:"unlockhash"`
-		WindowSize   types.BlockHeight  `json:"windowsize"`
+		Collateral      types.Currency     `json:"collateral"`
+		CollateralRatio uint64             `json:"collateralratio"`
+		NetAddress      modules.NetAddress `json:"netaddress"`
+		MaxDuration     types.BlockHeight  `json:"maxduration"`
+		MaxRevisionRate uint64             `json:"maxrevisionrate"`
+		MinDuration     types.BlockHeight  `json:"minduration"`
+		MinRevisionSize uint64             `json:"minrevisionsize"`
+		Price           types.Currency     `json:"price"`
+		TotalStorage    int64              `json:"totalstorage"`
+		UnlockHash      types.UnlockHash   `json:"unlockhash"`
+		WindowSize      types.BlockHeight  `json:"windowsize"`
+
+		DownloadBandwidthPrice types.Currency      `json:"downloadbandwidthprice"`
+		MinContractSize        uint64              `json:"mincontractsize"`
+		PriceTiers             []modules.PriceTier `json:"pricetiers"`
 
 		NumContracts       uint64         `json:"numcontracts"`
 		LostRevenue        types.Currency `json:"lostrevenue"`
@@ -45,14 +54,21 @@ func (srv *Server) hostHandlerGET(w http.ResponseWriter, req *http.Request, _ ht
 	anticipatedRevenue, revenue, lostRevenue := srv.host.Revenue()
 	rpcCalls := srv.host.RPCMetrics()
 	hg := HostGET{
-		Collateral:   settings.Collateral,
-		NetAddress:   settings.NetAddress,
-		MaxDuration:  settings.MaxDuration,
-		MinDuration:  settings.MinDuration,
-		Price:        settings.Price,
-		TotalStorage: settings.TotalStorage,
-		UnlockHash:   settings.UnlockHash,
-		WindowSize:   settings.WindowSize,
+		Collateral:      settings.Collateral,
+		CollateralRatio: settings.CollateralRatio,
+		NetAddress:      settings.NetAddress,
+		MaxDuration:     settings.MaxDuration,
+		MaxRevisionRate: settings.MaxRevisionRate,
+		MinDuration:     settings.MinDuration,
+		MinRevisionSize: settings.MinRevisionSize,
+		Price:           settings.Price,
+		TotalStorage:    settings.TotalStorage,
+		UnlockHash:      settings.UnlockHash,
+		WindowSize:      settings.WindowSize,
+
+		DownloadBandwidthPrice: settings.DownloadBandwidthPrice,
+		MinContractSize:        settings.MinContractSize,
+		PriceTiers:             settings.PriceTiers,
 
 		NumContracts:       srv.host.Contracts(),
 		LostRevenue:        lostRevenue,
@@ -73,40 +89,61 @@ func (srv *Server) hostHandlerGET(w http.ResponseWriter, req *http.Request, _ ht
 
 // hostHandlerPOST handles POST request to the /host API endpoint.
 func (srv *Server) hostHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	// Map each query string to a field in the host settings.
-	settings := srv.host.Settings()
-	qsVars := map[string]interface{}{
-		"collateral":   &settings.Collateral,
-		"maxduration":  &settings.MaxDuration,
-		"minduration":  &settings.MinDuration,
-		"price":        &settings.Price,
-		"totalstorage": &settings.TotalStorage,
-		"windowsize":   &settings.WindowSize,
-	}
+	// The settings are updated atomically, so that concurrent requests
+	// altering different fields do not overwrite each other.
+	err := srv.host.UpdateSettings(func(settings *modules.HostSettings) error {
+		// Map each query string to a field in the host settings.
+		qsVars := map[string]interface{}{
+			"collateral":             &settings.Collateral,
+			"collateralratio":        &settings.CollateralRatio,
+			"downloadbandwidthprice": &settings.DownloadBandwidthPrice,
+			"maxduration":            &settings.MaxDuration,
+			"maxrevisionrate":        &settings.MaxRevisionRate,
+			"mincontractsize":        &settings.MinContractSize,
+			"minduration":            &settings.MinDuration,
+			"minrevisionsize":        &settings.MinRevisionSize,
+			"price":                  &settings.Price,
+			"totalstorage":           &settings.TotalStorage,
+			"windowsize":             &settings.WindowSize,
+		}
 
-	// Iterate through the query string and replace any fields that have been
-	// altered.
-	for qs := range qsVars {
-		if req.FormValue(qs) != "" { // skip empty values
-			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+		// Iterate through the query string and replace any fields that have
+		// been altered.
+		for qs := range qsVars {
+			if req.FormValue(qs) != "" { // skip empty values
+				_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+				if err != nil {
+					return errors.New("Malformed " + qs)
+				}
+			}
+		}
+
+		// The price tiers are a JSON-encoded list, which cannot be scanned.
+		if tiers := req.FormValue("pricetiers"); tiers != "" {
+			settings.PriceTiers = nil
+			err := json.Unmarshal([]byte(tiers), &settings.PriceTiers)
 			if err != nil {
-				writeError(w, "Malformed "+qs, http.StatusBadRequest)
-				return
+				return errors.New("Malformed pricetiers")
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	srv.host.SetSettings(settings)
 	writeSuccess(w)
 }
 
 // hostAnnounceHandler handles the API call to get the host to announce itself
 // to the network.
 func (srv *Server) hostAnnounceHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	force := req.FormValue("force") == "true"
 	var err error
 	if addr := req.FormValue("netaddress"); addr != "" {
-		err = srv.host.AnnounceAddress(modules.NetAddress(addr))
+		err = srv.host.AnnounceAddress(modules.NetAddress(addr), force)
 	} else {
-		err = srv.host.Announce()
+		err = srv.host.Announce(force)
 	}
 	if err != nil {
 		writeError(w, err.Error(), http.StatusBadRequest)
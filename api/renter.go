@@ -11,6 +11,11 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+// RenterContracts lists the usage statistics of the renter's file contracts.
+type RenterContracts struct {
+	Contracts []modules.RenterContract `json:"contracts"`
+}
+
 // DownloadQueue contains the renter's download queue.
 type RenterDownloadQueue struct {
 	Downloads []modules.DownloadInfo `json:"downloads"`
@@ -21,6 +26,11 @@ type RenterFiles struct {
 	Files []modules.FileInfo `json:"files"`
 }
 
+// RenterFileHosts lists the hosts that store pieces of a file.
+type RenterFileHosts struct {
+	Hosts []modules.FileHostInfo `json:"hosts"`
+}
+
 // RenterLoad lists files that were loaded into the renter.
 type RenterLoad struct {
 	FilesAdded []string `json:"filesadded"`
@@ -36,6 +46,19 @@ type ActiveHosts struct {
 	Hosts []modules.HostSettings `json:"hosts"`
 }
 
+// HostScanQueue contains the number of hosts waiting to be scanned.
+type HostScanQueue struct {
+	Depth int `json:"depth"`
+}
+
+// renterContractsHandler handles the API call to request the renter's
+// contracts.
+func (srv *Server) renterContractsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, RenterContracts{
+		Contracts: srv.renter.Contracts(),
+	})
+}
+
 // renterDownloadsHandler handles the API call to request the download queue.
 func (srv *Server) renterDownloadsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	writeJSON(w, RenterDownloadQueue{
@@ -66,6 +89,35 @@ func (srv *Server) renterLoadAsciiHandler(w http.ResponseWriter, req *http.Reque
 	writeJSON(w, RenterLoad{FilesAdded: files})
 }
 
+// renterFileHostsHandler handles the API call to list the hosts that store
+// pieces of a file.
+func (srv *Server) renterFileHostsHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	hosts, err := srv.renter.FileHosts(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, RenterFileHosts{Hosts: hosts})
+}
+
+// renterPriorityHandler handles the API call to set the repair priority of a
+// file.
+func (srv *Server) renterPriorityHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var priority int
+	_, err := fmt.Sscan(req.FormValue("priority"), &priority)
+	if err != nil {
+		writeError(w, "Couldn't parse priority: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = srv.renter.SetFilePriority(strings.TrimPrefix(ps.ByName("siapath"), "/"), priority)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
+
 // renterRenameHandler handles the API call to rename a file entry in the
 // renter.
 func (srv *Server) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -144,11 +196,17 @@ func (srv *Server) renterUploadHandler(w http.ResponseWriter, req *http.Request,
 		}
 	}
 	renew := req.FormValue("renew") == "true"
+	alias := req.FormValue("alias") == "true"
+	diverse := req.FormValue("diverse") == "true"
+	reduce := req.FormValue("reduceredundancy") == "true"
 	err := srv.renter.Upload(modules.FileUploadParams{
-		Source:   req.FormValue("source"),
-		SiaPath:  strings.TrimPrefix(ps.ByName("siapath"), "/"),
-		Duration: duration,
-		Renew:    renew,
+		Source:           req.FormValue("source"),
+		SiaPath:          strings.TrimPrefix(ps.ByName("siapath"), "/"),
+		Duration:         duration,
+		Renew:            renew,
+		Alias:            alias,
+		Diverse:          diverse,
+		ReduceRedundancy: reduce,
 		// let the renter decide these values; eventually they will be configurable
 		ErasureCode: nil,
 		PieceSize:   0,
@@ -169,6 +227,14 @@ func (srv *Server) renterHostsActiveHandler(w http.ResponseWriter, req *http.Req
 	})
 }
 
+// renterHostsScanQueueHandler handles the API call asking for the number of
+// hosts waiting to be scanned.
+func (srv *Server) renterHostsScanQueueHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, HostScanQueue{
+		Depth: srv.renter.ScanQueueDepth(),
+	})
+}
+
 // renterHostsAllHandler handes the API call asking for the list of all hosts.
 func (srv *Server) renterHostsAllHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	writeJSON(w, ActiveHosts{
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/NebulousLabs/ed25519"
+)
+
+type (
+	// sigVerifier contains the signature verification dependency of a
+	// SigCache. The dependency is separated to enable mocking.
+	sigVerifier interface {
+		verify(data Hash, pk PublicKey, sig Signature) bool
+	}
+
+	// sigCacheKey identifies a verified signature.
+	sigCacheKey struct {
+		data Hash
+		pk   PublicKey
+		sig  Signature
+	}
+
+	// A SigCache remembers signatures that have been verified, so that
+	// verifying the same signature again does not repeat the expensive curve
+	// operations. Failed verifications are never cached. Once the cache is
+	// full, the least recently used signature is evicted. A nil SigCache
+	// verifies every signature.
+	SigCache struct {
+		size     int
+		entries  map[sigCacheKey]*list.Element
+		lru      *list.List // front is the most recently used
+		verifier sigVerifier
+		mu       sync.Mutex
+	}
+)
+
+// stdSigVerifier implements the sigVerifier dependency using ed25519.
+type stdSigVerifier struct{}
+
+func (stdSigVerifier) verify(data Hash, pk PublicKey, sig Signature) bool {
+	pkNorm := [PublicKeySize]byte(pk)
+	sigNorm := [SignatureSize]byte(sig)
+	return ed25519.Verify(&pkNorm, data[:], &sigNorm)
+}
+
+// NewSigCache returns a SigCache that remembers up to 'size' signatures.
+func NewSigCache(size int) *SigCache {
+	return &SigCache{
+		size:     size,
+		entries:  make(map[sigCacheKey]*list.Element),
+		lru:      list.New(),
+		verifier: stdSigVerifier{},
+	}
+}
+
+// VerifyHash uses a public key and input data to verify a signature, in the
+// same manner as the package-level VerifyHash. Signatures that are already
+// in the cache are not verified again.
+func (sc *SigCache) VerifyHash(data Hash, pk PublicKey, sig Signature) error {
+	if sc == nil {
+		return VerifyHash(data, pk, sig)
+	}
+	key := sigCacheKey{data, pk, sig}
+	sc.mu.Lock()
+	if elem, ok := sc.entries[key]; ok {
+		sc.lru.MoveToFront(elem)
+		sc.mu.Unlock()
+		return nil
+	}
+	sc.mu.Unlock()
+
+	// Verify without holding the lock, as verification is slow.
+	if !sc.verifier.verify(data, pk, sig) {
+		return errInvalidSignature
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.entries[key]; ok || sc.size <= 0 {
+		return nil
+	}
+	sc.entries[key] = sc.lru.PushFront(key)
+	if sc.lru.Len() > sc.size {
+		oldest := sc.lru.Back()
+		sc.lru.Remove(oldest)
+		delete(sc.entries, oldest.Value.(sigCacheKey))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"testing"
+)
+
+// countingVerifier wraps the standard verifier, counting the number of
+// signatures that are verified.
+type countingVerifier struct {
+	calls int
+}
+
+func (cv *countingVerifier) verify(data Hash, pk PublicKey, sig Signature) bool {
+	cv.calls++
+	return stdSigVerifier{}.verify(data, pk, sig)
+}
+
+// TestUnitSigCache checks that verified signatures are served from the cache,
+// that failed verifications are never cached, and that the least recently
+// used signature is evicted once the cache is full.
+func TestUnitSigCache(t *testing.T) {
+	sk, pk, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(data Hash) Signature {
+		sig, err := SignHash(data, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	sc := NewSigCache(2)
+	cv := new(countingVerifier)
+	sc.verifier = cv
+
+	// The second verification of a signature hits the cache.
+	data := HashObject("settings")
+	sig := sign(data)
+	for i := 0; i < 2; i++ {
+		if err := sc.VerifyHash(data, pk, sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cv.calls != 1 {
+		t.Fatal("expected the signature to be verified once, got", cv.calls)
+	}
+
+	// An invalid signature is rejected every time.
+	bad := sig
+	bad[0] ^= 1
+	for i := 0; i < 2; i++ {
+		if err := sc.VerifyHash(data, pk, bad); err != errInvalidSignature {
+			t.Fatal("expected errInvalidSignature, got", err)
+		}
+	}
+	if cv.calls != 3 {
+		t.Fatal("invalid signature was cached")
+	}
+
+	// Filling the cache evicts the least recently used signature. Using the
+	// first signature keeps it in the cache while the second is evicted.
+	data2, data3 := HashObject("two"), HashObject("three")
+	sig2, sig3 := sign(data2), sign(data3)
+	for _, v := range []struct {
+		data Hash
+		sig  Signature
+	}{{data2, sig2}, {data, sig}, {data3, sig3}} {
+		if err := sc.VerifyHash(v.data, pk, v.sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cv.calls != 5 {
+		t.Fatal("expected 5 verifications, got", cv.calls)
+	}
+	if err := sc.VerifyHash(data, pk, sig); err != nil || cv.calls != 5 {
+		t.Fatal("recently used signature was evicted")
+	}
+	if err := sc.VerifyHash(data2, pk, sig2); err != nil || cv.calls != 6 {
+		t.Fatal("least recently used signature was not evicted")
+	}
+
+	// A nil cache verifies every signature.
+	var nilCache *SigCache
+	if err := nilCache.VerifyHash(data, pk, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := nilCache.VerifyHash(data, pk, bad); err != errInvalidSignature {
+		t.Fatal("expected errInvalidSignature, got", err)
+	}
+}
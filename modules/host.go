@@ -1,6 +1,12 @@
 package modules
 
 import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -10,9 +16,74 @@ const (
 
 	// HostDir names the directory that contains the host persistence.
 	HostDir = "host"
+
+	// ProtocolVersion is the version of the contract negotiation and revision
+	// protocol spoken by this host and renter. Hosts advertise the version
+	// they speak in their announcements and settings.
+	ProtocolVersion = "1.1"
+
+	// MinProtocolVersion is the oldest protocol version that the renter can
+	// still negotiate with.
+	MinProtocolVersion = "1.0"
+
+	// PaidDownloadVersion is the oldest protocol version whose hosts accept
+	// RPCPaidDownload. Older hosts only accept RPCDownload, and do not charge
+	// for downloads.
+	PaidDownloadVersion = "1.1"
+)
+
+const (
+	// RejectionNotAccepting indicates that the host was not accepting new
+	// contracts at the time of the negotiation.
+	RejectionNotAccepting RejectionReason = "not accepting contracts"
+
+	// RejectionBadTerms indicates that the terms of the proposed contract
+	// did not match the settings of the host.
+	RejectionBadTerms RejectionReason = "bad contract terms"
+
+	// RejectionBadTransaction indicates that the renter sent a malformed or
+	// invalid transaction set.
+	RejectionBadTransaction RejectionReason = "bad transaction"
+
+	// RejectionInsufficientFunds indicates that the host wallet could not
+	// fund or sign the contract transaction.
+	RejectionInsufficientFunds RejectionReason = "insufficient funds"
+
+	// RejectionInsufficientCollateral indicates that the host wallet could
+	// not cover the collateral owed by the host's contracts.
+	RejectionInsufficientCollateral RejectionReason = "insufficient collateral"
+
+	// RejectionRenterPolicy indicates that the host's renter policy refused
+	// to form a contract with the renter.
+	RejectionRenterPolicy RejectionReason = "refused by renter policy"
+
+	// ProofMissingSector indicates that a sector of the file contract could
+	// not be read from disk when building the storage proof.
+	ProofMissingSector ProofReason = "missing sector"
+
+	// ProofWrongHeight indicates that the storage proof segment could not be
+	// determined, usually because the proof window has not yet opened.
+	ProofWrongHeight ProofReason = "wrong height"
+
+	// ProofBuildError indicates that the storage proof or its transaction
+	// could not be constructed.
+	ProofBuildError ProofReason = "build error"
+
+	// ProofBroadcastError indicates that the transaction pool rejected the
+	// storage proof transaction.
+	ProofBroadcastError ProofReason = "broadcast error"
 )
 
 var (
+	// ErrAnnouncementUnchanged is returned when the host declines to
+	// announce an address that it already announced recently. Announcing
+	// with force set bypasses the check.
+	ErrAnnouncementUnchanged = errors.New("host has already announced this address recently; announce with force to announce again")
+
+	// ErrUnsupportedHostKey is returned when verifying settings signed with a
+	// key that is not an ed25519 key.
+	ErrUnsupportedHostKey = errors.New("host public key uses an unsupported signature algorithm")
+
 	// RPCSettings is the specifier for requesting settings from the host.
 	RPCSettings = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
 
@@ -22,12 +93,21 @@ var (
 	// RPCRenew is the specifier to renewing an existing contract.
 	RPCRenew = types.Specifier{'R', 'e', 'n', 'e', 'w'}
 
+	// RPCRenewReadOnly is the specifier for renewing an existing contract
+	// into a read-only contract, which keeps the data of the existing
+	// contract but cannot be revised.
+	RPCRenewReadOnly = types.Specifier{'R', 'e', 'n', 'e', 'w', 'R', 'e', 'a', 'd', 'O', 'n', 'l', 'y'}
+
 	// RPCRevise is the specifier for revising an existing file contract.
 	RPCRevise = types.Specifier{'R', 'e', 'v', 'i', 's', 'e'}
 
 	// RPCDownload is the specifier for downloading a file from a host.
 	RPCDownload = types.Specifier{'D', 'o', 'w', 'n', 'l', 'o', 'a', 'd'}
 
+	// RPCPaidDownload is the specifier for downloading a file from a host
+	// that quotes its download price and is paid for each request.
+	RPCPaidDownload = types.Specifier{'P', 'a', 'i', 'd', 'D', 'o', 'w', 'n', 'l', 'o', 'a', 'd'}
+
 	// PrefixHostAnnouncement is used to indicate that a transaction's
 	// Arbitrary Data field contains a host announcement. The encoded
 	// announcement will follow this prefix.
@@ -43,23 +123,179 @@ type (
 	}
 
 	// HostAnnouncement declares a nodes intent to be a host, providing a net
-	// address that can be used to contact the host.
+	// address that can be used to contact the host, and the public key that
+	// the host signs its settings with.
 	HostAnnouncement struct {
-		IPAddress NetAddress
+		IPAddress       NetAddress
+		PublicKey       types.SiaPublicKey
+		ProtocolVersion string
 	}
 
 	// HostSettings are the parameters advertised by the host. These are the
 	// values that the renter will request from the host in order to build its
 	// database.
+	//
+	// CollateralRatio is the collateral that the host puts up for a file
+	// contract, as a percentage of the revenue that the host expects from the
+	// contract. If it is set, Collateral, the collateral per byte per block,
+	// is derived by the host from Price and CollateralRatio; otherwise
+	// Collateral is set directly.
+	//
+	// MinRevisionSize and MaxRevisionRate protect the host from renters that
+	// waste host resources with a flood of tiny revisions. MinRevisionSize is
+	// the minimum number of bytes that a revision must add to a contract, and
+	// MaxRevisionRate is the number of revisions per minute that a renter may
+	// submit against a single contract. A value of zero disables the limit.
+	//
+	// DownloadBandwidthPrice is the price per byte of data served to the
+	// renter. Renters pay for each download request with a contract revision
+	// before the data is sent. A price of zero makes downloads free.
+	//
+	// MinContractSize is the minimum number of bytes that a new file contract
+	// must be able to store. New contracts hold no data, so their size is the
+	// amount of data that the renter's funds pay for at the host's price. A
+	// value of zero disables the limit.
+	//
+	// PriceTiers, if non-empty, varies the price with the duration of the
+	// contract. The tiers are ordered by increasing MaxDuration, and the last
+	// tier covers the MaxDuration of the host. A contract is charged the price
+	// of the first tier that covers its duration, chosen when the contract is
+	// formed. Price is still used by renters to compare hosts, and must be the
+	// price of one of the tiers, but is only charged when there are no tiers.
+	//
+	// ProtocolVersion is the version of the contract negotiation and revision
+	// protocol that the host speaks. Hosts that predate protocol versions
+	// leave it empty.
 	HostSettings struct {
-		NetAddress   NetAddress        `json:"netaddress"`
-		TotalStorage int64             `json:"totalstorage"`
-		MinDuration  types.BlockHeight `json:"minduration"`
-		MaxDuration  types.BlockHeight `json:"maxduration"`
-		WindowSize   types.BlockHeight `json:"windowsize"`
-		Price        types.Currency    `json:"price"`
-		Collateral   types.Currency    `json:"collateral"`
-		UnlockHash   types.UnlockHash  `json:"unlockhash"`
+		NetAddress      NetAddress        `json:"netaddress"`
+		TotalStorage    int64             `json:"totalstorage"`
+		MinDuration     types.BlockHeight `json:"minduration"`
+		MaxDuration     types.BlockHeight `json:"maxduration"`
+		WindowSize      types.BlockHeight `json:"windowsize"`
+		Price           types.Currency    `json:"price"`
+		Collateral      types.Currency    `json:"collateral"`
+		UnlockHash      types.UnlockHash  `json:"unlockhash"`
+		CollateralRatio uint64            `json:"collateralratio"`
+		MinRevisionSize uint64            `json:"minrevisionsize"`
+		MaxRevisionRate uint64            `json:"maxrevisionrate"`
+
+		DownloadBandwidthPrice types.Currency `json:"downloadbandwidthprice"`
+		MinContractSize        uint64         `json:"mincontractsize"`
+		PriceTiers             []PriceTier    `json:"pricetiers"`
+		ProtocolVersion        string         `json:"protocolversion"`
+	}
+
+	// A PriceTier is the price per byte per block charged by a host for
+	// contracts lasting up to MaxDuration blocks.
+	PriceTier struct {
+		MaxDuration types.BlockHeight `json:"maxduration"`
+		Price       types.Currency    `json:"price"`
+	}
+
+	// SignedHostSettings are the settings of a host along with the host's
+	// signature of the settings, proving that the settings came from the
+	// host that announced the public key. The settings are encoded first, so
+	// that renters unaware of the signature can decode them as HostSettings.
+	SignedHostSettings struct {
+		Settings  HostSettings
+		Signature crypto.Signature
+	}
+
+	// A BandwidthUsage records the data transferred between the host and a
+	// renter, identified by the unlock hash of its valid proof output.
+	// 'Served' is the number of bytes sent to the renter, and 'Received' is
+	// the number of bytes received from the renter.
+	BandwidthUsage struct {
+		Renter   types.UnlockHash `json:"renter"`
+		Served   uint64           `json:"served"`
+		Received uint64           `json:"received"`
+	}
+
+	// A RejectionReason indicates why the host rejected a contract
+	// negotiation.
+	RejectionReason string
+
+	// A RejectionEvent records a contract negotiation that was rejected by
+	// the host.
+	RejectionEvent struct {
+		Time   time.Time       `json:"time"`
+		Reason RejectionReason `json:"reason"`
+		Error  string          `json:"error"`
+	}
+
+	// A ProofReason indicates why the host failed to submit a storage proof.
+	ProofReason string
+
+	// A ProofEvent records an attempt by the host to submit a storage proof
+	// for a file contract. Reason and Error are only set if the attempt
+	// failed.
+	ProofEvent struct {
+		Time        time.Time            `json:"time"`
+		ContractID  types.FileContractID `json:"contractid"`
+		WindowStart types.BlockHeight    `json:"windowstart"`
+		WindowEnd   types.BlockHeight    `json:"windowend"`
+		Success     bool                 `json:"success"`
+		Reason      ProofReason          `json:"reason"`
+		Error       string               `json:"error"`
+	}
+
+	// HostMetrics reports the storage usage of the host. Logical storage counts
+	// the data of each file contract separately, while physical storage counts
+	// the data that is actually on disk, where identical data shared between
+	// file contracts is only counted once. Remaining storage is the amount of
+	// physical storage that can still be used before the host rejects new
+	// data, and is negative if TotalStorage was reduced below the storage in
+	// use.
+	//
+	// Collateral is the collateral owed at the host's collateral rate by its
+	// unresolved file contracts. The negotiation protocols do not yet add
+	// collateral to file contracts, so this amount is tracked by the host but
+	// is not held by the contracts.
+	HostMetrics struct {
+		LogicalStorage   uint64         `json:"logicalstorage"`
+		PhysicalStorage  uint64         `json:"physicalstorage"`
+		TotalStorage     int64          `json:"totalstorage"`
+		RemainingStorage int64          `json:"remainingstorage"`
+		Collateral       types.Currency `json:"collateral"`
+	}
+
+	// A FolderTestResult reports the throughput of a storage folder of the
+	// host, measured in bytes per second. Error is set if the folder could
+	// not be tested, or if the data read back did not match the data
+	// written.
+	FolderTestResult struct {
+		Path            string  `json:"path"`
+		WriteThroughput float64 `json:"writethroughput"`
+		ReadThroughput  float64 `json:"readthroughput"`
+		Error           string  `json:"error"`
+	}
+
+	// SelfTestResult holds the results of a host self-test, one for each
+	// storage folder of the host.
+	SelfTestResult struct {
+		Folders []FolderTestResult `json:"folders"`
+	}
+
+	// A RebalanceStatus reports the progress of moving sectors between the
+	// storage folders of the host. Error holds the most recent error
+	// encountered while moving a sector.
+	RebalanceStatus struct {
+		Active       bool   `json:"active"`
+		SectorsMoved uint64 `json:"sectorsmoved"`
+		SectorsTotal uint64 `json:"sectorstotal"`
+		Error        string `json:"error"`
+	}
+
+	// HostContractInfo describes a file contract that the host is obligated
+	// to fulfill. RenterUnlockHash is the address that the renter is refunded
+	// to when the contract resolves.
+	HostContractInfo struct {
+		ID               types.FileContractID `json:"id"`
+		FileSize         uint64               `json:"filesize"`
+		WindowStart      types.BlockHeight    `json:"windowstart"`
+		WindowEnd        types.BlockHeight    `json:"windowend"`
+		Value            types.Currency       `json:"value"`
+		RenterUnlockHash types.UnlockHash     `json:"renterunlockhash"`
 	}
 
 	// HostRPCMetrics reports the quantity of each type of rpc call that has
@@ -78,29 +314,89 @@ type (
 	// such as announcements, settings, and implementing all of the RPCs of the
 	// host protocol.
 	Host interface {
+		// AddStorageFolder adds a folder in which the host can store
+		// sectors. Existing sectors are not moved to the folder until
+		// RebalanceStorage is called.
+		AddStorageFolder(path string) error
+
 		// Announce announces the host on the blockchain, returning an error if the
-		// external ip address is unknown.
-		Announce() error
+		// external ip address is unknown. Unless force is set, the host will
+		// not announce an address that it announced recently.
+		Announce(force bool) error
 
 		// AnnounceAddress announces the specified address on the blockchain.
-		AnnounceAddress(NetAddress) error
+		// Unless force is set, the host will not announce an address that it
+		// announced recently.
+		AnnounceAddress(addr NetAddress, force bool) error
+
+		// BandwidthLedger returns the data transferred with each renter
+		// during the current accounting period.
+		BandwidthLedger() []BandwidthUsage
 
 		// Capacity returns the amount of storage still available on the
 		// machine. The amount can be negative if the total capacity was
 		// reduced to below the active capacity.
 		Capacity() int64
 
+		// ConnectivityCheck dials the host at its own address, returning an
+		// error if the host cannot be reached.
+		ConnectivityCheck() error
+
 		// Contracts returns the number of unresolved file contracts that the
 		// host is responsible for.
 		Contracts() uint64
 
+		// ContractsByRenter returns the unresolved file contracts that refund
+		// to the provided renter unlock hash.
+		ContractsByRenter(types.UnlockHash) []HostContractInfo
+
 		// DeleteContract deletes a file contract. The revenue and collateral
 		// on the file contract will be lost, and the data will be removed.
 		DeleteContract(types.FileContractID) error
 
+		// ExportContracts writes the contracts of the host, along with the
+		// host keys, to the provided writer.
+		ExportContracts(io.Writer) error
+
+		// ImportContracts adds contracts written by ExportContracts to the
+		// host, refusing to overwrite contracts the host is already tracking.
+		ImportContracts(io.Reader) error
+
+		// MaintenanceMode indicates whether the host is in maintenance mode.
+		MaintenanceMode() bool
+
+		// Metrics returns information about the storage usage of the host.
+		Metrics() HostMetrics
+
+		// MetricsText writes the metrics of the host to the provided writer
+		// in the Prometheus text exposition format.
+		MetricsText(io.Writer) error
+
 		// NetAddress returns the host's network address
 		NetAddress() NetAddress
 
+		// ProofHistory returns the most recent storage proof attempts made by
+		// the host, oldest first.
+		ProofHistory() []ProofEvent
+
+		// ProjectEarnings projects the revenue that the host would earn
+		// over the next 'duration' blocks if it charged 'price' per byte per
+		// block, based on the rate at which contracts were recently formed.
+		ProjectEarnings(price types.Currency, duration types.BlockHeight) types.Currency
+
+		// RebalanceStatus reports the progress of the most recent storage
+		// rebalance.
+		RebalanceStatus() RebalanceStatus
+
+		// RebalanceStorage starts moving sectors between the storage
+		// folders of the host in the background, such that each folder
+		// holds a similar amount of data.
+		RebalanceStorage() error
+
+		// RecentRejections returns the most recent contract negotiations
+		// that were rejected by the host, oldest first.
+		RecentRejections() []RejectionEvent
+
 		// Revenue returns the amount of revenue that the host has lined up,
 		// the amount of revenue the host has successfully captured, and the
 		// amount of revenue the host has lost.
@@ -114,13 +410,110 @@ type (
 		// been made to the host.
 		RPCMetrics() HostRPCMetrics
 
+		// SectorVerification indicates whether sectors are checked against
+		// their Merkle roots before they are served.
+		SectorVerification() bool
+
+		// SelfTest writes a temporary sector to each storage folder of the
+		// host and reads it back, measuring the throughput of each folder.
+		SelfTest() (SelfTestResult, error)
+
+		// SetAnnounceRetry sets the number of times a rejected announcement
+		// is submitted, and the time waited before the first retry. Each
+		// retry waits twice as long and pays twice the fee of the last.
+		SetAnnounceRetry(attempts int, backoff time.Duration) error
+
+		// SetMaintenanceMode enables or disables maintenance mode, in which
+		// the host refuses new contracts and uploads but continues to serve
+		// downloads and submit storage proofs.
+		SetMaintenanceMode(bool) error
+
+		// SetSectorVerification enables or disables checking sectors
+		// against their Merkle roots before they are served, so that
+		// corrupt data is never sent to renters.
+		SetSectorVerification(bool) error
+
 		// SetConfig sets the hosting parameters of the host.
 		SetSettings(HostSettings) error
 
 		// Settings returns the host's settings.
 		Settings() HostSettings
 
+		// SweepRevenue moves the revenue of every matured storage proof
+		// output into a new address of the host's wallet, returning the
+		// transaction that was broadcast.
+		SweepRevenue() (types.Transaction, error)
+
+		// UpdateSettings applies a function to the host's settings, and
+		// validates and saves the result. Concurrent updates are applied one
+		// at a time, so that no update is lost.
+		UpdateSettings(func(*HostSettings) error) error
+
 		// Close saves the state of the host and stops its listener process.
 		Close() error
 	}
 )
+
+// SignHostSettings signs the settings of a host with the host's secret key.
+func SignHostSettings(settings HostSettings, sk crypto.SecretKey) (SignedHostSettings, error) {
+	sig, err := crypto.SignHash(crypto.HashObject(settings), sk)
+	if err != nil {
+		return SignedHostSettings{}, err
+	}
+	return SignedHostSettings{
+		Settings:  settings,
+		Signature: sig,
+	}, nil
+}
+
+// PriceForDuration returns the price per byte per block that the host charges
+// for a contract lasting 'duration' blocks. The price of the last tier is
+// returned for durations beyond every tier.
+func (hs HostSettings) PriceForDuration(duration types.BlockHeight) types.Currency {
+	if len(hs.PriceTiers) == 0 {
+		return hs.Price
+	}
+	for _, tier := range hs.PriceTiers {
+		if duration <= tier.MaxDuration {
+			return tier.Price
+		}
+	}
+	return hs.PriceTiers[len(hs.PriceTiers)-1].Price
+}
+
+// SupportedProtocol reports whether the renter can negotiate with a host that
+// speaks the given protocol version. An empty version is supported, since it
+// is advertised by hosts that predate protocol versions.
+func SupportedProtocol(version string) bool {
+	if version == "" {
+		return true
+	}
+	return build.IsVersion(version) &&
+		build.VersionCmp(version, MinProtocolVersion) >= 0 &&
+		build.VersionCmp(version, ProtocolVersion) <= 0
+}
+
+// SupportsPaidDownload reports whether a host that speaks the given protocol
+// version accepts RPCPaidDownload.
+func SupportsPaidDownload(version string) bool {
+	return SupportedProtocol(version) && build.IsVersion(version) &&
+		build.VersionCmp(version, PaidDownloadVersion) >= 0
+}
+
+// Verify checks that the settings were signed by the owner of the provided
+// public key.
+func (ss SignedHostSettings) Verify(pk types.SiaPublicKey) error {
+	return ss.VerifyCached(pk, nil)
+}
+
+// VerifyCached checks that the settings were signed by the owner of the
+// provided public key, skipping the verification if the signature is already
+// in the cache. A nil cache verifies the signature every time.
+func (ss SignedHostSettings) VerifyCached(pk types.SiaPublicKey, sc *crypto.SigCache) error {
+	if pk.Algorithm != types.SignatureEd25519 || len(pk.Key) != crypto.PublicKeySize {
+		return ErrUnsupportedHostKey
+	}
+	var edPK crypto.PublicKey
+	copy(edPK[:], pk.Key)
+	return sc.VerifyHash(crypto.HashObject(ss.Settings), edPK, ss.Signature)
+}
@@ -2,6 +2,8 @@ package host
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -9,47 +11,147 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	// errZeroAnnounceAttempts is returned by SetAnnounceRetry if the host
+	// would never attempt to announce.
+	errZeroAnnounceAttempts = errors.New("announcements must be attempted at least once")
+)
+
+// recentlyAnnounced returns true if the host announced 'addr' within the
+// past announceWindow blocks.
+func (h *Host) recentlyAnnounced(addr modules.NetAddress) bool {
+	return h.announcedAddress == addr && h.blockHeight < h.announcedHeight+h.announceWindow
+}
+
 // announce creates an announcement transaction and submits it to the network.
-func (h *Host) announce(addr modules.NetAddress) error {
-	// Generate an unlock hash, if necessary.
+// Unless force is set, addresses that were announced recently are not
+// announced again, so that frequent restarts do not waste fees.
+//
+// The announcement is recorded in the same critical section that checks for
+// a recent announcement, so that concurrent calls cannot both submit it. The
+// record is reverted if the announcement fails.
+func (h *Host) announce(addr modules.NetAddress, force bool) error {
+	h.mu.Lock()
+	if h.recentlyAnnounced(addr) && !force {
+		h.mu.Unlock()
+		return modules.ErrAnnouncementUnchanged
+	}
+
+	// Generate an unlock hash, if necessary. Storage proof outputs are paid
+	// to the host's own key so that SweepRevenue can spend them.
 	if h.settings.UnlockHash == (types.UnlockHash{}) {
-		uc, err := h.wallet.NextAddress()
+		h.settings.UnlockHash = h.unlockConditions().UnlockHash()
+		err := h.save()
 		if err != nil {
+			h.mu.Unlock()
 			return err
 		}
-		h.settings.UnlockHash = uc.UnlockHash()
-		err = h.save()
-		if err != nil {
-			return err
+	}
+	prevAddress, prevHeight := h.announcedAddress, h.announcedHeight
+	h.announcedAddress = addr
+	h.announcedHeight = h.blockHeight
+	claimedHeight := h.blockHeight
+	attempts, backoff := h.announceAttempts, h.announceBackoff
+	h.mu.Unlock()
+
+	err := h.submitAnnouncementWithRetry(addr, attempts, backoff)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		// Revert the record, unless another announcement has replaced it.
+		if h.announcedAddress == addr && h.announcedHeight == claimedHeight {
+			h.announcedAddress = prevAddress
+			h.announcedHeight = prevHeight
 		}
+		return err
 	}
+	h.log.Printf("INFO: Successfully announced as %v", addr)
+	return h.save()
+}
 
-	// Create a transaction with a host announcement.
-	txnBuilder := h.wallet.StartTransaction()
+// submitAnnouncementWithRetry submits an announcement of 'addr'. If the
+// transaction pool rejects it, for example because the network is congested,
+// the announcement is retried after 'backoff' with a higher fee, up to
+// 'attempts' times. The first attempt pays no fee. Other errors, such as a
+// wallet that cannot fund the fee, are returned immediately.
+func (h *Host) submitAnnouncementWithRetry(addr modules.NetAddress, attempts int, backoff time.Duration) error {
 	announcement := encoding.Marshal(modules.HostAnnouncement{
-		IPAddress: addr,
+		IPAddress:       addr,
+		PublicKey:       h.publicKey,
+		ProtocolVersion: modules.ProtocolVersion,
 	})
-	_ = txnBuilder.AddArbitraryData(append(modules.PrefixHostAnnouncement[:], announcement...))
-	txn, parents := txnBuilder.View()
-	txnSet := append(parents, txn)
-
-	// Add the transaction to the transaction pool.
-	err := h.tpool.AcceptTransactionSet(txnSet)
+	announcement = append(modules.PrefixHostAnnouncement[:], announcement...)
+	fee := types.ZeroCurrency
+	var err error
+	var rejected bool
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if fee.IsZero() {
+				fee = announceBaseFee
+			} else {
+				fee = fee.Mul(types.NewCurrency64(2))
+			}
+			h.log.Printf("WARN: announcement was rejected, retrying with a fee of %v: %v", fee, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		rejected, err = h.submitAnnouncement(announcement, fee)
+		if !rejected || err == modules.ErrDuplicateTransactionSet {
+			break
+		}
+	}
 	if err == modules.ErrDuplicateTransactionSet {
 		return errors.New("you have already announced yourself")
 	}
-	if err != nil {
-		return err
+	if err != nil && rejected {
+		return fmt.Errorf("announcement failed after %v attempts: %v", attempts, err)
 	}
-	h.log.Printf("INFO: Successfully announced as %v", addr)
+	return err
+}
 
-	return nil
+// submitAnnouncement creates a transaction holding an announcement that pays
+// 'fee' to miners, and submits it to the transaction pool. Transactions
+// without a fee have no inputs, and do not need to be signed. rejected is set
+// if the error was returned by the transaction pool, in which case the
+// announcement may be retried.
+func (h *Host) submitAnnouncement(announcement []byte, fee types.Currency) (rejected bool, err error) {
+	txnBuilder := h.wallet.StartTransaction()
+	if !fee.IsZero() {
+		err = txnBuilder.FundSiacoins(fee)
+		if err != nil {
+			txnBuilder.Drop()
+			return false, err
+		}
+		_ = txnBuilder.AddMinerFee(fee)
+	}
+	_ = txnBuilder.AddArbitraryData(announcement)
+
+	var txnSet []types.Transaction
+	if fee.IsZero() {
+		txn, parents := txnBuilder.View()
+		txnSet = append(parents, txn)
+	} else {
+		txnSet, err = txnBuilder.Sign(true)
+		if err != nil {
+			txnBuilder.Drop()
+			return false, err
+		}
+	}
+	err = h.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		txnBuilder.Drop()
+		return true, err
+	}
+	return false, nil
 }
 
 // Announce creates a host announcement transaction, adding information to the
 // arbitrary data, signing the transaction, and submitting it to the
-// transaction pool.
-func (h *Host) Announce() error {
+// transaction pool. The host will refuse to announce if it cannot reach itself
+// at its own address. AnnounceAddress can be used to skip the check. Unless
+// force is set, the host will not announce an address that it announced
+// recently, returning modules.ErrAnnouncementUnchanged instead.
+func (h *Host) Announce(force bool) error {
 	h.resourceLock.RLock()
 	defer h.resourceLock.RUnlock()
 	if h.closed {
@@ -67,16 +169,44 @@ func (h *Host) Announce() error {
 		return errors.New("can't announce without knowing external IP")
 	}
 
-	return h.announce(addr)
+	// Check that the host is reachable at the address being announced.
+	err := h.managedConnectivityCheck()
+	if err != nil {
+		return errors.New("refusing to announce: " + err.Error())
+	}
+
+	return h.announce(addr, force)
 }
 
 // AnnounceAddress submits a host announcement to the blockchain to announce a
 // specific address. No checks for validity are performed on the address.
-func (h *Host) AnnounceAddress(addr modules.NetAddress) error {
+func (h *Host) AnnounceAddress(addr modules.NetAddress, force bool) error {
 	h.resourceLock.RLock()
 	defer h.resourceLock.RUnlock()
 	if h.closed {
 		return errHostClosed
 	}
-	return h.announce(addr)
+	return h.announce(addr, force)
+}
+
+// SetAnnounceRetry sets the number of times the host tries to submit an
+// announcement that is rejected by the transaction pool, and the time waited
+// before the first retry. The wait doubles with each retry, as does the fee
+// paid by the announcement. Announce and AnnounceAddress return once the
+// announcement is accepted, or once every attempt has failed.
+func (h *Host) SetAnnounceRetry(attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		return errZeroAnnounceAttempts
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.announceAttempts = attempts
+	h.announceBackoff = backoff
+	return h.save()
 }
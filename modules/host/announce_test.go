@@ -1,6 +1,10 @@
 package host
 
 import (
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,7 +28,7 @@ func TestAnnouncement(t *testing.T) {
 	ht.host.mu.RLock()
 	addr := ht.host.netAddress
 	ht.host.mu.RUnlock()
-	err = ht.host.AnnounceAddress(addr)
+	err = ht.host.AnnounceAddress(addr, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,6 +44,9 @@ func TestAnnouncement(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	if ha.ProtocolVersion != modules.ProtocolVersion {
+		t.Error("announcement has the wrong protocol version:", ha.ProtocolVersion)
+	}
 
 	// Mine a block to get the announcement into the blockchain, and then wait
 	// until the hostdb recognizes the host.
@@ -54,3 +61,309 @@ func TestAnnouncement(t *testing.T) {
 		t.Fatal("no active hosts in hostdb after host made an announcement")
 	}
 }
+
+// TestConnectivityCheck checks that the connectivity check passes for a
+// reachable host, and that a host with a blocked port fails the check and
+// refuses to announce.
+func TestConnectivityCheck(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestConnectivityCheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host should be reachable at its own address, and the check should
+	// not be counted as a settings call.
+	settingsCalls := atomic.LoadUint64(&ht.host.atomicSettingsCalls)
+	err = ht.host.ConnectivityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadUint64(&ht.host.atomicSettingsCalls) != settingsCalls {
+		t.Error("connectivity check was counted as a settings call")
+	}
+
+	// Point the host at a port where nothing is listening.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockedAddr := modules.NetAddress(l.Addr().String())
+	l.Close()
+	ht.host.mu.Lock()
+	ht.host.netAddress = blockedAddr
+	ht.host.mu.Unlock()
+
+	err = ht.host.ConnectivityCheck()
+	if err == nil {
+		t.Fatal("connectivity check passed for a blocked port")
+	}
+	err = ht.host.Announce(false)
+	if err == nil {
+		t.Fatal("host announced despite failing the connectivity check")
+	}
+	if len(ht.tpool.TransactionList()) != 0 {
+		t.Error("announcement made it into the transaction pool")
+	}
+}
+
+// TestAnnouncementRateLimit announces twice in quick succession and checks
+// that only one announcement is broadcast, unless the second announcement is
+// forced or the announce window has passed.
+func TestAnnouncementRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestAnnouncementRateLimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.RLock()
+	addr := ht.host.netAddress
+	ht.host.mu.RUnlock()
+
+	// Announce twice. The second announcement should be declined.
+	err = ht.host.AnnounceAddress(addr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.AnnounceAddress(addr, false)
+	if err != modules.ErrAnnouncementUnchanged {
+		t.Fatal("expected ErrAnnouncementUnchanged, got", err)
+	}
+	if len(ht.tpool.TransactionList()) != 1 {
+		t.Fatal("expected 1 transaction in the transaction pool, got", len(ht.tpool.TransactionList()))
+	}
+
+	// Mine the announcement into a block, and check that a different address
+	// is still announced.
+	_, err = ht.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.AnnounceAddress("foo.com:1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A forced announcement of the original address should be broadcast.
+	err = ht.host.AnnounceAddress(addr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ht.tpool.TransactionList()) != 2 {
+		t.Fatal("expected 2 transactions in the transaction pool, got", len(ht.tpool.TransactionList()))
+	}
+
+	// Once the announce window has passed, the address can be announced
+	// again.
+	for i := types.BlockHeight(0); i < defaultAnnounceWindow; i++ {
+		_, err = ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ht.host.AnnounceAddress(addr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// feeWallet is a wallet whose transaction builders fund any amount without
+// holding inputs.
+type feeWallet struct {
+	modules.Wallet
+}
+
+// feeTxnBuilder is the transaction builder of a feeWallet.
+type feeTxnBuilder struct {
+	modules.TransactionBuilder
+	txn types.Transaction
+}
+
+func (feeWallet) NextAddress() (types.UnlockConditions, error) { return types.UnlockConditions{}, nil }
+func (feeWallet) StartTransaction() modules.TransactionBuilder { return new(feeTxnBuilder) }
+
+func (tb *feeTxnBuilder) FundSiacoins(types.Currency) error { return nil }
+func (tb *feeTxnBuilder) AddMinerFee(fee types.Currency) uint64 {
+	tb.txn.MinerFees = append(tb.txn.MinerFees, fee)
+	return uint64(len(tb.txn.MinerFees) - 1)
+}
+func (tb *feeTxnBuilder) AddArbitraryData(arb []byte) uint64 {
+	tb.txn.ArbitraryData = append(tb.txn.ArbitraryData, arb)
+	return uint64(len(tb.txn.ArbitraryData) - 1)
+}
+func (tb *feeTxnBuilder) View() (types.Transaction, []types.Transaction) { return tb.txn, nil }
+func (tb *feeTxnBuilder) Sign(bool) ([]types.Transaction, error) {
+	return []types.Transaction{tb.txn}, nil
+}
+func (tb *feeTxnBuilder) Drop() {}
+
+// feeTpool is a transaction pool that rejects transactions paying less than
+// 'minFee' in miner fees, recording every transaction it is given.
+type feeTpool struct {
+	modules.TransactionPool
+	minFee types.Currency
+	txns   []types.Transaction
+}
+
+var errFeeTooLow = errors.New("transaction fee is too low")
+
+func (tp *feeTpool) AcceptTransactionSet(ts []types.Transaction) error {
+	txn := ts[len(ts)-1]
+	tp.txns = append(tp.txns, txn)
+	fee := types.ZeroCurrency
+	for _, f := range txn.MinerFees {
+		fee = fee.Add(f)
+	}
+	if fee.Cmp(tp.minFee) < 0 {
+		return errFeeTooLow
+	}
+	return nil
+}
+
+// TestAnnouncementRetry checks that an announcement rejected by the
+// transaction pool is retried with a higher fee, and that the final error is
+// returned once every attempt has failed.
+func TestAnnouncementRetry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestAnnouncementRetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	if err := h.SetAnnounceRetry(0, 0); err != errZeroAnnounceAttempts {
+		t.Fatal("expected errZeroAnnounceAttempts, got", err)
+	}
+	err = h.SetAnnounceRetry(3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpool := &feeTpool{minFee: announceBaseFee}
+	h.mu.Lock()
+	h.wallet = feeWallet{}
+	h.tpool = tpool
+	h.mu.Unlock()
+
+	// The first attempt pays no fee and is rejected, and the retry pays the
+	// base fee and is accepted.
+	addr := modules.NetAddress("foo.com:1234")
+	err = h.AnnounceAddress(addr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpool.txns) != 2 {
+		t.Fatal("expected 2 attempts, got", len(tpool.txns))
+	}
+	if len(tpool.txns[0].MinerFees) != 0 {
+		t.Error("first attempt paid a fee")
+	}
+	if len(tpool.txns[1].MinerFees) != 1 || tpool.txns[1].MinerFees[0].Cmp(announceBaseFee) != 0 {
+		t.Error("retry did not pay the base fee:", tpool.txns[1].MinerFees)
+	}
+	h.mu.RLock()
+	announced := h.announcedAddress
+	h.mu.RUnlock()
+	if announced != addr {
+		t.Fatal("announcement was not recorded")
+	}
+
+	// If every attempt is rejected, the final error is returned after the
+	// last attempt, and each retry pays double the fee of the last.
+	tpool.txns = nil
+	tpool.minFee = announceBaseFee.Mul(types.NewCurrency64(100))
+	err = h.AnnounceAddress("bar.com:1234", false)
+	if err == nil || !strings.Contains(err.Error(), errFeeTooLow.Error()) {
+		t.Fatal("expected the announcement to fail with errFeeTooLow, got", err)
+	}
+	if len(tpool.txns) != 3 {
+		t.Fatal("expected 3 attempts, got", len(tpool.txns))
+	}
+	if tpool.txns[2].MinerFees[0].Cmp(announceBaseFee.Mul(types.NewCurrency64(2))) != 0 {
+		t.Error("second retry did not double the fee:", tpool.txns[2].MinerFees)
+	}
+	h.mu.RLock()
+	announced = h.announcedAddress
+	h.mu.RUnlock()
+	if announced != addr {
+		t.Fatal("failed announcement replaced the recorded announcement:", announced)
+	}
+
+	// Errors that do not come from the transaction pool are not retried.
+	tpool.txns = nil
+	h.mu.Lock()
+	h.wallet = brokeWallet{}
+	h.mu.Unlock()
+	err = h.AnnounceAddress("baz.com:1234", false)
+	if err != errNoFunds {
+		t.Fatal("expected errNoFunds, got", err)
+	}
+	if len(tpool.txns) != 1 {
+		t.Fatal("expected only the unfunded attempt to reach the transaction pool, got", len(tpool.txns))
+	}
+}
+
+// TestAnnouncementConcurrent announces the same address from two goroutines,
+// and checks that only one of them submits an announcement.
+func TestAnnouncementConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestAnnouncementConcurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	err = h.SetAnnounceRetry(2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpool := &feeTpool{minFee: announceBaseFee}
+	h.mu.Lock()
+	h.wallet = feeWallet{}
+	h.tpool = tpool
+	h.mu.Unlock()
+
+	// The first attempt is rejected, so the announcement is still in
+	// progress while the other goroutine checks for a recent announcement.
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- h.AnnounceAddress("foo.com:1234", false)
+		}()
+	}
+	var unchanged int
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		if err == modules.ErrAnnouncementUnchanged {
+			unchanged++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if unchanged != 1 {
+		t.Fatal("expected exactly one announcement to be skipped, got", unchanged)
+	}
+	if len(tpool.txns) != 2 {
+		t.Fatal("expected a single announcement with one retry, got", len(tpool.txns))
+	}
+}
+
+// brokeWallet is a feeWallet that cannot fund any fee.
+type brokeWallet struct {
+	feeWallet
+}
+
+// brokeTxnBuilder is the transaction builder of a brokeWallet.
+type brokeTxnBuilder struct {
+	feeTxnBuilder
+}
+
+var errNoFunds = errors.New("wallet has no funds")
+
+func (brokeWallet) StartTransaction() modules.TransactionBuilder { return new(brokeTxnBuilder) }
+func (tb *brokeTxnBuilder) FundSiacoins(types.Currency) error    { return errNoFunds }
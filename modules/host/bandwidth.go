@@ -0,0 +1,116 @@
+package host
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// bandwidthSaveInterval is the minimum amount of time between saves of
+	// the host caused by transfers. Transfers that are not saved immediately
+	// are saved with the next save of the host, which happens with every new
+	// block, including the block that ends an accounting period, and when
+	// the host is closed.
+	bandwidthSaveInterval = func() time.Duration {
+		if build.Release == "testing" {
+			return time.Second
+		}
+		if build.Release == "standard" {
+			return 5 * time.Minute
+		}
+		if build.Release == "dev" {
+			return time.Minute
+		}
+		panic("unrecognized release constant in host")
+	}()
+)
+
+// recordBandwidth adds the data transferred with a renter to the bandwidth
+// ledger. 'served' is the number of bytes sent to the renter, and 'received'
+// is the number of bytes received from the renter.
+func (h *Host) recordBandwidth(renter types.UnlockHash, served, received uint64) {
+	usage := h.bandwidth[renter]
+	usage.Renter = renter
+	usage.Served += served
+	usage.Received += received
+	h.bandwidth[renter] = usage
+}
+
+// managedRecordBandwidth records data transferred with a renter in the
+// bandwidth ledger, saving the host so that the transfer is remembered
+// across restarts. The host is saved at most once every
+// bandwidthSaveInterval, rather than after every transfer.
+func (h *Host) managedRecordBandwidth(renter types.UnlockHash, served, received uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordBandwidth(renter, served, received)
+	now := h.clock.Now()
+	if now.Sub(h.lastBandwidthSave) < bandwidthSaveInterval {
+		return
+	}
+	h.lastBandwidthSave = now
+	err := h.save()
+	if err != nil {
+		h.log.Println("WARN: failed to save host:", err)
+	}
+}
+
+// resetBandwidthPeriod clears the bandwidth ledger if the current accounting
+// period has ended. A period of zero never ends.
+func (h *Host) resetBandwidthPeriod() {
+	if h.bandwidthPeriod == 0 || h.blockHeight < h.bandwidthPeriodStart+h.bandwidthPeriod {
+		return
+	}
+	h.bandwidth = make(map[types.UnlockHash]modules.BandwidthUsage)
+	h.bandwidthPeriodStart = h.blockHeight
+}
+
+// bandwidthLedger returns the entries of the bandwidth ledger, sorted by
+// renter.
+func (h *Host) bandwidthLedger() []modules.BandwidthUsage {
+	ledger := make([]modules.BandwidthUsage, 0, len(h.bandwidth))
+	for _, usage := range h.bandwidth {
+		ledger = append(ledger, usage)
+	}
+	sort.Sort(byRenter(ledger))
+	return ledger
+}
+
+// BandwidthLedger returns the data transferred with each renter during the
+// current accounting period.
+func (h *Host) BandwidthLedger() []modules.BandwidthUsage {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.bandwidthLedger()
+}
+
+// SetBandwidthPeriod sets the length, in blocks, of the period after which
+// the bandwidth ledger is cleared. The current period starts over at the
+// current height. A period of zero never clears the ledger.
+func (h *Host) SetBandwidthPeriod(period types.BlockHeight) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.bandwidthPeriod = period
+	h.bandwidthPeriodStart = h.blockHeight
+	return h.save()
+}
+
+// byRenter sorts bandwidth usage by the unlock hash of the renter.
+type byRenter []modules.BandwidthUsage
+
+func (s byRenter) Len() int      { return len(s) }
+func (s byRenter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRenter) Less(i, j int) bool {
+	return bytes.Compare(s[i].Renter[:], s[j].Renter[:]) < 0
+}
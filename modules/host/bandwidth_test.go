@@ -0,0 +1,167 @@
+package host
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestBandwidthLedger downloads data from an obligation and checks that the
+// bytes served are recorded for the renter of the obligation.
+func TestBandwidthLedger(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestBandwidthLedger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Add an obligation holding a single sector.
+	renter := types.UnlockHash{1}
+	data, err := crypto.RandBytes(4 * crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob := &contractObligation{
+		ID: types.FileContractID{1},
+		OriginTransaction: types.Transaction{
+			FileContracts: []types.FileContract{{
+				ValidProofOutputs: []types.SiacoinOutput{{UnlockHash: renter}, {}},
+			}},
+		},
+		Sectors: []crypto.Hash{root},
+	}
+	h.mu.Lock()
+	err = h.addSector(root, data)
+	h.obligationsByID[ob.ID] = ob
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download part of the data.
+	requests := []modules.DownloadRequest{
+		{Offset: 0, Length: 100},
+		{Offset: 100, Length: 2 * crypto.SegmentSize},
+	}
+	renterConn, hostConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.managedRPCDownload(hostConn, false)
+		hostConn.Close()
+	}()
+	err = encoding.WriteObject(renterConn, ob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transferred uint64
+	for _, req := range requests {
+		err = encoding.WriteObject(renterConn, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment := make([]byte, req.Length)
+		_, err = io.ReadFull(renterConn, segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(segment, data[req.Offset:req.Offset+req.Length]) {
+			t.Fatal("host sent the wrong data")
+		}
+		transferred += req.Length
+	}
+	err = encoding.WriteObject(renterConn, modules.DownloadRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	renterConn.Close()
+
+	ledger := h.BandwidthLedger()
+	if len(ledger) != 1 || ledger[0].Renter != renter {
+		t.Fatal("ledger does not contain the renter:", ledger)
+	}
+	if ledger[0].Served != transferred || ledger[0].Received != 0 {
+		t.Errorf("expected %v bytes served and none received, got %v and %v", transferred, ledger[0].Served, ledger[0].Received)
+	}
+
+	// The ledger should be cleared once the accounting period ends.
+	err = h.SetBandwidthPeriod(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Lock()
+	h.blockHeight += 9
+	h.resetBandwidthPeriod()
+	h.mu.Unlock()
+	if len(h.BandwidthLedger()) != 1 {
+		t.Fatal("ledger was cleared before the end of the period")
+	}
+	h.mu.Lock()
+	h.blockHeight++
+	h.resetBandwidthPeriod()
+	h.mu.Unlock()
+	if len(h.BandwidthLedger()) != 0 {
+		t.Fatal("ledger was not cleared at the end of the period")
+	}
+}
+
+// TestBandwidthSaveInterval checks that transfers save the host at most once
+// every bandwidthSaveInterval, and that data received from a renter is
+// remembered across restarts.
+func TestBandwidthSaveInterval(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestBandwidthSaveInterval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	h.mu.Lock()
+	h.clock = clock
+	h.mu.Unlock()
+
+	renter := types.UnlockHash{1}
+	h.managedRecordBandwidth(renter, 0, 100)
+	saved := h.lastBandwidthSave
+	if !saved.Equal(clock.Now()) {
+		t.Fatal("first transfer did not save the host")
+	}
+	clock.advance(bandwidthSaveInterval / 2)
+	h.managedRecordBandwidth(renter, 10, 0)
+	if !h.lastBandwidthSave.Equal(saved) {
+		t.Fatal("host was saved again within the save interval")
+	}
+
+	// Both directions survive a restart, as the host is saved on close.
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err = New(ht.cs, ht.tpool, ht.wallet, ":0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := h.BandwidthLedger()
+	if len(ledger) != 1 || ledger[0].Received != 100 || ledger[0].Served != 10 {
+		t.Fatal("bandwidth was not remembered across restarts:", ledger)
+	}
+}
@@ -0,0 +1,17 @@
+package host
+
+import (
+	"time"
+)
+
+// A clock reports the current time. The host consults its clock for every
+// time-based decision, so that tests can control the passage of time.
+type clock interface {
+	Now() time.Time
+}
+
+// stdClock is the clock used by the host outside of testing.
+type stdClock struct{}
+
+// Now returns the current time.
+func (stdClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,96 @@
+package host
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A fakeClock is a clock that only moves when it is advanced.
+type fakeClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+// Now returns the time of the fake clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// advance moves the fake clock forward by d.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// TestFakeClockProofWindow mines blocks across the start of a storage proof
+// window while advancing a fake clock, and checks that the storage proof is
+// attempted exactly once, at the time of the block that opened the window.
+func TestFakeClockProofWindow(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestFakeClockProofWindow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+
+	// Add a confirmed contract whose proof window opens in a few blocks.
+	data, err := crypto.RandBytes(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := testObligation(1)
+	h.mu.Lock()
+	h.clock = clock
+	co.OriginConfirmed = true
+	co.RevisionConfirmed = true
+	co.OriginTransaction.FileContracts[0].WindowStart = h.blockHeight + 3
+	co.OriginTransaction.FileContracts[0].WindowEnd = h.blockHeight + 20
+	h.obligationsByID[co.ID] = co
+	err = h.addSector(root, data)
+	co.Sectors = append(co.Sectors, root)
+	h.handleActionItem(co)
+	proofHeight := co.windowStart() + resubmissionTimeout
+	blocks := proofHeight - h.blockHeight
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine blocks, ten minutes apart, until the proof is due.
+	for i := types.BlockHeight(1); i <= blocks; i++ {
+		clock.advance(10 * time.Minute)
+		h.ProcessConsensusChange(modules.ConsensusChange{
+			AppliedBlocks: []types.Block{{Timestamp: types.Timestamp(i)}},
+		})
+		if i < blocks && len(h.ProofHistory()) != 0 {
+			t.Fatal("storage proof was attempted before the window opened")
+		}
+	}
+	for i := 0; i < 50 && len(h.ProofHistory()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	proofs := h.ProofHistory()
+	if len(proofs) != 1 {
+		t.Fatal("expected exactly one storage proof attempt, got", len(proofs))
+	}
+	if !proofs[0].Time.Equal(clock.Now()) {
+		t.Error("storage proof attempt was not timed by the host clock:", proofs[0].Time)
+	}
+}
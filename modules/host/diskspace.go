@@ -0,0 +1,101 @@
+package host
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// diskSpaceMargin is the amount of free space that the host leaves on the
+	// disk holding its sectors, so that there is always room for the host's
+	// persist files and logs.
+	diskSpaceMargin = 64 << 20 // 64 MiB.
+)
+
+var (
+	// diskCheckInterval is the amount of time between checks of the free
+	// space on the disk holding the host's sectors.
+	diskCheckInterval = func() time.Duration {
+		if build.Release == "testing" {
+			return 100 * time.Millisecond
+		}
+		if build.Release == "standard" {
+			return 10 * time.Minute
+		}
+		if build.Release == "dev" {
+			return time.Minute
+		}
+		panic("unrecognized release constant in host")
+	}()
+)
+
+// managedCheckDiskSpace compares the storage that the host has left to offer
+// with the free space on the disks holding its storage folders. If other data
+// has filled the disks, the capacity of the host is lowered so that the host
+// does not accept data that it cannot store. No data is deleted, and the
+// capacity is restored once the disks have room again.
+//
+// The free space of every storage folder is counted, less diskSpaceMargin
+// for each folder, so storage folders are expected to be on separate disks.
+func (h *Host) managedCheckDiskSpace() {
+	h.mu.RLock()
+	freeSpace := h.freeSpace
+	folders := h.storageFolders()
+	h.mu.RUnlock()
+	var free uint64
+	var available int64
+	for _, folder := range folders {
+		folderFree, err := freeSpace(folder)
+		if err != nil {
+			h.log.Println("WARN: could not check free disk space:", err)
+			return
+		}
+		free += folderFree
+		if folderFree > diskSpaceMargin {
+			available += int64(folderFree) - diskSpaceMargin
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	shortfall := h.spaceRemaining + h.diskShortfall - available
+	if shortfall < 0 {
+		shortfall = 0
+	}
+	if shortfall == h.diskShortfall {
+		return
+	}
+	if shortfall > 0 {
+		h.log.Printf("WARN: disk is low on space (%v bytes free), lowering advertised storage by %v bytes", free, shortfall)
+	} else {
+		h.log.Println("INFO: disk has room again, restoring advertised storage")
+	}
+	h.spaceRemaining += h.diskShortfall - shortfall
+	h.diskShortfall = shortfall
+}
+
+// threadedMonitorDiskSpace periodically checks the free space on the disks
+// holding the host's storage folders until the host is closed.
+func (h *Host) threadedMonitorDiskSpace() {
+	for {
+		time.Sleep(diskCheckInterval)
+		h.resourceLock.RLock()
+		if h.closed {
+			h.resourceLock.RUnlock()
+			return
+		}
+		h.managedCheckDiskSpace()
+		h.resourceLock.RUnlock()
+	}
+}
+
+// advertisedSettings returns the settings that the host advertises to
+// renters, which account for any storage that the disk cannot provide.
+func (h *Host) advertisedSettings() modules.HostSettings {
+	settings := h.settings
+	settings.TotalStorage -= h.diskShortfall
+	settings.ProtocolVersion = modules.ProtocolVersion
+	return settings
+}
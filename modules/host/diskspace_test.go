@@ -0,0 +1,69 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestDiskSpaceMonitor simulates a disk that is filled by other data, and
+// checks that the host lowers its advertised storage without deleting data,
+// restoring the storage once the disk has room again.
+func TestDiskSpaceMonitor(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestDiskSpaceMonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	capacity := h.Capacity()
+	totalStorage := h.Settings().TotalStorage
+
+	// Leave only 1 MiB on the disk for the host.
+	free := uint64(diskSpaceMargin + 1<<20)
+	h.mu.Lock()
+	h.freeSpace = func(string) (uint64, error) { return free, nil }
+	h.mu.Unlock()
+	h.managedCheckDiskSpace()
+	if h.Capacity() != 1<<20 {
+		t.Fatal("capacity was not lowered to the free disk space:", h.Capacity())
+	}
+	if h.Settings().TotalStorage != totalStorage {
+		t.Error("configured storage should not change")
+	}
+	if h.Metrics().TotalStorage != totalStorage-(capacity-1<<20) {
+		t.Error("metrics do not report the lowered storage:", h.Metrics().TotalStorage)
+	}
+
+	// Renters should see the lowered storage.
+	renterConn, hostConn := net.Pipe()
+	go func() {
+		h.managedRPCSettings(hostConn)
+		hostConn.Close()
+	}()
+	var ss modules.SignedHostSettings
+	err = encoding.ReadObject(renterConn, &ss, maxContractLen)
+	renterConn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.Settings.TotalStorage != totalStorage-(capacity-1<<20) {
+		t.Error("advertised storage was not lowered:", ss.Settings.TotalStorage)
+	}
+
+	// The capacity is restored once the disk has room again.
+	h.mu.Lock()
+	h.freeSpace = func(string) (uint64, error) { return uint64(diskSpaceMargin + 2*capacity), nil }
+	h.mu.Unlock()
+	h.managedCheckDiskSpace()
+	if h.Capacity() != capacity {
+		t.Error("capacity was not restored:", h.Capacity())
+	}
+	if h.Metrics().TotalStorage != totalStorage {
+		t.Error("advertised storage was not restored:", h.Metrics().TotalStorage)
+	}
+}
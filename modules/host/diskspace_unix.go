@@ -0,0 +1,18 @@
+// +build !windows
+
+package host
+
+import (
+	"syscall"
+)
+
+// diskFreeSpace returns the number of bytes available to the host on the disk
+// containing 'path'.
+func diskFreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
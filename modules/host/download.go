@@ -4,7 +4,6 @@ import (
 	"errors"
 	"io"
 	"net"
-	"os"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -20,14 +19,31 @@ const (
 	tolerableDownloadSize = 1 << 26
 )
 
+var (
+	// errDownloadUnderpaid is returned if the revision sent with a download
+	// request does not pay the host for the data requested.
+	errDownloadUnderpaid = errors.New("revision does not pay for the requested download")
+
+	// errDownloadNotFree is returned if a renter that cannot pay for
+	// downloads requests data from a host that charges for them.
+	errDownloadNotFree = errors.New("host charges for downloads, which requires the paid download RPC")
+)
+
 // rpcDownload is an RPC that uploads requested segments of a file. After the
 // RPC has been initiated, the host will read and process requests in a loop
 // until the 'stop' signal is received or the connection times out.
 //
-// TODO: There is no lock obtained on the obligation, which means that a
-// revision could modify the file at the same time that it is being read from
-// disk.
-func (h *Host) managedRPCDownload(conn net.Conn) error {
+// The set of sectors is copied when the download starts, and sectors are never
+// modified once written, so a concurrent revision cannot corrupt the download.
+//
+// If paid is set, the renter called RPCPaidDownload: once the contract ID has
+// been read, the host sends its download bandwidth price. If the price is not
+// zero, each request must be followed by a revision of the file contract that
+// pays for the requested data, including for read-only contracts. The data is
+// only served once the host has accepted and signed the revision. Renters that
+// call RPCDownload are not sent a price and cannot pay, so they are refused if
+// the host charges for downloads.
+func (h *Host) managedRPCDownload(conn net.Conn, paid bool) error {
 	// Read the contract ID.
 	var contractID types.FileContractID
 	err := encoding.ReadObject(conn, &contractID, crypto.HashSize)
@@ -38,21 +54,55 @@ func (h *Host) managedRPCDownload(conn net.Conn) error {
 	// Verify the file exists, using a mutex while reading the host.
 	h.mu.RLock()
 	ob, exists := h.obligationsByID[contractID]
+	var roots []crypto.Hash
+	var renter types.UnlockHash
+	if exists {
+		roots = append(roots, ob.Sectors...)
+		renter = ob.renterUnlockHash()
+	}
+	verify := h.verifySectors
+	price := h.settings.DownloadBandwidthPrice
 	h.mu.RUnlock()
 	if !exists {
 		return errors.New("no record of that file")
 	}
+	if !paid && !price.IsZero() {
+		return errDownloadNotFree
+	}
 
-	// Open the file.
-	file, err := os.Open(ob.Path)
-	if err != nil {
-		return err
+	// Tell the renter the price of the download, so that it does not depend
+	// on settings that the renter may have fetched before the price changed.
+	if paid {
+		if err := encoding.WriteObject(conn, price); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
-	fi, err := file.Stat()
+
+	// Open the sectors that make up the file.
+	file, err := h.managedOpenSectors(roots)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	// Record the data sent to the renter once the download has finished, and
+	// submit the final payment revision to the blockchain.
+	var served uint64
+	var revised bool
+	defer func() {
+		if served > 0 {
+			h.managedRecordBandwidth(renter, served, 0)
+		}
+		if revised {
+			h.mu.RLock()
+			revTxn := ob.RevisionTransaction
+			h.mu.RUnlock()
+			err := h.tpool.AcceptTransactionSet([]types.Transaction{revTxn})
+			if err != nil && err != modules.ErrDuplicateTransactionSet {
+				h.log.Println("WARN: transaction pool rejected download revision transaction: " + err.Error())
+			}
+		}
+	}()
 
 	// Process requests until 'stop' signal is received, or until 100 requests
 	// have been received. A malicious host can at most extend the request out
@@ -69,23 +119,142 @@ func (h *Host) managedRPCDownload(conn net.Conn) error {
 		}
 
 		// Check for sane request parameters.
-		if request.Length+request.Offset > uint64(fi.Size()) {
+		size := uint64(file.Size())
+		if request.Offset > size || request.Length > size-request.Offset {
 			return errors.New("request exceeds file bounds")
 		}
 		if request.Length > tolerableDownloadSize {
 			return errors.New("cannot download provided length")
 		}
 
+		// Refuse to serve sectors that have been corrupted on disk.
+		if verify {
+			i, err := file.verifyRange(int64(request.Offset), int64(request.Length))
+			if err == errCorruptSector {
+				h.log.Printf("ERROR: sector %v at %v is corrupt and was not served", file.roots[i], file.files[i].Name())
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// Collect payment for the requested data.
+		if !price.IsZero() {
+			cost := price.Mul(types.NewCurrency64(request.Length))
+			if err := h.managedPayDownload(conn, ob, cost); err != nil {
+				return err
+			}
+			revised = true
+		}
+
 		// Write segment to conn.
 		err := conn.SetDeadline(time.Now().Add(5 * time.Minute)) // sufficient to transfer 4 MB over 100 kbps
 		if err != nil {
 			return err
 		}
 		segment := io.NewSectionReader(file, int64(request.Offset), int64(request.Length))
-		_, err = io.Copy(conn, segment)
+		n, err := io.Copy(conn, segment)
+		served += uint64(n)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// considerDownloadRevision checks that a revision pays the host 'cost' for
+// served data while leaving the rest of the file contract unchanged.
+func (h *Host) considerDownloadRevision(txn types.Transaction, obligation *contractObligation, cost types.Currency) error {
+	if len(txn.FileContractRevisions) != 1 {
+		return errors.New("transaction should have only one revision")
+	}
+	rev := txn.FileContractRevisions[0]
+	expectedPayout := types.PostTax(h.blockHeight, obligation.payout())
+
+	switch {
+	// these fields should never change
+	case rev.ParentID != obligation.ID:
+		return errors.New("bad revision parent ID")
+	case rev.NewUnlockHash != obligation.unlockHash():
+		return errors.New("bad revision unlock hash")
+	case rev.UnlockConditions.UnlockHash() != obligation.unlockHash():
+		return errors.New("bad revision unlock conditions")
+	case len(rev.NewValidProofOutputs) != 2:
+		return errors.New("bad revision valid proof outputs")
+	case len(rev.NewMissedProofOutputs) != 2:
+		return errors.New("bad revision missed proof outputs")
+	case rev.NewValidProofOutputs[1].UnlockHash != obligation.validProofUnlockHash(),
+		rev.NewMissedProofOutputs[1].UnlockHash != obligation.missedProofUnlockHash():
+		return errors.New("bad revision proof outputs")
+
+	// a download does not change the stored data or the proof window
+	case rev.NewFileSize != obligation.fileSize(),
+		rev.NewFileMerkleRoot != obligation.merkleRoot():
+		return errors.New("download revision must not change the file")
+	case rev.NewWindowStart != obligation.windowStart(),
+		rev.NewWindowEnd != obligation.windowEnd():
+		return errors.New("download revision must not change the proof window")
+
+	case rev.NewRevisionNumber <= obligation.revisionNumber():
+		return errStaleRevision
+
+	case rev.NewValidProofOutputs[0].Value.Add(rev.NewValidProofOutputs[1].Value).Cmp(expectedPayout) != 0,
+		// valid and missing outputs should still sum to payout
+		rev.NewMissedProofOutputs[0].Value.Add(rev.NewMissedProofOutputs[1].Value).Cmp(expectedPayout) != 0:
+		return errors.New("revision outputs do not sum to original payout")
+
+	case rev.NewValidProofOutputs[1].Value.Cmp(obligation.value().Add(cost)) < 0:
+		return errDownloadUnderpaid
+
+	case rev.NewMissedProofOutputs[0].Value.Cmp(rev.NewValidProofOutputs[0].Value) != 0:
+		return errors.New("revision missed renter payout does not match valid payout")
+	}
+	return nil
+}
+
+// managedPayDownload reads a revision that pays the host 'cost' for the data
+// of a download request. If the revision is acceptable, the host signs it,
+// revises the obligation, and sends the signed revision back to the renter.
+func (h *Host) managedPayDownload(conn net.Conn, obligation *contractObligation, cost types.Currency) error {
+	var revTxn types.Transaction
+	if err := encoding.ReadObject(conn, &revTxn, types.BlockSizeLimit); err != nil {
+		return errors.New("couldn't read download revision: " + err.Error())
+	}
+
+	// Protect against a simultaneous revision of the same contract.
+	obligation.mu.Lock()
+	defer obligation.mu.Unlock()
+
+	h.mu.Lock()
+	err := h.considerDownloadRevision(revTxn, obligation, cost)
+	if err == nil {
+		// manually sign the transaction
+		revTxn.TransactionSignatures = append(revTxn.TransactionSignatures, types.TransactionSignature{
+			ParentID:       crypto.Hash(obligation.ID),
+			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+			PublicKeyIndex: 1, // host key is always second
+		})
+		var encodedSig crypto.Signature
+		encodedSig, err = crypto.SignHash(revTxn.SigHash(len(revTxn.TransactionSignatures)-1), h.secretKey)
+		if err == nil {
+			revTxn.TransactionSignatures[len(revTxn.TransactionSignatures)-1].Signature = encodedSig[:]
+			h.reviseObligation(revTxn)
+		}
+	}
+	h.mu.Unlock()
+	if err != nil {
+		// There is nothing that can be done if there is an error while
+		// writing to a connection.
+		_ = encoding.WriteObject(conn, err.Error())
+		return err
+	}
+
+	// indicate acceptance, then send the signed transaction
+	if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
+		return errors.New("couldn't write acceptance: " + err.Error())
+	}
+	if err := encoding.WriteObject(conn, revTxn); err != nil {
+		return errors.New("couldn't write signed revision transaction: " + err.Error())
+	}
+	return nil
+}
@@ -2,9 +2,16 @@ package host
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
+	"net"
 	"path/filepath"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestRPCDownload checks that calls to download return the correct file.
@@ -36,3 +43,298 @@ func TestRPCDownload(t *testing.T) {
 		t.Error("uploaded and downloaded file do not match")
 	}
 }
+
+// TestRPCDownloadTo checks that the renter can download a file from the host
+// directly into a writer.
+func TestRPCDownloadTo(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestRPCDownloadTo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nickname := "TestRPCDownloadTo1"
+	uploadData, err := ht.uploadFile(nickname, renewDisabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the file into a buffer and compare to the data.
+	var buf bytes.Buffer
+	err = ht.renter.DownloadTo(nickname, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uploadData, buf.Bytes()) {
+		t.Error("uploaded and downloaded file do not match")
+	}
+}
+
+// TestDownloadCorruptSector flips a byte in a stored sector, and checks that a
+// host verifying its sectors refuses to serve the corrupt sector while still
+// serving the intact one.
+func TestDownloadCorruptSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestDownloadCorruptSector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	err = h.SetSectorVerification(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add an obligation holding two sectors.
+	const sectorSize = 4 * crypto.SegmentSize
+	data, err := crypto.RandBytes(2 * sectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob := testObligation(1)
+	h.mu.Lock()
+	for i := 0; i < 2; i++ {
+		sector := data[i*sectorSize : (i+1)*sectorSize]
+		root, err := crypto.ReaderMerkleRoot(bytes.NewReader(sector))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = h.addSector(root, sector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ob.Sectors = append(ob.Sectors, root)
+	}
+	h.obligationsByID[ob.ID] = ob
+	corruptPath := h.sectorPath(ob.Sectors[1])
+	h.mu.Unlock()
+
+	// Flip a byte in the second sector.
+	corrupt, err := ioutil.ReadFile(corruptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt[10] ^= 0xFF
+	err = ioutil.WriteFile(corruptPath, corrupt, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first sector should be served, but the download should fail once
+	// it reaches the second sector.
+	renterConn, hostConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.managedRPCDownload(hostConn, true)
+		hostConn.Close()
+	}()
+	err = encoding.WriteObject(renterConn, ob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var price types.Currency
+	err = encoding.ReadObject(renterConn, &price, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := modules.DownloadRequest{Offset: 0, Length: sectorSize}
+	err = encoding.WriteObject(renterConn, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := make([]byte, req.Length)
+	_, err = io.ReadFull(renterConn, segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(segment, data[:sectorSize]) {
+		t.Fatal("host sent the wrong data")
+	}
+	req = modules.DownloadRequest{Offset: sectorSize - 10, Length: 20}
+	err = encoding.WriteObject(renterConn, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != errCorruptSector {
+		t.Fatal("expected errCorruptSector, got", err)
+	}
+	if n, _ := renterConn.Read(make([]byte, 1)); n != 0 {
+		t.Fatal("host served data from a corrupt sector")
+	}
+	renterConn.Close()
+}
+
+// TestDownloadBandwidthPrice checks that a host charging for download
+// bandwidth only serves data that has been paid for, even under a read-only
+// contract, and that the payment is recorded in the contract revision.
+func TestDownloadBandwidthPrice(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestDownloadBandwidthPrice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	price := types.NewCurrency64(3)
+	h.mu.Lock()
+	h.settings.DownloadBandwidthPrice = price
+	h.mu.Unlock()
+
+	// Add a funded obligation holding a single sector.
+	data, err := crypto.RandBytes(4 * crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read-only contracts are charged like any other contract.
+	ob := testObligation(1)
+	ob.ReadOnly = true
+	fc := &ob.OriginTransaction.FileContracts[0]
+	fc.Payout = types.NewCurrency64(1e9)
+	fc.UnlockHash = types.UnlockConditions{}.UnlockHash()
+	fc.FileSize = uint64(len(data))
+	fc.FileMerkleRoot = root
+	fc.ValidProofOutputs[0].Value = types.PostTax(0, fc.Payout)
+	fc.MissedProofOutputs[0].Value = types.PostTax(0, fc.Payout)
+	h.mu.Lock()
+	err = h.addSector(root, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob.Sectors = append(ob.Sectors, root)
+	h.obligationsByID[ob.ID] = ob
+	h.mu.Unlock()
+
+	// download sends a download request along with a revision paying the
+	// host 'pay', and returns the host's response.
+	req := modules.DownloadRequest{Offset: 0, Length: uint64(len(data))}
+	download := func(pay types.Currency) (string, <-chan error, net.Conn) {
+		renterConn, hostConn := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- h.managedRPCDownload(hostConn, true)
+			hostConn.Close()
+		}()
+		if err := encoding.WriteObject(renterConn, ob.ID); err != nil {
+			t.Fatal(err)
+		}
+		var quoted types.Currency
+		if err := encoding.ReadObject(renterConn, &quoted, 256); err != nil {
+			t.Fatal(err)
+		}
+		if quoted.Cmp(price) != 0 {
+			t.Fatal("host sent the wrong download price:", quoted)
+		}
+		if err := encoding.WriteObject(renterConn, req); err != nil {
+			t.Fatal(err)
+		}
+		h.mu.RLock()
+		rev := types.FileContractRevision{
+			ParentID:          ob.ID,
+			UnlockConditions:  types.UnlockConditions{},
+			NewRevisionNumber: ob.revisionNumber() + 1,
+			NewFileSize:       ob.fileSize(),
+			NewFileMerkleRoot: ob.merkleRoot(),
+			NewWindowStart:    ob.windowStart(),
+			NewWindowEnd:      ob.windowEnd(),
+			NewValidProofOutputs: []types.SiacoinOutput{
+				{Value: types.PostTax(0, fc.Payout).Sub(ob.value()).Sub(pay)},
+				{Value: ob.value().Add(pay)},
+			},
+			NewMissedProofOutputs: []types.SiacoinOutput{
+				{Value: types.PostTax(0, fc.Payout).Sub(ob.value()).Sub(pay)},
+				{Value: ob.value().Add(pay)},
+			},
+			NewUnlockHash: ob.unlockHash(),
+		}
+		h.mu.RUnlock()
+		revTxn := types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{rev},
+			TransactionSignatures: []types.TransactionSignature{{
+				ParentID:       crypto.Hash(ob.ID),
+				CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+				PublicKeyIndex: 0,
+			}},
+		}
+		if err := encoding.WriteObject(renterConn, revTxn); err != nil {
+			t.Fatal(err)
+		}
+		var response string
+		if err := encoding.ReadObject(renterConn, &response, 128); err != nil {
+			t.Fatal(err)
+		}
+		return response, done, renterConn
+	}
+
+	// A renter calling the original download RPC cannot pay, and is refused
+	// before any price is sent.
+	renterConn, hostConn := net.Pipe()
+	go func() {
+		if err := encoding.WriteObject(renterConn, ob.ID); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := h.managedRPCDownload(hostConn, false); err != errDownloadNotFree {
+		t.Fatal("expected errDownloadNotFree, got", err)
+	}
+	hostConn.Close()
+	renterConn.Close()
+
+	// A revision that pays less than the price of the data is rejected, and
+	// no data is served.
+	cost := price.Mul(types.NewCurrency64(req.Length))
+	response, done, renterConn := download(cost.Sub(types.NewCurrency64(1)))
+	if response != errDownloadUnderpaid.Error() {
+		t.Fatal("expected underpaid revision to be rejected, got", response)
+	}
+	if err := <-done; err != errDownloadUnderpaid {
+		t.Fatal("expected errDownloadUnderpaid, got", err)
+	}
+	renterConn.Close()
+	if ob.hasRevision() {
+		t.Fatal("underpaid revision was applied to the obligation")
+	}
+
+	// A revision paying the price is signed, and the data is served.
+	response, done, renterConn = download(cost)
+	if response != modules.AcceptResponse {
+		t.Fatal("expected revision to be accepted, got", response)
+	}
+	var signedTxn types.Transaction
+	if err := encoding.ReadObject(renterConn, &signedTxn, types.BlockSizeLimit); err != nil {
+		t.Fatal(err)
+	}
+	if len(signedTxn.TransactionSignatures) != 2 {
+		t.Fatal("host did not sign the revision")
+	}
+	segment := make([]byte, req.Length)
+	if _, err := io.ReadFull(renterConn, segment); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(segment, data) {
+		t.Fatal("host sent the wrong data")
+	}
+	if err := encoding.WriteObject(renterConn, modules.DownloadRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	renterConn.Close()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !ob.hasRevision() || ob.RevisionTransaction.ID() != signedTxn.ID() {
+		t.Fatal("payment revision was not applied to the obligation")
+	}
+	if ob.value().Cmp(cost) != 0 {
+		t.Fatalf("expected host output of %v, got %v", cost, ob.value())
+	}
+}
@@ -0,0 +1,129 @@
+package host
+
+// expiry.go notifies subscribers when the storage proof window of a contract
+// is about to open, so that the contract can be renewed in time.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// expiryEventBufferSize is the number of events that will be buffered
+	// for each subscriber. Once the buffer is full, the oldest event is
+	// dropped to make room for the new one, so that a slow subscriber never
+	// blocks consensus processing.
+	expiryEventBufferSize = 64
+)
+
+var (
+	// defaultExpiryWarning is the number of blocks before the storage proof
+	// window of a contract that an expiry event is sent.
+	defaultExpiryWarning = func() types.BlockHeight {
+		if build.Release == "testing" {
+			return 5
+		}
+		if build.Release == "standard" {
+			return 1008 // 1 week.
+		}
+		if build.Release == "dev" {
+			return 36
+		}
+		panic("unrecognized release constant in host")
+	}()
+
+	// errZeroExpiryWarning is returned by SetExpiryWarning if the warning is
+	// zero.
+	errZeroExpiryWarning = errors.New("expiry warning must be positive")
+)
+
+// An ExpiryEvent indicates that the storage proof window of a contract opens
+// at WindowStart, after which the contract can no longer be revised.
+type ExpiryEvent struct {
+	ContractID  types.FileContractID
+	Renter      types.UnlockHash
+	WindowStart types.BlockHeight
+}
+
+// SubscribeExpiry returns a channel that receives an ExpiryEvent for each
+// contract whose storage proof window is about to open, along with a function
+// that ends the subscription and closes the channel. An event is sent once
+// for each contract, when the block height comes within the expiry warning of
+// the window.
+func (h *Host) SubscribeExpiry() (<-chan ExpiryEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan ExpiryEvent, expiryEventBufferSize)
+	h.expirySubscribers = append(h.expirySubscribers, events)
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i := range h.expirySubscribers {
+			if h.expirySubscribers[i] == events {
+				h.expirySubscribers = append(h.expirySubscribers[:i], h.expirySubscribers[i+1:]...)
+				close(events)
+				return
+			}
+		}
+	}
+	return events, unsubscribe
+}
+
+// SetExpiryWarning sets the number of blocks before the storage proof window
+// of a contract that an expiry event is sent. Contracts that have already
+// been announced as expiring are not announced again.
+func (h *Host) SetExpiryWarning(blocks types.BlockHeight) error {
+	if blocks == 0 {
+		return errZeroExpiryWarning
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.expiryWarning = blocks
+	return h.save()
+}
+
+// notifyExpiringContracts sends an expiry event for every contract whose
+// storage proof window opens within the expiry warning, and which has not
+// been announced as expiring before.
+func (h *Host) notifyExpiringContracts() {
+	for _, ob := range h.obligationsByID {
+		if ob.ExpiryNotified || h.blockHeight+h.expiryWarning < ob.windowStart() {
+			continue
+		}
+		ob.ExpiryNotified = true
+		h.notifyExpirySubscribers(ExpiryEvent{
+			ContractID:  ob.ID,
+			Renter:      ob.renterUnlockHash(),
+			WindowStart: ob.windowStart(),
+		})
+	}
+}
+
+// notifyExpirySubscribers sends an event to every subscriber. If the buffer of
+// a subscriber is full, the oldest event in the buffer is dropped.
+func (h *Host) notifyExpirySubscribers(e ExpiryEvent) {
+	for _, events := range h.expirySubscribers {
+		for sent := false; !sent; {
+			select {
+			case events <- e:
+				sent = true
+			default:
+				// Drop the oldest event. The subscriber may have emptied the
+				// buffer in the meantime, so the receive must not block.
+				select {
+				case <-events:
+				default:
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestExpiryNotifications advances the block height past the expiry warning of
+// two contracts, and checks that exactly one expiry event is sent for each
+// contract, at the height at which the warning begins.
+func TestExpiryNotifications(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestExpiryNotifications")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	if err := h.SetExpiryWarning(0); err != errZeroExpiryWarning {
+		t.Fatal("expected errZeroExpiryWarning, got", err)
+	}
+	err = h.SetExpiryWarning(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, unsubscribe := h.SubscribeExpiry()
+	defer unsubscribe()
+
+	// Add two contracts whose windows open at different heights.
+	h.mu.Lock()
+	startHeight := h.blockHeight
+	for i, offset := range []types.BlockHeight{5, 8} {
+		co := testObligation(byte(i))
+		co.OriginTransaction.FileContracts[0].WindowStart = startHeight + offset
+		co.OriginTransaction.FileContracts[0].WindowEnd = startHeight + 20
+		co.OriginTransaction.FileContracts[0].ValidProofOutputs[0].UnlockHash = types.UnlockHash{byte(i)}
+		h.obligationsByID[co.ID] = co
+	}
+	h.mu.Unlock()
+
+	// Apply blocks, checking for expiry events after each block.
+	received := make(map[types.FileContractID]int)
+	for i := types.BlockHeight(1); i <= 10; i++ {
+		h.ProcessConsensusChange(modules.ConsensusChange{
+			AppliedBlocks: []types.Block{{Timestamp: types.Timestamp(i)}},
+		})
+		for drained := false; !drained; {
+			select {
+			case e := <-events:
+				received[e.ContractID]++
+				if e.Renter != (types.UnlockHash{e.ContractID[0]}) {
+					t.Error("expiry event has the wrong renter:", e.Renter)
+				}
+				if startHeight+i+3 != e.WindowStart {
+					t.Errorf("expiry event for a window at %v was sent at height %v", e.WindowStart, startHeight+i)
+				}
+			default:
+				drained = true
+			}
+		}
+	}
+	if len(received) != 2 {
+		t.Fatal("expected expiry events for 2 contracts, got", len(received))
+	}
+	for id, n := range received {
+		if n != 1 {
+			t.Errorf("expected 1 expiry event for contract %v, got %v", id, n)
+		}
+	}
+}
+
+// TestExpiryRevisedWindow checks that a contract is announced as expiring
+// again after a revision moves its proof window, but not after a revision
+// that leaves the window unchanged.
+func TestExpiryRevisedWindow(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestExpiryRevisedWindow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	co := testObligation(0)
+	co.OriginTransaction.FileContracts[0].WindowStart = h.blockHeight + 5
+	co.ExpiryNotified = true
+	h.obligationsByID[co.ID] = co
+	revise := func(windowStart types.BlockHeight) {
+		h.reviseObligation(types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:              co.ID,
+				NewWindowStart:        windowStart,
+				NewValidProofOutputs:  []types.SiacoinOutput{{}, {}},
+				NewMissedProofOutputs: []types.SiacoinOutput{{}, {}},
+			}},
+		})
+	}
+
+	revise(co.windowStart())
+	if !co.ExpiryNotified {
+		t.Fatal("revision that kept the window reset the expiry notification")
+	}
+	revise(co.windowStart() + 10)
+	if co.ExpiryNotified {
+		t.Fatal("revision that moved the window did not reset the expiry notification")
+	}
+}
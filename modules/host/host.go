@@ -4,8 +4,10 @@ package host
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -18,6 +20,12 @@ const (
 	maxContractLen      = 1 << 16   // The maximum allowed size of a file contract coming in over the wire. This does not include the file.
 	defaultTotalStorage = 10e9      // 10 GB.
 	defaultMaxDuration  = 144 * 120 // 120 days.
+
+	// defaultMinRevisionSize and defaultMaxRevisionRate are loose enough that
+	// they will never be reached by the renter, which uploads pieces of at
+	// least 64 KiB.
+	defaultMinRevisionSize = 1 << 12 // 4 KiB.
+	defaultMaxRevisionRate = 1000    // Revisions per minute, per contract.
 )
 
 var (
@@ -31,6 +39,11 @@ var (
 	// the negotiation protocols have logic to deal with non-zero collateral.
 	defaultCollateral = types.NewCurrency64(0)
 
+	// defaultCollateralRatio defines the collateral that the host puts up by
+	// default, as a percentage of the revenue that the host expects from a
+	// file contract. Set to zero so that defaultCollateral is used.
+	defaultCollateralRatio = uint64(0)
+
 	// defaultWindowSize is the size of the proof of storage window requested
 	// by the host. The host will not delete any obligations until the window
 	// has closed and buried under several confirmations.
@@ -47,6 +60,88 @@ var (
 		panic("unrecognized release constant in host")
 	}()
 
+	// defaultAnnounceWindow is the number of blocks after an announcement
+	// during which the host will not announce the same address again unless
+	// forced to.
+	defaultAnnounceWindow = func() types.BlockHeight {
+		if build.Release == "testing" {
+			return 10
+		}
+		if build.Release == "standard" {
+			return 1008 // 1 week.
+		}
+		if build.Release == "dev" {
+			return 36
+		}
+		panic("unrecognized release constant in host")
+	}()
+
+	// defaultAnnounceAttempts is the number of times the host tries to submit
+	// an announcement before giving up.
+	defaultAnnounceAttempts = 5
+
+	// defaultAnnounceBackoff is the time the host waits before retrying a
+	// rejected announcement. The wait doubles with each retry.
+	defaultAnnounceBackoff = func() time.Duration {
+		if build.Release == "testing" {
+			return time.Millisecond
+		}
+		if build.Release == "standard" {
+			return 30 * time.Second
+		}
+		if build.Release == "dev" {
+			return 5 * time.Second
+		}
+		panic("unrecognized release constant in host")
+	}()
+
+	// announceBaseFee is the miner fee paid by the first retry of a rejected
+	// announcement. The first attempt pays no fee, and the fee doubles with
+	// each further retry.
+	announceBaseFee = types.SiacoinPrecision
+
+	// windowSizeRatio is the smallest allowed ratio of MaxDuration to
+	// WindowSize. A proof window that covers most of the longest contract the
+	// host accepts leaves no time in which the host can collect on its
+	// storage proofs.
+	windowSizeRatio = types.BlockHeight(2)
+
+	// maxPriceTiers is the largest number of price tiers that a host may
+	// advertise. Renters limit the size of the settings that they will read
+	// from a host, and the settings must fit within that limit.
+	maxPriceTiers = 16
+
+	// errZeroMaxDuration and errZeroWindowSize are returned by SetSettings
+	// if the max duration or window size is zero.
+	errZeroMaxDuration = errors.New("max duration must be positive")
+	errZeroWindowSize  = errors.New("window size must be positive")
+
+	// errWindowTooLarge is returned by SetSettings if the window size is too
+	// large a fraction of the max duration.
+	errWindowTooLarge = fmt.Errorf("window size must be no more than 1/%v of the max duration", windowSizeRatio)
+
+	// errMinContractSize is returned by SetSettings if the minimum contract
+	// size is larger than the total storage of the host, in which case no
+	// contract could be accepted.
+	errMinContractSize = errors.New("minimum contract size cannot exceed the total storage of the host")
+
+	// errPriceTierOrder is returned by SetSettings if the price tiers are
+	// not ordered by strictly increasing duration.
+	errPriceTierOrder = errors.New("price tiers must be ordered by increasing duration")
+
+	// errTooManyPriceTiers is returned by SetSettings if the settings have
+	// more than maxPriceTiers price tiers.
+	errTooManyPriceTiers = fmt.Errorf("settings cannot have more than %v price tiers", maxPriceTiers)
+
+	// errPriceNotTier is returned by SetSettings if the price of the settings
+	// is not the price of any tier. Renters weigh hosts by their price, so it
+	// must be a price that the host actually charges.
+	errPriceNotTier = errors.New("price must be the price of one of the price tiers")
+
+	// errPriceTierCoverage is returned by SetSettings if the last price tier
+	// does not cover the max duration of the host.
+	errPriceTierCoverage = errors.New("price tiers must cover the max duration")
+
 	// errChangedUnlockHash is returned by SetSettings if the unlock hash has
 	// changed, an illegal operation.
 	errChangedUnlockHash = errors.New("cannot change the unlock hash in SetSettings")
@@ -87,21 +182,80 @@ type Host struct {
 	recentChange modules.ConsensusChangeID
 	actionItems  map[types.BlockHeight]map[types.FileContractID]*contractObligation
 
-	// Host Identity
-	netAddress modules.NetAddress
-	publicKey  types.SiaPublicKey
-	secretKey  crypto.SecretKey
-
-	// File Management.
-	obligationsByID map[types.FileContractID]*contractObligation
-
-	// Statistics
+	// Host Identity. 'announcedAddress' is the address of the most recent
+	// announcement, which was made at 'announcedHeight'. A rejected
+	// announcement is retried up to 'announceAttempts' times in total,
+	// waiting 'announceBackoff' before the first retry.
+	netAddress       modules.NetAddress
+	publicKey        types.SiaPublicKey
+	secretKey        crypto.SecretKey
+	announcedAddress modules.NetAddress
+	announcedHeight  types.BlockHeight
+	announceWindow   types.BlockHeight
+	announceAttempts int
+	announceBackoff  time.Duration
+
+	// File Management. 'sectors' tracks every sector on disk, along with the
+	// number of obligations that reference each sector. 'reservedStorage' is
+	// the space promised to accepted revisions whose data has not yet been
+	// stored. 'diskShortfall' is the amount by which the advertised storage
+	// has been lowered because the disks are running out of space, and
+	// 'freeSpace' reports the free space on the disk holding a folder.
+	// 'storageFolderPaths' lists the storage folders added in addition to the
+	// sector directory, and 'rebalance' reports the progress of moving
+	// sectors between them.
+	obligationsByID    map[types.FileContractID]*contractObligation
+	sectors            map[crypto.Hash]*sectorUsage
+	reservedStorage    int64
+	diskShortfall      int64
+	freeSpace          func(path string) (uint64, error)
+	storageFolderPaths []string
+	rebalance          modules.RebalanceStatus
+
+	// Statistics. 'revenueOutputs' holds the storage proof outputs that have
+	// not yet been swept by SweepRevenue.
 	anticipatedRevenue types.Currency
 	fileCounter        int64
 	lostRevenue        types.Currency
 	revenue            types.Currency
+	revenueOutputs     []revenueOutput
 	spaceRemaining     int64
 
+	// Bandwidth Accounting. 'bandwidth' holds the data transferred with each
+	// renter since 'bandwidthPeriodStart'. The ledger is cleared once
+	// 'bandwidthPeriod' blocks have passed, unless the period is zero.
+	// 'lastBandwidthSave' is the time at which a transfer last saved the
+	// host.
+	bandwidth            map[types.UnlockHash]modules.BandwidthUsage
+	bandwidthPeriod      types.BlockHeight
+	bandwidthPeriodStart types.BlockHeight
+	lastBandwidthSave    time.Time
+
+	// Expiry Notifications. Subscribers receive an event once the storage
+	// proof window of a contract is within 'expiryWarning' blocks.
+	expirySubscribers []chan ExpiryEvent
+	expiryWarning     types.BlockHeight
+
+	// Sector Verification. While 'verifySectors' is set, sectors are checked
+	// against their Merkle roots before they are served to renters.
+	verifySectors bool
+
+	// Maintenance. While 'maintenance' is set, the host refuses new contracts
+	// and uploads, but continues to serve downloads and submit storage
+	// proofs.
+	maintenance bool
+
+	// Diagnostics. 'rejections' holds the most recent contract negotiations
+	// that were rejected by the host, and 'lastRejectionSave' is the time at
+	// which a rejection last caused the host to be saved. 'proofs' holds the
+	// most recent storage proof attempts. 'proofsSucceeded' and
+	// 'proofsFailed' count every storage proof attempt made by the host.
+	rejections        []modules.RejectionEvent
+	lastRejectionSave time.Time
+	proofs            []modules.ProofEvent
+	proofsSucceeded   uint64
+	proofsFailed      uint64
+
 	// The resource lock is held by threaded functions for the duration of
 	// their operation. Functions should grab the resource lock as a read lock
 	// unless they are planning on manipulating the 'closed' variable.
@@ -111,12 +265,17 @@ type Host struct {
 	closed       bool
 	resourceLock sync.RWMutex
 
-	// Utilities.
-	listener   net.Listener
-	log        *persist.Logger
-	mu         sync.RWMutex
-	persistDir string
-	settings   modules.HostSettings
+	// Utilities. 'pricePolicy' adjusts the price in 'settings' at each block,
+	// and 'renterPolicy' decides which renters the host forms contracts with.
+	// 'clock' is consulted for all time-based decisions.
+	clock        clock
+	listener     net.Listener
+	log          *persist.Logger
+	mu           sync.RWMutex
+	persistDir   string
+	pricePolicy  PricePolicy
+	renterPolicy RenterPolicy
+	settings     modules.HostSettings
 }
 
 // New returns an initialized Host.
@@ -141,8 +300,20 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 		actionItems: make(map[types.BlockHeight]map[types.FileContractID]*contractObligation),
 
 		obligationsByID: make(map[types.FileContractID]*contractObligation),
+		sectors:         make(map[crypto.Hash]*sectorUsage),
+		freeSpace:       diskFreeSpace,
+
+		announceWindow:   defaultAnnounceWindow,
+		announceAttempts: defaultAnnounceAttempts,
+		announceBackoff:  defaultAnnounceBackoff,
 
-		persistDir: persistDir,
+		bandwidth: make(map[types.UnlockHash]modules.BandwidthUsage),
+
+		expiryWarning: defaultExpiryWarning,
+
+		clock:        stdClock{},
+		persistDir:   persistDir,
+		renterPolicy: acceptAllPolicy{},
 	}
 
 	// Load all of the saved host state into the host.
@@ -157,6 +328,11 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 		return nil, err
 	}
 
+	// Make sure that the disk can hold the advertised storage, and keep
+	// checking as the disk fills.
+	h.managedCheckDiskSpace()
+	go h.threadedMonitorDiskSpace()
+
 	return h, nil
 }
 
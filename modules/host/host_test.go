@@ -3,6 +3,7 @@ package host
 import (
 	"errors"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -72,7 +73,7 @@ func (ht *hostTester) initRenting() error {
 	}
 
 	// Announce the host.
-	err := ht.host.Announce()
+	err := ht.host.Announce(false)
 	if err != nil {
 		return err
 	}
@@ -331,6 +332,126 @@ func TestSetUnlockHash(t *testing.T) {
 	}
 }
 
+// TestSetSettingsWindowSize checks that SetSettings rejects window sizes that
+// are too large relative to the max duration.
+func TestSetSettingsWindowSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestSetSettingsWindowSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := ht.host.Settings()
+	settings.MaxDuration = 100
+	settings.WindowSize = 150
+	err = ht.host.SetSettings(settings)
+	if err != errWindowTooLarge {
+		t.Error("expected errWindowTooLarge, got", err)
+	}
+	settings.WindowSize = 0
+	err = ht.host.SetSettings(settings)
+	if err != errZeroWindowSize {
+		t.Error("expected errZeroWindowSize, got", err)
+	}
+	settings.MaxDuration = 0
+	settings.WindowSize = 10
+	err = ht.host.SetSettings(settings)
+	if err != errZeroMaxDuration {
+		t.Error("expected errZeroMaxDuration, got", err)
+	}
+	if ht.host.Settings().MaxDuration != defaultMaxDuration {
+		t.Error("rejected settings were applied")
+	}
+
+	// A balanced window size and max duration should be accepted.
+	settings.MaxDuration = 100
+	settings.WindowSize = 20
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUpdateSettings checks that concurrent calls to UpdateSettings altering
+// different fields do not overwrite each other, and that invalid updates are
+// rejected.
+func TestUpdateSettings(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestUpdateSettings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ht.host.Settings()
+
+	// Increment two fields from many goroutines at once.
+	const updates = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*updates)
+	for i := 0; i < updates; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- ht.host.UpdateSettings(func(s *modules.HostSettings) error {
+				s.TotalStorage++
+				return nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- ht.host.UpdateSettings(func(s *modules.HostSettings) error {
+				s.MaxRevisionRate++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := ht.host.Settings()
+	if after.TotalStorage != before.TotalStorage+updates {
+		t.Errorf("expected total storage of %v, got %v", before.TotalStorage+updates, after.TotalStorage)
+	}
+	if after.MaxRevisionRate != before.MaxRevisionRate+updates {
+		t.Errorf("expected max revision rate of %v, got %v", before.MaxRevisionRate+updates, after.MaxRevisionRate)
+	}
+
+	// Changes to the unlock hash, invalid settings, and updates that fail
+	// should all leave the settings unchanged.
+	err = ht.host.UpdateSettings(func(s *modules.HostSettings) error {
+		s.UnlockHash = types.UnlockHash{1}
+		return nil
+	})
+	if err != errChangedUnlockHash {
+		t.Error("expected errChangedUnlockHash, got", err)
+	}
+	err = ht.host.UpdateSettings(func(s *modules.HostSettings) error {
+		s.WindowSize = 0
+		return nil
+	})
+	if err != errZeroWindowSize {
+		t.Error("expected errZeroWindowSize, got", err)
+	}
+	errUpdate := errors.New("update failed")
+	err = ht.host.UpdateSettings(func(s *modules.HostSettings) error {
+		s.TotalStorage = 0
+		return errUpdate
+	})
+	if err != errUpdate {
+		t.Error("expected errUpdate, got", err)
+	}
+	if s := ht.host.Settings(); s.UnlockHash != after.UnlockHash || s.WindowSize != after.WindowSize || s.TotalStorage != after.TotalStorage {
+		t.Error("rejected updates were applied")
+	}
+}
+
 // TestPersistentSettings checks that settings persist between instances of the
 // host.
 func TestPersistentSettings(t *testing.T) {
@@ -380,3 +501,44 @@ func TestPersistentSettings(t *testing.T) {
 		t.Error("settings retrieval did not return updated value")
 	}
 }
+
+// TestPersistentCollateralRatio checks that a collateral ratio persists
+// between instances of the host, and that the collateral rate is derived from
+// it after a restart.
+func TestPersistentCollateralRatio(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestPersistentCollateralRatio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := ht.host.Settings()
+	settings.CollateralRatio = 150
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSettings := ht.host.Settings()
+	if newSettings.Collateral.Cmp(collateralRate(settings)) != 0 {
+		t.Error("collateral was not derived from the collateral ratio")
+	}
+
+	// Reboot the host and verify that the ratio stuck.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(ht.cs, ht.tpool, ht.wallet, ":0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootSettings := h.Settings()
+	if rebootSettings.CollateralRatio != settings.CollateralRatio {
+		t.Error("collateral ratio did not persist:", rebootSettings.CollateralRatio)
+	}
+	if rebootSettings.Collateral.Cmp(newSettings.Collateral) != 0 {
+		t.Error("collateral rate changed after a restart:", rebootSettings.Collateral)
+	}
+}
@@ -24,6 +24,47 @@ func (h *Host) Contracts() uint64 {
 	return uint64(len(h.obligationsByID))
 }
 
+// ContractsByRenter returns the unresolved file contracts whose renter output
+// pays to the provided unlock hash. An empty slice is returned if the host has
+// no contracts with the renter.
+func (h *Host) ContractsByRenter(uh types.UnlockHash) []modules.HostContractInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	contracts := []modules.HostContractInfo{}
+	for _, co := range h.obligationsByID {
+		if co.renterUnlockHash() != uh {
+			continue
+		}
+		contracts = append(contracts, modules.HostContractInfo{
+			ID:               co.ID,
+			FileSize:         co.fileSize(),
+			WindowStart:      co.windowStart(),
+			WindowEnd:        co.windowEnd(),
+			Value:            co.value(),
+			RenterUnlockHash: uh,
+		})
+	}
+	return contracts
+}
+
+// Metrics returns information about the storage usage of the host.
+func (h *Host) Metrics() modules.HostMetrics {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hm := modules.HostMetrics{
+		TotalStorage:     h.advertisedSettings().TotalStorage,
+		RemainingStorage: h.spaceRemaining,
+	}
+	for _, su := range h.sectors {
+		hm.LogicalStorage += su.Count * su.Size
+		hm.PhysicalStorage += su.Size
+	}
+	for _, co := range h.obligationsByID {
+		hm.Collateral = hm.Collateral.Add(co.Collateral)
+	}
+	return hm
+}
+
 // NetAddress returns the address at which the host can be reached.
 func (h *Host) NetAddress() modules.NetAddress {
 	h.mu.RLock()
@@ -53,6 +94,49 @@ func (h *Host) RPCMetrics() modules.HostRPCMetrics {
 	}
 }
 
+// checkWindowSize checks that the window size and max duration of settings are
+// positive, and that the proof window is a small enough fraction of the max
+// duration for the host to be able to collect on its storage proofs.
+func checkWindowSize(settings modules.HostSettings) error {
+	switch {
+	case settings.MaxDuration == 0:
+		return errZeroMaxDuration
+	case settings.WindowSize == 0:
+		return errZeroWindowSize
+	case settings.WindowSize > settings.MaxDuration/windowSizeRatio:
+		return errWindowTooLarge
+	}
+	return nil
+}
+
+// checkPriceTiers checks that the price tiers of the settings are few enough
+// to be advertised, that they are ordered by increasing duration, that they
+// cover every duration that the host accepts, and that the price of the
+// settings is one of the tier prices. Settings without tiers are always valid.
+func checkPriceTiers(settings modules.HostSettings) error {
+	tiers := settings.PriceTiers
+	if len(tiers) == 0 {
+		return nil
+	}
+	if len(tiers) > maxPriceTiers {
+		return errTooManyPriceTiers
+	}
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].MaxDuration <= tiers[i-1].MaxDuration {
+			return errPriceTierOrder
+		}
+	}
+	if tiers[len(tiers)-1].MaxDuration < settings.MaxDuration {
+		return errPriceTierCoverage
+	}
+	for _, tier := range tiers {
+		if tier.Price.Cmp(settings.Price) == 0 {
+			return nil
+		}
+	}
+	return errPriceNotTier
+}
+
 // SetSettings updates the host's internal HostSettings object.
 func (h *Host) SetSettings(settings modules.HostSettings) error {
 	h.mu.Lock()
@@ -62,16 +146,55 @@ func (h *Host) SetSettings(settings modules.HostSettings) error {
 	if h.closed {
 		return errHostClosed
 	}
+	return h.setSettings(settings)
+}
 
+// UpdateSettings applies fn to a copy of the host's settings, and then
+// validates and saves the result. The host is locked for the duration of the
+// call, so concurrent updates to different fields cannot overwrite each
+// other. If fn returns an error, the settings are left unchanged.
+func (h *Host) UpdateSettings(fn func(*modules.HostSettings) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	settings := h.settings
+	err := fn(&settings)
+	if err != nil {
+		return err
+	}
+	return h.setSettings(settings)
+}
+
+// setSettings validates settings and makes them the host's settings.
+func (h *Host) setSettings(settings modules.HostSettings) error {
 	// Check that the unlock hash was not changed.
 	if settings.UnlockHash != h.settings.UnlockHash {
 		return errChangedUnlockHash
 	}
+	err := checkWindowSize(settings)
+	if err != nil {
+		return err
+	}
+	err = checkPriceTiers(settings)
+	if err != nil {
+		return err
+	}
+	if settings.MinContractSize != 0 && (settings.TotalStorage < 0 || settings.MinContractSize > uint64(settings.TotalStorage)) {
+		return errMinContractSize
+	}
 
 	// Update the amount of space remaining to reflect the new volume of total
 	// storage.
 	h.spaceRemaining += settings.TotalStorage - h.settings.TotalStorage
 
+	// The collateral is derived from the price if a collateral ratio is set.
+	settings.Collateral = collateralRate(settings)
+
 	h.settings = settings
 	return h.save()
 }
@@ -0,0 +1,51 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errMaintenance is returned if a renter tries to form a contract or
+	// upload data while the host is in maintenance mode.
+	errMaintenance = errors.New("host is in maintenance mode and is not accepting new contracts or uploads")
+)
+
+// managedCheckMaintenance returns errMaintenance if the host is in
+// maintenance mode, recording the rejected negotiation.
+func (h *Host) managedCheckMaintenance() error {
+	h.mu.RLock()
+	maintenance := h.maintenance
+	h.mu.RUnlock()
+	if maintenance {
+		h.managedRecordRejection(modules.RejectionNotAccepting, errMaintenance)
+		return errMaintenance
+	}
+	return nil
+}
+
+// MaintenanceMode indicates whether the host is in maintenance mode.
+func (h *Host) MaintenanceMode() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.maintenance
+}
+
+// SetMaintenanceMode enables or disables maintenance mode. While in
+// maintenance mode, the host refuses new contracts, renewals, and uploads,
+// but continues to serve downloads and to submit storage proofs for its
+// existing contracts, so that no collateral is lost. The mode persists
+// across restarts.
+func (h *Host) SetMaintenanceMode(enabled bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.maintenance = enabled
+	return h.save()
+}
@@ -0,0 +1,114 @@
+package host
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestMaintenanceMode enables maintenance mode, and checks that new contracts
+// and uploads are refused while storage proofs are still submitted, and that
+// the mode persists across restarts.
+func TestMaintenanceMode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestMaintenanceMode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	h.settings.UnlockHash[0] = 1
+	h.mu.Unlock()
+
+	err = h.SetMaintenanceMode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New contracts should be refused.
+	renterConn, hostConn := net.Pipe()
+	err = h.managedRPCUpload(hostConn)
+	renterConn.Close()
+	hostConn.Close()
+	if err != errMaintenance {
+		t.Fatal("expected errMaintenance when forming a contract, got", err)
+	}
+	rejections := h.RecentRejections()
+	if len(rejections) != 1 || rejections[0].Reason != modules.RejectionNotAccepting {
+		t.Error("refused contract was not recorded:", rejections)
+	}
+
+	// Uploads to existing contracts should be refused.
+	co := testObligation(0)
+	renterConn, hostConn = net.Pipe()
+	go encoding.WriteObject(renterConn, co.ID)
+	err = h.managedRPCRevise(hostConn)
+	renterConn.Close()
+	hostConn.Close()
+	if err != errMaintenance {
+		t.Fatal("expected errMaintenance when revising a contract, got", err)
+	}
+
+	// A storage proof that is due should still be attempted.
+	data, err := crypto.RandBytes(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Lock()
+	co.OriginConfirmed = true
+	co.OriginTransaction.FileContracts[0].WindowStart = h.blockHeight
+	co.OriginTransaction.FileContracts[0].WindowEnd = h.blockHeight + 10
+	h.addObligation(co)
+	err = h.addSector(root, data)
+	co.Sectors = append(co.Sectors, root)
+	h.handleActionItem(co)
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && len(h.ProofHistory()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	proofs := h.ProofHistory()
+	if len(proofs) != 1 || proofs[0].ContractID != co.ID {
+		t.Fatal("storage proof was not attempted in maintenance mode:", proofs)
+	}
+
+	// Restart the host and check that it is still in maintenance mode.
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootHost, err := New(ht.cs, ht.tpool, ht.wallet, ":0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rebootHost.MaintenanceMode() {
+		t.Fatal("maintenance mode did not persist across restarts")
+	}
+
+	// Disabling maintenance mode lifts the restriction.
+	err = rebootHost.SetMaintenanceMode(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterConn, hostConn = net.Pipe()
+	renterConn.Close()
+	err = rebootHost.managedRPCUpload(hostConn)
+	hostConn.Close()
+	if err == errMaintenance {
+		t.Error("host refused a contract after leaving maintenance mode")
+	}
+}
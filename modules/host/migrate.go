@@ -0,0 +1,119 @@
+package host
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// contractExportMetadata is the header of the contract sets written by
+	// ExportContracts.
+	contractExportMetadata = persist.Metadata{
+		Header:  "Sia Host Contracts",
+		Version: "0.5",
+	}
+
+	// errContractExists is returned when importing a contract that the host
+	// is already tracking.
+	errContractExists = errors.New("host is already tracking an imported contract")
+
+	// errHostKeyMismatch is returned when importing contracts that were
+	// signed with a different key than the key of a host that already has
+	// contracts of its own.
+	errHostKeyMismatch = errors.New("imported contracts use a different host key than the existing contracts of the host")
+)
+
+// contractExport is the set of contracts written by ExportContracts. The host
+// keys are included because renters expect revisions to the contracts to be
+// signed by the key that the contracts were formed with.
+type contractExport struct {
+	PublicKey   types.SiaPublicKey
+	SecretKey   crypto.SecretKey
+	Obligations []*contractObligation
+}
+
+// ExportContracts writes every contract obligation of the host, along with the
+// host keys, to w. Together with the host's sectors, the export allows the
+// contracts to be imported into a host on a different machine.
+func (h *Host) ExportContracts(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return persist.Save(contractExportMetadata, contractExport{
+		PublicKey:   h.publicKey,
+		SecretKey:   h.secretKey,
+		Obligations: h.getObligations(),
+	}, w)
+}
+
+// ImportContracts reads a set of contracts written by ExportContracts and adds
+// them to the host. The sectors of the contracts must already be in one of the
+// host's storage folders, otherwise an error is returned. No contracts are
+// imported if any of them is already being tracked by the host.
+//
+// The host adopts the exported keys if it has no contracts of its own. Renters
+// verify the host's settings against the announced key, so a host that has
+// announced is re-announced at the same address with the adopted key.
+func (h *Host) ImportContracts(r io.Reader) error {
+	var export contractExport
+	err := persist.Load(contractExportMetadata, &export, r)
+	if err != nil {
+		return err
+	}
+
+	addr, err := h.managedImportContracts(export)
+	if err != nil || addr == "" {
+		return err
+	}
+	err = h.AnnounceAddress(addr, true)
+	if err != nil {
+		return errors.New("contracts were imported, but the adopted host key could not be announced: " + err.Error())
+	}
+	return nil
+}
+
+// managedImportContracts adds the contracts of an export to the host. If the
+// host adopts the exported keys, the address of its last announcement is
+// returned so that the new key can be announced. The announcement record is
+// cleared, so that the announce rate limit does not apply to the new key.
+func (h *Host) managedImportContracts(export contractExport) (modules.NetAddress, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return "", errHostClosed
+	}
+
+	for _, co := range export.Obligations {
+		if _, exists := h.obligationsByID[co.ID]; exists {
+			return "", errContractExists
+		}
+		for _, root := range co.Sectors {
+			_, err := h.findSector(root)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	var reannounce modules.NetAddress
+	samePK := h.publicKey.Algorithm == export.PublicKey.Algorithm && bytes.Equal(h.publicKey.Key, export.PublicKey.Key)
+	if !samePK && len(h.obligationsByID) != 0 {
+		return "", errHostKeyMismatch
+	} else if !samePK {
+		h.publicKey = export.PublicKey
+		h.secretKey = export.SecretKey
+		reannounce = h.announcedAddress
+		h.announcedAddress = ""
+		h.announcedHeight = 0
+	}
+
+	h.loadObligations(export.Obligations)
+	h.log.Printf("INFO: imported %v contracts", len(export.Obligations))
+	return reannounce, h.save()
+}
@@ -0,0 +1,122 @@
+package host
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestExportImportContracts exports the contracts of one host and imports
+// them into a fresh host, checking that the imported contracts are tracked and
+// that their storage proofs are still scheduled.
+func TestExportImportContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	oldHT, err := blankHostTester("TestExportImportContracts - old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHT, err := blankHostTester("TestExportImportContracts - new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHost, newHost := oldHT.host, newHT.host
+
+	// Give the old host a contract whose proof window is open.
+	data, err := crypto.RandBytes(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := testObligation(1)
+	oldHost.mu.Lock()
+	co.OriginConfirmed = true
+	co.RevisionConfirmed = true
+	co.OriginTransaction.FileContracts[0].WindowStart = oldHost.blockHeight + 1
+	co.OriginTransaction.FileContracts[0].WindowEnd = oldHost.blockHeight + 10
+	oldHost.obligationsByID[co.ID] = co
+	err = oldHost.addSector(root, data)
+	co.Sectors = append(co.Sectors, root)
+	oldHost.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var export bytes.Buffer
+	err = oldHost.ExportContracts(&export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Importing without the sectors in place should fail.
+	err = newHost.ImportContracts(bytes.NewReader(export.Bytes()))
+	if err == nil {
+		t.Fatal("contracts were imported without their sectors")
+	}
+	if len(newHost.ProofHistory()) != 0 || newHost.Contracts() != 0 {
+		t.Fatal("failed import modified the host")
+	}
+
+	// Move the sectors to a storage folder of the new host, and open the
+	// proof window on the new host so that the imported contract needs a
+	// storage proof. The new host has announced, so adopting the exported keys
+	// should re-announce it despite the announce rate limit.
+	folder := filepath.Join(newHT.persistDir, "disk2")
+	err = newHost.AddStorageFolder(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(folder, root.String()), data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := modules.NetAddress("foo.com:1234")
+	newHost.mu.Lock()
+	newHost.blockHeight = co.windowStart()
+	newHost.announcedAddress = addr
+	newHost.announcedHeight = newHost.blockHeight - 1
+	newHost.mu.Unlock()
+	err = newHost.ImportContracts(bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newHost.Contracts() != 1 {
+		t.Fatal("contract was not imported")
+	}
+	newHost.mu.RLock()
+	samePK := bytes.Equal(newHost.publicKey.Key, oldHost.publicKey.Key)
+	_, scheduled := newHost.actionItems[newHost.blockHeight+resubmissionTimeout][co.ID]
+	reannounced := newHost.announcedAddress == addr && newHost.announcedHeight == newHost.blockHeight
+	newHost.mu.RUnlock()
+	if !samePK {
+		t.Error("host did not adopt the key of the exported contracts")
+	}
+	if !scheduled {
+		t.Error("imported contract was not scheduled for follow-up")
+	}
+	if !reannounced {
+		t.Error("host was not re-announced with the adopted key")
+	}
+	for i := 0; i < 50 && len(newHost.ProofHistory()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	proofs := newHost.ProofHistory()
+	if len(proofs) != 1 || proofs[0].ContractID != co.ID {
+		t.Fatal("storage proof was not attempted for the imported contract:", proofs)
+	}
+
+	// Importing the same contracts again should be refused.
+	err = newHost.ImportContracts(bytes.NewReader(export.Bytes()))
+	if err != errContractExists {
+		t.Fatal("expected errContractExists, got", err)
+	}
+}
@@ -1,6 +1,7 @@
 package host
 
 import (
+	"errors"
 	"net"
 	"sync/atomic"
 	"time"
@@ -11,6 +12,20 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// connectivityCheckTimeout is the amount of time that the connectivity
+	// check will wait for the host to respond.
+	connectivityCheckTimeout = 15 * time.Second
+)
+
+var (
+	// rpcConnectivityCheck is the specifier used by the host to request its
+	// own settings during a connectivity check. It is answered like
+	// RPCSettings, but is not counted in the RPC metrics, as the call does not
+	// come from a renter.
+	rpcConnectivityCheck = types.Specifier{'C', 'o', 'n', 'n', 'e', 'c', 't', 'i', 'v', 'i', 't', 'y'}
+)
+
 // initNetworking performs actions like port forwarding, and gets the host
 // established on the network.
 func (h *Host) initNetworking(address string) error {
@@ -75,10 +90,16 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	switch id {
 	case modules.RPCDownload:
 		atomic.AddUint64(&h.atomicDownloadCalls, 1)
-		err = h.managedRPCDownload(conn)
+		err = h.managedRPCDownload(conn, false)
+	case modules.RPCPaidDownload:
+		atomic.AddUint64(&h.atomicDownloadCalls, 1)
+		err = h.managedRPCDownload(conn, true)
 	case modules.RPCRenew:
 		atomic.AddUint64(&h.atomicRenewCalls, 1)
-		err = h.managedRPCRenew(conn)
+		err = h.managedRPCRenew(conn, false)
+	case modules.RPCRenewReadOnly:
+		atomic.AddUint64(&h.atomicRenewCalls, 1)
+		err = h.managedRPCRenew(conn, true)
 	case modules.RPCRevise:
 		atomic.AddUint64(&h.atomicReviseCalls, 1)
 		err = h.managedRPCRevise(conn)
@@ -88,6 +109,8 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	case modules.RPCUpload:
 		atomic.AddUint64(&h.atomicUploadCalls, 1)
 		err = h.managedRPCUpload(conn)
+	case rpcConnectivityCheck:
+		err = h.managedRPCSettings(conn)
 	default:
 		atomic.AddUint64(&h.atomicErroredCalls, 1)
 		h.log.Printf("WARN: incoming conn %v requested unknown RPC \"%v\"", conn.RemoteAddr(), id)
@@ -121,9 +144,56 @@ func (h *Host) threadedListen() {
 	}
 }
 
-// managedRPCSettings is an rpc that returns the host's settings.
+// ConnectivityCheck dials the host's advertised address and requests the
+// host's settings, returning an error if the host cannot be reached. The
+// request is not counted in the host's RPC metrics. A host that fails the
+// check is likely behind a firewall or a router that is not forwarding the
+// host's port.
+func (h *Host) ConnectivityCheck() error {
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+	return h.managedConnectivityCheck()
+}
+
+// managedConnectivityCheck performs the connectivity check without grabbing
+// the resource lock, which must be held by the caller.
+func (h *Host) managedConnectivityCheck() error {
+	h.mu.RLock()
+	addr := h.netAddress
+	h.mu.RUnlock()
+
+	conn, err := net.DialTimeout("tcp", string(addr), connectivityCheckTimeout)
+	if err != nil {
+		return errors.New("host is unreachable at " + string(addr) + ": " + err.Error())
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(connectivityCheckTimeout))
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, rpcConnectivityCheck)
+	if err != nil {
+		return errors.New("could not request settings from host at " + string(addr) + ": " + err.Error())
+	}
+	var settings modules.HostSettings
+	err = encoding.ReadObject(conn, &settings, maxContractLen)
+	if err != nil {
+		return errors.New("could not read settings from host at " + string(addr) + ": " + err.Error())
+	}
+	return nil
+}
+
+// managedRPCSettings is an rpc that returns the host's settings, signed by the
+// host so that renters can verify that the settings came from the host.
 func (h *Host) managedRPCSettings(conn net.Conn) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return encoding.WriteObject(conn, h.Settings())
+	ss, err := modules.SignHostSettings(h.advertisedSettings(), h.secretKey)
+	if err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, ss)
 }
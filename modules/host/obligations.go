@@ -3,6 +3,7 @@ package host
 import (
 	"os"
 	"sync"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -37,6 +38,24 @@ var (
 		}
 		panic("unrecognized release value")
 	}()
+
+	// obligationGracePeriod is the number of blocks past the end of the
+	// storage proof window that the host will wait before pruning an
+	// obligation that has not otherwise been removed. Once the window has
+	// closed, no storage proof can be submitted for the obligation, so the
+	// sectors held by the obligation are no longer needed.
+	obligationGracePeriod = func() types.BlockHeight {
+		if build.Release == "testing" {
+			return 5
+		}
+		if build.Release == "standard" {
+			return 144
+		}
+		if build.Release == "dev" {
+			return 20
+		}
+		panic("unrecognized release value")
+	}()
 )
 
 // A contractObligation tracks a file contract that the host is obligated to
@@ -53,9 +72,40 @@ type contractObligation struct {
 	RevisionConfirmed   bool                 // whether the most recent revision has been confirmed.
 	ProofConfirmed      bool                 // whether the storage proof has been confirmed.
 
-	// Where on disk the file is stored.
+	// The Merkle roots of the sectors that make up the file, in order. The
+	// sectors themselves are stored and reference counted by the host.
+	Sectors []crypto.Hash
+
+	// COMPATv0.5 - where on disk the file is stored for obligations that were
+	// created before the host began storing data as sectors.
 	Path string
 
+	// The collateral owed on the contract at the host's collateral rate at
+	// the time of the latest negotiation. Collateral is not yet added to
+	// file contracts, so it is tracked by the host but not held by the
+	// contract.
+	Collateral types.Currency
+
+	// Whether an expiry event has been sent for the current proof window of
+	// the contract.
+	ExpiryNotified bool
+
+	// The height at which the host formed the contract. Obligations that
+	// were formed before the height was recorded have a height of zero.
+	FormationHeight types.BlockHeight
+
+	// Read-only contracts are formed with RPCRenewReadOnly, and hold the
+	// data of the renewed contract. Their data is never revised, but
+	// downloads, including the revisions that pay for them, and storage
+	// proofs continue as usual.
+	ReadOnly bool
+
+	// Revision throttling. revisionCount is the number of revisions that have
+	// been attempted since revisionWindowStart. These fields are protected by
+	// 'mu' and are not persisted.
+	revisionWindowStart time.Time
+	revisionCount       uint64
+
 	// The mutex ensures that revisions are happening in serial. The actual
 	// data under the obligations is being protected by the host's mutex.
 	// Grabbing 'mu' is not sufficient to guarantee modification safety of the
@@ -63,6 +113,21 @@ type contractObligation struct {
 	mu sync.Mutex
 }
 
+// allowRevision counts a revision attempt against the obligation, returning
+// false if more than 'limit' revisions have been attempted in the past
+// minute. A limit of zero allows any number of revisions.
+func (co *contractObligation) allowRevision(limit uint64, now time.Time) bool {
+	if limit == 0 {
+		return true
+	}
+	if now.Sub(co.revisionWindowStart) >= time.Minute {
+		co.revisionWindowStart = now
+		co.revisionCount = 0
+	}
+	co.revisionCount++
+	return co.revisionCount <= limit
+}
+
 // fileSize returns the size of the file that is held by the contract
 // obligation.
 func (co *contractObligation) fileSize() uint64 {
@@ -126,6 +191,15 @@ func (co *contractObligation) reset() {
 	co.RevisionConfirmed = !co.hasRevision()
 }
 
+// renterUnlockHash returns the operating unlock hash of the renter's output
+// for a successful file contract in the obligation.
+func (co *contractObligation) renterUnlockHash() types.UnlockHash {
+	if co.hasRevision() {
+		return co.RevisionTransaction.FileContractRevisions[0].NewValidProofOutputs[0].UnlockHash
+	}
+	return co.OriginTransaction.FileContracts[0].ValidProofOutputs[0].UnlockHash
+}
+
 // revisionNumber returns the operating revision number of the obligation.
 func (co *contractObligation) revisionNumber() uint64 {
 	if co.hasRevision() {
@@ -188,6 +262,19 @@ func (co *contractObligation) windowStart() types.BlockHeight {
 	return co.OriginTransaction.FileContracts[0].WindowStart
 }
 
+// tierDuration returns the duration that selects the price tier of the
+// obligation. The tier is locked in when the contract is formed, so it is
+// chosen by the original duration of the contract rather than the duration
+// that remains. Obligations that predate the formation height fall back to the
+// remaining duration at 'height'.
+func (co *contractObligation) tierDuration(height types.BlockHeight) types.BlockHeight {
+	origStart := co.OriginTransaction.FileContracts[0].WindowStart
+	if co.FormationHeight == 0 || co.FormationHeight >= origStart {
+		return co.windowStart() - height
+	}
+	return origStart - co.FormationHeight
+}
+
 // windowEnd returns the first block in the storage proof window of the
 // contract obligation.
 func (co *contractObligation) windowEnd() types.BlockHeight {
@@ -217,15 +304,24 @@ func (h *Host) addObligation(co *contractObligation) {
 	}
 
 	// Add the obligation to the list of host obligations.
+	co.FormationHeight = h.blockHeight
 	h.obligationsByID[co.ID] = co
 
 	// The host needs to verify that the obligation transaction made it into
 	// the blockchain.
 	h.addActionItem(h.blockHeight+resubmissionTimeout, co)
 
+	// Add a reference to each sector that is already held by the obligation,
+	// which is the case when an existing contract is being renewed.
+	for _, root := range co.Sectors {
+		err := h.referenceSector(root)
+		if err != nil {
+			h.log.Println("ERROR: failed to reference sector of new obligation:", err)
+		}
+	}
+
 	// Update the statistics.
 	h.anticipatedRevenue = h.anticipatedRevenue.Add(co.value()) // Output at index 1 alone belongs to host.
-	h.spaceRemaining = h.spaceRemaining - int64(co.fileSize())
 
 	err := h.save()
 	if err != nil {
@@ -246,9 +342,8 @@ func (h *Host) reviseObligation(revisionTransaction types.Transaction) {
 		panic("cannot revise obligation - obligation not found")
 	}
 
-	// Update the host's statistics.
-	h.spaceRemaining += int64(obligation.fileSize())
-	h.spaceRemaining -= int64(revisionTransaction.FileContractRevisions[0].NewFileSize)
+	// Update the host's statistics. Storage is accounted for as sectors are
+	// added, not when the revision is applied.
 	h.anticipatedRevenue = h.anticipatedRevenue.Sub(obligation.value())
 	h.anticipatedRevenue = h.anticipatedRevenue.Add(revisionTransaction.FileContractRevisions[0].NewValidProofOutputs[1].Value)
 
@@ -256,9 +351,18 @@ func (h *Host) reviseObligation(revisionTransaction types.Transaction) {
 	// blockchain.
 	h.addActionItem(h.blockHeight+resubmissionTimeout, obligation)
 
-	// Add the revision to the obligation
+	// A revision that moves the proof window is announced as expiring again
+	// once the new window approaches.
+	rev := revisionTransaction.FileContractRevisions[0]
+	if rev.NewWindowStart != obligation.windowStart() {
+		obligation.ExpiryNotified = false
+	}
+
+	// Add the revision to the obligation, recording the collateral owed for
+	// the revised file size.
 	obligation.RevisionTransaction = revisionTransaction
 	obligation.RevisionConfirmed = false
+	obligation.Collateral = h.contractCollateral(rev.NewFileSize, rev.NewWindowStart)
 
 	err := h.save()
 	if err != nil {
@@ -266,40 +370,39 @@ func (h *Host) reviseObligation(revisionTransaction types.Transaction) {
 	}
 }
 
-// removeObligation removes a file contract obligation and the corresponding
-// file, allowing that space to be reallocated to new file contracts.
-//
-// TODO: The error handling in this function is not very tolerant.
+// removeObligation removes a file contract obligation and releases its
+// sectors, allowing that space to be reallocated to new file contracts once no
+// other obligation references the sectors.
 func (h *Host) removeObligation(co *contractObligation, successful bool) {
-	// Get the size of the file that's about to be removed.
-	var size int64
-	stat, err := os.Stat(co.Path)
-	if err != nil {
-		h.log.Println("ERROR: failed to remove obligation due to stat error:", err)
-	} else {
-		size = stat.Size()
+	// Release each of the sectors held by the obligation.
+	for _, root := range co.Sectors {
+		err := h.removeSector(root)
+		if err != nil {
+			h.log.Println("ERROR: failed to remove sector of obligation:", err)
+		}
 	}
 
-	// Remove the file and reallocate the space. If any of the operations fail,
-	// none of the space will be re-added.
-	err = os.Remove(co.Path)
-	if err != nil {
-		h.log.Println("ERROR: failed to remove obligation:", err)
-	} else {
-		h.spaceRemaining += size
+	// COMPATv0.5 - remove the file of an obligation that was never migrated
+	// to sectors. The space of unmigrated files is not tracked.
+	if co.Path != "" {
+		err := os.Remove(co.Path)
+		if err != nil {
+			h.log.Println("ERROR: failed to remove obligation file:", err)
+		}
 	}
 
 	// Update host statistics.
 	h.anticipatedRevenue = h.anticipatedRevenue.Sub(co.value())
 	if successful {
 		h.revenue = h.revenue.Add(co.value())
+		h.addRevenueOutput(co)
 	} else {
 		h.lostRevenue = h.lostRevenue.Add(co.value())
 	}
 
 	// Remove the obligation from memory.
 	delete(h.obligationsByID, co.ID)
-	err = h.save()
+	err := h.save()
 	if err != nil {
 		h.log.Println("ERROR: failed to save host:", err)
 	}
@@ -400,7 +503,7 @@ func (h *Host) handleActionItem(co *contractObligation) {
 		// The storage proof for the contract has not made it onto the
 		// blockchain, recreate the storage proof and submit it to the
 		// blockchain.
-		go h.threadedCreateStorageProof(co)
+		go h.threadedCreateStorageProof(co, append([]crypto.Hash(nil), co.Sectors...))
 
 		// Add an action to check that the storage proof has been successful.
 		nextCheckup := h.blockHeight + resubmissionTimeout
@@ -424,3 +527,23 @@ func (h *Host) handleActionItem(co *contractObligation) {
 		panic("logic error - unreachable code has been hit")
 	}
 }
+
+// pruneExpiredObligations removes every obligation whose storage proof window
+// closed more than 'obligationGracePeriod' blocks ago, freeing the sectors held
+// by the obligations. Obligations are normally removed by handleActionItem,
+// but obligations whose action items were lost would otherwise linger
+// forever.
+func (h *Host) pruneExpiredObligations() {
+	for _, co := range h.obligationsByID {
+		if co.windowEnd()+obligationGracePeriod >= h.blockHeight {
+			continue
+		}
+		// Sanity check - a storage proof cannot be needed after the window
+		// has closed.
+		if build.DEBUG && co.windowEnd() >= h.blockHeight {
+			panic("pruning an obligation that may still need a storage proof")
+		}
+		h.log.Printf("WARN: pruning expired obligation %v", co.ID)
+		h.removeObligation(co, co.proofConfirmed())
+	}
+}
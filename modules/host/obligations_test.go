@@ -0,0 +1,150 @@
+package host
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPruneExpiredObligations checks that obligations are pruned once the
+// storage proof window has closed and the grace period has passed, and that
+// the storage of pruned obligations is reclaimed.
+func TestPruneExpiredObligations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestPruneExpiredObligations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	baselineSpace := h.spaceRemaining
+
+	// Create two obligations holding different sectors, the first of which
+	// has a window that ends much sooner than the second.
+	var roots []crypto.Hash
+	var obligations []*contractObligation
+	for i := 0; i < 2; i++ {
+		data, err := crypto.RandBytes(2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		co := testObligation(byte(i))
+		co.OriginTransaction.FileContracts[0].WindowStart = h.blockHeight + 10 + 100*types.BlockHeight(i)
+		co.OriginTransaction.FileContracts[0].WindowEnd = h.blockHeight + 20 + 100*types.BlockHeight(i)
+		h.addObligation(co)
+		err = h.addSector(root, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		co.Sectors = append(co.Sectors, root)
+		roots = append(roots, root)
+		obligations = append(obligations, co)
+	}
+
+	// Prune at the end of the first window, nothing should be removed.
+	h.blockHeight = obligations[0].windowEnd()
+	h.pruneExpiredObligations()
+	if len(h.obligationsByID) != 2 {
+		t.Fatal("obligation was pruned before the grace period passed")
+	}
+
+	// Prune after the grace period of the first window.
+	h.blockHeight = obligations[0].windowEnd() + obligationGracePeriod + 1
+	h.pruneExpiredObligations()
+	if len(h.obligationsByID) != 1 {
+		t.Fatal("expired obligation was not pruned")
+	}
+	if _, exists := h.obligationsByID[obligations[1].ID]; !exists {
+		t.Fatal("the wrong obligation was pruned")
+	}
+	for _, co := range h.getObligations() {
+		if co.ID == obligations[0].ID {
+			t.Error("pruned obligation is still persisted")
+		}
+	}
+	_, err = os.Stat(h.sectorPath(roots[0]))
+	if !os.IsNotExist(err) {
+		t.Error("sector of pruned obligation was not removed")
+	}
+	_, err = os.Stat(h.sectorPath(roots[1]))
+	if err != nil {
+		t.Error("sector of active obligation was removed:", err)
+	}
+	if h.spaceRemaining != baselineSpace-2048 {
+		t.Error("space of pruned obligation was not reclaimed")
+	}
+	h.mu.Unlock()
+	hm := h.Metrics()
+	h.mu.Lock()
+	if hm.PhysicalStorage != 2048 {
+		t.Error("metrics report the wrong storage after pruning:", hm.PhysicalStorage)
+	}
+}
+
+// TestContractsByRenter adds obligations from two different renters to the
+// host, and checks that ContractsByRenter only returns the obligations of the
+// requested renter.
+func TestContractsByRenter(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestContractsByRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Create obligations for two renters. The second obligation of renter A
+	// has been revised.
+	renterA := types.UnlockHash{1}
+	renterB := types.UnlockHash{2}
+	obA1 := testObligation(1)
+	obA1.OriginTransaction.FileContracts[0].ValidProofOutputs[0].UnlockHash = renterA
+	obA2 := testObligation(2)
+	obA2.OriginTransaction.FileContracts[0].ValidProofOutputs[0].UnlockHash = renterA
+	obA2.RevisionTransaction = types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			NewFileSize:           100,
+			NewValidProofOutputs:  []types.SiacoinOutput{{UnlockHash: renterA}, {}},
+			NewMissedProofOutputs: []types.SiacoinOutput{{}, {}},
+		}},
+	}
+	obB := testObligation(3)
+	obB.OriginTransaction.FileContracts[0].ValidProofOutputs[0].UnlockHash = renterB
+	h.mu.Lock()
+	for _, ob := range []*contractObligation{obA1, obA2, obB} {
+		h.obligationsByID[ob.ID] = ob
+	}
+	h.mu.Unlock()
+
+	contracts := h.ContractsByRenter(renterA)
+	if len(contracts) != 2 {
+		t.Fatal("expected 2 contracts for renter A, got", len(contracts))
+	}
+	for _, c := range contracts {
+		if c.ID != obA1.ID && c.ID != obA2.ID {
+			t.Error("wrong contract returned for renter A:", c.ID)
+		}
+		if c.ID == obA2.ID && c.FileSize != 100 {
+			t.Error("revised contract has wrong file size:", c.FileSize)
+		}
+	}
+	contracts = h.ContractsByRenter(renterB)
+	if len(contracts) != 1 || contracts[0].ID != obB.ID {
+		t.Fatal("wrong contracts returned for renter B:", contracts)
+	}
+	contracts = h.ContractsByRenter(types.UnlockHash{3})
+	if contracts == nil || len(contracts) != 0 {
+		t.Fatal("expected an empty slice for an unknown renter, got", contracts)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync/atomic"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
@@ -15,6 +16,16 @@ const (
 	// logFile establishes the name of the file that gets used for logging.
 	settingsFile = "settings.json"
 	logFile      = modules.HostDir + ".log"
+
+	// settingsVersion is the version of the persisted host settings. It is
+	// incremented whenever fields are added to modules.HostSettings, so that
+	// settings saved by older versions can be migrated when they are loaded.
+	//
+	// Settings saved without a version are version 0, and may be missing the
+	// WindowSize, MaxDuration, MinRevisionSize, and MaxRevisionRate fields.
+	// Settings saved before version 2 have no DownloadBandwidthPrice, which
+	// leaves downloads free, as they were.
+	settingsVersion = 2
 )
 
 // persistMetadata is the header that gets written to the persist file, and is
@@ -31,17 +42,38 @@ type persistence struct {
 	RecentChange modules.ConsensusChangeID
 
 	// Host Identity.
-	NetAddress modules.NetAddress
-	PublicKey  types.SiaPublicKey
-	SecretKey  crypto.SecretKey
+	NetAddress       modules.NetAddress
+	PublicKey        types.SiaPublicKey
+	SecretKey        crypto.SecretKey
+	AnnouncedAddress modules.NetAddress
+	AnnouncedHeight  types.BlockHeight
+	AnnounceAttempts int
+	AnnounceBackoff  time.Duration
 
 	// File Management.
-	Obligations []*contractObligation
+	Obligations    []*contractObligation
+	StorageFolders []string
+	VerifySectors  bool
 
 	// Statistics.
-	FileCounter int64
-	LostRevenue types.Currency
-	Revenue     types.Currency
+	FileCounter    int64
+	LostRevenue    types.Currency
+	Revenue        types.Currency
+	RevenueOutputs []revenueOutput
+
+	// Bandwidth Accounting.
+	Bandwidth            []modules.BandwidthUsage
+	BandwidthPeriod      types.BlockHeight
+	BandwidthPeriodStart types.BlockHeight
+
+	// Expiry Notifications.
+	ExpiryWarning types.BlockHeight
+
+	// Diagnostics.
+	Rejections      []modules.RejectionEvent
+	Proofs          []modules.ProofEvent
+	ProofsSucceeded uint64
+	ProofsFailed    uint64
 
 	// RPC Metrics.
 	ErroredCalls      uint64
@@ -53,7 +85,9 @@ type persistence struct {
 	UploadCalls       uint64
 
 	// Utilities.
-	Settings modules.HostSettings
+	Maintenance     bool
+	Settings        modules.HostSettings
+	SettingsVersion int
 }
 
 // getObligations returns a slice containing all of the contract obligations
@@ -74,17 +108,38 @@ func (h *Host) save() error {
 		RecentChange: h.recentChange,
 
 		// Host Identity.
-		NetAddress: h.netAddress,
-		PublicKey:  h.publicKey,
-		SecretKey:  h.secretKey,
+		NetAddress:       h.netAddress,
+		PublicKey:        h.publicKey,
+		SecretKey:        h.secretKey,
+		AnnouncedAddress: h.announcedAddress,
+		AnnouncedHeight:  h.announcedHeight,
+		AnnounceAttempts: h.announceAttempts,
+		AnnounceBackoff:  h.announceBackoff,
 
 		// File Management.
-		Obligations: h.getObligations(),
+		Obligations:    h.getObligations(),
+		StorageFolders: h.storageFolderPaths,
+		VerifySectors:  h.verifySectors,
 
 		// Statistics.
-		FileCounter: h.fileCounter,
-		LostRevenue: h.lostRevenue,
-		Revenue:     h.revenue,
+		FileCounter:    h.fileCounter,
+		LostRevenue:    h.lostRevenue,
+		Revenue:        h.revenue,
+		RevenueOutputs: h.revenueOutputs,
+
+		// Bandwidth Accounting.
+		Bandwidth:            h.bandwidthLedger(),
+		BandwidthPeriod:      h.bandwidthPeriod,
+		BandwidthPeriodStart: h.bandwidthPeriodStart,
+
+		// Expiry Notifications.
+		ExpiryWarning: h.expiryWarning,
+
+		// Diagnostics.
+		Rejections:      h.rejections,
+		Proofs:          h.proofs,
+		ProofsSucceeded: h.proofsSucceeded,
+		ProofsFailed:    h.proofsFailed,
 
 		// RPC Metrics.
 		ErroredCalls:      atomic.LoadUint64(&h.atomicErroredCalls),
@@ -96,7 +151,9 @@ func (h *Host) save() error {
 		UploadCalls:       atomic.LoadUint64(&h.atomicUploadCalls),
 
 		// Utilities.
-		Settings: h.settings,
+		Maintenance:     h.maintenance,
+		Settings:        h.settings,
+		SettingsVersion: settingsVersion,
 	}
 	return persist.SaveFile(persistMetadata, p, filepath.Join(h.persistDir, settingsFile))
 }
@@ -108,9 +165,22 @@ func (h *Host) loadObligations(cos []*contractObligation) {
 		// Store the obligation in the obligations list.
 		h.obligationsByID[co.ID] = co
 
-		// Update spaceRemaining to account for the storage held by this
-		// obligation.
-		h.spaceRemaining -= int64(co.fileSize())
+		// COMPATv0.5 - move the file of the obligation into sector storage.
+		if co.Path != "" {
+			err := h.migrateObligationFile(co)
+			if err != nil {
+				h.log.Println("ERROR: could not migrate obligation file to sectors:", err)
+			}
+		}
+
+		// Reference the sectors of the obligation. spaceRemaining is updated
+		// to account for each sector as it is first referenced.
+		for _, root := range co.Sectors {
+			err := h.referenceSector(root)
+			if err != nil {
+				h.log.Println("ERROR: could not load sector of obligation:", err)
+			}
+		}
 
 		// Update anticipated revenue to reflect the revenue in this file
 		// contract.
@@ -121,17 +191,44 @@ func (h *Host) loadObligations(cos []*contractObligation) {
 	}
 }
 
+// migrateSettings fills in the fields of settings that were saved by an older
+// version of the host. Fields that did not exist in the older version load as
+// zero values, which are replaced with the current defaults. Settings saved by
+// the current version are returned unchanged, as a zero value may have been
+// chosen deliberately.
+func migrateSettings(settings modules.HostSettings, version int) modules.HostSettings {
+	if version < 1 {
+		if settings.WindowSize == 0 {
+			settings.WindowSize = defaultWindowSize
+		}
+		if settings.MaxDuration == 0 {
+			settings.MaxDuration = defaultMaxDuration
+		}
+		if settings.MinRevisionSize == 0 {
+			settings.MinRevisionSize = defaultMinRevisionSize
+		}
+		if settings.MaxRevisionRate == 0 {
+			settings.MaxRevisionRate = defaultMaxRevisionRate
+		}
+	}
+	return settings
+}
+
 // establishDefaults configures the default settings for the host, overwriting
 // any existing settings.
 func (h *Host) establishDefaults() error {
 	// Configure the settings object.
 	h.settings = modules.HostSettings{
-		TotalStorage: defaultTotalStorage,
-		MaxDuration:  defaultMaxDuration,
-		WindowSize:   defaultWindowSize,
-		Price:        defaultPrice,
-		Collateral:   defaultCollateral,
+		TotalStorage:    defaultTotalStorage,
+		MaxDuration:     defaultMaxDuration,
+		WindowSize:      defaultWindowSize,
+		Price:           defaultPrice,
+		Collateral:      defaultCollateral,
+		CollateralRatio: defaultCollateralRatio,
+		MinRevisionSize: defaultMinRevisionSize,
+		MaxRevisionRate: defaultMaxRevisionRate,
 	}
+	h.settings.Collateral = collateralRate(h.settings)
 	h.spaceRemaining = h.settings.TotalStorage
 
 	// Generate signing key, for revising contracts.
@@ -176,17 +273,45 @@ func (h *Host) load() error {
 	h.netAddress = p.NetAddress
 	h.publicKey = p.PublicKey
 	h.secretKey = p.SecretKey
+	h.announcedAddress = p.AnnouncedAddress
+	h.announcedHeight = p.AnnouncedHeight
+	if p.AnnounceAttempts != 0 {
+		h.announceAttempts = p.AnnounceAttempts
+		h.announceBackoff = p.AnnounceBackoff
+	}
 
 	// Copy over the file management. The space remaining is recalculated from
 	// disk instead of being saved, to maximize the potential usefulness of
 	// restarting Sia as a means of eliminating unkonwn errors.
 	h.fileCounter = p.FileCounter
 	h.spaceRemaining = p.Settings.TotalStorage
+	h.storageFolderPaths = p.StorageFolders
+	h.verifySectors = p.VerifySectors
 	h.loadObligations(p.Obligations)
 
 	// Copy over statistics.
 	h.revenue = p.Revenue
 	h.lostRevenue = p.LostRevenue
+	h.revenueOutputs = p.RevenueOutputs
+
+	// Copy over bandwidth accounting.
+	for _, usage := range p.Bandwidth {
+		h.bandwidth[usage.Renter] = usage
+	}
+	h.bandwidthPeriod = p.BandwidthPeriod
+	h.bandwidthPeriodStart = p.BandwidthPeriodStart
+
+	// Copy over expiry notifications. Hosts saved before the warning was
+	// configurable keep the default.
+	if p.ExpiryWarning != 0 {
+		h.expiryWarning = p.ExpiryWarning
+	}
+
+	// Copy over diagnostics.
+	h.rejections = p.Rejections
+	h.proofs = p.Proofs
+	h.proofsSucceeded = p.ProofsSucceeded
+	h.proofsFailed = p.ProofsFailed
 
 	// Copy over rpc tracking.
 	atomic.StoreUint64(&h.atomicErroredCalls, p.ErroredCalls)
@@ -197,8 +322,11 @@ func (h *Host) load() error {
 	atomic.StoreUint64(&h.atomicSettingsCalls, p.SettingsCalls)
 	atomic.StoreUint64(&h.atomicUploadCalls, p.UploadCalls)
 
-	// Utilities.
-	h.settings = p.Settings
+	// Utilities. Settings from older versions are migrated, and the
+	// collateral rate is derived from the collateral ratio, if one is set.
+	h.settings = migrateSettings(p.Settings, p.SettingsVersion)
+	h.settings.Collateral = collateralRate(h.settings)
+	h.maintenance = p.Maintenance
 
 	// Subscribe to the consensus set.
 	err = h.initConsensusSubscription()
@@ -217,6 +345,10 @@ func (h *Host) initPersist() error {
 	if err != nil {
 		return err
 	}
+	err = os.MkdirAll(filepath.Join(h.persistDir, sectorDir), 0700)
+	if err != nil {
+		return err
+	}
 
 	// Initialize the logger. Logger must be initialized first, because the
 	// rest of the initialization makes use of the logger.
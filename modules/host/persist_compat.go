@@ -1,7 +1,6 @@
 package host
 
 import (
-	"os"
 	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -59,7 +58,6 @@ func (h *Host) loadCompat04Obligations(c04os []compat04Obligation) []*contractOb
 		// reveal which obligations have transactions on the blockchain, all
 		// other obligations will be discarded.
 		h.obligationsByID[co.ID] = co
-		h.spaceRemaining -= int64(co.fileSize())
 		h.anticipatedRevenue = h.anticipatedRevenue.Add(co.value())
 		cos = append(cos, co)
 	}
@@ -91,7 +89,8 @@ func (h *Host) compatibilityLoad() error {
 	h.revenue = c04h.Profit
 
 	// Copy over utilities.
-	h.settings = c04h.HostSettings
+	h.settings = migrateSettings(c04h.HostSettings, 0)
+	h.settings.Collateral = collateralRate(h.settings)
 
 	// Subscribe to the consensus set.
 	if build.DEBUG && h.recentChange != (modules.ConsensusChangeID{}) {
@@ -116,23 +115,24 @@ func (h *Host) compatibilityLoad() error {
 			h.removeObligation(uo, obligationFailed)
 			continue
 		}
-		// Check that the file Merkle root matches the Merkle root found in the
-		// blockchain.
-		file, err := os.Open(uo.Path)
+		// Move the file into sector storage. The Merkle root of the sector
+		// is the Merkle root of the file, and must match the Merkle root found
+		// in the blockchain.
+		err := h.migrateObligationFile(uo)
 		if err != nil {
-			h.log.Println("Compatibility contract file could not be opened.")
+			h.log.Println("Compatibility contract file could not be migrated:", err)
 			h.removeObligation(uo, obligationFailed)
 			continue
 		}
-		merkleRoot, err := crypto.ReaderMerkleRoot(file)
-		file.Close() // Close the file after use, to prevent buildup if the loop iterates many times.
-		if err != nil {
-			h.log.Println("Compatibility contract file could not be checksummed")
+		if len(uo.Sectors) != 1 || uo.Sectors[0] != uo.merkleRoot() {
+			h.log.Println("Compatibility contract file has the wrong merkle root")
 			h.removeObligation(uo, obligationFailed)
 			continue
 		}
-		if merkleRoot != uo.merkleRoot() {
-			h.log.Println("Compatibility contract file has the wrong merkle root")
+		err = h.referenceSector(uo.Sectors[0])
+		if err != nil {
+			h.log.Println("Compatibility contract sector could not be loaded:", err)
+			uo.Sectors = nil
 			h.removeObligation(uo, obligationFailed)
 			continue
 		}
@@ -1,7 +1,10 @@
 package host
 
 import (
+	"io"
+	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/modules"
@@ -12,7 +15,7 @@ import (
 // buildCompat04Host creates a compatibility persist file for the host, but
 // does not save it. When the host closes, it saves, which means the
 // compatibility struct must be created before closing but saved after closing.
-func (ht *hostTester) buildCompat04Host() compat04Host {
+func (ht *hostTester) buildCompat04Host() (compat04Host, error) {
 	c04h := compat04Host{
 		SpaceRemaining: ht.host.spaceRemaining,
 		FileCounter:    int(ht.host.fileCounter),
@@ -22,14 +25,32 @@ func (ht *hostTester) buildCompat04Host() compat04Host {
 		PublicKey:      ht.host.publicKey,
 	}
 	for _, obligation := range ht.host.obligationsByID {
+		// 0.4.x hosts stored each obligation as a single file, build that
+		// file out of the sectors of the obligation.
+		ht.host.fileCounter++
+		path := filepath.Join(ht.host.persistDir, strconv.Itoa(int(ht.host.fileCounter)))
+		file, err := ht.host.managedOpenSectors(obligation.Sectors)
+		if err != nil {
+			return compat04Host{}, err
+		}
+		data, err := ioutil.ReadAll(io.NewSectionReader(file, 0, file.Size()))
+		file.Close()
+		if err != nil {
+			return compat04Host{}, err
+		}
+		err = ioutil.WriteFile(path, data, 0600)
+		if err != nil {
+			return compat04Host{}, err
+		}
+
 		compatObligation := compat04Obligation{
 			ID:           obligation.ID,
 			FileContract: obligation.OriginTransaction.FileContracts[0],
-			Path:         obligation.Path,
+			Path:         path,
 		}
 		c04h.Obligations = append(c04h.Obligations, compatObligation)
 	}
-	return c04h
+	return c04h, nil
 }
 
 // TestPersistCompat04 checks that the compatibility loader for version 0.4.x
@@ -55,7 +76,7 @@ func TestPersistCompat04(t *testing.T) {
 	}
 	// Get a compatibility file to save after closing the host.
 	ht.host.mu.Lock()
-	c04h := ht.buildCompat04Host()
+	c04h, err := ht.buildCompat04Host()
 	ht.host.mu.Unlock()
 	if err != nil {
 		t.Fatal(err)
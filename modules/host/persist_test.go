@@ -6,6 +6,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -124,3 +125,74 @@ func TestUnitGetObligations(t *testing.T) {
 		t.Fatal("ob2 not represented in fetched obligations")
 	}
 }
+
+// TestSettingsMigration loads settings saved by an older version of the host
+// and checks that the fields missing from the old settings are given default
+// values instead of zero values.
+func TestSettingsMigration(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestSettingsMigration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save a settings file that predates the settings version and the
+	// newer settings fields.
+	oldPrice := types.NewCurrency64(12345)
+	old := struct {
+		NetAddress modules.NetAddress
+		Settings   struct {
+			TotalStorage int64
+			Price        types.Currency
+		}
+	}{NetAddress: ht.host.netAddress}
+	old.Settings.TotalStorage = 1e6
+	old.Settings.Price = oldPrice
+	err = persist.SaveFile(persistMetadata, old, filepath.Join(ht.host.persistDir, settingsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the old settings. The saved fields should be kept, and the missing
+	// fields should be set to their defaults.
+	ht.host.mu.Lock()
+	err = ht.host.load()
+	settings := ht.host.settings
+	ht.host.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TotalStorage != 1e6 || settings.Price.Cmp(oldPrice) != 0 {
+		t.Error("saved settings were not loaded:", settings.TotalStorage, settings.Price)
+	}
+	if settings.WindowSize != defaultWindowSize {
+		t.Error("window size was not migrated:", settings.WindowSize)
+	}
+	if settings.MaxDuration != defaultMaxDuration {
+		t.Error("max duration was not migrated:", settings.MaxDuration)
+	}
+	if settings.MinRevisionSize != defaultMinRevisionSize || settings.MaxRevisionRate != defaultMaxRevisionRate {
+		t.Error("revision limits were not migrated:", settings.MinRevisionSize, settings.MaxRevisionRate)
+	}
+
+	// Settings saved by the current version are not migrated, so a zero value
+	// chosen by the host operator survives a reload.
+	ht.host.mu.Lock()
+	ht.host.settings.MinRevisionSize = 0
+	err = ht.host.save()
+	if err != nil {
+		ht.host.mu.Unlock()
+		t.Fatal(err)
+	}
+	err = ht.host.load()
+	settings = ht.host.settings
+	ht.host.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MinRevisionSize != 0 {
+		t.Error("current settings were migrated:", settings.MinRevisionSize)
+	}
+}
@@ -0,0 +1,171 @@
+package host
+
+import (
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// earningsWindow is the number of recent blocks whose contract
+	// formations are used to project the earnings of the host.
+	earningsWindow = func() types.BlockHeight {
+		if build.Release == "testing" {
+			return 10
+		}
+		if build.Release == "standard" {
+			return 1008 // 1 week.
+		}
+		if build.Release == "dev" {
+			return 72
+		}
+		panic("unrecognized release value")
+	}()
+)
+
+// A PriceMarket reports the average price of storage on the network. The
+// renter's hostdb is a PriceMarket.
+type PriceMarket interface {
+	AveragePrice() types.Currency
+}
+
+// A PricePolicy controls how the host sets its advertised price. A policy with
+// a MarketRatio of zero is static: the price set by SetSettings is advertised
+// unchanged. Otherwise, the price is recomputed at each block to be
+// MarketRatio percent of the network average reported by Market, but never
+// less than MinPrice.
+type PricePolicy struct {
+	MinPrice    types.Currency
+	MarketRatio uint64
+	Market      PriceMarket
+}
+
+// collateralRate returns the collateral per byte per block that the host asks
+// of itself for file contracts under the provided settings. If the
+// CollateralRatio is set, the rate is CollateralRatio percent of the price,
+// which makes the collateral of a file contract proportional to the revenue
+// that the host expects from it. Otherwise the Collateral of the settings is
+// used as is.
+func collateralRate(settings modules.HostSettings) types.Currency {
+	if settings.CollateralRatio == 0 {
+		return settings.Collateral
+	}
+	return settings.Price.Mul(types.NewCurrency64(settings.CollateralRatio)).Div(types.NewCurrency64(100))
+}
+
+// contractCollateral returns the collateral owed for a file contract holding
+// 'filesize' bytes until 'windowStart'. If the CollateralRatio is set, the
+// collateral is that percentage of the revenue of the contract, at the price
+// of the tier that covers its duration. Otherwise the flat Collateral rate is
+// used. The negotiation protocols do not yet add collateral to file
+// contracts, so the amount is only tracked by the host, and is not held by
+// the contract.
+func (h *Host) contractCollateral(filesize uint64, windowStart types.BlockHeight) types.Currency {
+	if windowStart <= h.blockHeight {
+		return types.ZeroCurrency
+	}
+	duration := windowStart - h.blockHeight
+	size := types.NewCurrency64(filesize).Mul(types.NewCurrency64(uint64(duration)))
+	if h.settings.CollateralRatio == 0 {
+		return h.settings.Collateral.Mul(size)
+	}
+	revenue := h.settings.PriceForDuration(duration).Mul(size)
+	return revenue.Mul(types.NewCurrency64(h.settings.CollateralRatio)).Div(types.NewCurrency64(100))
+}
+
+// managedCheckCollateral checks that the confirmed balance of the host's wallet
+// covers the collateral owed by the host's unresolved obligations once a
+// contract holds 'filesize' bytes until 'windowStart'. 'co' is the obligation
+// being revised, whose current collateral is replaced, or nil for a new
+// contract. The wallet is not consulted if no collateral is owed.
+func (h *Host) managedCheckCollateral(co *contractObligation, filesize uint64, windowStart types.BlockHeight) error {
+	h.mu.RLock()
+	owed := h.contractCollateral(filesize, windowStart)
+	for _, ob := range h.obligationsByID {
+		if ob != co {
+			owed = owed.Add(ob.Collateral)
+		}
+	}
+	h.mu.RUnlock()
+	if owed.IsZero() {
+		return nil
+	}
+	balance, _, _ := h.wallet.ConfirmedBalance()
+	if balance.Cmp(owed) < 0 {
+		return errInsufficientCollateral
+	}
+	return nil
+}
+
+// applyPricePolicy updates the advertised price of the host according to its
+// price policy. The price is left unchanged if the policy is static or if the
+// market has no price data.
+func (h *Host) applyPricePolicy() {
+	policy := h.pricePolicy
+	if policy.MarketRatio == 0 || policy.Market == nil {
+		return
+	}
+	average := policy.Market.AveragePrice()
+	if average.IsZero() {
+		return
+	}
+	price := average.Mul(types.NewCurrency64(policy.MarketRatio)).Div(types.NewCurrency64(100))
+	if price.Cmp(policy.MinPrice) < 0 {
+		price = policy.MinPrice
+	}
+	h.settings.Price = price
+	h.settings.Collateral = collateralRate(h.settings)
+}
+
+// SetPricePolicy sets the policy used to set the host's advertised price, and
+// applies it immediately. The policy is not persisted, and must be set again
+// each time the host is started.
+func (h *Host) SetPricePolicy(policy PricePolicy) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.pricePolicy = policy
+	h.applyPricePolicy()
+	return h.save()
+}
+
+// ProjectEarnings projects the revenue that the host would earn over the next
+// 'duration' blocks if it charged 'price' per byte per block. New data is
+// assumed to arrive at the rate of the contracts formed during the last
+// earningsWindow blocks, and to be stored until the end of the period, so the
+// data earns for half of the period on average. The data is capped at the
+// total storage of the host. The projection does not model how renters react
+// to a change in price, so it is proportional to the price.
+func (h *Host) ProjectEarnings(price types.Currency, duration types.BlockHeight) types.Currency {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// A host younger than the window projects from the blocks it has seen.
+	window := earningsWindow
+	if h.blockHeight < window {
+		window = h.blockHeight
+	}
+	if window == 0 || duration == 0 {
+		return types.ZeroCurrency
+	}
+
+	// Sum the data held by the contracts formed during the window.
+	var recent uint64
+	for _, co := range h.obligationsByID {
+		if co.FormationHeight <= h.blockHeight && h.blockHeight-co.FormationHeight < window {
+			recent += co.fileSize()
+		}
+	}
+
+	// Project the data that arrives during the period.
+	data := types.NewCurrency64(recent).Mul(types.NewCurrency64(uint64(duration))).Div(types.NewCurrency64(uint64(window)))
+	if capacity := types.NewCurrency64(uint64(h.settings.TotalStorage)); data.Cmp(capacity) > 0 {
+		data = capacity
+	}
+	return price.Mul(data).Mul(types.NewCurrency64(uint64(duration))).Div(types.NewCurrency64(2))
+}
@@ -0,0 +1,256 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestContractCollateral checks that the collateral owed by a contract is
+// proportional to the revenue that the host expects from the contract.
+func TestContractCollateral(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestContractCollateral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Without a ratio, the collateral rate is set directly.
+	settings := h.Settings()
+	settings.Collateral = types.NewCurrency64(7)
+	err = h.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Settings().Collateral.Cmp(types.NewCurrency64(7)) != 0 {
+		t.Fatal("collateral rate was not set directly:", h.Settings().Collateral)
+	}
+
+	// Put up collateral worth one and a half times the expected revenue.
+	settings.CollateralRatio = 150
+	err = h.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings = h.Settings()
+	if settings.Collateral.Cmp(settings.Price.Mul(types.NewCurrency64(3)).Div(types.NewCurrency64(2))) != 0 {
+		t.Fatal("collateral rate was not derived from the price:", settings.Collateral)
+	}
+
+	// Revise two contracts of the same duration to hold different amounts of
+	// data.
+	h.mu.Lock()
+	const duration = 40
+	sizes := []uint64{1 << 12, 1 << 13}
+	var obligations []*contractObligation
+	for i, size := range sizes {
+		co := testObligation(byte(i))
+		co.OriginTransaction.FileContracts[0].WindowStart = h.blockHeight + duration
+		co.OriginTransaction.FileContracts[0].WindowEnd = h.blockHeight + duration + 10
+		h.addObligation(co)
+		h.reviseObligation(types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:              co.ID,
+				NewRevisionNumber:     1,
+				NewFileSize:           size,
+				NewWindowStart:        co.windowStart(),
+				NewWindowEnd:          co.windowEnd(),
+				NewValidProofOutputs:  []types.SiacoinOutput{{}, {}},
+				NewMissedProofOutputs: []types.SiacoinOutput{{}, {}},
+			}},
+		})
+		obligations = append(obligations, co)
+	}
+	h.mu.Unlock()
+
+	for i, co := range obligations {
+		revenue := settings.Price.Mul(types.NewCurrency64(sizes[i])).Mul(types.NewCurrency64(duration))
+		expected := revenue.Mul(types.NewCurrency64(3)).Div(types.NewCurrency64(2))
+		if co.Collateral.Cmp(expected) != 0 {
+			t.Errorf("contract %v has collateral %v, expected %v", i, co.Collateral, expected)
+		}
+	}
+	if obligations[0].Collateral.Mul(types.NewCurrency64(2)).Cmp(obligations[1].Collateral) != 0 {
+		t.Error("collateral did not scale with the size of the contract")
+	}
+	total := obligations[0].Collateral.Add(obligations[1].Collateral)
+	if hm := h.Metrics(); hm.Collateral.Cmp(total) != 0 {
+		t.Error("metrics report the wrong collateral:", hm.Collateral, total)
+	}
+
+	// A contract is charged the price of the tier that covers its duration,
+	// so its collateral is derived from that price.
+	tierPrice := settings.Price.Mul(types.NewCurrency64(2))
+	h.mu.Lock()
+	h.settings.PriceTiers = []modules.PriceTier{
+		{MaxDuration: duration, Price: tierPrice},
+		{MaxDuration: h.settings.MaxDuration, Price: settings.Price},
+	}
+	collateral := h.contractCollateral(sizes[0], h.blockHeight+duration)
+	h.mu.Unlock()
+	revenue := tierPrice.Mul(types.NewCurrency64(sizes[0])).Mul(types.NewCurrency64(duration))
+	if expected := revenue.Mul(types.NewCurrency64(3)).Div(types.NewCurrency64(2)); collateral.Cmp(expected) != 0 {
+		t.Errorf("collateral was not derived from the tier price: got %v, expected %v", collateral, expected)
+	}
+}
+
+// TestInsufficientCollateral checks that the host refuses new contracts and
+// revisions once its wallet cannot cover the collateral owed by its
+// contracts.
+func TestInsufficientCollateral(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestInsufficientCollateral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	if err := h.managedCheckCollateral(nil, 0, 0); err != nil {
+		t.Fatal("contract was refused although no collateral is owed:", err)
+	}
+	co := testObligation(1)
+	balance, _, _ := ht.wallet.ConfirmedBalance()
+	co.Collateral = balance.Add(types.NewCurrency64(1))
+	h.mu.Lock()
+	h.obligationsByID[co.ID] = co
+	h.mu.Unlock()
+	if err := h.managedCheckCollateral(nil, 0, 0); err != errInsufficientCollateral {
+		t.Fatal("expected errInsufficientCollateral, got", err)
+	}
+
+	// A revision replaces the collateral owed by the contract being revised.
+	if err := h.managedCheckCollateral(co, 0, 0); err != nil {
+		t.Fatal("revision was refused although it owes no collateral:", err)
+	}
+	other := testObligation(2)
+	if err := h.managedCheckCollateral(other, 0, 0); err != errInsufficientCollateral {
+		t.Fatal("expected errInsufficientCollateral, got", err)
+	}
+}
+
+// testMarket is a PriceMarket that reports a fixed average price.
+type testMarket struct {
+	average types.Currency
+}
+
+// AveragePrice returns the fixed average price of the testMarket.
+func (m *testMarket) AveragePrice() types.Currency { return m.average }
+
+// TestPricePolicy checks that the advertised price of the host follows the
+// network average according to its price policy, without dropping below the
+// policy's floor.
+func TestPricePolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestPricePolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// A static policy leaves the price set by SetSettings untouched.
+	staticPrice := h.Settings().Price
+	market := &testMarket{average: types.NewCurrency64(1000)}
+	err = h.SetPricePolicy(PricePolicy{Market: market})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Settings().Price.Cmp(staticPrice) != 0 {
+		t.Fatal("static price policy changed the price")
+	}
+
+	// Price at 80% of the network average, with a floor of 500.
+	floor := types.NewCurrency64(500)
+	err = h.SetPricePolicy(PricePolicy{
+		MinPrice:    floor,
+		MarketRatio: 80,
+		Market:      market,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Settings().Price.Cmp(types.NewCurrency64(800)) != 0 {
+		t.Fatal("price does not track the network average:", h.Settings().Price)
+	}
+
+	// The price is recomputed when a block arrives.
+	market.average = types.NewCurrency64(2000)
+	_, err = ht.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Settings().Price.Cmp(types.NewCurrency64(1600)) != 0 {
+		t.Fatal("price was not updated after a block:", h.Settings().Price)
+	}
+
+	// The price does not drop below the floor.
+	market.average = types.NewCurrency64(100)
+	_, err = ht.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Settings().Price.Cmp(floor) != 0 {
+		t.Fatal("price dropped below the floor:", h.Settings().Price)
+	}
+}
+
+// TestProjectEarnings checks that the projected earnings of the host follow
+// the recent contract formations, scale with the price, and are capped by the
+// total storage of the host.
+func TestProjectEarnings(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestProjectEarnings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Form a contract holding 1000 bytes within the window, and one holding
+	// far more data before the window, which should be ignored.
+	h.mu.Lock()
+	h.blockHeight = 2 * earningsWindow
+	recent := testObligation(1)
+	recent.OriginTransaction.FileContracts[0].FileSize = 1000
+	h.addObligation(recent)
+	old := testObligation(2)
+	old.OriginTransaction.FileContracts[0].FileSize = 1 << 30
+	h.addObligation(old)
+	old.FormationHeight = h.blockHeight - earningsWindow
+	h.settings.TotalStorage = 1 << 40
+	h.mu.Unlock()
+
+	// Over two windows, 2000 bytes arrive, earning for one window on
+	// average.
+	price := types.NewCurrency64(5)
+	duration := 2 * earningsWindow
+	expected := price.Mul(types.NewCurrency64(2000)).Mul(types.NewCurrency64(uint64(earningsWindow)))
+	if projected := h.ProjectEarnings(price, duration); projected.Cmp(expected) != 0 {
+		t.Fatalf("expected projection of %v, got %v", expected, projected)
+	}
+
+	// The projection is proportional to the price.
+	doubled := h.ProjectEarnings(price.Mul(types.NewCurrency64(2)), duration)
+	if doubled.Cmp(expected.Mul(types.NewCurrency64(2))) != 0 {
+		t.Fatal("doubling the price did not double the projection:", doubled)
+	}
+	if !h.ProjectEarnings(types.ZeroCurrency, duration).IsZero() {
+		t.Fatal("expected no earnings at a price of zero")
+	}
+
+	// Projected data cannot exceed the total storage of the host.
+	h.mu.Lock()
+	h.settings.TotalStorage = 500
+	h.mu.Unlock()
+	expected = price.Mul(types.NewCurrency64(500)).Mul(types.NewCurrency64(uint64(earningsWindow)))
+	if projected := h.ProjectEarnings(price, duration); projected.Cmp(expected) != 0 {
+		t.Fatalf("expected capped projection of %v, got %v", expected, projected)
+	}
+}
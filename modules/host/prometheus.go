@@ -0,0 +1,81 @@
+package host
+
+// prometheus.go exports the metrics of the host in the Prometheus text
+// exposition format, so that the host can be scraped by a standard exporter.
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A metricSample is a single value of a metric, along with its labels in
+// exposition format, e.g. `{rpc="upload"}`.
+type metricSample struct {
+	labels string
+	value  string
+}
+
+// A metricFamily is a named metric along with its help text, type, and
+// samples.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string // "counter" or "gauge"
+	samples []metricSample
+}
+
+// metric returns a metricFamily holding a single unlabelled sample.
+func metric(name, help, kind, value string) metricFamily {
+	return metricFamily{name, help, kind, []metricSample{{"", value}}}
+}
+
+// MetricsText writes the metrics of the host to w in the Prometheus text
+// exposition format. Storage is reported in bytes, and currency in hastings.
+func (h *Host) MetricsText(w io.Writer) error {
+	hm := h.Metrics()
+	unresolved, resolved, lost := h.Revenue()
+	rpc := h.RPCMetrics()
+	h.mu.RLock()
+	contracts := uint64(len(h.obligationsByID))
+	succeeded, failed := h.proofsSucceeded, h.proofsFailed
+	h.mu.RUnlock()
+
+	u := func(n uint64) string { return strconv.FormatUint(n, 10) }
+	i := func(n int64) string { return strconv.FormatInt(n, 10) }
+	families := []metricFamily{
+		metric("sia_host_storage_total_bytes", "Storage advertised by the host.", "gauge", i(hm.TotalStorage)),
+		metric("sia_host_storage_remaining_bytes", "Storage that the host can still fill.", "gauge", i(hm.RemainingStorage)),
+		metric("sia_host_storage_logical_bytes", "Data stored under the contracts of the host, counting shared sectors once per contract.", "gauge", u(hm.LogicalStorage)),
+		metric("sia_host_storage_physical_bytes", "Data stored on disk by the host.", "gauge", u(hm.PhysicalStorage)),
+		metric("sia_host_contracts", "Unresolved file contracts of the host.", "gauge", u(contracts)),
+		metric("sia_host_collateral_hastings", "Collateral owed by unresolved file contracts at the host's collateral rate.", "gauge", hm.Collateral.String()),
+		metric("sia_host_revenue_unresolved_hastings", "Revenue expected from unresolved file contracts.", "gauge", unresolved.String()),
+		metric("sia_host_revenue_resolved_hastings", "Revenue collected from storage proofs.", "gauge", resolved.String()),
+		metric("sia_host_revenue_lost_hastings", "Revenue lost to missed storage proofs.", "gauge", lost.String()),
+		metric("sia_host_storage_proofs_succeeded_total", "Storage proofs submitted by the host.", "counter", u(succeeded)),
+		metric("sia_host_storage_proofs_failed_total", "Storage proofs that the host failed to submit.", "counter", u(failed)),
+		{"sia_host_rpc_calls_total", "RPC calls made to the host, by type.", "counter", []metricSample{
+			{`{rpc="download"}`, u(rpc.DownloadCalls)},
+			{`{rpc="renew"}`, u(rpc.RenewCalls)},
+			{`{rpc="revise"}`, u(rpc.ReviseCalls)},
+			{`{rpc="settings"}`, u(rpc.SettingsCalls)},
+			{`{rpc="upload"}`, u(rpc.UploadCalls)},
+			{`{rpc="unrecognized"}`, u(rpc.UnrecognizedCalls)},
+		}},
+		metric("sia_host_rpc_errors_total", "RPC calls to the host that returned an error.", "counter", u(rpc.ErrorCalls)),
+	}
+	for _, mf := range families {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", mf.name, mf.help, mf.name, mf.kind)
+		if err != nil {
+			return err
+		}
+		for _, s := range mf.samples {
+			_, err = fmt.Fprintf(w, "%s%s %s\n", mf.name, s.labels, s.value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
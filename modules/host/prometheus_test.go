@@ -0,0 +1,78 @@
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// sampleRegexp matches a sample line of the Prometheus text exposition
+// format.
+var sampleRegexp = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="[^"]*"\})? ([0-9]+)$`)
+
+// TestMetricsText checks that the metrics written by MetricsText are well
+// formed, and that the key counters hold the expected values.
+func TestMetricsText(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestMetricsText")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Add a contract, and record a successful and a failed storage proof.
+	co := testObligation(1)
+	h.mu.Lock()
+	h.obligationsByID[co.ID] = co
+	h.mu.Unlock()
+	h.managedRecordProof(co, "", nil)
+	h.managedRecordProof(co, modules.ProofBuildError, errors.New("no data"))
+
+	var buf bytes.Buffer
+	err = h.MetricsText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every sample must be well formed, and must be preceded by the HELP and
+	// TYPE lines of its metric.
+	described := make(map[string]int)
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			described[strings.Fields(line)[2]]++
+			continue
+		}
+		match := sampleRegexp.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("malformed metric line: %q", line)
+		}
+		if described[match[1]] != 2 {
+			t.Fatalf("metric %v is missing its HELP or TYPE line", match[1])
+		}
+		values[match[1]+match[2]] = match[3]
+	}
+
+	expected := map[string]string{
+		"sia_host_contracts":                      "1",
+		"sia_host_storage_proofs_succeeded_total": "1",
+		"sia_host_storage_proofs_failed_total":    "1",
+		`sia_host_rpc_calls_total{rpc="upload"}`:  "0",
+		"sia_host_storage_physical_bytes":         "0",
+		"sia_host_revenue_resolved_hastings":      "0",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("expected %v to be %v, got %q", name, value, values[name])
+		}
+	}
+}
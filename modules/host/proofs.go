@@ -0,0 +1,54 @@
+package host
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxProofEvents is the number of storage proof attempts that the host
+	// remembers. Older attempts are discarded.
+	maxProofEvents = 100
+)
+
+// managedRecordProof records a storage proof attempt for an obligation,
+// logging the outcome and saving the host so that the attempt is remembered
+// across restarts. A nil error indicates that the proof was submitted
+// successfully.
+func (h *Host) managedRecordProof(co *contractObligation, reason modules.ProofReason, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	event := modules.ProofEvent{
+		Time:        h.clock.Now(),
+		ContractID:  co.ID,
+		WindowStart: co.windowStart(),
+		WindowEnd:   co.windowEnd(),
+		Success:     err == nil,
+	}
+	if err != nil {
+		h.proofsFailed++
+		event.Reason = reason
+		event.Error = err.Error()
+		h.log.Printf("ERROR: storage proof for %v (window %v-%v) failed: %v: %v", co.ID, event.WindowStart, event.WindowEnd, reason, err)
+	} else {
+		h.proofsSucceeded++
+		h.log.Printf("INFO: submitted storage proof for %v (window %v-%v)", co.ID, event.WindowStart, event.WindowEnd)
+	}
+
+	h.proofs = append(h.proofs, event)
+	if len(h.proofs) > maxProofEvents {
+		h.proofs = h.proofs[len(h.proofs)-maxProofEvents:]
+	}
+	saveErr := h.save()
+	if saveErr != nil {
+		h.log.Println("WARN: failed to save host:", saveErr)
+	}
+}
+
+// ProofHistory returns the most recent storage proof attempts made by the
+// host, oldest first.
+func (h *Host) ProofHistory() []modules.ProofEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]modules.ProofEvent(nil), h.proofs...)
+}
@@ -0,0 +1,61 @@
+package host
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestProofHistoryMissingSector removes a sector of an obligation from disk
+// and checks that the failed storage proof is recorded with the correct
+// reason.
+func TestProofHistoryMissingSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestProofHistoryMissingSector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Create an obligation holding a single sector.
+	data, err := crypto.RandBytes(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := testObligation(0)
+	h.mu.Lock()
+	h.addObligation(co)
+	err = h.addSector(root, data)
+	co.Sectors = append(co.Sectors, root)
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the sector from disk and attempt a storage proof.
+	err = os.Remove(h.sectorPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.threadedCreateStorageProof(co, []crypto.Hash{root})
+
+	proofs := h.ProofHistory()
+	if len(proofs) != 1 {
+		t.Fatal("storage proof attempt was not recorded:", proofs)
+	}
+	if proofs[0].Success || proofs[0].Reason != modules.ProofMissingSector {
+		t.Error("failed storage proof was recorded with the wrong reason:", proofs[0])
+	}
+	if proofs[0].ContractID != co.ID || proofs[0].WindowStart != co.windowStart() || proofs[0].WindowEnd != co.windowEnd() {
+		t.Error("storage proof was recorded with the wrong contract details:", proofs[0])
+	}
+}
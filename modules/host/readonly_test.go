@@ -0,0 +1,121 @@
+package host
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReadOnlyContract checks that the data of a read-only contract can be
+// downloaded, and that the host refuses to revise the contract.
+func TestReadOnlyContract(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestReadOnlyContract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Add a read-only obligation holding a single sector, as formed by
+	// renewing a contract with RPCRenewReadOnly.
+	data, err := crypto.RandBytes(4 * crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob := testObligation(1)
+	ob.Sectors = []crypto.Hash{root}
+	ob.ReadOnly = true
+	h.mu.Lock()
+	err = h.addSector(root, data)
+	h.obligationsByID[ob.ID] = ob
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the data.
+	renterConn, hostConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.managedRPCDownload(hostConn, true)
+		hostConn.Close()
+	}()
+	err = encoding.WriteObject(renterConn, ob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var price types.Currency
+	err = encoding.ReadObject(renterConn, &price, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := modules.DownloadRequest{Offset: 0, Length: uint64(len(data))}
+	err = encoding.WriteObject(renterConn, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded := make([]byte, req.Length)
+	_, err = io.ReadFull(renterConn, downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("host sent the wrong data")
+	}
+	err = encoding.WriteObject(renterConn, modules.DownloadRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	renterConn.Close()
+
+	// Try to revise the contract.
+	reviseConn, hostReviseConn := net.Pipe()
+	go func() {
+		done <- h.managedRPCRevise(hostReviseConn)
+		hostReviseConn.Close()
+	}()
+	err = encoding.WriteObject(reviseConn, ob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revTxn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID:          ob.ID,
+			NewRevisionNumber: 1,
+		}},
+	}
+	err = encoding.WriteObject(reviseConn, revTxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response string
+	err = encoding.ReadObject(reviseConn, &response, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != errReadOnlyContract.Error() {
+		t.Fatal("expected the revision to be rejected as read-only, got", response)
+	}
+	if err := <-done; err != errReadOnlyContract {
+		t.Fatal("expected errReadOnlyContract, got", err)
+	}
+	reviseConn.Close()
+	if len(ob.Sectors) != 1 {
+		t.Fatal("read-only contract was modified")
+	}
+}
@@ -0,0 +1,73 @@
+package host
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxRejections is the number of rejected contract negotiations that the
+	// host remembers. Older rejections are discarded.
+	maxRejections = 100
+)
+
+var (
+	// rejectionSaveInterval is the minimum amount of time between saves of
+	// the host caused by rejected contract negotiations. Rejections that are
+	// not saved immediately are saved with the next save of the host, which
+	// at the latest is when the host is closed.
+	rejectionSaveInterval = func() time.Duration {
+		if build.Release == "testing" {
+			return time.Second
+		}
+		if build.Release == "standard" {
+			return 5 * time.Minute
+		}
+		if build.Release == "dev" {
+			return time.Minute
+		}
+		panic("unrecognized release constant in host")
+	}()
+)
+
+// recordRejection adds a rejected contract negotiation to the host's set of
+// recent rejections, discarding the oldest rejection if the set is full.
+func (h *Host) recordRejection(reason modules.RejectionReason, err error) {
+	h.rejections = append(h.rejections, modules.RejectionEvent{
+		Time:   h.clock.Now(),
+		Reason: reason,
+		Error:  err.Error(),
+	})
+	if len(h.rejections) > maxRejections {
+		h.rejections = h.rejections[len(h.rejections)-maxRejections:]
+	}
+}
+
+// managedRecordRejection records a rejected contract negotiation, saving the
+// host so that the rejection is remembered across restarts. The host is saved
+// at most once every rejectionSaveInterval, so that a renter cannot make the
+// host write to disk by sending a stream of bad negotiations.
+func (h *Host) managedRecordRejection(reason modules.RejectionReason, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordRejection(reason, err)
+	now := h.clock.Now()
+	if now.Sub(h.lastRejectionSave) < rejectionSaveInterval {
+		return
+	}
+	h.lastRejectionSave = now
+	saveErr := h.save()
+	if saveErr != nil {
+		h.log.Println("WARN: failed to save host:", saveErr)
+	}
+}
+
+// RecentRejections returns the most recent contract negotiations that were
+// rejected by the host, oldest first.
+func (h *Host) RecentRejections() []modules.RejectionEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]modules.RejectionEvent(nil), h.rejections...)
+}
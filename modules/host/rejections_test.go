@@ -0,0 +1,137 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRecentRejections triggers rejected contract negotiations and checks that
+// they are recorded with the correct reason and persist across restarts.
+func TestRecentRejections(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestRecentRejections")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Try to upload to a host that does not have an unlock hash.
+	renterConn, hostConn := net.Pipe()
+	err = ht.host.managedRPCUpload(hostConn)
+	if err != errNoUnlockHash {
+		t.Fatal("expecting errNoUnlockHash:", err)
+	}
+	renterConn.Close()
+	hostConn.Close()
+	rejections := ht.host.RecentRejections()
+	if len(rejections) != 1 || rejections[0].Reason != modules.RejectionNotAccepting {
+		t.Fatal("rejection was not recorded correctly:", rejections)
+	}
+
+	// Negotiate a contract with bad terms.
+	renterConn, hostConn = net.Pipe()
+	go func() {
+		defer renterConn.Close()
+		var hostKey types.SiaPublicKey
+		if encoding.ReadObject(renterConn, &hostKey, 256) != nil {
+			return
+		}
+		if encoding.WriteObject(renterConn, types.SiaPublicKey{}) != nil {
+			return
+		}
+		// Send a transaction set without a file contract.
+		if encoding.WriteObject(renterConn, []types.Transaction{{}}) != nil {
+			return
+		}
+		var response string
+		encoding.ReadObject(renterConn, &response, 256)
+	}()
+	err = ht.host.managedNegotiateContract(hostConn, 0, crypto.Hash{}, nil, false)
+	if err == nil {
+		t.Fatal("expecting the contract to be rejected")
+	}
+	hostConn.Close()
+	rejections = ht.host.RecentRejections()
+	if len(rejections) != 2 || rejections[1].Reason != modules.RejectionBadTerms {
+		t.Fatal("rejection was not recorded correctly:", rejections)
+	}
+
+	// Restart the host and check that the rejections persisted.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootHost, err := New(ht.cs, ht.tpool, ht.wallet, ":0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejections = rebootHost.RecentRejections()
+	if len(rejections) != 2 || rejections[0].Reason != modules.RejectionNotAccepting || rejections[1].Reason != modules.RejectionBadTerms {
+		t.Error("rejections did not persist across restarts:", rejections)
+	}
+}
+
+// TestRejectionLimit checks that only the most recent rejections are kept.
+func TestRejectionLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestRejectionLimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxRejections+10; i++ {
+		ht.host.managedRecordRejection(modules.RejectionBadTerms, errors.New("rejection"))
+	}
+	ht.host.managedRecordRejection(modules.RejectionNotAccepting, errors.New("final rejection"))
+	rejections := ht.host.RecentRejections()
+	if len(rejections) != maxRejections {
+		t.Fatal("wrong number of rejections kept:", len(rejections))
+	}
+	final := rejections[len(rejections)-1]
+	if final.Reason != modules.RejectionNotAccepting || final.Error != "final rejection" {
+		t.Error("most recent rejection was not kept:", final)
+	}
+}
+
+// TestRejectionSaveInterval checks that rejections save the host at most once
+// every rejectionSaveInterval.
+func TestRejectionSaveInterval(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestRejectionSaveInterval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	h.mu.Lock()
+	h.clock = clock
+	h.mu.Unlock()
+
+	h.managedRecordRejection(modules.RejectionBadTerms, errors.New("rejection"))
+	saved := h.lastRejectionSave
+	if !saved.Equal(clock.Now()) {
+		t.Fatal("first rejection did not save the host")
+	}
+	clock.advance(rejectionSaveInterval / 2)
+	h.managedRecordRejection(modules.RejectionBadTerms, errors.New("rejection"))
+	if !h.lastRejectionSave.Equal(saved) {
+		t.Fatal("host was saved again within the save interval")
+	}
+	clock.advance(rejectionSaveInterval)
+	h.managedRecordRejection(modules.RejectionBadTerms, errors.New("rejection"))
+	if !h.lastRejectionSave.Equal(clock.Now()) {
+		t.Fatal("host was not saved once the save interval had passed")
+	}
+}
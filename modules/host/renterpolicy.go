@@ -0,0 +1,50 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// errRenterRejected is returned if the host's renter policy refuses to
+	// form a contract with the renter. The error is sent to the renter.
+	errRenterRejected = errors.New("host does not accept contracts from this renter")
+)
+
+// A RenterPolicy decides which renters the host forms file contracts with,
+// allowing operators to refuse renters based on their own reputation logic.
+// The policy is consulted once the terms of a contract have been checked
+// against the host's settings. The renter is identified by the unlock hash of
+// its valid proof output, which is where the renter receives its refund.
+type RenterPolicy interface {
+	AcceptContract(renter types.UnlockHash, fc types.FileContract) bool
+}
+
+// acceptAllPolicy is the default renter policy, which accepts contracts from
+// every renter.
+type acceptAllPolicy struct{}
+
+// AcceptContract accepts the contract.
+func (acceptAllPolicy) AcceptContract(types.UnlockHash, types.FileContract) bool {
+	return true
+}
+
+// SetRenterPolicy sets the policy used to decide which renters the host forms
+// contracts with. A nil policy accepts every renter. The policy is not
+// persisted, and must be set again each time the host is started.
+func (h *Host) SetRenterPolicy(policy RenterPolicy) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	if policy == nil {
+		policy = acceptAllPolicy{}
+	}
+	h.renterPolicy = policy
+	return nil
+}
@@ -0,0 +1,138 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// refusePolicy is a RenterPolicy that refuses contracts from a single renter.
+type refusePolicy struct {
+	refused types.UnlockHash
+}
+
+// AcceptContract accepts the contract unless it is from the refused renter.
+func (p refusePolicy) AcceptContract(renter types.UnlockHash, fc types.FileContract) bool {
+	return renter != p.refused
+}
+
+// contractTxn returns a transaction containing a new file contract from the
+// renter with the provided key and refund address that meets the terms of
+// the host.
+func (ht *hostTester) contractTxn(renterKey types.SiaPublicKey, renter types.UnlockHash) types.Transaction {
+	ht.host.mu.RLock()
+	defer ht.host.mu.RUnlock()
+	windowStart := ht.host.blockHeight + ht.host.settings.MaxDuration
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{renterKey, ht.host.publicKey},
+		SignaturesRequired: 2,
+	}
+	return types.Transaction{
+		FileContracts: []types.FileContract{{
+			WindowStart: windowStart,
+			WindowEnd:   windowStart + ht.host.settings.WindowSize,
+			Payout:      types.NewCurrency64(1),
+			UnlockHash:  uc.UnlockHash(),
+			ValidProofOutputs: []types.SiacoinOutput{
+				{UnlockHash: renter},
+				{UnlockHash: ht.host.settings.UnlockHash},
+			},
+			MissedProofOutputs: []types.SiacoinOutput{
+				{UnlockHash: renter},
+				{UnlockHash: types.UnlockHash{}},
+			},
+		}},
+	}
+}
+
+// TestRenterPolicy sets a policy that refuses a single renter, and checks
+// that the refused renter cannot form a contract while other renters can.
+func TestRenterPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestRenterPolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := types.UnlockHash{1}
+	accepted := types.UnlockHash{2}
+
+	// By default, contracts from every renter are accepted.
+	for _, renter := range []types.UnlockHash{refused, accepted} {
+		ht.host.mu.RLock()
+		err = ht.host.considerContract(ht.contractTxn(types.SiaPublicKey{}, renter), types.SiaPublicKey{}, 0, crypto.Hash{})
+		ht.host.mu.RUnlock()
+		if err != nil {
+			t.Fatal("contract rejected under the default policy:", err)
+		}
+	}
+
+	err = ht.host.SetRenterPolicy(refusePolicy{refused: refused})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(ht.contractTxn(types.SiaPublicKey{}, refused), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != errRenterRejected {
+		t.Fatal("expected errRenterRejected for the refused renter, got", err)
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(ht.contractTxn(types.SiaPublicKey{}, accepted), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != nil {
+		t.Fatal("contract from another renter was rejected:", err)
+	}
+
+	// Negotiating a contract as the refused renter should fail, and the
+	// renter should be told why.
+	renterConn, hostConn := net.Pipe()
+	response := make(chan string, 1)
+	go func() {
+		defer renterConn.Close()
+		defer close(response)
+		var hostKey types.SiaPublicKey
+		if encoding.ReadObject(renterConn, &hostKey, 256) != nil {
+			return
+		}
+		if encoding.WriteObject(renterConn, types.SiaPublicKey{}) != nil {
+			return
+		}
+		if encoding.WriteObject(renterConn, []types.Transaction{ht.contractTxn(types.SiaPublicKey{}, refused)}) != nil {
+			return
+		}
+		var resp string
+		if encoding.ReadObject(renterConn, &resp, 256) == nil {
+			response <- resp
+		}
+	}()
+	err = ht.host.managedNegotiateContract(hostConn, 0, crypto.Hash{}, nil, false)
+	hostConn.Close()
+	if err == nil {
+		t.Fatal("refused renter was able to negotiate a contract")
+	}
+	if resp := <-response; resp != errRenterRejected.Error() {
+		t.Error("renter received the wrong response:", resp)
+	}
+	rejections := ht.host.RecentRejections()
+	if len(rejections) != 1 || rejections[0].Reason != modules.RejectionRenterPolicy {
+		t.Error("rejection was not recorded correctly:", rejections)
+	}
+
+	// A nil policy restores the default.
+	err = ht.host.SetRenterPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(ht.contractTxn(types.SiaPublicKey{}, refused), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != nil {
+		t.Fatal("contract rejected after resetting the policy:", err)
+	}
+}
@@ -0,0 +1,129 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// errNoMaturedRevenue is returned by SweepRevenue if none of the host's
+	// revenue outputs have matured.
+	errNoMaturedRevenue = errors.New("no revenue has matured since the last sweep")
+)
+
+// A revenueOutput is the output created by the storage proof of a successful
+// obligation. The output is delayed, and cannot be spent until it has
+// matured.
+type revenueOutput struct {
+	ID             types.SiacoinOutputID
+	Value          types.Currency
+	MaturityHeight types.BlockHeight
+}
+
+// unlockConditions returns the unlock conditions of the host's payout
+// address, which can be spent with the host's secret key.
+func (h *Host) unlockConditions() types.UnlockConditions {
+	return types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{h.publicKey},
+		SignaturesRequired: 1,
+	}
+}
+
+// addRevenueOutput records the storage proof output of a successful
+// obligation. The storage proof is confirmed no later than the end of the
+// proof window, so the output is certain to have matured MaturityDelay blocks
+// after the window ends. Outputs paid to an address other than the host's
+// payout address belong to the wallet already, and are not tracked.
+func (h *Host) addRevenueOutput(co *contractObligation) {
+	if co.validProofUnlockHash() != h.unlockConditions().UnlockHash() {
+		return
+	}
+	h.revenueOutputs = append(h.revenueOutputs, revenueOutput{
+		ID:             co.ID.StorageProofOutputID(types.ProofValid, 1),
+		Value:          co.value(),
+		MaturityHeight: co.windowEnd() + types.MaturityDelay,
+	})
+}
+
+// SweepRevenue consolidates the revenue of every matured storage proof output
+// into a single output at a new address of the host's wallet, returning the
+// transaction that was broadcast. Outputs of storage proofs that have not yet
+// matured are left for a later sweep.
+func (h *Host) SweepRevenue() (types.Transaction, error) {
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return types.Transaction{}, errHostClosed
+	}
+
+	// Spend each matured output with the host's unlock conditions.
+	h.mu.RLock()
+	uc := h.unlockConditions()
+	sk := h.secretKey
+	var txn types.Transaction
+	var total types.Currency
+	swept := make(map[types.SiacoinOutputID]struct{})
+	for _, ro := range h.revenueOutputs {
+		if ro.MaturityHeight <= h.blockHeight {
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+				ParentID:         ro.ID,
+				UnlockConditions: uc,
+			})
+			total = total.Add(ro.Value)
+			swept[ro.ID] = struct{}{}
+		}
+	}
+	h.mu.RUnlock()
+	if len(swept) == 0 {
+		return types.Transaction{}, errNoMaturedRevenue
+	}
+
+	// Move the matured revenue to a new address of the wallet.
+	walletUC, err := h.wallet.NextAddress()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	txn.SiacoinOutputs = []types.SiacoinOutput{{
+		Value:      total,
+		UnlockHash: walletUC.UnlockHash(),
+	}}
+
+	// Sign each input.
+	for _, sci := range txn.SiacoinInputs {
+		txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+			ParentID:       crypto.Hash(sci.ParentID),
+			CoveredFields:  types.CoveredFields{WholeTransaction: true},
+			PublicKeyIndex: 0,
+		})
+	}
+	for i := range txn.TransactionSignatures {
+		encodedSig, err := crypto.SignHash(txn.SigHash(i), sk)
+		if err != nil {
+			return types.Transaction{}, err
+		}
+		txn.TransactionSignatures[i].Signature = encodedSig[:]
+	}
+	err = h.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	h.log.Printf("INFO: swept %v hastings of revenue from %v storage proofs", total, len(swept))
+
+	// Forget the outputs that were swept.
+	h.mu.Lock()
+	var pending []revenueOutput
+	for _, ro := range h.revenueOutputs {
+		if _, ok := swept[ro.ID]; !ok {
+			pending = append(pending, ro)
+		}
+	}
+	h.revenueOutputs = pending
+	err = h.save()
+	h.mu.Unlock()
+	if err != nil {
+		h.log.Println("WARN: failed to save host:", err)
+	}
+	return txn, nil
+}
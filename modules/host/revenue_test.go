@@ -0,0 +1,115 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSweepRevenue uploads a file to the host, mines blocks until the storage
+// proof output has matured, and checks that the swept output matches the
+// revenue earned by the host.
+func TestSweepRevenue(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestSweepRevenue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ht.uploadFile("TestSweepRevenue - 1", renewDisabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.RLock()
+	expectedRevenue := ht.host.anticipatedRevenue
+	ht.host.mu.RUnlock()
+
+	// Nothing can be swept while the obligation is unresolved.
+	_, err = ht.host.SweepRevenue()
+	if err != errNoMaturedRevenue {
+		t.Fatal("expected errNoMaturedRevenue, got", err)
+	}
+
+	// Mine until the storage proof has been confirmed and its output has
+	// matured.
+	for i := types.BlockHeight(0); i <= testUploadDuration+defaultWindowSize+confirmationRequirement+types.MaturityDelay; i++ {
+		_, err := ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ht.host.mu.RLock()
+	if len(ht.host.obligationsByID) != 0 {
+		t.Error("host did not delete a finished obligation")
+	}
+	if len(ht.host.revenueOutputs) != 1 {
+		t.Fatal("expected 1 revenue output, got", len(ht.host.revenueOutputs))
+	}
+	ht.host.mu.RUnlock()
+
+	// Sweep the revenue.
+	txn, err := ht.host.SweepRevenue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].Value.Cmp(expectedRevenue) != 0 {
+		t.Fatal("swept output does not match the earned revenue:", txn.SiacoinOutputs, expectedRevenue)
+	}
+	found := false
+	for _, tpoolTxn := range ht.tpool.TransactionList() {
+		if tpoolTxn.ID() == txn.ID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("sweep transaction was not broadcast")
+	}
+
+	// The revenue cannot be swept twice.
+	_, err = ht.host.SweepRevenue()
+	if err != errNoMaturedRevenue {
+		t.Fatal("expected errNoMaturedRevenue, got", err)
+	}
+}
+
+// TestResolvedCollateral resolves a successful and a failed obligation, and
+// checks that the host no longer counts their collateral as owed.
+func TestResolvedCollateral(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestResolvedCollateral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Add two obligations owing collateral, one with a confirmed storage
+	// proof.
+	succeeded := testObligation(1)
+	succeeded.OriginConfirmed = true
+	succeeded.ProofConfirmed = true
+	succeeded.Collateral = types.NewCurrency64(100)
+	failed := testObligation(2)
+	failed.OriginConfirmed = true
+	failed.Collateral = types.NewCurrency64(40)
+	h.mu.Lock()
+	h.obligationsByID[succeeded.ID] = succeeded
+	h.obligationsByID[failed.ID] = failed
+	h.mu.Unlock()
+	if h.Metrics().Collateral.Cmp(types.NewCurrency64(140)) != 0 {
+		t.Fatal("expected 140 hastings of owed collateral, got", h.Metrics().Collateral)
+	}
+
+	// Advance past the proof window and the confirmation requirement.
+	h.mu.Lock()
+	h.blockHeight = succeeded.windowEnd() + confirmationRequirement
+	h.handleActionItem(succeeded)
+	h.handleActionItem(failed)
+	h.mu.Unlock()
+
+	if c := h.Metrics().Collateral; !c.IsZero() {
+		t.Error("collateral is still owed after the obligations resolved:", c)
+	}
+}
@@ -0,0 +1,405 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+const (
+	// sectorDir is the name of the directory that holds the sectors stored by
+	// the host.
+	sectorDir = "sectors"
+)
+
+var (
+	// errSectorNotFound is returned when a sector referenced by an obligation
+	// is not being tracked by the host.
+	errSectorNotFound = errors.New("sector is not being tracked by the host")
+
+	// errCorruptSector is returned when the data of a sector no longer
+	// matches its Merkle root, for example due to bit-rot.
+	errCorruptSector = errors.New("sector data does not match its Merkle root")
+)
+
+// A sectorUsage tracks a piece of data that is stored on disk by the host.
+// Sectors are content-addressed by their Merkle root, which means that
+// identical data uploaded under multiple file contracts is only stored once.
+// The sector file is only removed from disk once no obligations reference it.
+type sectorUsage struct {
+	Count  uint64 // The number of obligation references to the sector.
+	Size   uint64 // The size of the sector on disk.
+	Folder int    // The index of the storage folder holding the sector.
+}
+
+// sectorFile presents the ordered sectors of an obligation as a single,
+// contiguous, read-only file.
+type sectorFile struct {
+	files    []*os.File
+	roots    []crypto.Hash // The Merkle root of each file.
+	offsets  []int64       // The offset within the sectorFile of each file.
+	verified []bool        // Whether each file has been checked by verifyRange.
+	size     int64
+}
+
+// ReadAt implements the io.ReaderAt interface, reading across sector
+// boundaries as necessary.
+func (sf *sectorFile) ReadAt(b []byte, off int64) (n int, err error) {
+	for n < len(b) {
+		if off >= sf.size {
+			return n, io.EOF
+		}
+
+		// Find the sector containing 'off' and read no further than the end
+		// of that sector.
+		i := sort.Search(len(sf.offsets), func(i int) bool { return sf.offsets[i] > off }) - 1
+		end := sf.size
+		if i+1 < len(sf.offsets) {
+			end = sf.offsets[i+1]
+		}
+		chunk := b[n:]
+		if int64(len(chunk)) > end-off {
+			chunk = chunk[:end-off]
+		}
+		m, err := sf.files[i].ReadAt(chunk, off-sf.offsets[i])
+		n += m
+		off += int64(m)
+		if err != nil && !(err == io.EOF && m == len(chunk)) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// verifyRange checks that every sector holding data in the 'length' bytes at
+// 'off' still matches its Merkle root. Each sector is only checked the first
+// time it is part of a range. If a sector does not match, its index is
+// returned along with errCorruptSector.
+func (sf *sectorFile) verifyRange(off, length int64) (int, error) {
+	if sf.verified == nil {
+		sf.verified = make([]bool, len(sf.files))
+	}
+	first := sort.Search(len(sf.offsets), func(i int) bool { return sf.offsets[i] > off }) - 1
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < len(sf.files) && sf.offsets[i] < off+length; i++ {
+		if sf.verified[i] {
+			continue
+		}
+		end := sf.size
+		if i+1 < len(sf.offsets) {
+			end = sf.offsets[i+1]
+		}
+		root, err := crypto.ReaderMerkleRoot(io.NewSectionReader(sf.files[i], 0, end-sf.offsets[i]))
+		if err != nil {
+			return i, err
+		}
+		if root != sf.roots[i] {
+			return i, errCorruptSector
+		}
+		sf.verified[i] = true
+	}
+	return 0, nil
+}
+
+// Size returns the combined size of all of the sectors in the sectorFile.
+func (sf *sectorFile) Size() int64 {
+	return sf.size
+}
+
+// Close closes all of the sector files.
+func (sf *sectorFile) Close() error {
+	var closeErr error
+	for _, file := range sf.files {
+		err := file.Close()
+		if err != nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// sectorPath returns the location on disk of the sector with the provided
+// Merkle root. Sectors that are not being tracked are looked up in the storage
+// folders, and are placed in the primary folder if they are not found.
+func (h *Host) sectorPath(root crypto.Hash) string {
+	folder := 0
+	if su, exists := h.sectors[root]; exists {
+		folder = su.Folder
+	} else {
+		folder = h.locateSector(root)
+	}
+	return filepath.Join(h.storageFolders()[folder], root.String())
+}
+
+// managedSectorPath returns the location on disk of the sector with the
+// provided Merkle root.
+func (h *Host) managedSectorPath(root crypto.Hash) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sectorPath(root)
+}
+
+// availableStorage returns the amount of storage that can be promised to new
+// contracts and revisions, which excludes storage that is already reserved.
+func (h *Host) availableStorage() int64 {
+	return h.spaceRemaining - h.reservedStorage
+}
+
+// reserveStorage reserves 'size' bytes of storage for data that has not yet
+// arrived, so that concurrent negotiations cannot promise the same storage
+// twice. HostCapacityErr is returned if not enough storage is available.
+// Reservations of zero bytes always succeed. The reservation must be released
+// with releaseStorage once the data has been stored or the negotiation has
+// failed.
+func (h *Host) reserveStorage(size int64) error {
+	if size > 0 && size > h.availableStorage() {
+		return HostCapacityErr
+	}
+	h.reservedStorage += size
+	return nil
+}
+
+// releaseStorage releases a reservation made by reserveStorage.
+func (h *Host) releaseStorage(size int64) {
+	h.reservedStorage -= size
+	if build.DEBUG && h.reservedStorage < 0 {
+		panic("released more storage than was reserved")
+	}
+}
+
+// managedAddSector adds a reference to the sector containing 'data', writing
+// the sector to disk if no other obligation is already storing the same data.
+// HostCapacityErr is returned if there is not enough space remaining to store
+// the sector, or if no storage folder has room for it on disk. The host lock
+// is only held while the sector is looked up and recorded, not while the
+// sector is written; the space of the sector is claimed before the write, so
+// that concurrent uploads cannot claim the same space.
+func (h *Host) managedAddSector(root crypto.Hash, data []byte) error {
+	size := int64(len(data))
+	h.mu.Lock()
+	if su, exists := h.sectors[root]; exists {
+		su.Count++
+		h.mu.Unlock()
+		return nil
+	}
+	if size > h.spaceRemaining {
+		h.mu.Unlock()
+		return HostCapacityErr
+	}
+	folder, err := h.leastUsedFolder(uint64(size))
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	dir := h.storageFolders()[folder]
+	h.spaceRemaining -= size
+	h.mu.Unlock()
+
+	path := filepath.Join(dir, root.String())
+	err = writeSectorFile(path, data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil && (folder >= len(h.storageFolders()) || h.storageFolders()[folder] != dir) {
+		err = errors.New("storage folder was removed while the sector was written")
+	}
+	if err != nil {
+		h.spaceRemaining += size
+		if _, exists := h.sectors[root]; !exists || h.sectorPath(root) != path {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	// The same sector may have been added while it was being written.
+	if su, exists := h.sectors[root]; exists {
+		su.Count++
+		h.spaceRemaining += size
+		if h.sectorPath(root) != path {
+			os.Remove(path)
+		}
+		return nil
+	}
+	h.sectors[root] = &sectorUsage{
+		Count:  1,
+		Size:   uint64(size),
+		Folder: folder,
+	}
+	return nil
+}
+
+// writeSectorFile writes the data of a sector to path. The data is written to
+// a uniquely named temporary file first, so that a failure during the write
+// never leaves a partial sector under the sector's name, and so that
+// concurrent writes of the same sector do not interfere.
+func writeSectorFile(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+"_temp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// referenceSector adds a reference to a sector that is already on disk. If the
+// sector is not yet being tracked, the size is read from disk.
+func (h *Host) referenceSector(root crypto.Hash) error {
+	su, exists := h.sectors[root]
+	if exists {
+		su.Count++
+		return nil
+	}
+	folder := h.locateSector(root)
+	stat, err := os.Stat(filepath.Join(h.storageFolders()[folder], root.String()))
+	if err != nil {
+		return err
+	}
+	h.sectors[root] = &sectorUsage{
+		Count:  1,
+		Size:   uint64(stat.Size()),
+		Folder: folder,
+	}
+	h.spaceRemaining -= stat.Size()
+	return nil
+}
+
+// removeSector removes a reference to a sector. The sector is deleted from
+// disk and the space is reclaimed when no references remain.
+func (h *Host) removeSector(root crypto.Hash) error {
+	su, exists := h.sectors[root]
+	if !exists {
+		if build.DEBUG {
+			panic("removing a sector that is not being tracked")
+		}
+		return errSectorNotFound
+	}
+	su.Count--
+	if su.Count > 0 {
+		return nil
+	}
+
+	path := h.sectorPath(root)
+	delete(h.sectors, root)
+	err := os.Remove(path)
+	if err != nil {
+		// The sector is no longer tracked, but is still consuming space on
+		// disk, so the space is not reclaimed.
+		return err
+	}
+	h.spaceRemaining += int64(su.Size)
+	return nil
+}
+
+// migrateObligationFile moves the file of an obligation created before the
+// host stored data as sectors into the sector directory, replacing the file
+// with a single sector. The caller is responsible for referencing the sector.
+//
+// COMPATv0.5 - obligations created before sectors were introduced keep all of
+// their data in a single file at 'Path'.
+func (h *Host) migrateObligationFile(co *contractObligation) error {
+	file, err := os.Open(co.Path)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	root, err := crypto.ReaderMerkleRoot(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Empty files do not become sectors.
+	if stat.Size() == 0 {
+		co.Path = ""
+		return os.Remove(file.Name())
+	}
+
+	// The file becomes the sector. If another obligation already holds the
+	// same data, the sector on disk is replaced with identical data.
+	err = os.Rename(co.Path, h.sectorPath(root))
+	if err != nil {
+		return err
+	}
+	co.Path = ""
+	co.Sectors = []crypto.Hash{root}
+	return nil
+}
+
+// managedOpenSectors opens the provided sectors in order, returning a
+// sectorFile that presents them as a single file.
+func (h *Host) managedOpenSectors(roots []crypto.Hash) (*sectorFile, error) {
+	sf := new(sectorFile)
+	for _, root := range roots {
+		file, err := os.Open(h.managedSectorPath(root))
+		if os.IsNotExist(err) {
+			// The sector may have been moved to another storage folder
+			// after its location was looked up.
+			file, err = os.Open(h.managedSectorPath(root))
+		}
+		if err != nil {
+			sf.Close()
+			return nil, err
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			sf.Close()
+			return nil, err
+		}
+		sf.files = append(sf.files, file)
+		sf.roots = append(sf.roots, root)
+		sf.offsets = append(sf.offsets, sf.size)
+		sf.size += stat.Size()
+	}
+	return sf, nil
+}
+
+// SectorVerification indicates whether sectors are checked against their
+// Merkle roots before they are served.
+func (h *Host) SectorVerification() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.verifySectors
+}
+
+// SetSectorVerification enables or disables the verification of sectors
+// before they are served. While enabled, each sector read by a download is
+// checked against its Merkle root, and a download that reaches a corrupt
+// sector fails instead of serving the corrupt data. Corrupt sectors are
+// logged.
+func (h *Host) SetSectorVerification(enabled bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.verifySectors = enabled
+	return h.save()
+}
@@ -0,0 +1,187 @@
+package host
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// testObligation returns a contract obligation with a minimal file contract,
+// suitable for adding to the host directly.
+func testObligation(id byte) *contractObligation {
+	return &contractObligation{
+		ID: types.FileContractID{id},
+		OriginTransaction: types.Transaction{
+			FileContracts: []types.FileContract{{
+				ValidProofOutputs:  []types.SiacoinOutput{{}, {}},
+				MissedProofOutputs: []types.SiacoinOutput{{}, {}},
+			}},
+		},
+	}
+}
+
+// addSector adds a reference to the sector containing 'data' while the caller
+// holds the host lock, for tests that set up the host directly.
+func (h *Host) addSector(root crypto.Hash, data []byte) error {
+	h.mu.Unlock()
+	defer h.mu.Lock()
+	return h.managedAddSector(root, data)
+}
+
+// TestSectorDeduplication uploads the same sector under two contracts and
+// checks that the sector is only stored on disk once.
+func TestSectorDeduplication(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestSectorDeduplication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	baselineSpace := h.spaceRemaining
+
+	// Add the same sector to two different obligations.
+	data, err := crypto.RandBytes(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co1 := testObligation(1)
+	co2 := testObligation(2)
+	for _, co := range []*contractObligation{co1, co2} {
+		h.addObligation(co)
+		err = h.addSector(root, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		co.Sectors = append(co.Sectors, root)
+	}
+
+	// The logical storage should count the sector twice, while the physical
+	// storage should count the sector once.
+	h.mu.Unlock()
+	hm := h.Metrics()
+	h.mu.Lock()
+	if hm.LogicalStorage != 2*uint64(len(data)) {
+		t.Error("wrong logical storage:", hm.LogicalStorage)
+	}
+	if hm.PhysicalStorage != uint64(len(data)) {
+		t.Error("wrong physical storage:", hm.PhysicalStorage)
+	}
+	if h.spaceRemaining != baselineSpace-int64(len(data)) {
+		t.Error("sector was not counted once against the remaining space")
+	}
+
+	// Removing the first obligation should not remove the sector.
+	h.removeObligation(co1, obligationSucceeded)
+	sectorData, err := ioutil.ReadFile(h.sectorPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sectorData, data) {
+		t.Error("sector data was corrupted")
+	}
+	if h.spaceRemaining != baselineSpace-int64(len(data)) {
+		t.Error("space was reclaimed while the sector is still referenced")
+	}
+
+	// Removing the second obligation should free the sector.
+	h.removeObligation(co2, obligationSucceeded)
+	_, err = os.Stat(h.sectorPath(root))
+	if !os.IsNotExist(err) {
+		t.Error("sector was not removed after the last reference was dropped")
+	}
+	if h.spaceRemaining != baselineSpace {
+		t.Error("space was not reclaimed after the last reference was dropped")
+	}
+	if len(h.sectors) != 0 {
+		t.Error("sector is still being tracked")
+	}
+}
+
+// TestSectorFile checks that a sectorFile correctly reads across the
+// boundaries of the sectors that it is built from.
+func TestSectorFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestSectorFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+
+	// Store three sectors of different sizes.
+	var roots []crypto.Hash
+	var full []byte
+	for _, size := range []int{64, 200, 1000} {
+		data, err := crypto.RandBytes(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = h.addSector(root, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+		full = append(full, data...)
+	}
+	h.mu.Unlock()
+
+	sf, err := h.managedOpenSectors(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	if sf.Size() != int64(len(full)) {
+		t.Fatal("sector file has the wrong size")
+	}
+
+	// Read a range that spans all three sectors.
+	b := make([]byte, 1200)
+	_, err = sf.ReadAt(b, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, full[32:1232]) {
+		t.Error("read across sector boundaries returned the wrong data")
+	}
+
+	// Read past the end of the file.
+	n, err := sf.ReadAt(b, int64(len(full))-10)
+	if err != io.EOF || n != 10 {
+		t.Error("expecting a short read and EOF:", n, err)
+	}
+
+	// Verifying a range that starts before the first sector should not
+	// panic.
+	_, err = sf.verifyRange(-10, 20)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The full reader should produce the whole file.
+	readBack, err := ioutil.ReadAll(io.NewSectionReader(sf, 0, sf.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readBack, full) {
+		t.Error("sector file does not match the full data")
+	}
+}
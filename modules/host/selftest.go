@@ -0,0 +1,106 @@
+package host
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// selfTestSize is the size of the temporary sector that is written to
+	// each storage folder during a self-test.
+	selfTestSize = func() int {
+		if build.Release == "testing" {
+			return 1 << 16 // 64 KiB.
+		}
+		return 1 << 24 // 16 MiB.
+	}()
+
+	// errSelfTestCorrupt is returned when the data read back during a
+	// self-test does not match the data that was written.
+	errSelfTestCorrupt = errors.New("data read back from the storage folder did not match the data written")
+)
+
+// throughput returns the number of bytes per second that 'n' bytes
+// transferred over 'elapsed' amounts to.
+func throughput(n int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// testFolder writes 'data' to a temporary file in the folder at 'path' and
+// reads it back, measuring the throughput of the folder. The temporary file is
+// always removed.
+func testFolder(path string, data []byte) (result modules.FolderTestResult) {
+	result.Path = path
+	file, err := ioutil.TempFile(path, "selftest_")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// The write is synced so that the time to reach the disk is measured,
+	// rather than the time to reach the OS cache.
+	start := time.Now()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.WriteThroughput = throughput(len(data), time.Since(start))
+
+	readBack := make([]byte, len(data))
+	start = time.Now()
+	_, err = file.ReadAt(readBack, 0)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ReadThroughput = throughput(len(data), time.Since(start))
+	if !bytes.Equal(data, readBack) {
+		result.Error = errSelfTestCorrupt.Error()
+	}
+	return result
+}
+
+// SelfTest writes a temporary sector to each storage folder of the host and
+// reads it back, measuring the throughput of each folder and verifying that
+// the data is intact. A folder that fails the test is reported in the results
+// without stopping the test of the other folders.
+func (h *Host) SelfTest() (modules.SelfTestResult, error) {
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return modules.SelfTestResult{}, errHostClosed
+	}
+
+	data, err := crypto.RandBytes(selfTestSize)
+	if err != nil {
+		return modules.SelfTestResult{}, err
+	}
+	h.mu.RLock()
+	folders := h.storageFolders()
+	h.mu.RUnlock()
+	var result modules.SelfTestResult
+	for _, folder := range folders {
+		folderResult := testFolder(folder, data)
+		if folderResult.Error != "" {
+			h.log.Printf("WARN: self-test of %v failed: %v", folder, folderResult.Error)
+		}
+		result.Folders = append(result.Folders, folderResult)
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package host
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestSelfTest runs the self-test of a host and checks that throughput is
+// reported and the temporary sector is removed.
+func TestSelfTest(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestSelfTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ht.host.SelfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Folders) != 1 {
+		t.Fatal("expected one folder result, got", len(result.Folders))
+	}
+	fr := result.Folders[0]
+	if fr.Error != "" {
+		t.Fatal("self-test failed:", fr.Error)
+	}
+	if fr.WriteThroughput <= 0 || fr.ReadThroughput <= 0 {
+		t.Error("self-test did not report throughput:", fr)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(ht.host.persistDir, sectorDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Error("self-test did not clean up after itself")
+	}
+
+	// A folder that cannot be written to should be reported.
+	fr = testFolder(filepath.Join(ht.persistDir, "dne"), []byte{1, 2, 3})
+	if fr.Error == "" {
+		t.Error("expected an error for a missing folder")
+	}
+}
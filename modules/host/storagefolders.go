@@ -0,0 +1,314 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errFolderExists is returned by AddStorageFolder if the host is already
+	// storing sectors in the folder.
+	errFolderExists = errors.New("host is already storing sectors in that folder")
+
+	// errRebalanceInProgress is returned by RebalanceStorage if sectors are
+	// already being moved between storage folders.
+	errRebalanceInProgress = errors.New("storage is already being rebalanced")
+)
+
+// A sectorMove is a planned move of a sector to another storage folder.
+type sectorMove struct {
+	root   crypto.Hash
+	folder int
+}
+
+// storageFolders returns the folders in which the host stores sectors. The
+// sector directory in the persist directory is always the first folder.
+func (h *Host) storageFolders() []string {
+	return append([]string{filepath.Join(h.persistDir, sectorDir)}, h.storageFolderPaths...)
+}
+
+// locateSector returns the index of the storage folder that holds the sector
+// with the provided Merkle root, without consulting the sectors tracked by the
+// host. The primary folder is returned if the sector is not found.
+func (h *Host) locateSector(root crypto.Hash) int {
+	folders := h.storageFolders()
+	for i := len(folders) - 1; i > 0; i-- {
+		_, err := os.Stat(filepath.Join(folders[i], root.String()))
+		if err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+// findSector returns the location on disk of the sector with the provided
+// Merkle root, searching every storage folder for sectors that are not being
+// tracked. errSectorNotFound is returned if no folder holds the sector.
+func (h *Host) findSector(root crypto.Hash) (string, error) {
+	folders := h.storageFolders()
+	if su, exists := h.sectors[root]; exists {
+		folders = folders[su.Folder : su.Folder+1]
+	}
+	for _, folder := range folders {
+		path := filepath.Join(folder, root.String())
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errSectorNotFound
+}
+
+// folderUsage returns the number of bytes stored in each storage folder.
+func (h *Host) folderUsage() []uint64 {
+	usage := make([]uint64, len(h.storageFolders()))
+	for _, su := range h.sectors {
+		usage[su.Folder] += su.Size
+	}
+	return usage
+}
+
+// folderHasRoom reports whether the disk holding a storage folder has room
+// for 'size' more bytes, while leaving diskSpaceMargin free. Folders whose free
+// space cannot be checked are treated as full.
+func (h *Host) folderHasRoom(folder string, size uint64) bool {
+	free, err := h.freeSpace(folder)
+	return err == nil && free >= diskSpaceMargin && free-diskSpaceMargin >= size
+}
+
+// leastUsedFolder returns the index of the storage folder that holds the
+// least data among the folders with room for a sector of 'size' bytes, which
+// is where new sectors are stored. HostCapacityErr is returned if no folder
+// has room for the sector.
+func (h *Host) leastUsedFolder(size uint64) (int, error) {
+	folders := h.storageFolders()
+	usage := h.folderUsage()
+	least := -1
+	for i := range usage {
+		if least != -1 && usage[i] >= usage[least] {
+			continue
+		}
+		if h.folderHasRoom(folders[i], size) {
+			least = i
+		}
+	}
+	if least == -1 {
+		return 0, HostCapacityErr
+	}
+	return least, nil
+}
+
+// planRebalance returns the sector moves that even out the data stored in
+// each storage folder. Sectors are moved from the fullest folder to the
+// emptiest folder until another move would not bring the two closer together.
+func (h *Host) planRebalance() []sectorMove {
+	usage := h.folderUsage()
+	sectors := make([][]crypto.Hash, len(usage))
+	for root, su := range h.sectors {
+		sectors[su.Folder] = append(sectors[su.Folder], root)
+	}
+
+	var moves []sectorMove
+	for {
+		fullest, emptiest := 0, 0
+		for i := range usage {
+			if usage[i] > usage[fullest] {
+				fullest = i
+			}
+			if usage[i] < usage[emptiest] {
+				emptiest = i
+			}
+		}
+		if len(sectors[fullest]) == 0 {
+			break
+		}
+		root := sectors[fullest][len(sectors[fullest])-1]
+		size := h.sectors[root].Size
+		if usage[fullest]-usage[emptiest] <= size {
+			break
+		}
+		sectors[fullest] = sectors[fullest][:len(sectors[fullest])-1]
+		usage[fullest] -= size
+		usage[emptiest] += size
+		moves = append(moves, sectorMove{root: root, folder: emptiest})
+	}
+	return moves
+}
+
+// copySector copies the sector at 'src' to 'dst'. The copy is written to a
+// temporary file and synced before being renamed, so that a partial sector is
+// never left under the sector's name.
+func copySector(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+"_temp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(dst + "_temp")
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		os.Remove(dst + "_temp")
+		return err
+	}
+	return os.Rename(dst+"_temp", dst)
+}
+
+// managedMoveSector moves a sector to another storage folder. The sector is
+// copied without holding the host lock, and the lock is only taken to point
+// the host at the new copy. The sector is only removed from its old folder
+// once the copy in the new folder is complete and is being tracked by the
+// host, meaning that an interruption at any point leaves at least one
+// complete copy of the sector on disk. Sectors that were removed or moved
+// since the move was planned, or while the sector was being copied, are
+// skipped.
+func (h *Host) managedMoveSector(move sectorMove) error {
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	h.mu.RLock()
+	su, exists := h.sectors[move.root]
+	var folder int
+	var src, dst string
+	if exists {
+		folder = su.Folder
+		src = h.sectorPath(move.root)
+		dst = filepath.Join(h.storageFolders()[move.folder], move.root.String())
+	}
+	h.mu.RUnlock()
+	if !exists || folder == move.folder {
+		return nil
+	}
+	err := copySector(src, dst)
+	if err != nil {
+		return err
+	}
+
+	// Only point the host at the new copy if the sector has not changed
+	// while it was being copied. Otherwise the copy is removed, unless the
+	// sector now lives in the new folder, in which case the copy is the
+	// sector itself.
+	h.mu.Lock()
+	current, exists := h.sectors[move.root]
+	if !exists || current != su || current.Folder != folder {
+		stale := !exists || current.Folder != move.folder
+		h.mu.Unlock()
+		if stale {
+			os.Remove(dst)
+		}
+		return nil
+	}
+	su.Folder = move.folder
+	h.mu.Unlock()
+
+	// A failure to remove the old copy only wastes space, as the sector is
+	// now read from the new folder.
+	return os.Remove(src)
+}
+
+// threadedRebalanceStorage moves the sectors chosen by planRebalance, updating
+// the rebalance status as each sector is moved.
+func (h *Host) threadedRebalanceStorage() {
+	defer func() {
+		h.mu.Lock()
+		h.rebalance.Active = false
+		h.mu.Unlock()
+	}()
+
+	h.mu.Lock()
+	moves := h.planRebalance()
+	h.rebalance.SectorsTotal = uint64(len(moves))
+	h.mu.Unlock()
+
+	for _, move := range moves {
+		err := h.managedMoveSector(move)
+		if err == errHostClosed {
+			return
+		}
+		h.mu.Lock()
+		if err != nil {
+			h.log.Printf("WARN: could not move sector %v to %v: %v", move.root, h.storageFolders()[move.folder], err)
+			h.rebalance.Error = err.Error()
+		} else {
+			h.rebalance.SectorsMoved++
+		}
+		h.mu.Unlock()
+	}
+}
+
+// AddStorageFolder adds a folder in which the host can store sectors, creating
+// the folder if it does not exist. New sectors are stored in the folder
+// holding the least data, but existing sectors are not moved to the new
+// folder until RebalanceStorage is called.
+func (h *Host) AddStorageFolder(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+
+	for _, folder := range h.storageFolders() {
+		if folder == path {
+			return errFolderExists
+		}
+	}
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return err
+	}
+	h.storageFolderPaths = append(h.storageFolderPaths, path)
+	return h.save()
+}
+
+// RebalanceStatus reports the progress of the most recent storage rebalance.
+func (h *Host) RebalanceStatus() modules.RebalanceStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.rebalance
+}
+
+// RebalanceStorage starts moving sectors between the storage folders of the
+// host in the background, such that each folder holds a similar amount of
+// data. Progress is reported by RebalanceStatus. Only one rebalance can run
+// at a time.
+func (h *Host) RebalanceStorage() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLock.RLock()
+	defer h.resourceLock.RUnlock()
+	if h.closed {
+		return errHostClosed
+	}
+	if h.rebalance.Active {
+		return errRebalanceInProgress
+	}
+
+	h.rebalance = modules.RebalanceStatus{Active: true}
+	go h.threadedRebalanceStorage()
+	return nil
+}
@@ -0,0 +1,130 @@
+package host
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// TestRebalanceStorage fills the sector directory of a host, adds a second,
+// empty storage folder, and checks that rebalancing moves half of the sectors
+// to the new folder without losing any data.
+func TestRebalanceStorage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestRebalanceStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Fill the sector directory.
+	sectors := make(map[crypto.Hash][]byte)
+	h.mu.Lock()
+	for i := 0; i < 8; i++ {
+		data, err := crypto.RandBytes(4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = h.addSector(root, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sectors[root] = data
+	}
+	h.mu.Unlock()
+
+	// Add a second folder and rebalance.
+	folder := filepath.Join(ht.persistDir, "disk2")
+	err = h.AddStorageFolder(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddStorageFolder(folder); err != errFolderExists {
+		t.Fatal("expected errFolderExists, got", err)
+	}
+	err = h.RebalanceStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && h.RebalanceStatus().Active; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	status := h.RebalanceStatus()
+	if status.Active {
+		t.Fatal("rebalance did not finish")
+	}
+	if status.Error != "" {
+		t.Fatal("rebalance failed:", status.Error)
+	}
+	if status.SectorsMoved != 4 || status.SectorsTotal != 4 {
+		t.Fatalf("expected 4 of 4 sectors to be moved, got %v of %v", status.SectorsMoved, status.SectorsTotal)
+	}
+
+	// Each folder should hold half of the sectors, and every sector should
+	// still be readable.
+	for _, dir := range h.storageFolders() {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 4 {
+			t.Errorf("expected 4 sectors in %v, got %v", dir, len(files))
+		}
+	}
+	for root, data := range sectors {
+		sf, err := h.managedOpenSectors([]crypto.Hash{root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := make([]byte, sf.Size())
+		_, err = sf.ReadAt(stored, 0)
+		sf.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(stored, data) {
+			t.Fatal("sector was corrupted while being moved")
+		}
+	}
+
+	// A new sector should be stored in the folder holding the least data,
+	// unless the disk holding that folder is full.
+	h.mu.Lock()
+	h.sectors[crypto.Hash{255}] = &sectorUsage{Count: 1, Size: 4096, Folder: 0}
+	if folder, err := h.leastUsedFolder(4096); err != nil || folder != 1 {
+		t.Error("new sectors are not stored in the least used folder:", folder, err)
+	}
+	h.freeSpace = func(path string) (uint64, error) {
+		if path == folder {
+			return diskSpaceMargin, nil
+		}
+		return diskSpaceMargin + 1<<20, nil
+	}
+	if folder, err := h.leastUsedFolder(4096); err != nil || folder != 0 {
+		t.Error("new sectors are stored in a full folder:", folder, err)
+	}
+	if _, err := h.leastUsedFolder(2 << 20); err != HostCapacityErr {
+		t.Error("expected HostCapacityErr when no folder has room, got", err)
+	}
+	delete(h.sectors, crypto.Hash{255})
+	h.mu.Unlock()
+
+	// The free space of every folder counts towards the capacity of the host.
+	h.mu.Lock()
+	h.freeSpace = func(string) (uint64, error) { return diskSpaceMargin + 1<<20, nil }
+	h.mu.Unlock()
+	h.managedCheckDiskSpace()
+	if h.Capacity() != 2<<20 {
+		t.Error("capacity does not count the free space of every folder:", h.Capacity())
+	}
+}
@@ -0,0 +1,50 @@
+package host
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// BuildStorageProof builds a storage proof for a segment of the data formed by
+// concatenating sectors, exactly as the host builds the proofs for its
+// obligations. The ParentID of the returned proof is left empty. It is useful
+// for reproducing the proof of a known data set when debugging.
+func BuildStorageProof(sectors [][]byte, segmentIndex uint64) (types.StorageProof, error) {
+	readers := make([]io.Reader, len(sectors))
+	for i := range sectors {
+		readers[i] = bytes.NewReader(sectors[i])
+	}
+	return buildStorageProof(io.MultiReader(readers...), segmentIndex)
+}
+
+// buildStorageProof builds a storage proof for a segment of the data read
+// from r.
+func buildStorageProof(r io.Reader, segmentIndex uint64) (types.StorageProof, error) {
+	base, hashSet, err := crypto.BuildReaderProof(r, segmentIndex)
+	if err != nil {
+		return types.StorageProof{}, err
+	}
+	sp := types.StorageProof{
+		HashSet: hashSet,
+	}
+	copy(sp.Segment[:], base)
+	return sp, nil
+}
+
+// VerifyStorageProof reports whether sp proves that the segment at
+// segmentIndex belongs to a file of fileSize bytes with the provided Merkle
+// root. The final segment of a file is only checked up to the end of the file.
+func VerifyStorageProof(sp types.StorageProof, segmentIndex, fileSize uint64, root crypto.Hash) bool {
+	leaves := crypto.CalculateLeaves(fileSize)
+	if segmentIndex >= leaves {
+		return false
+	}
+	segmentLen := uint64(crypto.SegmentSize)
+	if segmentIndex == leaves-1 && fileSize%crypto.SegmentSize != 0 {
+		segmentLen = fileSize % crypto.SegmentSize
+	}
+	return crypto.VerifySegment(sp.Segment[:segmentLen], sp.HashSet, leaves, segmentIndex, root)
+}
@@ -0,0 +1,59 @@
+package host
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// TestBuildStorageProof builds storage proofs for each segment of a known set of
+// sectors and verifies them, and checks that proofs are rejected when
+// verified against the wrong segment.
+func TestBuildStorageProof(t *testing.T) {
+	// The final segment of the data is only partially filled.
+	sector1, err := crypto.RandBytes(4 * crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sector2, err := crypto.RandBytes(3*crypto.SegmentSize + 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectors := [][]byte{sector1, sector2}
+	data := append(append([]byte(nil), sectors[0]...), sectors[1]...)
+	fileSize := uint64(len(data))
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := crypto.CalculateLeaves(fileSize)
+	for i := uint64(0); i < leaves; i++ {
+		sp, err := BuildStorageProof(sectors, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyStorageProof(sp, i, fileSize, root) {
+			t.Error("valid proof of segment", i, "was rejected")
+		}
+	}
+
+	// A proof verified against the wrong segment index should be rejected.
+	sp, err := BuildStorageProof(sectors, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyStorageProof(sp, 2, fileSize, root) {
+		t.Error("proof was accepted for the wrong segment")
+	}
+	if VerifyStorageProof(sp, leaves, fileSize, root) {
+		t.Error("proof was accepted for a segment beyond the end of the file")
+	}
+
+	// A proof should be rejected if the data has changed.
+	sp.Segment[0]++
+	if VerifyStorageProof(sp, 1, fileSize, root) {
+		t.Error("proof of modified data was accepted")
+	}
+}
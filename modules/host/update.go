@@ -1,7 +1,7 @@
 package host
 
 import (
-	"os"
+	"io"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -62,52 +62,50 @@ func (h *Host) initConsensusSubscription() error {
 }
 
 // threadedCreateStorageProof creates a storage proof for a file contract
-// obligation and submits it to the blockchain. Though a lock is never held, a
-// significant amount of disk I/O happens, meaning this function should be
-// called in a separate goroutine.
-func (h *Host) threadedCreateStorageProof(obligation *contractObligation) {
+// obligation and submits it to the blockchain. 'sectors' is a copy of the
+// sectors of the obligation, taken while the caller held the host lock. Though
+// a lock is never held, a significant amount of disk I/O happens, meaning this
+// function should be called in a separate goroutine.
+func (h *Host) threadedCreateStorageProof(obligation *contractObligation, sectors []crypto.Hash) {
 	h.resourceLock.RLock()
 	defer h.resourceLock.RUnlock()
 	if build.DEBUG && h.closed {
 		panic("the close order should guarantee that threadedCreateStorageProof has access to host resources - yet host is closed!")
 	}
 
-	file, err := os.Open(obligation.Path)
+	file, err := h.managedOpenSectors(sectors)
 	if err != nil {
-		h.log.Printf("ERROR: could not open obligation %v (%v) for storage proof: %v", obligation.ID, obligation.Path, err)
+		h.managedRecordProof(obligation, modules.ProofMissingSector, err)
 		return
 	}
 	defer file.Close()
 
 	segmentIndex, err := h.cs.StorageProofSegment(obligation.ID)
 	if err != nil {
-		h.log.Printf("ERROR: could not determine storage proof index for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.managedRecordProof(obligation, modules.ProofWrongHeight, err)
 		return
 	}
-	base, hashSet, err := crypto.BuildReaderProof(file, segmentIndex)
+	sp, err := buildStorageProof(io.NewSectionReader(file, 0, file.Size()), segmentIndex)
 	if err != nil {
-		h.log.Printf("ERROR: could not construct storage proof for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.managedRecordProof(obligation, modules.ProofBuildError, err)
 		return
 	}
-	sp := types.StorageProof{
-		ParentID: obligation.ID,
-		HashSet:  hashSet,
-	}
-	copy(sp.Segment[:], base)
+	sp.ParentID = obligation.ID
 
 	// Create and send the transaction.
 	txnBuilder := h.wallet.StartTransaction()
 	txnBuilder.AddStorageProof(sp)
 	txnSet, err := txnBuilder.Sign(true)
 	if err != nil {
-		h.log.Println("couldn't sign storage proof transaction:", err)
+		h.managedRecordProof(obligation, modules.ProofBuildError, err)
 		return
 	}
 	err = h.tpool.AcceptTransactionSet(txnSet)
 	if err != nil {
-		h.log.Printf("ERROR: could not submit storage proof txn for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.managedRecordProof(obligation, modules.ProofBroadcastError, err)
 		return
 	}
+	h.managedRecordProof(obligation, "", nil)
 }
 
 // ProcessConsensusChange will be called by the consensus set every time there
@@ -213,6 +211,18 @@ func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 		delete(h.actionItems, h.blockHeight)
 	}
 
+	// Prune any obligations that have outlived their storage proof window,
+	// and warn subscribers about contracts whose window is about to open.
+	h.pruneExpiredObligations()
+	h.notifyExpiringContracts()
+
+	// Start a new bandwidth accounting period, if the current one has ended.
+	h.resetBandwidthPeriod()
+
+	// Adjust the advertised price to follow the market, if the price policy
+	// calls for it.
+	h.applyPricePolicy()
+
 	// Update the host's recent change pointer to point to the most recent
 	// change.
 	h.recentChange = cc.ID
@@ -5,9 +5,6 @@ import (
 	"errors"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -23,8 +20,57 @@ const (
 
 var (
 	// HostCapacityErr indicates that a host does not have enough room on disk
-	// to accept more files.
+	// to accept more files. It is returned if accepting a contract or revision
+	// would cause the host to store more data than allowed by TotalStorage,
+	// and is sent to the renter.
 	HostCapacityErr = errors.New("host is at capacity and cannot take more files")
+
+	// errBadSignedTxnSet is returned if the renter sends a signed transaction
+	// set that does not match the transaction set the host agreed to.
+	errBadSignedTxnSet = errors.New("renter sent bad signed transaction set")
+
+	// errEmptyTxnSet is returned if the renter sends an empty initial
+	// transaction set.
+	errEmptyTxnSet = errors.New("initial transaction set was empty")
+
+	// errContractTooSmall is returned if a new contract cannot store as much
+	// data as the host's MinContractSize. The error is sent to the renter.
+	errContractTooSmall = errors.New("contract is smaller than the minimum contract size of the host")
+
+	// errInsufficientCollateral is returned if the confirmed balance of the
+	// host's wallet cannot cover the collateral owed by the host's contracts
+	// once a new contract is formed. The error is sent to the renter.
+	errInsufficientCollateral = errors.New("host cannot cover the collateral of the contract")
+
+	// errRevisionTooSmall is returned if a revision adds less data than the
+	// host's MinRevisionSize.
+	errRevisionTooSmall = errors.New("revision adds too little data")
+
+	// errTooManyRevisions is returned if a renter revises a contract more
+	// often than the host's MaxRevisionRate allows.
+	errTooManyRevisions = errors.New("too many revisions, try again later")
+
+	// errExtensionTooLong is returned if a renter tries to extend a contract
+	// beyond the maximum duration of the host.
+	errExtensionTooLong = errors.New("contract extension exceeds the maximum duration of the host")
+
+	// errExtensionAddsData is returned if a revision that extends a contract
+	// also changes the data of the contract.
+	errExtensionAddsData = errors.New("contract extension cannot change the contract data")
+
+	// errStaleRevision is returned if a revision does not have a higher
+	// revision number than the latest revision of the contract held by the
+	// host. Revisions must be applied in order, so that the host's latest
+	// revision is always the most recent one.
+	errStaleRevision = errors.New("revision number must be greater than that of the latest revision")
+
+	// errReadOnlyContract is returned if a renter tries to revise a contract
+	// that was renewed as read-only. The error is sent to the renter.
+	errReadOnlyContract = errors.New("contract is read-only and cannot be revised")
+
+	// errNoUnlockHash is returned if a renter tries to form a contract with a
+	// host that has not yet generated an address for receiving payments.
+	errNoUnlockHash = errors.New("couldn't negotiate contract: host does not have an address")
 )
 
 // considerContract checks that the provided transaction matches the host's
@@ -35,6 +81,12 @@ func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublic
 		return errors.New("transaction should have only one file contract")
 	}
 
+	// New contracts are rejected once the host is full. Renewed contracts
+	// reuse the sectors of the original contract and do not need any space.
+	if filesize == 0 && h.availableStorage() <= 0 {
+		return HostCapacityErr
+	}
+
 	// convenience variables
 	fc := txn.FileContracts[0]
 	duration := fc.WindowStart - h.blockHeight
@@ -66,6 +118,16 @@ func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublic
 		return errors.New("file contract missed proof output not sent to void")
 	}
 
+	// Check that the contract is large enough. The renter's funds must cover
+	// storing MinContractSize bytes at the host's price for the duration of
+	// the contract, unless the contract already holds that much data.
+	if min := h.settings.MinContractSize; filesize < min {
+		minCost := h.settings.PriceForDuration(duration).Mul(types.NewCurrency64(uint64(duration))).Mul(types.NewCurrency64(min))
+		if fc.ValidProofOutputs[0].Value.Cmp(minCost) < 0 {
+			return errContractTooSmall
+		}
+	}
+
 	// check unlock hash
 	uc := types.UnlockConditions{
 		PublicKeys:         []types.SiaPublicKey{renterKey, h.publicKey},
@@ -75,12 +137,27 @@ func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublic
 		return errors.New("bad file contract unlock hash")
 	}
 
+	// check that the host is willing to contract with the renter
+	if !h.renterPolicy.AcceptContract(fc.ValidProofOutputs[0].UnlockHash, fc) {
+		return errRenterRejected
+	}
+
 	return nil
 }
 
 // considerRevision checks that the provided file contract revision is still
-// acceptable to the host.
+// acceptable to the host. A revision either adds data to the contract, or
+// extends the contract by moving its storage proof window later, in which case
+// the renter must pay for storing the existing data over the new duration.
+// Every revision considered counts against the revision rate limit of the
+// obligation, so the caller must hold the lock of the obligation.
 func (h *Host) considerRevision(txn types.Transaction, obligation *contractObligation) error {
+	// Throttle renters that revise the contract too frequently. Rejected
+	// revisions also count against the limit.
+	if !obligation.allowRevision(h.settings.MaxRevisionRate, h.clock.Now()) {
+		return errTooManyRevisions
+	}
+
 	// Check that there is only one revision.
 	if len(txn.FileContractRevisions) != 1 {
 		return errors.New("transaction should have only one revision")
@@ -88,18 +165,16 @@ func (h *Host) considerRevision(txn types.Transaction, obligation *contractOblig
 
 	// calculate minimum expected output value
 	rev := txn.FileContractRevisions[0]
-	duration := types.NewCurrency64(uint64(obligation.windowStart() - h.blockHeight))
-	minHostPrice := types.NewCurrency64(rev.NewFileSize).Mul(duration).Mul(h.settings.Price)
+	extension := rev.NewWindowStart != obligation.windowStart()
+	duration := rev.NewWindowStart - h.blockHeight
+	price := h.settings.PriceForDuration(obligation.tierDuration(h.blockHeight))
+	minHostPrice := types.NewCurrency64(rev.NewFileSize).Mul(types.NewCurrency64(uint64(duration))).Mul(price)
 	expectedPayout := types.PostTax(h.blockHeight, obligation.payout())
 
 	switch {
 	// these fields should never change
 	case rev.ParentID != obligation.ID:
 		return errors.New("bad revision parent ID")
-	case rev.NewWindowStart != obligation.windowStart():
-		return errors.New("bad revision window start")
-	case rev.NewWindowEnd != obligation.windowEnd():
-		return errors.New("bad revision window end")
 	case rev.NewUnlockHash != obligation.unlockHash():
 		return errors.New("bad revision unlock hash")
 	case rev.UnlockConditions.UnlockHash() != obligation.unlockHash():
@@ -112,15 +187,31 @@ func (h *Host) considerRevision(txn types.Transaction, obligation *contractOblig
 		rev.NewMissedProofOutputs[1].UnlockHash != obligation.missedProofUnlockHash():
 		return errors.New("bad revision proof outputs")
 
+	// the window may only move later, and must keep its size
+	case rev.NewWindowStart < obligation.windowStart():
+		return errors.New("bad revision window start")
+	case rev.NewWindowEnd-rev.NewWindowStart != obligation.windowEnd()-obligation.windowStart():
+		return errors.New("bad revision window end")
+
 	case rev.NewRevisionNumber <= obligation.revisionNumber():
-		return errors.New("revision must have higher revision number")
+		return errStaleRevision
 
-	case rev.NewFileSize > uint64(h.spaceRemaining):
-		return errors.New("revision file size is too large")
-	case rev.NewFileSize <= obligation.fileSize():
+	case extension && rev.NewWindowStart > h.blockHeight+h.settings.MaxDuration:
+		return errExtensionTooLong
+	case extension && (rev.NewFileSize != obligation.fileSize() || rev.NewFileMerkleRoot != obligation.merkleRoot()):
+		return errExtensionAddsData
+
+	case !extension && rev.NewFileSize <= obligation.fileSize():
 		return errors.New("revision must add data")
 	case rev.NewFileSize-obligation.fileSize() > maxRevisionSize:
 		return errors.New("revision adds too much data")
+	case rev.NewFileSize > obligation.fileSize() && int64(rev.NewFileSize-obligation.fileSize()) > h.availableStorage():
+		// only the added data is compared against the capacity, so that
+		// extensions are accepted by a host whose TotalStorage was reduced
+		// below the storage in use
+		return HostCapacityErr
+	case !extension && rev.NewFileSize-obligation.fileSize() < h.settings.MinRevisionSize:
+		return errRevisionTooSmall
 
 	case rev.NewValidProofOutputs[0].Value.Add(rev.NewValidProofOutputs[1].Value).Cmp(expectedPayout) != 0,
 		// valid and missing outputs should still sum to payout
@@ -129,6 +220,7 @@ func (h *Host) considerRevision(txn types.Transaction, obligation *contractOblig
 
 	case rev.NewValidProofOutputs[1].Value.Cmp(minHostPrice) < 0:
 		// outputs should have been adjusted proportional to the new filesize
+		// and duration
 		return errors.New("revision price is too small")
 
 	case rev.NewMissedProofOutputs[0].Value.Cmp(rev.NewValidProofOutputs[0].Value) != 0:
@@ -138,11 +230,32 @@ func (h *Host) considerRevision(txn types.Transaction, obligation *contractOblig
 	return nil
 }
 
+// managedReserveRevision checks that the provided revision is acceptable to
+// the host, and reserves storage for the data that the revision adds. The
+// check and the reservation are made atomically, so that concurrent revisions
+// cannot overcommit the host's storage. The size of the reservation is
+// returned, and must be released by the caller.
+func (h *Host) managedReserveRevision(txn types.Transaction, obligation *contractObligation) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err := h.considerRevision(txn, obligation)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(txn.FileContractRevisions[0].NewFileSize - obligation.fileSize())
+	err = h.reserveStorage(size)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // managedNegotiateContract negotiates a file contract with a renter, and adds
 // the metadata to the host's obligation set. The filesize, merkleRoot, and
-// filename arguments are provided to make managedNegotiateContract usable
-// with both rpcUpload and rpcRenew.
-func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRoot crypto.Hash, filename string) error {
+// sectors arguments are provided to make managedNegotiateContract usable with
+// both rpcUpload and rpcRenew. If readOnly is set, the contract can never be
+// revised.
+func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRoot crypto.Hash, sectors []crypto.Hash, readOnly bool) error {
 	// allow 5 minutes for contract negotiation
 	err := conn.SetDeadline(time.Now().Add(5 * time.Minute))
 	if err != nil {
@@ -168,7 +281,8 @@ func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRo
 		return errors.New("couldn't read the initial transaction set: " + err.Error())
 	}
 	if len(unsignedTxnSet) == 0 {
-		return errors.New("initial transaction set was empty")
+		h.managedRecordRejection(modules.RejectionBadTransaction, errEmptyTxnSet)
+		return errEmptyTxnSet
 	}
 
 	// The transaction with the file contract should be the last transaction in
@@ -180,6 +294,17 @@ func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRo
 	h.mu.RUnlock()
 	if err != nil {
 		_ = encoding.WriteObject(conn, err.Error())
+		reason := modules.RejectionBadTerms
+		if err == errRenterRejected {
+			reason = modules.RejectionRenterPolicy
+		}
+		h.managedRecordRejection(reason, err)
+		return errors.New("rejected file contract: " + err.Error())
+	}
+	err = h.managedCheckCollateral(nil, filesize, contractTxn.FileContracts[0].WindowStart)
+	if err != nil {
+		_ = encoding.WriteObject(conn, err.Error())
+		h.managedRecordRejection(modules.RejectionInsufficientCollateral, err)
 		return errors.New("rejected file contract: " + err.Error())
 	}
 	if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
@@ -202,11 +327,13 @@ func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRo
 	// The host will verify that the signed transaction set provided by the
 	// renter is the same transaction set that the host considered previously.
 	if len(signedTxnSet) != len(unsignedTxnSet) {
-		return errors.New("renter sent bad signed transaction set")
+		h.managedRecordRejection(modules.RejectionBadTransaction, errBadSignedTxnSet)
+		return errBadSignedTxnSet
 	}
 	for i := range signedTxnSet {
 		if signedTxnSet[i].ID() != unsignedTxnSet[i].ID() {
-			return errors.New("renter sent bad signed transaction set")
+			h.managedRecordRejection(modules.RejectionBadTransaction, errBadSignedTxnSet)
+			return errBadSignedTxnSet
 		}
 	}
 
@@ -216,6 +343,7 @@ func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRo
 	txnBuilder := h.wallet.RegisterTransaction(signedTxn, parents)
 	signedTxnSet, err = txnBuilder.Sign(true)
 	if err != nil {
+		h.managedRecordRejection(modules.RejectionInsufficientFunds, err)
 		return err
 	}
 	err = h.tpool.AcceptTransactionSet(signedTxnSet)
@@ -224,16 +352,20 @@ func (h *Host) managedNegotiateContract(conn net.Conn, filesize uint64, merkleRo
 		err = nil
 	}
 	if err != nil {
+		h.managedRecordRejection(modules.RejectionBadTransaction, err)
 		return err
 	}
 
-	// Add this contract to the host's list of obligations.
+	// Add this contract to the host's list of obligations, recording the
+	// collateral owed at the host's collateral rate.
 	co := &contractObligation{
 		ID:                contractTxn.FileContractID(0),
 		OriginTransaction: contractTxn,
-		Path:              filename,
+		Sectors:           sectors,
+		ReadOnly:          readOnly,
 	}
 	h.mu.Lock()
+	co.Collateral = h.contractCollateral(filesize, contractTxn.FileContracts[0].WindowStart)
 	h.addObligation(co)
 	h.mu.Unlock()
 	if err != nil {
@@ -254,16 +386,19 @@ func (h *Host) managedRPCUpload(conn net.Conn) error {
 	// Check that the host has grabbed an address from the wallet.
 	h.mu.RLock()
 	uh := h.settings.UnlockHash
-	h.fileCounter++ // Harmless to increment the file counter in the event of an error.
-	filename := filepath.Join(h.persistDir, strconv.Itoa(int(h.fileCounter)))
 	h.mu.RUnlock()
 
 	if uh == (types.UnlockHash{}) {
-		return errors.New("couldn't negotiate contract: host does not have an address")
+		h.managedRecordRejection(modules.RejectionNotAccepting, errNoUnlockHash)
+		return errNoUnlockHash
+	}
+	err := h.managedCheckMaintenance()
+	if err != nil {
+		return err
 	}
 
 	// negotiate expecting empty Merkle root
-	return h.managedNegotiateContract(conn, 0, crypto.Hash{}, filename)
+	return h.managedNegotiateContract(conn, 0, crypto.Hash{}, nil, false)
 }
 
 // managedRPCRevise is an RPC that allows a renter to revise a file contract. It will
@@ -275,18 +410,35 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 		return errors.New("couldn't read contract ID: " + err.Error())
 	}
 
+	// no new data is accepted while the host is in maintenance mode
+	err := h.managedCheckMaintenance()
+	if err != nil {
+		return err
+	}
+
 	// remove conn deadline while we wait for lock and rebuild the Merkle tree.
-	err := conn.SetDeadline(time.Now().Add(15 * time.Minute))
+	err = conn.SetDeadline(time.Now().Add(15 * time.Minute))
 	if err != nil {
 		return err
 	}
 
 	h.mu.RLock()
 	obligation, exists := h.obligationsByID[fcid]
+	readOnly := exists && obligation.ReadOnly
 	h.mu.RUnlock()
 	if !exists {
 		return errors.New("no record of that contract")
 	}
+	// Read-only contracts are refused before the Merkle tree is rebuilt, so
+	// that attempts to revise them cost the host nothing. The first proposed
+	// revision is read so that the renter receives the reason.
+	if readOnly {
+		var revTxn types.Transaction
+		if encoding.ReadObject(conn, &revTxn, types.BlockSizeLimit) == nil {
+			_ = encoding.WriteObject(conn, errReadOnlyContract.Error())
+		}
+		return errReadOnlyContract
+	}
 	// need to protect against two simultaneous revisions to the same
 	// contract; this can cause inconsistency and data loss, making storage
 	// proofs impossible
@@ -296,15 +448,16 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 	obligation.mu.Lock()
 	defer obligation.mu.Unlock()
 
-	// open the file in append mode
-	file, err := os.OpenFile(obligation.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0660)
+	// rebuild current Merkle tree from the sectors of the obligation
+	h.mu.RLock()
+	roots := append([]crypto.Hash(nil), obligation.Sectors...)
+	h.mu.RUnlock()
+	file, err := h.managedOpenSectors(roots)
 	if err != nil {
 		return err
 	}
-
-	// rebuild current Merkle tree
 	tree := crypto.NewTree()
-	err = tree.ReadSegments(file)
+	err = tree.ReadSegments(io.NewSectionReader(file, 0, file.Size()))
 	if err != nil {
 		// Error does not need to be checked when closing the file, already
 		// there have been issues related to the filesystem.
@@ -313,8 +466,16 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 	}
 
 	// accept new revisions in a loop. The final good transaction will be
-	// submitted to the blockchain.
+	// submitted to the blockchain. Storage is reserved for each revision
+	// when it is accepted, and the reservation is released once the data has
+	// been stored, or when the loop exits.
 	revisionErr := func() error {
+		var reserved int64
+		defer func() {
+			h.mu.Lock()
+			h.releaseStorage(reserved)
+			h.mu.Unlock()
+		}()
 		for {
 			// allow 5 minutes between revisions
 			err := conn.SetDeadline(time.Now().Add(5 * time.Minute))
@@ -338,10 +499,9 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 				return err
 			}
 
-			// check revision against original file contract
-			h.mu.RLock()
-			err = h.considerRevision(revTxn, obligation)
-			h.mu.RUnlock()
+			// check revision against original file contract, and reserve
+			// storage for the new data
+			reserved, err = h.managedReserveRevision(revTxn, obligation)
 			if err != nil {
 				// There is nothing that can be done if there is an error while
 				// writing to a connection.
@@ -349,6 +509,16 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 				return err
 			}
 
+			// check that the host can cover the collateral owed for the
+			// revised contract
+			rev := revTxn.FileContractRevisions[0]
+			err = h.managedCheckCollateral(obligation, rev.NewFileSize, rev.NewWindowStart)
+			if err != nil {
+				_ = encoding.WriteObject(conn, err.Error())
+				h.managedRecordRejection(modules.RejectionInsufficientCollateral, err)
+				return err
+			}
+
 			// indicate acceptance
 			if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
 				return errors.New("couldn't write acceptance: " + err.Error())
@@ -356,9 +526,14 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 
 			// read piece
 			// TODO: simultaneously read into tree and file
-			rev := revTxn.FileContractRevisions[0]
 			piece := make([]byte, rev.NewFileSize-obligation.fileSize())
-			_, err = io.ReadFull(conn, piece)
+			n, err := io.ReadFull(conn, piece)
+			if n > 0 {
+				h.mu.RLock()
+				renter := obligation.renterUnlockHash()
+				h.mu.RUnlock()
+				h.managedRecordBandwidth(renter, 0, uint64(n))
+			}
 			if err != nil {
 				return errors.New("couldn't read piece data: " + err.Error())
 			}
@@ -384,13 +559,35 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 			}
 			revTxn.TransactionSignatures[1].Signature = encodedSig[:]
 
-			// append piece to file
-			if _, err := file.Write(piece); err != nil {
-				return errors.New("couldn't write new data to file: " + err.Error())
+			// store the piece as a sector, then save the updated obligation
+			// to disk
+			sectorRoot, err := crypto.ReaderMerkleRoot(bytes.NewReader(piece))
+			if err != nil {
+				return err
+			}
+			// extensions carry no data, and do not add a sector. The sector
+			// is written before the host lock is acquired.
+			if len(piece) != 0 {
+				err = h.managedAddSector(sectorRoot, piece)
+				if err != nil {
+					return errors.New("couldn't write new data to sector: " + err.Error())
+				}
 			}
-
-			// save updated obligation to disk
 			h.mu.Lock()
+			h.releaseStorage(reserved)
+			reserved = 0
+			// the obligation may have been revised by a revision seen on the
+			// blockchain while the piece was being read
+			if rev.NewRevisionNumber <= obligation.revisionNumber() {
+				if len(piece) != 0 {
+					h.removeSector(sectorRoot)
+				}
+				h.mu.Unlock()
+				return errStaleRevision
+			}
+			if len(piece) != 0 {
+				obligation.Sectors = append(obligation.Sectors, sectorRoot)
+			}
 			h.reviseObligation(revTxn)
 			h.mu.Unlock()
 
@@ -414,14 +611,21 @@ func (h *Host) managedRPCRevise(conn net.Conn) error {
 
 // managedRPCRenew is an RPC that allows a renter to renew a file contract. The
 // protocol is identical to standard contract negotiation, except that the
-// Merkle root is copied over from the old contract.
-func (h *Host) managedRPCRenew(conn net.Conn) error {
+// Merkle root is copied over from the old contract. If readOnly is set, the
+// renewed contract can never be revised.
+func (h *Host) managedRPCRenew(conn net.Conn, readOnly bool) error {
 	// read ID of contract to be renewed
 	var fcid types.FileContractID
 	if err := encoding.ReadObject(conn, &fcid, crypto.HashSize); err != nil {
 		return errors.New("couldn't read contract ID: " + err.Error())
 	}
 
+	// renewals are new contracts, which are refused in maintenance mode
+	err := h.managedCheckMaintenance()
+	if err != nil {
+		return err
+	}
+
 	h.mu.RLock()
 	obligation, exists := h.obligationsByID[fcid]
 	h.mu.RUnlock()
@@ -432,27 +636,11 @@ func (h *Host) managedRPCRenew(conn net.Conn) error {
 	obligation.mu.Lock()
 	defer obligation.mu.Unlock()
 
-	// copy over old file data
+	// The renewed contract references the same sectors as the old contract,
+	// no data needs to be copied.
 	h.mu.RLock()
-	h.fileCounter++
-	filename := filepath.Join(h.persistDir, strconv.Itoa(int(h.fileCounter)))
+	sectors := append([]crypto.Hash(nil), obligation.Sectors...)
 	h.mu.RUnlock()
 
-	// TODO: What happens if the copy operation fails partway through? Does
-	// there need to be garbage collection at startup for failed uploads that
-	// might still be on disk?
-	old, err := os.Open(obligation.Path)
-	if err != nil {
-		return err
-	}
-	renewed, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(renewed, old)
-	if err != nil {
-		return err
-	}
-
-	return h.managedNegotiateContract(conn, obligation.fileSize(), obligation.merkleRoot(), filename)
+	return h.managedNegotiateContract(conn, obligation.fileSize(), obligation.merkleRoot(), sectors, readOnly)
 }
@@ -1,9 +1,11 @@
 package host
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -176,6 +178,84 @@ func TestRPCUpload(t *testing.T) {
 	}
 }
 
+// TestHostFull fills the host to capacity and checks that new contracts and
+// revisions are rejected, while the stored data can still be downloaded.
+func TestHostFull(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostTester("TestHostFull")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadData, err := ht.uploadFile("TestHostFull - 1", renewDisabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reduce the total storage of the host to the amount of storage in use.
+	settings := ht.host.Settings()
+	settings.TotalStorage -= ht.host.Capacity()
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm := ht.host.Metrics()
+	if hm.RemainingStorage > 0 {
+		t.Error("host metrics report remaining storage on a full host:", hm.RemainingStorage)
+	}
+	if hm.TotalStorage != settings.TotalStorage {
+		t.Error("host metrics report the wrong total storage:", hm.TotalStorage)
+	}
+
+	// New contracts should be rejected.
+	ht.host.mu.Lock()
+	err = ht.host.considerContract(types.Transaction{FileContracts: []types.FileContract{{}}}, types.SiaPublicKey{}, 0, crypto.Hash{})
+	if err != HostCapacityErr {
+		t.Error("expected HostCapacityErr when forming a contract, got", err)
+	}
+
+	// Revisions that add data should be rejected.
+	var ob *contractObligation
+	for _, ob = range ht.host.obligationsByID {
+	}
+	if ob == nil || !ob.hasRevision() {
+		t.Fatal("host does not have a revised obligation")
+	}
+	rev := ob.RevisionTransaction.FileContractRevisions[0]
+	rev.NewRevisionNumber++
+	rev.NewFileSize += crypto.SegmentSize
+	err = ht.host.considerRevision(types.Transaction{FileContractRevisions: []types.FileContractRevision{rev}}, ob)
+	if err != HostCapacityErr {
+		t.Error("expected HostCapacityErr when revising a contract, got", err)
+	}
+
+	// New sectors should not be written to disk.
+	data, err := crypto.RandBytes(crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.addSector(root, data)
+	if err != HostCapacityErr {
+		t.Error("expected HostCapacityErr when adding a sector, got", err)
+	}
+	ht.host.mu.Unlock()
+
+	// The stored file should still be downloadable.
+	var buf bytes.Buffer
+	err = ht.renter.DownloadTo("TestHostFull - 1", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), uploadData) {
+		t.Error("downloaded data does not match uploaded data")
+	}
+}
+
 // TestRPCRenew attempts to upload a file to the host, adding coverage to the
 // upload function.
 func TestRPCRenew(t *testing.T) {
@@ -426,3 +506,481 @@ func TestRestartCorruptSuccessObligation(t *testing.T) {
 		t.Error("host is reporting losses on the file contract")
 	}
 }
+
+// newRevisableObligation returns an obligation holding 'size' bytes and funded
+// by 'payout', whose proof window opens 'duration' blocks after the current
+// height of the host and lasts 10 blocks.
+func newRevisableObligation(h *Host, id byte, size uint64, payout types.Currency, duration types.BlockHeight) *contractObligation {
+	co := testObligation(id)
+	fc := &co.OriginTransaction.FileContracts[0]
+	fc.UnlockHash = types.UnlockConditions{}.UnlockHash()
+	fc.FileSize = size
+	fc.Payout = payout
+	fc.WindowStart = h.blockHeight + duration
+	fc.WindowEnd = fc.WindowStart + 10
+	return co
+}
+
+// testRevision returns a transaction holding revision 'number' of 'co', which
+// stores 'size' bytes and moves the proof window to open at 'windowStart'. The
+// host is paid 'hostPayout' out of the payout of the contract, and the renter
+// is paid the rest.
+func testRevision(h *Host, co *contractObligation, number, size uint64, windowStart types.BlockHeight, hostPayout types.Currency) types.Transaction {
+	payout := types.PostTax(h.blockHeight, co.payout())
+	outputs := []types.SiacoinOutput{{Value: payout.Sub(hostPayout)}, {Value: hostPayout}}
+	return types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID:              co.ID,
+			NewRevisionNumber:     number,
+			NewFileSize:           size,
+			NewWindowStart:        windowStart,
+			NewWindowEnd:          windowStart + co.windowEnd() - co.windowStart(),
+			NewValidProofOutputs:  outputs,
+			NewMissedProofOutputs: append([]types.SiacoinOutput(nil), outputs...),
+			NewUnlockHash:         co.unlockHash(),
+		}},
+	}
+}
+
+// TestRevisionLimits hammers the host with rapid revisions and checks that
+// the host starts rejecting them once MaxRevisionRate has been reached, and
+// that revisions adding less than MinRevisionSize bytes are rejected.
+func TestRevisionLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestRevisionLimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings.MaxRevisionRate = 10
+	h.settings.MinRevisionSize = 4096
+
+	// Create an obligation and a revision that is valid except for the
+	// amount of data it adds.
+	co := newRevisableObligation(h, 0, 0, types.ZeroCurrency, 10)
+	txn := testRevision(h, co, 1, 1, co.windowStart(), types.ZeroCurrency)
+
+	// Submit revisions up to the limit. They should be rejected for being
+	// too small, but not for being too frequent.
+	for i := uint64(0); i < h.settings.MaxRevisionRate; i++ {
+		err = h.considerRevision(txn, co)
+		if err != errRevisionTooSmall {
+			t.Fatalf("revision %v: expected %v, got %v", i, errRevisionTooSmall, err)
+		}
+	}
+
+	// Any further revisions should be throttled.
+	for i := 0; i < 5; i++ {
+		err = h.considerRevision(txn, co)
+		if err != errTooManyRevisions {
+			t.Fatalf("expected %v, got %v", errTooManyRevisions, err)
+		}
+	}
+
+	// Once the minute has passed, revisions are accepted again.
+	co.revisionWindowStart = co.revisionWindowStart.Add(-time.Minute)
+	err = h.considerRevision(txn, co)
+	if err != errRevisionTooSmall {
+		t.Fatalf("expected %v, got %v", errRevisionTooSmall, err)
+	}
+
+	// A limit of zero disables throttling.
+	h.settings.MaxRevisionRate = 0
+	h.settings.MinRevisionSize = 0
+	for i := 0; i < 50; i++ {
+		err = h.considerRevision(txn, co)
+		if err == errTooManyRevisions || err == errRevisionTooSmall {
+			t.Fatal("revision was rejected despite the limits being disabled:", err)
+		}
+	}
+}
+
+// TestConcurrentRevisionReservations launches simultaneous revisions against
+// a nearly full host, and checks that the storage promised to the revisions
+// never exceeds the host's TotalStorage.
+func TestConcurrentRevisionReservations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestConcurrentRevisionReservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+
+	// Leave room for exactly 'fits' revisions.
+	const revisionSize = 4096
+	const fits = 5
+	const attempts = 20
+	h.mu.Lock()
+	h.settings.Price = types.ZeroCurrency
+	h.settings.MinRevisionSize = 0
+	h.settings.MaxRevisionRate = 0
+	h.settings.TotalStorage = fits*revisionSize + revisionSize/2
+	h.spaceRemaining = h.settings.TotalStorage
+	h.mu.Unlock()
+
+	// Create one obligation per revision, each revision adding revisionSize
+	// bytes.
+	obligations := make([]*contractObligation, attempts)
+	txns := make([]types.Transaction, attempts)
+	for i := range obligations {
+		co := newRevisableObligation(h, byte(i), 0, types.ZeroCurrency, 10)
+		obligations[i] = co
+		txns[i] = testRevision(h, co, 1, revisionSize, co.windowStart(), types.ZeroCurrency)
+	}
+
+	// Submit every revision at once. Each accepted revision holds its
+	// reservation for a moment, as if the data were still in transit, and
+	// then stores its data.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var accepted, full int
+	for i := range obligations {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reserved, err := h.managedReserveRevision(txns[i], obligations[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if err == HostCapacityErr {
+				full++
+				return
+			} else if err != nil {
+				t.Error(err)
+				return
+			}
+			accepted++
+
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.reservedStorage > h.settings.TotalStorage {
+				t.Error("reserved storage exceeds total storage:", h.reservedStorage)
+			}
+			data, err := crypto.RandBytes(int(reserved))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			h.releaseStorage(reserved)
+			err = h.addSector(crypto.HashBytes(data), data)
+			if err != nil {
+				t.Error("could not store the data of an accepted revision:", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted != fits || full != attempts-fits {
+		t.Fatalf("expected %v revisions to be accepted and %v rejected, got %v and %v", fits, attempts-fits, accepted, full)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.reservedStorage != 0 {
+		t.Error("storage reservations were not released:", h.reservedStorage)
+	}
+	if h.spaceRemaining < 0 || h.settings.TotalStorage-h.spaceRemaining != fits*revisionSize {
+		t.Error("host committed the wrong amount of storage:", h.settings.TotalStorage-h.spaceRemaining)
+	}
+}
+
+// TestContractExtension checks that the host accepts revisions that extend a
+// contract within its maximum duration, and rejects extensions beyond it.
+func TestContractExtension(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestContractExtension")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings.Price = types.NewCurrency64(1)
+	h.settings.Collateral = types.NewCurrency64(1)
+	h.settings.MaxDuration = 100
+	h.settings.MaxRevisionRate = 0
+	h.settings.MinRevisionSize = 4096
+
+	// Create an obligation holding 100 bytes.
+	co := newRevisableObligation(h, 0, 100, types.NewCurrency64(1e6), 10)
+	h.addObligation(co)
+
+	// extend creates a revision that moves the window of the obligation to
+	// start at 'windowStart', paying the host for the full duration.
+	extend := func(windowStart types.BlockHeight) types.Transaction {
+		hostPayout := types.NewCurrency64(co.fileSize()).Mul(types.NewCurrency64(uint64(windowStart - h.blockHeight))).Mul(h.settings.Price)
+		return testRevision(h, co, co.revisionNumber()+1, co.fileSize(), windowStart, hostPayout)
+	}
+
+	// Extensions beyond the maximum duration should be rejected.
+	err = h.considerRevision(extend(h.blockHeight+h.settings.MaxDuration+1), co)
+	if err != errExtensionTooLong {
+		t.Fatalf("expected %v, got %v", errExtensionTooLong, err)
+	}
+
+	// Extensions that change the data should be rejected.
+	txn := extend(h.blockHeight + h.settings.MaxDuration)
+	txn.FileContractRevisions[0].NewFileSize += 4096
+	err = h.considerRevision(txn, co)
+	if err != errExtensionAddsData {
+		t.Fatalf("expected %v, got %v", errExtensionAddsData, err)
+	}
+
+	// Extensions that do not pay for the new duration should be rejected.
+	txn = extend(h.blockHeight + 50)
+	txn.FileContractRevisions[0].NewWindowStart += 10
+	txn.FileContractRevisions[0].NewWindowEnd += 10
+	err = h.considerRevision(txn, co)
+	if err == nil || err == errExtensionTooLong {
+		t.Fatal("expected underpaid extension to be rejected, got", err)
+	}
+
+	// An extension within the maximum duration should be accepted, and
+	// should move the window and collateral of the obligation. Extensions add
+	// no data, so they are accepted even if TotalStorage was reduced below the
+	// storage in use.
+	h.spaceRemaining = -4096
+	txn = extend(h.blockHeight + h.settings.MaxDuration)
+	err = h.considerRevision(txn, co)
+	if err != nil {
+		t.Fatal("extension within the maximum duration was rejected:", err)
+	}
+	err = h.reserveStorage(0)
+	if err != nil {
+		t.Fatal("could not reserve storage for an extension:", err)
+	}
+	h.reviseObligation(txn)
+	if co.windowStart() != h.blockHeight+h.settings.MaxDuration || co.windowEnd() != co.windowStart()+10 {
+		t.Error("extension did not move the window of the obligation:", co.windowStart(), co.windowEnd())
+	}
+	if co.Collateral.Cmp(h.contractCollateral(co.fileSize(), co.windowStart())) != 0 {
+		t.Error("extension did not adjust the collateral of the obligation:", co.Collateral)
+	}
+}
+
+// TestStaleRevision checks that the host rejects revisions whose revision
+// number is not greater than that of the latest revision of the contract,
+// while accepting revisions that are in order.
+func TestStaleRevision(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestStaleRevision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings.Price = types.NewCurrency64(1)
+	h.settings.MaxDuration = 100
+	h.settings.MaxRevisionRate = 0
+
+	// Create an obligation holding 100 bytes.
+	co := newRevisableObligation(h, 0, 100, types.NewCurrency64(1e6), 10)
+	h.addObligation(co)
+
+	// revision creates a revision with the provided revision number that
+	// extends the contract to start at 'windowStart'.
+	revision := func(number uint64, windowStart types.BlockHeight) types.Transaction {
+		hostPayout := types.NewCurrency64(co.fileSize()).Mul(types.NewCurrency64(uint64(windowStart - h.blockHeight))).Mul(h.settings.Price)
+		return testRevision(h, co, number, co.fileSize(), windowStart, hostPayout)
+	}
+
+	// Apply revision 2.
+	txn := revision(2, h.blockHeight+50)
+	err = h.considerRevision(txn, co)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.reviseObligation(txn)
+
+	// Revision 1 arrives out of order, and should be rejected, as should a
+	// second revision 2.
+	err = h.considerRevision(revision(1, h.blockHeight+60), co)
+	if err != errStaleRevision {
+		t.Fatalf("expected %v, got %v", errStaleRevision, err)
+	}
+	err = h.considerRevision(revision(2, h.blockHeight+60), co)
+	if err != errStaleRevision {
+		t.Fatalf("expected %v, got %v", errStaleRevision, err)
+	}
+	if co.revisionNumber() != 2 || co.windowStart() != h.blockHeight+50 {
+		t.Error("stale revision was applied")
+	}
+
+	// Revision 3 is in order, and should be accepted.
+	err = h.considerRevision(revision(3, h.blockHeight+60), co)
+	if err != nil {
+		t.Fatal("in-order revision was rejected:", err)
+	}
+}
+
+// TestMinContractSize sets a minimum contract size, and checks that contracts
+// whose funds cannot store that much data are rejected.
+func TestMinContractSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestMinContractSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const minSize = 1000
+	settings := ht.host.Settings()
+	settings.Price = types.NewCurrency64(1)
+	settings.MinContractSize = minSize
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// contractTxn creates a contract with funds for storing 'size' bytes.
+	contractTxn := func(size uint64) types.Transaction {
+		txn := ht.contractTxn(types.SiaPublicKey{}, types.UnlockHash{1})
+		duration := settings.MaxDuration
+		txn.FileContracts[0].ValidProofOutputs[0].Value = types.NewCurrency64(size * uint64(duration))
+		return txn
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(contractTxn(minSize-1), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != errContractTooSmall {
+		t.Fatal("expected errContractTooSmall, got", err)
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(contractTxn(minSize), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != nil {
+		t.Fatal("contract of the minimum size was rejected:", err)
+	}
+
+	// A minimum of zero accepts the small contract.
+	settings.MinContractSize = 0
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.RLock()
+	err = ht.host.considerContract(contractTxn(minSize-1), types.SiaPublicKey{}, 0, crypto.Hash{})
+	ht.host.mu.RUnlock()
+	if err != nil {
+		t.Fatal("small contract was rejected without a minimum:", err)
+	}
+
+	// The minimum cannot exceed the total storage of the host.
+	settings.MinContractSize = uint64(settings.TotalStorage) + 1
+	err = ht.host.SetSettings(settings)
+	if err != errMinContractSize {
+		t.Fatal("expected errMinContractSize, got", err)
+	}
+}
+
+// TestPriceTiers forms contracts of two durations with a host that prices
+// storage by duration, and checks that each contract is charged the price of
+// its tier.
+func TestPriceTiers(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestPriceTiers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tiers must be ordered by duration, and must cover the max duration.
+	settings := ht.host.Settings()
+	settings.MaxDuration = 100
+	settings.WindowSize = 1
+	settings.MaxRevisionRate = 0
+	settings.MinRevisionSize = 0
+	settings.PriceTiers = []modules.PriceTier{
+		{MaxDuration: 50, Price: types.NewCurrency64(1)},
+		{MaxDuration: 20, Price: types.NewCurrency64(3)},
+	}
+	err = ht.host.SetSettings(settings)
+	if err != errPriceTierOrder {
+		t.Fatal("expected errPriceTierOrder, got", err)
+	}
+	settings.PriceTiers = []modules.PriceTier{
+		{MaxDuration: 20, Price: types.NewCurrency64(3)},
+		{MaxDuration: 50, Price: types.NewCurrency64(1)},
+	}
+	err = ht.host.SetSettings(settings)
+	if err != errPriceTierCoverage {
+		t.Fatal("expected errPriceTierCoverage, got", err)
+	}
+	settings.PriceTiers[1].MaxDuration = settings.MaxDuration
+	settings.Price = types.NewCurrency64(2)
+	err = ht.host.SetSettings(settings)
+	if err != errPriceNotTier {
+		t.Fatal("expected errPriceNotTier, got", err)
+	}
+	settings.Price = types.NewCurrency64(1)
+	tiers := settings.PriceTiers
+	settings.PriceTiers = make([]modules.PriceTier, maxPriceTiers+1)
+	for i := range settings.PriceTiers {
+		settings.PriceTiers[i] = modules.PriceTier{MaxDuration: types.BlockHeight(i+1) * settings.MaxDuration, Price: settings.Price}
+	}
+	err = ht.host.SetSettings(settings)
+	if err != errTooManyPriceTiers {
+		t.Fatal("expected errTooManyPriceTiers, got", err)
+	}
+	settings.PriceTiers = tiers
+	err = ht.host.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := ht.host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// revise creates a revision that adds 'size' bytes to a new obligation
+	// lasting 'duration' blocks, paying the host 'price' per byte per block.
+	const size = 4096
+	revise := func(duration types.BlockHeight, price types.Currency) (types.Transaction, *contractObligation) {
+		co := newRevisableObligation(h, byte(duration), 0, types.NewCurrency64(1e9), duration)
+		hostPayout := price.Mul(types.NewCurrency64(size)).Mul(types.NewCurrency64(uint64(duration)))
+		return testRevision(h, co, 1, size, co.windowStart(), hostPayout), co
+	}
+
+	// A short contract is charged the price of the first tier, and a long
+	// contract the price of the second.
+	for _, duration := range []types.BlockHeight{10, 80} {
+		price := settings.PriceForDuration(duration)
+		txn, co := revise(duration, price)
+		err = h.considerRevision(txn, co)
+		if err != nil {
+			t.Fatalf("revision paying the price of its tier was rejected for a duration of %v: %v", duration, err)
+		}
+		txn, co = revise(duration, price.Sub(types.NewCurrency64(1)))
+		err = h.considerRevision(txn, co)
+		if err == nil {
+			t.Fatalf("revision paying less than the price of its tier was accepted for a duration of %v", duration)
+		}
+	}
+
+	// The cheaper price of the long contract is not enough for a short one.
+	txn, co := revise(10, settings.PriceForDuration(80))
+	if h.considerRevision(txn, co) == nil {
+		t.Fatal("short contract was charged the price of the long tier")
+	}
+
+	// The tier is locked in when the contract is formed, so a long contract
+	// keeps the price of its tier once only a short duration remains.
+	h.blockHeight += 100
+	txn, co = revise(10, settings.PriceForDuration(80))
+	co.FormationHeight = h.blockHeight - 70
+	err = h.considerRevision(txn, co)
+	h.blockHeight -= 100
+	if err != nil {
+		t.Fatal("long contract was not charged the price of its original tier:", err)
+	}
+}
@@ -1,7 +1,15 @@
 package modules
 
 import (
+	"errors"
 	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNoHost      = errors.New("address has no host")
+	errInvalidPort = errors.New("address has an invalid port")
 )
 
 // A NetAddress contains the information needed to contact a peer.
@@ -29,6 +37,24 @@ func (na NetAddress) Port() string {
 	return port
 }
 
+// Normalize returns the canonical form of a NetAddress, so that different
+// spellings of the same address compare as equal. Surrounding whitespace is
+// removed and the host is lowercased. An error is returned if the address has
+// no host, or if the port is not a number between 1 and 65535.
+func (na NetAddress) Normalize() (NetAddress, error) {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(string(na)))
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", errNoHost
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", errInvalidPort
+	}
+	return NetAddress(net.JoinHostPort(strings.ToLower(host), port)), nil
+}
+
 // IsLoopback returns true for ip addresses that are on the same machine.
 func (na NetAddress) IsLoopback() bool {
 	if !na.IsValid() {
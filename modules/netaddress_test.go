@@ -110,3 +110,33 @@ func TestIsValid(t *testing.T) {
 		}
 	}
 }
+
+// TestNormalize tests the Normalize method of the NetAddress type.
+func TestNormalize(t *testing.T) {
+	testSet := []struct {
+		query      NetAddress
+		normalized NetAddress
+		valid      bool
+	}{
+		{"hn.com:8811", "hn.com:8811", true},
+		{"HN.com:8811", "hn.com:8811", true},
+		{" hn.com:8811\n", "hn.com:8811", true},
+		{"12.34.45.64:7777", "12.34.45.64:7777", true},
+		{"[::1]:7124", "[::1]:7124", true},
+		{"[FE80::1]:7124", "[fe80::1]:7124", true},
+
+		{"", "", false},
+		{"hn.com", "", false},
+		{":8811", "", false},
+		{"hn.com:0", "", false},
+		{"hn.com:65536", "", false},
+		{"hn.com:notAPort", "", false},
+		{"garbage:6146:616", "", false},
+	}
+	for _, test := range testSet {
+		normalized, err := test.query.Normalize()
+		if (err == nil) != test.valid || normalized != test.normalized {
+			t.Error("test failed:", test, normalized, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -11,6 +12,43 @@ var (
 	RenterDir = "renter"
 )
 
+const (
+	// FileSortName sorts files by their path.
+	FileSortName = "name"
+
+	// FileSortSize sorts files by their size, smallest first.
+	FileSortSize = "size"
+
+	// FileSortRedundancy sorts files by their redundancy, least redundant
+	// first.
+	FileSortRedundancy = "redundancy"
+
+	// DownloadStatusQueued indicates that a download is waiting for other
+	// downloads to finish before it starts.
+	DownloadStatusQueued = "queued"
+
+	// DownloadStatusActive indicates that a download is in progress.
+	DownloadStatusActive = "downloading"
+
+	// DownloadStatusComplete indicates that a download finished successfully.
+	DownloadStatusComplete = "complete"
+
+	// DownloadStatusFailed indicates that a download ended with an error.
+	DownloadStatusFailed = "failed"
+
+	// ConsistencyUnknownContract indicates that a file references a file
+	// contract that the renter has no record of.
+	ConsistencyUnknownContract = "unknowncontract"
+
+	// ConsistencyUnusedContract indicates that a file contract is not
+	// referenced by any file.
+	ConsistencyUnusedContract = "unusedcontract"
+
+	// ConsistencyInsufficientPieces indicates that a chunk of a file has fewer
+	// pieces on known contracts than are needed to recover it.
+	ConsistencyInsufficientPieces = "insufficientpieces"
+)
+
 // An ErasureCoder is an error-correcting encoder and decoder.
 type ErasureCoder interface {
 	// NumPieces is the number of pieces returned by Encode.
@@ -42,6 +80,35 @@ type FileUploadParams struct {
 	Renew       bool
 	ErasureCode ErasureCoder
 	PieceSize   uint64
+
+	// ChunkSize, if non-zero, sets the size of the chunks that the file is
+	// split into. It must be a multiple of PieceSize times the minimum number
+	// of pieces of the erasure code, and larger chunks are erasure-coded into
+	// proportionally larger pieces.
+	ChunkSize uint64
+
+	// Hosts, if non-empty, pins the file to the specified hosts. Contracts
+	// are only formed with these hosts, instead of hosts chosen at random by
+	// the hostdb.
+	Hosts []NetAddress
+
+	// Alias, if set, allows a file with the same contents as a file that
+	// was already uploaded to be added as an alias of that file. The alias
+	// shares the file contracts of the existing file, so nothing is
+	// uploaded. Without Alias, uploading a duplicate file is refused.
+	Alias bool
+
+	// Diverse, if set, places the pieces of each chunk on hosts in distinct
+	// subnets, where enough such hosts are available.
+	Diverse bool
+
+	// ReduceRedundancy, if set, allows the redundancy of the file to be
+	// reduced when fewer hosts are available than the erasure code has
+	// pieces, instead of leaving the file incomplete. The file records the
+	// reduced erasure code, which keeps the minimum number of pieces and at
+	// least one parity piece, and is reported with ReducedRedundancy in its
+	// FileInfo.
+	ReduceRedundancy bool
 }
 
 // FileInfo provides information about a file.
@@ -51,17 +118,85 @@ type FileInfo struct {
 	Available      bool              `json:"available"`
 	Renewing       bool              `json:"renewing"`
 	UploadProgress float64           `json:"uploadprogress"`
+	Redundancy     float64           `json:"redundancy"`
 	Expiration     types.BlockHeight `json:"expiration"`
+
+	// ExpiringSoon is set if the file is not being renewed, and its
+	// contracts expire within the expiry window of the renter.
+	ExpiringSoon bool `json:"expiringsoon"`
+
+	// ReducedRedundancy is set if the file was uploaded with ReduceRedundancy
+	// and its erasure code was reduced because too few hosts were available.
+	ReducedRedundancy bool `json:"reducedredundancy"`
+}
+
+// A FileHostInfo describes the pieces of a file that are stored on a host
+// under a single file contract.
+type FileHostInfo struct {
+	ContractID  types.FileContractID `json:"contractid"`
+	IP          NetAddress           `json:"ip"`
+	Pieces      []FilePiece          `json:"pieces"`
+	WindowStart types.BlockHeight    `json:"windowstart"`
+}
+
+// A FilePiece identifies a piece of a file by the index of its chunk and its
+// index within the chunk.
+type FilePiece struct {
+	Chunk uint64 `json:"chunk"`
+	Piece uint64 `json:"piece"`
 }
 
 // DownloadInfo provides information about a file that has been requested for
-// download.
+// download. Status is one of the DownloadStatus constants.
 type DownloadInfo struct {
 	SiaPath     string    `json:"siapath"`
 	Destination string    `json:"destination"`
 	Filesize    uint64    `json:"filesize"`
 	Received    uint64    `json:"received"`
 	StartTime   time.Time `json:"starttime"`
+	Status      string    `json:"status"`
+}
+
+// A ConsistencyIssue describes a mismatch between the files of the renter and
+// its file contracts. Kind is one of the Consistency constants. SiaPath and
+// Chunk are only set if the issue concerns a file or a chunk of a file, and
+// ContractID is only set if the issue concerns a contract.
+type ConsistencyIssue struct {
+	Kind       string               `json:"kind"`
+	SiaPath    string               `json:"siapath"`
+	ContractID types.FileContractID `json:"contractid"`
+	Chunk      uint64               `json:"chunk"`
+}
+
+// A RenterContract contains the usage statistics of a file contract formed
+// by the renter. RenterFunds is the amount remaining in the contract that the
+// renter has not yet paid to the host, and Size is the amount of data stored
+// under the contract, as of the latest revision.
+type RenterContract struct {
+	ID         types.FileContractID `json:"id"`
+	IP         NetAddress           `json:"ip"`
+	EndHeight  types.BlockHeight    `json:"endheight"`
+	Uploaded   uint64               `json:"uploaded"`
+	Downloaded uint64               `json:"downloaded"`
+	Spent      types.Currency       `json:"spent"`
+
+	RenterFunds types.Currency `json:"renterfunds"`
+	Size        uint64         `json:"size"`
+}
+
+// A SpendingSummary totals the spending of the renter on the file contracts
+// formed during a range of blocks. Contract funding is the payout of new
+// contracts, and renewal funding is the payout of renewed contracts. Contract
+// fees are the siafund fees paid on both. Storage spending is the amount paid
+// to hosts for uploaded data, which is a portion of the funding. Usage is
+// attributed to the height at which its contract was formed.
+type SpendingSummary struct {
+	ContractFunding types.Currency `json:"contractfunding"`
+	RenewalFunding  types.Currency `json:"renewalfunding"`
+	ContractFees    types.Currency `json:"contractfees"`
+	StorageSpending types.Currency `json:"storagespending"`
+	Uploaded        uint64         `json:"uploaded"`
+	Downloaded      uint64         `json:"downloaded"`
 }
 
 // A Renter uploads, tracks, repairs, and downloads a set of files for the
@@ -74,18 +209,74 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostSettings
 
+	// CancelDownload aborts the active download of a file and removes it
+	// from the download queue.
+	CancelDownload(path string) error
+
+	// CheckConsistency cross-validates the files of the renter against its
+	// file contracts, and reports any mismatches. Nothing is modified.
+	CheckConsistency() []ConsistencyIssue
+
+	// Contracts returns the usage statistics of each file contract formed
+	// by the renter.
+	Contracts() []RenterContract
+
+	// EstimateUploadCost estimates the amount that will be paid to hosts to
+	// store a file of the given size for the given duration. An error is
+	// returned if the upload params are invalid.
+	EstimateUploadCost(size uint64, up FileUploadParams, duration types.BlockHeight) (types.Currency, error)
+
+	// SpendingReport summarizes the spending on the file contracts formed
+	// at or after the given height.
+	SpendingReport(since types.BlockHeight) SpendingSummary
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
 	// Download downloads a file to the given destination.
 	Download(path, destination string) error
 
+	// DownloadTo downloads a file, writing the contents of the file to the
+	// provided writer.
+	DownloadTo(path string, w io.Writer) error
+
+	// DownloadHead downloads the first n bytes of a file, fetching only the
+	// chunks that contain them.
+	DownloadHead(path string, n uint64) ([]byte, error)
+
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
+	// Downloads lists the downloads that are queued or in progress.
+	Downloads() []DownloadInfo
+
+	// FileOwner returns the owner and permission bits of a file.
+	FileOwner(path string) (owner string, permissions uint32, err error)
+
+	// FileHosts returns the hosts that store pieces of a file, along with
+	// the pieces that each host stores.
+	FileHosts(path string) ([]FileHostInfo, error)
+
+	// ExpiringFiles returns the files that are not being renewed and whose
+	// contracts expire within the given number of blocks.
+	ExpiringFiles(within types.BlockHeight) []FileInfo
+
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// FileListPage returns up to 'limit' files starting at 'offset', sorted
+	// by one of the FileSort constants, along with the total number of files.
+	FileListPage(offset, limit int, sortBy string) ([]FileInfo, int)
+
+	// HostDBReady indicates whether the hostdb knows about enough active
+	// hosts for the renter to upload.
+	HostDBReady() bool
+
+	// ListDirectory returns the subdirectories and files directly under a
+	// prefix of the renter's file paths, as if the paths formed a directory
+	// tree.
+	ListDirectory(prefix string) ([]string, []FileInfo)
+
 	// LoadSharedFiles loads a '.sia' file into the renter. A .sia file may
 	// contain multiple files. The paths of the added files are returned.
 	LoadSharedFiles(source string) ([]string, error)
@@ -97,6 +288,37 @@ type Renter interface {
 	// Rename changes the path of a file.
 	RenameFile(path, newPath string) error
 
+	// RotateFileKey re-encrypts a file under a new encryption key by
+	// uploading it again, replacing the file contracts of the file.
+	RotateFileKey(path string) error
+
+	// ScanQueueDepth returns the number of hosts that are waiting to be
+	// scanned by the hostdb.
+	ScanQueueDepth() int
+
+	// SetFileOwner sets the owner and permission bits of a file. The
+	// renter stores but does not enforce them.
+	SetFileOwner(path, owner string, permissions uint32) error
+
+	// SetFilePriority sets the repair priority of a file. Files with a
+	// higher priority are repaired first.
+	SetFilePriority(path string, priority int) error
+
+	// SetFileTracking sets whether a file is actively repaired, and whether
+	// the file contracts of the file are renewed.
+	SetFileTracking(path string, track bool, renew bool) error
+
+	// RepairFile immediately restores a file to full redundancy.
+	RepairFile(path string) error
+
+	// SetFileRedundancy changes the number of pieces that each chunk of a
+	// file is erasure-coded into, uploading any additional pieces.
+	SetFileRedundancy(path string, numPieces int) error
+
+	// SetRepairPath changes the local copy of a file that is used for
+	// repairs.
+	SetRepairPath(path, newPath string) error
+
 	// ShareFiles creates a '.sia' file that can be shared with others.
 	ShareFiles(paths []string, shareDest string) error
 
@@ -105,4 +327,12 @@ type Renter interface {
 
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
+
+	// UploadStream uploads 'size' bytes read from a stream under the
+	// provided nickname, using the input parameters.
+	UploadStream(nickname string, r io.Reader, size uint64, up FileUploadParams) error
+
+	// WaitForHosts blocks until the hostdb knows about at least 'minHosts'
+	// active hosts, or until the context is cancelled.
+	WaitForHosts(ctx context.Context, minHosts int) error
 }
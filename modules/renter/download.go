@@ -1,21 +1,37 @@
 package renter
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"net"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// downloadOverdrive is the number of pieces beyond the minimum that are
+	// requested in parallel when downloading a chunk.
+	downloadOverdrive = 2
+
+	// defaultDownloadRetries is the default number of additional hosts that
+	// are tried when a host fails to serve a piece.
+	defaultDownloadRetries = 3
 )
 
 var (
 	errInsufficientHosts  = errors.New("insufficient hosts to recover file")
 	errInsufficientPieces = errors.New("couldn't fetch enough pieces to recover data")
+	errHashMismatch       = errors.New("downloaded file does not match the hash of the uploaded file")
+	errDownloadCancelled  = errors.New("download was cancelled")
+	errNoActiveDownload   = errors.New("no active download of that file")
 )
 
 // A fetcher fetches pieces from a host. This interface exists to facilitate
@@ -31,10 +47,13 @@ type fetcher interface {
 // A hostFetcher fetches pieces from a host. It implements the fetcher
 // interface.
 type hostFetcher struct {
-	conn      net.Conn
-	pieceMap  map[uint64][]pieceData
-	pieceSize uint64
-	masterKey crypto.TwofishKey
+	conn       net.Conn
+	contractID types.FileContractID
+	pieceMap   map[uint64][]pieceData
+	pieceSize  uint64
+	price      types.Currency // download price per byte, sent by the host
+	masterKey  crypto.TwofishKey
+	hdb        hostDB
 }
 
 // pieces returns the pieces stored on this host that are part of a given
@@ -56,12 +75,20 @@ func (hf *hostFetcher) fetch(p pieceData) ([]byte, error) {
 		return nil, err
 	}
 
+	// pay for the piece, if the host charges for downloads
+	err = hf.hdb.PayDownload(hf.conn, hf.contractID, hf.price, hf.pieceSize)
+	if err != nil {
+		return nil, err
+	}
+	hf.conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
 	// download piece
 	data := make([]byte, hf.pieceSize)
 	_, err = io.ReadFull(hf.conn, data)
 	if err != nil {
 		return nil, err
 	}
+	hf.hdb.RecordDownload(hf.contractID, uint64(len(data)))
 
 	// generate decryption key
 	key := deriveKey(hf.masterKey, p.Chunk, p.Piece)
@@ -81,16 +108,22 @@ func (hf *hostFetcher) Close() error {
 // connect and then disconnect without making any actual requests (but holding
 // the connection open the entire time). This is wasteful of host resources.
 // Consider only opening the connection after the first request has been made.
-func newHostFetcher(fc fileContract, pieceSize uint64, masterKey crypto.TwofishKey) (*hostFetcher, error) {
-	conn, err := net.DialTimeout("tcp", string(fc.IP), 15*time.Second)
+func newHostFetcher(fc fileContract, pieceSize uint64, masterKey crypto.TwofishKey, hdb hostDB) (*hostFetcher, error) {
+	conn, err := hdb.DialHost(fc.IP)
 	if err != nil {
 		return nil, err
 	}
 	conn.SetDeadline(time.Now().Add(15 * time.Second))
 	defer conn.SetDeadline(time.Time{})
 
-	// send RPC
-	err = encoding.WriteObject(conn, modules.RPCDownload)
+	// send RPC. Hosts that predate paid downloads do not quote a price, and
+	// serve downloads for free.
+	paid := hostSupportsPaidDownload(hdb, fc.IP)
+	rpc := modules.RPCDownload
+	if paid {
+		rpc = modules.RPCPaidDownload
+	}
+	err = encoding.WriteObject(conn, rpc)
 	if err != nil {
 		return nil, err
 	}
@@ -101,19 +134,42 @@ func newHostFetcher(fc fileContract, pieceSize uint64, masterKey crypto.TwofishK
 		return nil, err
 	}
 
+	// read the download price of the host
+	var price types.Currency
+	if paid {
+		err = encoding.ReadObject(conn, &price, 256)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// make piece map
 	pieceMap := make(map[uint64][]pieceData)
 	for _, p := range fc.Pieces {
 		pieceMap[p.Chunk] = append(pieceMap[p.Chunk], p)
 	}
 	return &hostFetcher{
-		conn:      conn,
-		pieceMap:  pieceMap,
-		pieceSize: pieceSize + crypto.TwofishOverhead,
-		masterKey: masterKey,
+		conn:       conn,
+		contractID: fc.ID,
+		pieceMap:   pieceMap,
+		pieceSize:  pieceSize + crypto.TwofishOverhead,
+		price:      price,
+		masterKey:  masterKey,
+		hdb:        hdb,
 	}, nil
 }
 
+// hostSupportsPaidDownload reports whether the host at addr advertises a
+// protocol version that accepts RPCPaidDownload.
+func hostSupportsPaidDownload(hdb hostDB, addr modules.NetAddress) bool {
+	for _, host := range hdb.AllHosts() {
+		if host.NetAddress == addr {
+			return modules.SupportsPaidDownload(host.ProtocolVersion)
+		}
+	}
+	return false
+}
+
 // checkHosts checks that a set of hosts is sufficient to download a file.
 func checkHosts(hosts []fetcher, minPieces int, numChunks uint64) error {
 	for i := uint64(0); i < numChunks; i++ {
@@ -128,6 +184,15 @@ func checkHosts(hosts []fetcher, minPieces int, numChunks uint64) error {
 	return nil
 }
 
+// A sparseWriter is a download destination that can skip over a region
+// instead of writing it. On most filesystems, a region of an *os.File that is
+// skipped and never written is stored as a hole, and reads back as zeros.
+type sparseWriter interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
 // A download is a file download that has been queued by the renter.
 type download struct {
 	// NOTE: received is the first field to ensure 64-bit alignment, which is
@@ -137,19 +202,48 @@ type download struct {
 	startTime   time.Time
 	siapath     string
 	destination string
+	status      string // protected by the renter's lock
+
+	// cancel is closed to abort the download. done is closed once the
+	// download has stopped and any partial file has been removed.
+	cancel chan struct{}
+	done   chan struct{}
 
 	erasureCode modules.ErasureCoder
 	chunkSize   uint64
 	fileSize    uint64
+	hash        crypto.Hash // if non-empty, the recovered data must match
+	zeroChunks  map[uint64]struct{}
+	sparse      bool // zero chunks may be skipped if the destination is a sparseWriter
 	hosts       []fetcher
+	hostLocks   []sync.Mutex // one per host; held while fetching from the host
+	maxRetries  int          // additional hosts tried when a piece fetch fails
 }
 
-// getPiece locates and downloads a specific piece.
-func (d *download) getPiece(chunkIndex, pieceIndex uint64) []byte {
-	for _, h := range d.hosts {
+// getPiece locates and downloads a specific piece. Each host only serves one
+// request at a time, so getPiece waits for any outstanding request to the host
+// to complete. If a host fails to serve the piece, getPiece fails over to the
+// next host holding the same piece, trying at most maxRetries additional
+// hosts. If cancel is closed before the request is made, or every attempt
+// fails, getPiece returns nil.
+func (d *download) getPiece(chunkIndex, pieceIndex uint64, cancel <-chan struct{}) []byte {
+	attempts := 0
+	for i, h := range d.hosts {
+		if attempts > d.maxRetries {
+			return nil
+		}
 		for _, p := range h.pieces(chunkIndex) {
 			if p.Piece == pieceIndex {
+				d.hostLocks[i].Lock()
+				select {
+				case <-cancel:
+					d.hostLocks[i].Unlock()
+					return nil
+				default:
+				}
 				data, err := h.fetch(p)
+				d.hostLocks[i].Unlock()
+				attempts++
 				if err != nil {
 					break // try next host
 				}
@@ -160,32 +254,86 @@ func (d *download) getPiece(chunkIndex, pieceIndex uint64) []byte {
 	return nil
 }
 
-// run performs the actual download. It spawns one worker per host, and
-// instructs them to sequentially download chunks. It then writes the
-// recovered chunks to w.
+// A fetchedPiece is the result of a piece request made by getChunk.
+type fetchedPiece struct {
+	index uint64
+	data  []byte
+}
+
+// getChunk downloads the pieces of a chunk. More than the minimum number of
+// pieces are requested in parallel, and getChunk returns as soon as the
+// minimum have arrived, so that a slow host does not stall the chunk. Requests
+// that have not yet been sent when the chunk completes are cancelled.
+func (d *download) getChunk(chunkIndex uint64) ([][]byte, error) {
+	chunk := make([][]byte, d.erasureCode.NumPieces())
+	// pick hosts at random
+	chunkOrder, err := crypto.Perm(len(chunk))
+	if err != nil {
+		return nil, err
+	}
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+	// results is buffered so that stragglers never block.
+	results := make(chan fetchedPiece, len(chunk))
+	next, inFlight := 0, 0
+	request := func() {
+		j := uint64(chunkOrder[next])
+		next++
+		inFlight++
+		go func() {
+			results <- fetchedPiece{j, d.getPiece(chunkIndex, j, cancel)}
+		}()
+	}
+	for next < len(chunkOrder) && inFlight < d.erasureCode.MinPieces()+downloadOverdrive {
+		request()
+	}
+
+	// Collect pieces, requesting a replacement for each failed piece.
+	left := d.erasureCode.MinPieces()
+	for left > 0 && inFlight > 0 {
+		var piece fetchedPiece
+		select {
+		case piece = <-results:
+		case <-d.cancel:
+			return nil, errDownloadCancelled
+		}
+		inFlight--
+		if piece.data != nil {
+			chunk[piece.index] = piece.data
+			left--
+		} else if next < len(chunkOrder) {
+			request()
+		}
+	}
+	if left != 0 {
+		return nil, errInsufficientPieces
+	}
+	return chunk, nil
+}
+
+// run performs the actual download. Chunks are downloaded sequentially, with
+// the pieces of each chunk being fetched in parallel. The recovered chunks
+// are written to w. If the download is sparse and w is a sparseWriter, chunks
+// that are known to contain only zeros are not fetched; w is seeked past them
+// instead, leaving a hole. If the hash of the original file is known, the
+// recovered data is checked against it, and errHashMismatch is returned if the
+// data does not match. If the download is cancelled, errDownloadCancelled is
+// returned.
 func (d *download) run(w io.Writer) error {
+	sw, sparse := w.(sparseWriter)
+	sparse = sparse && d.sparse
+	h := crypto.NewHash()
+	if d.hash != (crypto.Hash{}) {
+		w = io.MultiWriter(w, h)
+	}
+
 	var received uint64
 	for i := uint64(0); received < d.fileSize; i++ {
-		// load pieces into chunk
-		chunk := make([][]byte, d.erasureCode.NumPieces())
-		left := d.erasureCode.MinPieces()
-		// pick hosts at random
-		chunkOrder, err := crypto.Perm(len(chunk))
-		if err != nil {
-			return err
-		}
-		for _, j := range chunkOrder {
-			chunk[j] = d.getPiece(i, uint64(j))
-			if chunk[j] != nil {
-				left--
-			} else {
-			}
-			if left == 0 {
-				break
-			}
-		}
-		if left != 0 {
-			return errInsufficientPieces
+		select {
+		case <-d.cancel:
+			return errDownloadCancelled
+		default:
 		}
 
 		// Write pieces to w. We always write chunkSize bytes unless this is
@@ -194,43 +342,102 @@ func (d *download) run(w io.Writer) error {
 		if n > d.fileSize-received {
 			n = d.fileSize - received
 		}
-		err = d.erasureCode.Recover(chunk, uint64(n), w)
-		if err != nil {
-			return err
+		if _, zero := d.zeroChunks[i]; zero && sparse {
+			// Skip the chunk, leaving a hole of zeros in the destination.
+			if _, err := sw.Seek(int64(n), io.SeekCurrent); err != nil {
+				return err
+			}
+			if d.hash != (crypto.Hash{}) {
+				h.Write(make([]byte, n))
+			}
+		} else {
+			chunk, err := d.getChunk(i)
+			if err != nil {
+				return err
+			}
+			err = d.erasureCode.Recover(chunk, uint64(n), w)
+			if err != nil {
+				return err
+			}
 		}
 		received += n
 		atomic.AddUint64(&d.received, n)
 	}
 
+	// Seeking past the end of the destination does not extend it, so if the
+	// file ends in a hole, it must be extended to its full size.
+	if sparse {
+		if err := sw.Truncate(int64(d.fileSize)); err != nil {
+			return err
+		}
+	}
+
+	if d.hash != (crypto.Hash{}) {
+		var hash crypto.Hash
+		copy(hash[:], h.Sum(nil))
+		if hash != d.hash {
+			return errHashMismatch
+		}
+	}
 	return nil
 }
 
 // newDownload initializes and returns a download object.
 func (f *file) newDownload(hosts []fetcher, destination string) *download {
+	f.mu.RLock()
+	name := f.name
+	zeroChunks := make(map[uint64]struct{}, len(f.zeroChunks))
+	for i := range f.zeroChunks {
+		zeroChunks[i] = struct{}{}
+	}
+	f.mu.RUnlock()
+
 	return &download{
 		erasureCode: f.erasureCode,
 		chunkSize:   f.chunkSize(),
 		fileSize:    f.size,
+		hash:        f.hash,
+		zeroChunks:  zeroChunks,
 		hosts:       hosts,
+		hostLocks:   make([]sync.Mutex, len(hosts)),
+		maxRetries:  defaultDownloadRetries,
 
 		startTime:   time.Now(),
 		received:    0,
-		siapath:     f.name,
+		siapath:     name,
 		destination: destination,
+		status:      modules.DownloadStatusQueued,
+
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
 	}
 }
 
-// Download downloads a file, identified by its path, to the destination
-// specified.
-func (r *Renter) Download(path, destination string) error {
-	// Lookup the file associated with the nickname.
+// setHosts sets the hosts that a download fetches pieces from. It must be
+// called before the download runs.
+func (d *download) setHosts(hosts []fetcher) {
+	d.hosts = hosts
+	d.hostLocks = make([]sync.Mutex, len(hosts))
+}
+
+// managedBeginTransfer looks up the file associated with path and starts a
+// transfer of the file, so that the file is not renamed or deleted while it is
+// in use. The caller is responsible for ending the transfer.
+func (r *Renter) managedBeginTransfer(path string) (*file, error) {
 	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
 	file, exists := r.files[path]
-	r.mu.Unlock(lockID)
 	if !exists {
-		return errors.New("no file with that path")
+		return nil, errors.New("no file with that path")
 	}
+	file.beginTransfer()
+	return file, nil
+}
 
+// connectFileHosts initiates a connection to each of the hosts of a file, and
+// checks that the hosts are sufficient to download the file. The caller is
+// responsible for closing the returned fetchers.
+func (r *Renter) connectFileHosts(file *file) ([]*hostFetcher, error) {
 	// Copy the file's metadata
 	var contracts []fileContract
 	file.mu.RLock()
@@ -240,52 +447,297 @@ func (r *Renter) Download(path, destination string) error {
 	file.mu.RUnlock()
 
 	// Initiate connections to each host.
-	var hosts []fetcher
+	var hfs []*hostFetcher
 	for _, fc := range contracts {
 		// TODO: connect in parallel
-		hf, err := newHostFetcher(fc, file.pieceSize, file.masterKey)
+		hf, err := newHostFetcher(fc, file.chunkPieceSize(), file.masterKey, r.hostDB)
 		if err != nil {
 			continue
 		}
-		defer hf.Close()
-		hosts = append(hosts, hf)
+		hfs = append(hfs, hf)
 	}
 
 	// Check that this host set is sufficient to download the file.
-	err := checkHosts(hosts, file.erasureCode.MinPieces(), file.numChunks())
+	hosts := make([]fetcher, len(hfs))
+	for i := range hfs {
+		hosts[i] = hfs[i]
+	}
+	// An empty file has no pieces, so it can be downloaded without any hosts.
+	numChunks := file.numChunks()
+	if file.empty() {
+		numChunks = 0
+	}
+	err := checkHosts(hosts, file.erasureCode.MinPieces(), numChunks)
 	if err != nil {
-		return err
+		for _, hf := range hfs {
+			hf.Close()
+		}
+		return nil, err
 	}
+	return hfs, nil
+}
 
-	// Create file on disk with the correct permissions.
-	perm := os.FileMode(file.mode)
-	if perm == 0 {
-		// sane default
-		perm = 0666
+// connectHosts looks up the file associated with path and initiates a
+// connection to each of the file's hosts. A transfer of the file is started,
+// so that the file is not renamed or deleted while it is in use. The caller
+// is responsible for closing the returned fetchers and for ending the
+// transfer of the returned file.
+func (r *Renter) connectHosts(path string) (*file, []*hostFetcher, error) {
+	file, err := r.managedBeginTransfer(path)
+	if err != nil {
+		return nil, nil, err
 	}
-	f, err := os.OpenFile(destination, os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+	hfs, err := r.connectFileHosts(file)
 	if err != nil {
-		return err
+		file.endTransfer()
+		return nil, nil, err
 	}
-	defer f.Close()
+	return file, hfs, nil
+}
 
-	// Create the download object.
-	d := file.newDownload(hosts, destination)
+// notifyDownloadSlot wakes every queued download so that it can check
+// whether it may start.
+func (r *Renter) notifyDownloadSlot() {
+	close(r.downloadSlot)
+	r.downloadSlot = make(chan struct{})
+}
+
+// canStartDownload reports whether a queued download may start. Downloads
+// start in the order that they were queued, and only while fewer than
+// maxDownloads downloads are running.
+func (r *Renter) canStartDownload(d *download) bool {
+	if r.maxDownloads != 0 && r.activeDownloads >= r.maxDownloads {
+		return false
+	}
+	for _, qd := range r.downloadQueue {
+		if qd.status == modules.DownloadStatusQueued {
+			return qd == d
+		}
+	}
+	return false
+}
+
+// managedWaitForDownloadSlot blocks until the queued download may start, and
+// then marks the download as active. errDownloadCancelled is returned if the
+// download is cancelled while it is waiting.
+func (r *Renter) managedWaitForDownloadSlot(d *download) error {
+	for {
+		lockID := r.mu.Lock()
+		if r.canStartDownload(d) {
+			r.activeDownloads++
+			d.status = modules.DownloadStatusActive
+			r.mu.Unlock(lockID)
+			return nil
+		}
+		slot := r.downloadSlot
+		r.mu.Unlock(lockID)
+
+		select {
+		case <-slot:
+		case <-d.cancel:
+			return errDownloadCancelled
+		}
+	}
+}
+
+// managedQueueDownload adds a download to the download queue, waits in the
+// queue if the maximum number of downloads is already running, and then runs
+// the download, writing the file to the writer returned by start. start is
+// only called once the download may run, so that a queued download holds no
+// host connections and does not touch its destination. start must set the
+// hosts of the download. If the download fails after start has succeeded and
+// a destination is provided, the partial file at the destination is removed.
+func (r *Renter) managedQueueDownload(d *download, start func() (io.Writer, error)) error {
+	defer close(d.done)
 
 	// Add the download to the download queue.
-	lockID = r.mu.Lock()
+	lockID := r.mu.Lock()
+	d.maxRetries = r.maxRetries
 	r.downloadQueue = append(r.downloadQueue, d)
 	r.mu.Unlock(lockID)
 
-	// Perform download.
-	err = d.run(f)
+	// Perform download once there is room for it to run.
+	started := false
+	err := r.managedWaitForDownloadSlot(d)
+	if err == nil {
+		var w io.Writer
+		w, err = start()
+		if err == nil {
+			started = true
+			err = d.run(w)
+		}
+		lockID = r.mu.Lock()
+		r.activeDownloads--
+		r.notifyDownloadSlot()
+		r.mu.Unlock(lockID)
+	}
+
+	lockID = r.mu.Lock()
 	if err != nil {
+		d.status = modules.DownloadStatusFailed
+	} else {
+		d.status = modules.DownloadStatusComplete
+	}
+	r.mu.Unlock(lockID)
+
+	if err != nil && started && d.destination != "" {
 		// File could not be downloaded; delete the copy on disk.
-		os.Remove(destination)
+		os.Remove(d.destination)
+	}
+	return err
+}
+
+// managedDownload downloads a file from the provided hosts, writing the file
+// to w. The download is added to the download queue, and waits in the queue
+// if the maximum number of downloads is already running.
+func (r *Renter) managedDownload(file *file, hosts []fetcher, destination string, w io.Writer) error {
+	d := file.newDownload(hosts, destination)
+	return r.managedQueueDownload(d, func() (io.Writer, error) {
+		return w, nil
+	})
+}
+
+// createDestination creates the destination file of a download with the
+// permissions of the renter's file, truncating any existing file. The new
+// file lets zero chunks be skipped without leaving stale data behind.
+func createDestination(file *file, destination string) (*os.File, error) {
+	perm := os.FileMode(file.mode)
+	if perm == 0 {
+		// sane default
+		perm = 0666
+	}
+	return os.OpenFile(destination, os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+}
+
+// managedDownloadFile downloads a file from the provided hosts to the
+// destination. The destination is only created once the download leaves the
+// download queue.
+func (r *Renter) managedDownloadFile(file *file, hosts []fetcher, destination string) error {
+	d := file.newDownload(hosts, destination)
+	d.sparse = true
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	return r.managedQueueDownload(d, func() (io.Writer, error) {
+		var err error
+		f, err = createDestination(file, destination)
+		return f, err
+	})
+}
+
+// connectDownload connects to the hosts of the file being downloaded by d,
+// and sets them as the hosts of the download. The caller is responsible for
+// closing the returned fetchers.
+func (r *Renter) connectDownload(file *file, d *download) ([]*hostFetcher, error) {
+	hfs, err := r.connectFileHosts(file)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]fetcher, len(hfs))
+	for i, hf := range hfs {
+		hosts[i] = hf
+	}
+	d.setHosts(hosts)
+	return hfs, nil
+}
+
+// Download downloads a file, identified by its path, to the destination
+// specified. The hosts of the file are not contacted, and the destination is
+// not created, until the download leaves the download queue.
+func (r *Renter) Download(path, destination string) error {
+	file, err := r.managedBeginTransfer(path)
+	if err != nil {
 		return err
 	}
+	defer file.endTransfer()
 
-	return nil
+	var hfs []*hostFetcher
+	var f *os.File
+	defer func() {
+		for _, hf := range hfs {
+			hf.Close()
+		}
+		if f != nil {
+			f.Close()
+		}
+	}()
+	d := file.newDownload(nil, destination)
+	d.sparse = true
+	return r.managedQueueDownload(d, func() (io.Writer, error) {
+		hfs, err = r.connectDownload(file, d)
+		if err != nil {
+			return nil, err
+		}
+		f, err = createDestination(file, destination)
+		return f, err
+	})
+}
+
+// DownloadTo downloads a file, identified by its path, writing the contents
+// of the file to w. Chunks are recovered and written to w in order, and the
+// padding of the final chunk is not written. The hosts of the file are not
+// contacted until the download leaves the download queue.
+func (r *Renter) DownloadTo(path string, w io.Writer) error {
+	file, err := r.managedBeginTransfer(path)
+	if err != nil {
+		return err
+	}
+	defer file.endTransfer()
+
+	var hfs []*hostFetcher
+	defer func() {
+		for _, hf := range hfs {
+			hf.Close()
+		}
+	}()
+	d := file.newDownload(nil, "")
+	return r.managedQueueDownload(d, func() (io.Writer, error) {
+		hfs, err = r.connectDownload(file, d)
+		return w, err
+	})
+}
+
+// managedDownloadHead downloads the first n bytes of a file from the provided
+// hosts. Only the chunks containing those bytes are fetched.
+func (r *Renter) managedDownloadHead(file *file, hosts []fetcher, n uint64) ([]byte, error) {
+	d := file.newDownload(hosts, "")
+	if n < d.fileSize {
+		d.fileSize = n
+	}
+	// The hash of the file covers the whole file, so it cannot be used to
+	// verify the head.
+	d.hash = crypto.Hash{}
+	lockID := r.mu.RLock()
+	d.maxRetries = r.maxRetries
+	r.mu.RUnlock(lockID)
+
+	buf := new(bytes.Buffer)
+	err := d.run(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DownloadHead downloads the first n bytes of a file, identified by its path,
+// fetching only the chunks that contain them. If the file is smaller than n
+// bytes, the whole file is returned. The download is not added to the download
+// queue.
+func (r *Renter) DownloadHead(path string, n uint64) ([]byte, error) {
+	file, hfs, err := r.connectHosts(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.endTransfer()
+	hosts := make([]fetcher, len(hfs))
+	for i, hf := range hfs {
+		defer hf.Close()
+		hosts[i] = hf
+	}
+	return r.managedDownloadHead(file, hosts, n)
 }
 
 // DownloadQueue returns the list of downloads in the queue.
@@ -303,7 +755,47 @@ func (r *Renter) DownloadQueue() []modules.DownloadInfo {
 			Filesize:    d.fileSize,
 			Received:    atomic.LoadUint64(&d.received),
 			StartTime:   d.startTime,
+			Status:      d.status,
+		}
+	}
+	return downloads
+}
+
+// Downloads returns the downloads that are queued or in progress.
+func (r *Renter) Downloads() []modules.DownloadInfo {
+	var downloads []modules.DownloadInfo
+	for _, di := range r.DownloadQueue() {
+		if di.Status == modules.DownloadStatusQueued || di.Status == modules.DownloadStatusActive {
+			downloads = append(downloads, di)
 		}
 	}
 	return downloads
 }
+
+// CancelDownload aborts the active or queued download of the file at path and
+// removes the download from the download queue. CancelDownload does not return
+// until the download has stopped and any partially downloaded file has been
+// removed.
+func (r *Renter) CancelDownload(path string) error {
+	lockID := r.mu.Lock()
+	var d *download
+	for i, qd := range r.downloadQueue {
+		if qd.siapath == path && (qd.status == modules.DownloadStatusActive || qd.status == modules.DownloadStatusQueued) {
+			d = qd
+			r.downloadQueue = append(r.downloadQueue[:i], r.downloadQueue[i+1:]...)
+			break
+		}
+	}
+	if d != nil {
+		// The next queued download may now be first in line.
+		r.notifyDownloadSlot()
+	}
+	r.mu.Unlock(lockID)
+	if d == nil {
+		return errNoActiveDownload
+	}
+
+	close(d.cancel)
+	<-d.done
+	return nil
+}
@@ -4,10 +4,20 @@ import (
 	"bytes"
 	"crypto/rand"
 	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // a testFetcher simulates a host. It implements the fetcher interface.
@@ -18,6 +28,7 @@ type testFetcher struct {
 
 	nAttempt int // total number of download attempts
 	nFetch   int // number of successful download attempts
+	mu       sync.Mutex
 
 	// used to simulate real-world conditions
 	delay    time.Duration // transfers will take this long
@@ -29,16 +40,49 @@ func (f *testFetcher) pieces(chunkIndex uint64) []pieceData {
 }
 
 func (f *testFetcher) fetch(p pieceData) ([]byte, error) {
+	f.mu.Lock()
 	f.nAttempt++
+	f.mu.Unlock()
 	time.Sleep(f.delay)
 	// randomly fail
 	if n, _ := crypto.RandIntn(f.failRate); n == 0 {
 		return nil, io.EOF
 	}
+	f.mu.Lock()
 	f.nFetch++
+	f.mu.Unlock()
 	return f.data[p.Offset : p.Offset+f.pieceSize], nil
 }
 
+// newTestFetchers erasure-codes 'data' with 'rsc' into pieces of 'pieceSize'
+// bytes, and returns a reliable testFetcher for each piece index, holding that
+// piece of every chunk. The final chunk is padded with zeros.
+func newTestFetchers(data []byte, rsc modules.ErasureCoder, pieceSize uint64) ([]fetcher, error) {
+	hosts := make([]fetcher, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = &testFetcher{
+			pieceMap:  make(map[uint64][]pieceData),
+			pieceSize: pieceSize,
+			failRate:  1 << 30, // effectively never fail
+		}
+	}
+	chunkSize := pieceSize * uint64(rsc.MinPieces())
+	for i := uint64(0); i*chunkSize < uint64(len(data)); i++ {
+		chunk := make([]byte, chunkSize)
+		copy(chunk, data[i*chunkSize:])
+		pieces, err := rsc.Encode(chunk)
+		if err != nil {
+			return nil, err
+		}
+		for j, p := range pieces {
+			host := hosts[j].(*testFetcher)
+			host.pieceMap[i] = append(host.pieceMap[i], pieceData{i, uint64(j), uint64(len(host.data))})
+			host.data = append(host.data, p...)
+		}
+	}
+	return hosts, nil
+}
+
 // TestErasureDownload tests parallel downloading of erasure-coded data.
 func TestErasureDownload(t *testing.T) {
 	if testing.Short() {
@@ -56,57 +100,34 @@ func TestErasureDownload(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// create hosts
+	// upload data to hosts
 	const pieceSize = 10
-	hosts := make([]fetcher, rsc.NumPieces())
-	for i := range hosts {
-		hosts[i] = &testFetcher{
-			pieceMap:  make(map[uint64][]pieceData),
-			pieceSize: pieceSize,
-
-			delay:    time.Millisecond,
-			failRate: 5, // 20% failure rate
-		}
+	hosts, err := newTestFetchers(data, rsc, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hosts {
+		h.(*testFetcher).delay = time.Millisecond
+		h.(*testFetcher).failRate = 5 // 20% failure rate
 	}
 	// make one host really slow
 	hosts[0].(*testFetcher).delay = 100 * time.Millisecond
 	// make one host always fail
 	hosts[1].(*testFetcher).failRate = 1
 
-	// upload data to hosts
-	r := bytes.NewReader(data) // makes chunking easier
-	chunk := make([]byte, pieceSize*rsc.MinPieces())
-	var i uint64
-	for i = uint64(0); ; i++ {
-		_, err := io.ReadFull(r, chunk)
-		if err == io.EOF {
-			break
-		} else if err != nil && err != io.ErrUnexpectedEOF {
-			t.Fatal(err)
-		}
-		pieces, err := rsc.Encode(chunk)
-		if err != nil {
-			t.Fatal(err)
-		}
-		for j, p := range pieces {
-			host := hosts[j%len(hosts)].(*testFetcher) // distribute evenly
-			host.pieceMap[i] = append(host.pieceMap[i], pieceData{
-				uint64(i),
-				uint64(j),
-				uint64(len(host.data)),
-			})
-			host.data = append(host.data, p...)
-		}
+	// download data
+	f, err := newFile("foo", rsc, pieceSize, dataSize)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// check hosts (not strictly necessary)
-	err = checkHosts(hosts, rsc.MinPieces(), i)
+	err = checkHosts(hosts, rsc.MinPieces(), f.numChunks())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// download data
-	d := newFile("foo", rsc, pieceSize, dataSize).newDownload(hosts, "")
+	d := f.newDownload(hosts, "")
 	buf := new(bytes.Buffer)
 	err = d.run(buf)
 	if err != nil {
@@ -131,3 +152,565 @@ func TestErasureDownload(t *testing.T) {
 		t.Log("Total fetches:  ", totFetch)
 	*/
 }
+
+// TestDownloadHashMismatch checks that a download is rejected when the
+// recovered data does not match the hash of the uploaded file.
+func TestDownloadHashMismatch(t *testing.T) {
+	// generate data
+	const dataSize = 300
+	data := make([]byte, dataSize)
+	rand.Read(data)
+
+	// create Reed-Solomon encoder
+	rsc, err := NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upload data to reliable hosts
+	const pieceSize = 10
+	hosts, err := newTestFetchers(data, rsc, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a copy of the hosts that have the first piece of their data
+	// corrupted, so that the reconstruction differs regardless of which pieces
+	// are fetched.
+	corruptHosts := make([]fetcher, len(hosts))
+	for i, h := range hosts {
+		h := h.(*testFetcher)
+		corrupt := &testFetcher{
+			data:      append([]byte(nil), h.data...),
+			pieceMap:  h.pieceMap,
+			pieceSize: h.pieceSize,
+			failRate:  h.failRate,
+		}
+		corrupt.data[0]++
+		corruptHosts[i] = corrupt
+	}
+
+	// an intact download should pass verification
+	f, err := newFile("foo", rsc, pieceSize, dataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hash = crypto.HashBytes(data)
+	buf := new(bytes.Buffer)
+	err = f.newDownload(hosts, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("recovered data does not match original")
+	}
+
+	// a corrupted download should fail verification
+	err = f.newDownload(corruptHosts, "").run(new(bytes.Buffer))
+	if err != errHashMismatch {
+		t.Fatal("expected hash mismatch, got", err)
+	}
+
+	// without a known hash, the corruption goes undetected
+	f.hash = crypto.Hash{}
+	err = f.newDownload(corruptHosts, "").run(new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDownloadSlowHost checks that a single slow host does not stall a
+// download when the minimum number of pieces can be fetched from faster hosts.
+func TestDownloadSlowHost(t *testing.T) {
+	// generate data
+	const dataSize = 300
+	data := make([]byte, dataSize)
+	rand.Read(data)
+
+	// create Reed-Solomon encoder
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upload data to reliable hosts, the first of which is very slow
+	const pieceSize = 10
+	hosts, err := newTestFetchers(data, rsc, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const slowDelay = 5 * time.Second
+	hosts[0].(*testFetcher).delay = slowDelay
+
+	// The download should complete using the fast hosts, without waiting for
+	// the slow host to respond.
+	f, err := newFile("foo", rsc, pieceSize, dataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hash = crypto.HashBytes(data)
+	buf := new(bytes.Buffer)
+	start := time.Now()
+	err = f.newDownload(hosts, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= slowDelay {
+		t.Fatal("download waited for the slow host:", elapsed)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("recovered data does not match original")
+	}
+}
+
+// TestCancelDownload starts a download from slow hosts, cancels it, and
+// checks that the download leaves the queue and that the partially downloaded
+// file is removed.
+func TestCancelDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestCancelDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// create hosts that take a long time to serve their pieces
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pieceSize = 10
+	hosts := make([]fetcher, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = &testFetcher{
+			data:      make([]byte, pieceSize),
+			pieceMap:  map[uint64][]pieceData{0: {{0, uint64(i), 0}}},
+			pieceSize: pieceSize,
+			delay:     time.Minute,
+			failRate:  1 << 30,
+		}
+	}
+
+	// start the download
+	f, err := newFile("foo", rsc, pieceSize, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := build.TempDir("renter", "TestCancelDownload", "downloads")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "foo")
+	errChan := make(chan error)
+	go func() {
+		errChan <- rt.renter.managedDownloadFile(f, hosts, destination)
+	}()
+	for i := 0; i < 50 && len(rt.renter.Downloads()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	downloads := rt.renter.Downloads()
+	if len(downloads) != 1 || downloads[0].SiaPath != "foo" || downloads[0].Status != modules.DownloadStatusActive {
+		t.Fatal("download is not listed as active:", downloads)
+	}
+	if _, err := os.Stat(destination); err != nil {
+		t.Fatal("destination file was not created:", err)
+	}
+
+	// cancel the download
+	err = rt.renter.CancelDownload("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-errChan:
+		if err != errDownloadCancelled {
+			t.Fatal("expected errDownloadCancelled, got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download did not stop after being cancelled")
+	}
+	if len(rt.renter.Downloads()) != 0 || len(rt.renter.DownloadQueue()) != 0 {
+		t.Fatal("cancelled download is still in the queue")
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Fatal("partial file was not removed:", err)
+	}
+
+	// cancelling again should fail
+	err = rt.renter.CancelDownload("foo")
+	if err != errNoActiveDownload {
+		t.Fatal("expected errNoActiveDownload, got", err)
+	}
+}
+
+// TestDownloadFailover checks that a piece which a host fails to serve is
+// fetched from another host holding the same piece, and that the number of
+// hosts tried is bounded by the download's retry limit.
+func TestDownloadFailover(t *testing.T) {
+	// generate data
+	const pieceSize = 10
+	data := make([]byte, pieceSize)
+	rand.Read(data)
+
+	// create Reed-Solomon encoder
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first host holds every piece, but always fails. The second host
+	// holds only the first piece.
+	bad := &testFetcher{
+		pieceMap:  make(map[uint64][]pieceData),
+		pieceSize: pieceSize,
+		failRate:  1,
+	}
+	for j, p := range pieces {
+		bad.pieceMap[0] = append(bad.pieceMap[0], pieceData{0, uint64(j), uint64(len(bad.data))})
+		bad.data = append(bad.data, p...)
+	}
+	good := &testFetcher{
+		data:      pieces[0],
+		pieceMap:  map[uint64][]pieceData{0: {{0, 0, 0}}},
+		pieceSize: pieceSize,
+		failRate:  1 << 30, // effectively never fail
+	}
+	hosts := []fetcher{bad, good}
+
+	// the download should fail over to the second host
+	f, err := newFile("foo", rsc, pieceSize, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hash = crypto.HashBytes(data)
+	buf := new(bytes.Buffer)
+	err = f.newDownload(hosts, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("recovered data does not match original")
+	}
+	if good.nFetch != 1 {
+		t.Fatal("expected 1 fetch from the second host, got", good.nFetch)
+	}
+
+	// without retries, the second host is never tried
+	d := f.newDownload(hosts, "")
+	d.maxRetries = 0
+	err = d.run(new(bytes.Buffer))
+	if err != errInsufficientPieces {
+		t.Fatal("expected errInsufficientPieces, got", err)
+	}
+	if good.nAttempt != 1 {
+		t.Fatal("second host was tried despite the retry limit")
+	}
+}
+
+// TestMaxConcurrentDownloads queues more downloads than the concurrency
+// limit, and checks that no more than the limit run at once while the rest
+// wait in the queue.
+func TestMaxConcurrentDownloads(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestMaxConcurrentDownloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	const limit = 2
+	const numDownloads = 5
+	rt.renter.SetMaxConcurrentDownloads(limit)
+
+	// create hosts that take a moment to serve their pieces
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pieceSize = 10
+	hosts := make([]fetcher, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = &testFetcher{
+			data:      make([]byte, pieceSize),
+			pieceMap:  map[uint64][]pieceData{0: {{0, uint64(i), 0}}},
+			pieceSize: pieceSize,
+			delay:     100 * time.Millisecond,
+			failRate:  1 << 30,
+		}
+	}
+
+	// start the downloads, and watch the queue until they have all finished
+	errChan := make(chan error, numDownloads)
+	for i := 0; i < numDownloads; i++ {
+		f, err := newFile("foo"+strconv.Itoa(i), rsc, pieceSize, pieceSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			errChan <- rt.renter.managedDownload(f, hosts, "", new(bytes.Buffer))
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for finished := 0; finished < numDownloads; {
+		select {
+		case err := <-errChan:
+			if err != nil {
+				t.Fatal(err)
+			}
+			finished++
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("downloads did not finish")
+		}
+		active := 0
+		for _, di := range rt.renter.Downloads() {
+			if di.Status == modules.DownloadStatusActive {
+				active++
+			}
+		}
+		if active > limit {
+			t.Fatalf("%v downloads running at once, limit is %v", active, limit)
+		}
+	}
+	for _, di := range rt.renter.DownloadQueue() {
+		if di.Status != modules.DownloadStatusComplete {
+			t.Error("download did not complete:", di.SiaPath, di.Status)
+		}
+	}
+}
+
+// TestQueuedDownload checks that a download waiting in the download queue is
+// listed by Downloads, and that it does not touch its destination until it
+// leaves the queue.
+func TestQueuedDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestQueuedDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.SetMaxConcurrentDownloads(1)
+
+	// create hosts that take a long time to serve their pieces
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pieceSize = 10
+	hosts := make([]fetcher, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = &testFetcher{
+			data:      make([]byte, pieceSize),
+			pieceMap:  map[uint64][]pieceData{0: {{0, uint64(i), 0}}},
+			pieceSize: pieceSize,
+			delay:     time.Minute,
+			failRate:  1 << 30,
+		}
+	}
+
+	// Occupy the only download slot.
+	active, err := newFile("active", rsc, pieceSize, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- rt.renter.managedDownload(active, hosts, "", new(bytes.Buffer))
+	}()
+	for i := 0; i < 50 && len(rt.renter.Downloads()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Queue a download to an existing file.
+	dir := build.TempDir("renter", "TestQueuedDownload")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "queued")
+	err = ioutil.WriteFile(destination, []byte("existing data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := newFile("queued", rsc, pieceSize, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		errChan <- rt.renter.managedDownloadFile(queued, hosts, destination)
+	}()
+	for i := 0; i < 50 && len(rt.renter.Downloads()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	downloads := rt.renter.Downloads()
+	if len(downloads) != 2 || downloads[0].SiaPath != "queued" || downloads[0].Status != modules.DownloadStatusQueued {
+		t.Fatal("queued download is not listed:", downloads)
+	}
+
+	// Cancelling the queued download leaves the destination untouched.
+	err = rt.renter.CancelDownload("queued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errChan; err != errDownloadCancelled {
+		t.Fatal("expected errDownloadCancelled, got", err)
+	}
+	contents, err := ioutil.ReadFile(destination)
+	if err != nil || string(contents) != "existing data" {
+		t.Fatal("queued download modified its destination:", string(contents), err)
+	}
+	err = rt.renter.CancelDownload("active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-errChan
+}
+
+// A chunkFetcher is a testFetcher that records which chunks were fetched.
+type chunkFetcher struct {
+	*testFetcher
+	fetched map[uint64]bool
+}
+
+func (f *chunkFetcher) fetch(p pieceData) ([]byte, error) {
+	f.mu.Lock()
+	f.fetched[p.Chunk] = true
+	f.mu.Unlock()
+	return f.testFetcher.fetch(p)
+}
+
+// TestDownloadHead downloads the head of a multi-chunk file, and checks that
+// only the first chunk is fetched.
+func TestDownloadHead(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestDownloadHead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// upload three chunks of data to hosts
+	const pieceSize = 10
+	const dataSize = 55
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	rsc, err := NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := newTestFetchers(data, rsc, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range hosts {
+		hosts[i] = &chunkFetcher{testFetcher: h.(*testFetcher), fetched: make(map[uint64]bool)}
+	}
+	f, err := newFile("foo", rsc, pieceSize, dataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// download the head of the file
+	head, err := rt.renter.managedDownloadHead(f, hosts, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(head, data[:15]) {
+		t.Fatal("head does not match the start of the file")
+	}
+	for _, h := range hosts {
+		for chunk := range h.(*chunkFetcher).fetched {
+			if chunk != 0 {
+				t.Fatal("chunk", chunk, "was fetched")
+			}
+		}
+	}
+
+	// the head of a file smaller than n is the whole file
+	head, err = rt.renter.managedDownloadHead(f, hosts, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(head, data) {
+		t.Fatal("head does not match the file")
+	}
+}
+
+// versionHostDB is a hostDB with a single host at a given protocol version,
+// which quotes 'price' if it is called with RPCPaidDownload.
+type versionHostDB struct {
+	uploadHostDB
+	version string
+	price   types.Currency
+	rpcs    chan types.Specifier
+}
+
+// AllHosts reports the single host of the hostDB.
+func (hdb versionHostDB) AllHosts() []modules.HostSettings {
+	return []modules.HostSettings{{NetAddress: "foo", ProtocolVersion: hdb.version}}
+}
+
+// DialHost returns a connection to a simulated host that reports the RPC it
+// was called with.
+func (hdb versionHostDB) DialHost(modules.NetAddress) (net.Conn, error) {
+	renterConn, hostConn := net.Pipe()
+	go func() {
+		defer hostConn.Close()
+		var rpc types.Specifier
+		var fcid types.FileContractID
+		if encoding.ReadObject(hostConn, &rpc, 16) != nil || encoding.ReadObject(hostConn, &fcid, 32) != nil {
+			return
+		}
+		hdb.rpcs <- rpc
+		if rpc == modules.RPCPaidDownload {
+			encoding.WriteObject(hostConn, hdb.price)
+		}
+		// wait for the renter to close the connection
+		hostConn.Read(make([]byte, 1))
+	}()
+	return renterConn, nil
+}
+
+// TestHostFetcherProtocol checks that the renter only uses the paid download
+// RPC with hosts that advertise a protocol version that accepts it.
+func TestHostFetcherProtocol(t *testing.T) {
+	fc := fileContract{ID: types.FileContractID{1}, IP: "foo"}
+	tests := []struct {
+		version string
+		rpc     types.Specifier
+	}{
+		{"", modules.RPCDownload},
+		{"1.0", modules.RPCDownload},
+		{modules.PaidDownloadVersion, modules.RPCPaidDownload},
+	}
+	for _, test := range tests {
+		hdb := versionHostDB{
+			version: test.version,
+			price:   types.NewCurrency64(5),
+			rpcs:    make(chan types.Specifier, 1),
+		}
+		hf, err := newHostFetcher(fc, 64, crypto.TwofishKey{}, hdb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rpc := <-hdb.rpcs; rpc != test.rpc {
+			t.Errorf("host at version %q was called with %v, expected %v", test.version, rpc, test.rpc)
+		}
+		if paid := test.rpc == modules.RPCPaidDownload; paid != !hf.price.IsZero() {
+			t.Errorf("host at version %q: wrong download price %v", test.version, hf.price)
+		}
+		hf.conn.Close()
+	}
+}
@@ -0,0 +1,116 @@
+// +build !windows
+
+package renter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
+)
+
+// TestDownloadSparse uploads a file containing a large region of zeros, and
+// checks that the region is not fetched when the file is downloaded, and that
+// the downloaded file is sparse but identical to the original.
+func TestDownloadSparse(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestDownloadSparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The file is one chunk of random data, followed by 32 chunks of zeros
+	// and another chunk of random data.
+	const pieceSize = 1 << 16
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFile("foo", rsc, pieceSize, 34*pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, f.size)
+	rand.Read(data[:pieceSize])
+	rand.Read(data[33*pieceSize:])
+	f.hash = crypto.HashBytes(data)
+
+	// upload the file, storing the pieces on the hosts
+	hosts := make([]fetcher, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = &chunkFetcher{
+			testFetcher: &testFetcher{
+				pieceMap:  make(map[uint64][]pieceData),
+				pieceSize: pieceSize,
+				failRate:  1 << 30,
+			},
+			fetched: make(map[uint64]bool),
+		}
+	}
+	uploaders := []hostdb.Uploader{uploadHostDB{}, uploadHostDB{}}
+	for i := uint64(0); i < f.numChunks(); i++ {
+		chunk := data[i*f.chunkSize() : (i+1)*f.chunkSize()]
+		err := f.uploadChunk(i, chunk, []uint64{0, 1}, uploaders, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pieces, err := rsc.Encode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, p := range pieces {
+			host := hosts[j].(*chunkFetcher)
+			host.pieceMap[i] = append(host.pieceMap[i], pieceData{i, uint64(j), uint64(len(host.data))})
+			host.data = append(host.data, p...)
+		}
+	}
+	if len(f.zeroChunks) != 32 {
+		t.Fatal("expected 32 zero chunks, got", len(f.zeroChunks))
+	}
+
+	// download the file
+	dir := build.TempDir("renter", "TestDownloadSparse")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "foo")
+	err = rt.renter.managedDownloadFile(f, hosts, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hosts {
+		for chunk := range h.(*chunkFetcher).fetched {
+			if chunk != 0 && chunk != 33 {
+				t.Fatal("zero chunk", chunk, "was fetched")
+			}
+		}
+	}
+
+	// the downloaded file should match the original, but take up less space
+	// on disk
+	downloaded, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("downloaded file does not match the original")
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used := fi.Sys().(*syscall.Stat_t).Blocks * 512; used >= fi.Size() {
+		t.Fatalf("downloaded file is not sparse: %v bytes used for a %v byte file", used, fi.Size())
+	}
+}
@@ -1,13 +1,68 @@
 package renter
 
 import (
+	"errors"
 	"io"
+	"sync"
 
 	"github.com/klauspost/reedsolomon"
 
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+const (
+	// rsCodeID is the identifier of the Reed-Solomon erasure coder in .sia
+	// files.
+	rsCodeID = "Reed-Solomon"
+)
+
+var (
+	errDuplicateErasureCoder = errors.New("an erasure coder with that identifier is already registered")
+
+	// erasureCoders maps the identifier stored in .sia files to the function
+	// that loads an erasure coder of that type.
+	erasureCoders = map[string]ErasureCoderLoader{
+		rsCodeID: loadRSCode,
+	}
+	erasureCodersMu sync.RWMutex
+)
+
+// A RegisteredErasureCoder is an erasure coder that can be saved in a .sia
+// file. The identifier returned by ErasureCoderID is stored in the file,
+// followed by the parameters written by MarshalSia. When the file is loaded,
+// the parameters are read by the ErasureCoderLoader registered under the
+// identifier.
+type RegisteredErasureCoder interface {
+	modules.ErasureCoder
+	encoding.SiaMarshaler
+	ErasureCoderID() string
+}
+
+// An ErasureCoderLoader reads the parameters of an erasure coder from r and
+// returns the coder.
+type ErasureCoderLoader func(r io.Reader) (modules.ErasureCoder, error)
+
+// RegisterErasureCoder makes an erasure coder type available for loading .sia
+// files. An error is returned if the identifier is already registered.
+func RegisterErasureCoder(id string, load ErasureCoderLoader) error {
+	erasureCodersMu.Lock()
+	defer erasureCodersMu.Unlock()
+	if _, exists := erasureCoders[id]; exists {
+		return errDuplicateErasureCoder
+	}
+	erasureCoders[id] = load
+	return nil
+}
+
+// erasureCoderLoader returns the loader registered under id.
+func erasureCoderLoader(id string) (ErasureCoderLoader, bool) {
+	erasureCodersMu.RLock()
+	defer erasureCodersMu.RUnlock()
+	load, exists := erasureCoders[id]
+	return load, exists
+}
+
 // rsCode is a Reed-Solomon encoder/decoder. It implements the
 // modules.ErasureCoder interface.
 type rsCode struct {
@@ -53,6 +108,29 @@ func (rs *rsCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
 	return rs.enc.Join(w, pieces, int(n))
 }
 
+// ErasureCoderID returns the identifier of the Reed-Solomon coder.
+func (rs *rsCode) ErasureCoderID() string { return rsCodeID }
+
+// MarshalSia implements the encoding.SiaMarshaler interface, writing the
+// number of data and parity pieces to w.
+func (rs *rsCode) MarshalSia(w io.Writer) error {
+	return encoding.NewEncoder(w).EncodeAll(
+		uint64(rs.dataPieces),
+		uint64(rs.numPieces-rs.dataPieces),
+	)
+}
+
+// loadRSCode reads the parameters written by rsCode.MarshalSia and returns a
+// new Reed-Solomon coder.
+func loadRSCode(r io.Reader) (modules.ErasureCoder, error) {
+	var nData, nParity uint64
+	err := encoding.NewDecoder(r).DecodeAll(&nData, &nParity)
+	if err != nil {
+		return nil, err
+	}
+	return NewRSCode(int(nData), int(nParity))
+}
+
 // NewRSCode creates a new Reed-Solomon encoder/decoder using the supplied
 // parameters.
 func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
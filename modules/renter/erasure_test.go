@@ -3,10 +3,57 @@ package renter
 import (
 	"bytes"
 	"crypto/rand"
+	"io"
 	"io/ioutil"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 )
 
+// replicationCode is a mock erasure coder that stores a full copy of the
+// data in every piece.
+type replicationCode struct {
+	copies int
+}
+
+func (rc *replicationCode) NumPieces() int { return rc.copies }
+func (rc *replicationCode) MinPieces() int { return 1 }
+
+func (rc *replicationCode) Encode(data []byte) ([][]byte, error) {
+	pieces := make([][]byte, rc.copies)
+	for i := range pieces {
+		pieces[i] = append([]byte(nil), data...)
+	}
+	return pieces, nil
+}
+
+func (rc *replicationCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	for _, p := range pieces {
+		if p != nil {
+			_, err := w.Write(p[:n])
+			return err
+		}
+	}
+	return errInsufficientPieces
+}
+
+func (rc *replicationCode) ErasureCoderID() string { return "Test-Replication" }
+
+func (rc *replicationCode) MarshalSia(w io.Writer) error {
+	return encoding.NewEncoder(w).Encode(uint64(rc.copies))
+}
+
+// loadReplicationCode is the ErasureCoderLoader of replicationCode.
+func loadReplicationCode(r io.Reader) (modules.ErasureCoder, error) {
+	var copies uint64
+	err := encoding.NewDecoder(r).Decode(&copies)
+	if err != nil {
+		return nil, err
+	}
+	return &replicationCode{copies: int(copies)}, nil
+}
+
 // TestRSEncode tests the rsCode type.
 func TestRSEncode(t *testing.T) {
 	badParams := []struct {
@@ -91,3 +138,50 @@ func BenchmarkRSRecover(b *testing.B) {
 		rsc.Recover(pieces, 1<<20, ioutil.Discard)
 	}
 }
+
+// TestErasureCoderRegistry saves a file that uses a registered mock erasure
+// coder and checks that the file can be loaded again.
+func TestErasureCoderRegistry(t *testing.T) {
+	// Registering an identifier twice is an error.
+	err := RegisterErasureCoder(rsCodeID, loadRSCode)
+	if err != errDuplicateErasureCoder {
+		t.Fatal("expected errDuplicateErasureCoder, got", err)
+	}
+
+	// A file using an unregistered coder cannot be loaded.
+	savedFile := newTestingFile()
+	savedFile.erasureCode = &replicationCode{copies: 3}
+	buf := new(bytes.Buffer)
+	err = savedFile.MarshalSia(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = new(file).UnmarshalSia(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatal("loaded a file that uses an unregistered erasure coder")
+	}
+
+	// Once the coder is registered, the file can be loaded.
+	err = RegisterErasureCoder("Test-Replication", loadReplicationCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		erasureCodersMu.Lock()
+		delete(erasureCoders, "Test-Replication")
+		erasureCodersMu.Unlock()
+	}()
+	loadedFile := new(file)
+	err = loadedFile.UnmarshalSia(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = equalFiles(savedFile, loadedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, ok := loadedFile.erasureCode.(*replicationCode)
+	if !ok || rc.copies != 3 {
+		t.Fatal("erasure coder was not loaded correctly:", loadedFile.erasureCode)
+	}
+}
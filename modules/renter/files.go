@@ -1,9 +1,12 @@
 package renter
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -12,15 +15,22 @@ import (
 )
 
 var (
-	ErrUnknownPath  = errors.New("no file known with that path")
-	ErrPathOverload = errors.New("a file already exists at that location")
+	ErrUnknownPath     = errors.New("no file known with that path")
+	ErrPathOverload    = errors.New("a file already exists at that location")
+	ErrNoRepairSource  = errors.New("no local copy of that file is available for repairs")
+	ErrSourceMismatch  = errors.New("local file does not match the size of the uploaded file")
+	ErrDuplicateUpload = errors.New("a file with identical contents has already been uploaded; upload with alias set to share its contracts instead")
+	ErrBadErasureCode  = errors.New("erasure code must require at least one piece, and produce more pieces than it requires")
+	ErrBadChunkSize    = errors.New("chunk size must be a multiple of the piece size times the minimum number of pieces")
+	ErrFileBusy        = errors.New("file cannot be changed while it is being uploaded or downloaded")
 )
 
 // A file is a single file that has been uploaded to the network. Files are
 // split into equal-length chunks, which are then erasure-coded into pieces.
 // Each piece is separately encrypted, using a key derived from the file's
 // master key. The pieces are uploaded to hosts in groups, such that one file
-// contract covers many pieces.
+// contract covers many pieces. Unless 'customChunkSize' is set, each chunk
+// holds exactly one pieceSize of data per required piece.
 type file struct {
 	name        string
 	size        uint64
@@ -28,8 +38,16 @@ type file struct {
 	masterKey   crypto.TwofishKey
 	erasureCode modules.ErasureCoder
 	pieceSize   uint64
-	mode        uint32 // actually an os.FileMode
-	mu          sync.RWMutex
+	mode        uint32              // actually an os.FileMode
+	hash        crypto.Hash         // hash of the original file; empty if unknown
+	owner       string              // owner of the file; not enforced by the renter
+	permissions uint32              // Unix-style permission bits; not enforced by the renter
+	zeroChunks  map[uint64]struct{} // chunks whose data is entirely zeros
+
+	customChunkSize uint64 // zero if the chunk size is derived from pieceSize
+	transfers       int    // number of uploads and downloads in progress
+	repairing       bool   // whether the missing pieces of f are being uploaded
+	mu              sync.RWMutex
 }
 
 // A fileContract is a contract covering an arbitrary number of file pieces.
@@ -55,13 +73,68 @@ func deriveKey(masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypt
 	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
 }
 
-// chunkSize returns the size of one chunk.
+// checkErasureCode returns ErrBadErasureCode if code cannot be used to split
+// a file into chunks and pieces.
+func checkErasureCode(code modules.ErasureCoder) error {
+	if code == nil || code.MinPieces() < 1 || code.NumPieces() <= code.MinPieces() {
+		return ErrBadErasureCode
+	}
+	return nil
+}
+
+// chunkSize returns the size of one chunk. The size is zero if the erasure
+// code of the file does not require any pieces.
 func (f *file) chunkSize() uint64 {
-	return f.pieceSize * uint64(f.erasureCode.MinPieces())
+	minPieces := f.erasureCode.MinPieces()
+	if minPieces < 1 {
+		return 0
+	}
+	if f.customChunkSize != 0 {
+		return f.customChunkSize
+	}
+	return f.pieceSize * uint64(minPieces)
+}
+
+// chunkPieceSize returns the size of each piece of a chunk, before
+// encryption. Unless the file has a custom chunk size, this is the piece
+// size.
+func (f *file) chunkPieceSize() uint64 {
+	minPieces := f.erasureCode.MinPieces()
+	if minPieces < 1 {
+		return 0
+	}
+	return f.chunkSize() / uint64(minPieces)
+}
+
+// checkChunkSize returns ErrBadChunkSize if chunkSize is not a multiple of the
+// default chunk size of f. A chunk size of zero selects the default.
+func (f *file) checkChunkSize(chunkSize uint64) error {
+	stripe := f.pieceSize * uint64(f.erasureCode.MinPieces())
+	if stripe == 0 || chunkSize%stripe != 0 {
+		return ErrBadChunkSize
+	}
+	return nil
 }
 
-// numChunks returns the number of chunks that f was split into.
+// setChunkSize sets the size of the chunks of f, which must be a multiple of
+// the piece size times the minimum number of pieces of the erasure code.
+// Larger chunks are erasure-coded into proportionally larger pieces. A chunk
+// size of zero restores the default, which is one piece size per required
+// piece.
+func (f *file) setChunkSize(chunkSize uint64) error {
+	if err := f.checkChunkSize(chunkSize); err != nil {
+		return err
+	}
+	f.customChunkSize = chunkSize
+	return nil
+}
+
+// numChunks returns the number of chunks that f was split into. A file that
+// cannot be split into chunks has zero chunks.
 func (f *file) numChunks() uint64 {
+	if f.chunkSize() == 0 {
+		return 0
+	}
 	// empty files still need at least one chunk
 	if f.size == 0 {
 		return 1
@@ -74,10 +147,60 @@ func (f *file) numChunks() uint64 {
 	return n
 }
 
+// beginTransfer records that an upload or download of f has started. Renaming
+// or deleting f is refused until the transfer ends. The caller must hold the
+// lock of the renter while looking up f and calling beginTransfer, so that f
+// cannot be renamed or deleted in between.
+func (f *file) beginTransfer() {
+	f.mu.Lock()
+	f.transfers++
+	f.mu.Unlock()
+}
+
+// endTransfer records that a transfer started by beginTransfer has ended.
+func (f *file) endTransfer() {
+	f.mu.Lock()
+	f.transfers--
+	f.mu.Unlock()
+}
+
+// beginRepair records that a repair of f has started, returning false if f is
+// already being repaired. Only one repair of a file may run at a time, so that
+// the same missing pieces are not uploaded twice.
+func (f *file) beginRepair() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.repairing {
+		return false
+	}
+	f.repairing = true
+	return true
+}
+
+// endRepair records that a repair started by beginRepair has ended.
+func (f *file) endRepair() {
+	f.mu.Lock()
+	f.repairing = false
+	f.mu.Unlock()
+}
+
+// empty reports whether f holds no data. An empty file still has one chunk,
+// but no pieces of the chunk need to be uploaded, so an empty file is
+// available without any file contracts.
+func (f *file) empty() bool {
+	return f.size == 0
+}
+
 // available indicates whether the file is ready to be downloaded.
 func (f *file) available() bool {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
+	if f.numChunks() == 0 {
+		return false
+	}
+	if f.empty() {
+		return true
+	}
 	chunkPieces := make([]int, f.numChunks())
 	for _, fc := range f.contracts {
 		for _, p := range fc.Pieces {
@@ -100,13 +223,53 @@ func (f *file) uploadProgress() float64 {
 	defer f.mu.RUnlock()
 	var uploaded uint64
 	for _, fc := range f.contracts {
-		uploaded += uint64(len(fc.Pieces)) * f.pieceSize
+		uploaded += uint64(len(fc.Pieces)) * f.chunkPieceSize()
+	}
+	desired := f.chunkPieceSize() * uint64(f.erasureCode.NumPieces()) * f.numChunks()
+	if desired == 0 {
+		return 0
+	}
+	if f.empty() {
+		return 100
 	}
-	desired := f.pieceSize * uint64(f.erasureCode.NumPieces()) * f.numChunks()
 
 	return 100 * (float64(uploaded) / float64(desired))
 }
 
+// redundancy returns the redundancy of the least redundant chunk. A file with a
+// redundancy of less than 1 cannot be recovered. Pieces that are stored on
+// multiple hosts are only counted once.
+func (f *file) redundancy() float64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.numChunks() == 0 {
+		return 0
+	}
+	if f.empty() {
+		return float64(f.erasureCode.NumPieces()) / float64(f.erasureCode.MinPieces())
+	}
+	chunkPieces := make([]map[uint64]struct{}, f.numChunks())
+	for i := range chunkPieces {
+		chunkPieces[i] = make(map[uint64]struct{})
+	}
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			// skip pieces that do not belong to the file
+			if p.Chunk >= uint64(len(chunkPieces)) || p.Piece >= uint64(f.erasureCode.NumPieces()) {
+				continue
+			}
+			chunkPieces[p.Chunk][p.Piece] = struct{}{}
+		}
+	}
+	minPieces := len(chunkPieces[0])
+	for _, pieces := range chunkPieces {
+		if len(pieces) < minPieces {
+			minPieces = len(pieces)
+		}
+	}
+	return float64(minPieces) / float64(f.erasureCode.MinPieces())
+}
+
 // expiration returns the lowest height at which any of the file's contracts
 // will expire.
 func (f *file) expiration() types.BlockHeight {
@@ -124,8 +287,12 @@ func (f *file) expiration() types.BlockHeight {
 	return lowest
 }
 
-// newFile creates a new file object.
-func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64) *file {
+// newFile creates a new file object. An error is returned if the erasure code
+// cannot be used to split the file into chunks and pieces.
+func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64) (*file, error) {
+	if err := checkErasureCode(code); err != nil {
+		return nil, err
+	}
 	key, _ := crypto.GenerateTwofishKey()
 	return &file{
 		name:        name,
@@ -134,10 +301,109 @@ func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64)
 		masterKey:   key,
 		erasureCode: code,
 		pieceSize:   pieceSize,
+		zeroChunks:  make(map[uint64]struct{}),
+	}, nil
+}
+
+// alias returns a copy of f under a new name. The copy refers to the same
+// file contracts and pieces as f, so no data needs to be uploaded.
+func (f *file) alias(name string) *file {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	contracts := make(map[types.FileContractID]fileContract, len(f.contracts))
+	for id, fc := range f.contracts {
+		fc.Pieces = append([]pieceData(nil), fc.Pieces...)
+		contracts[id] = fc
+	}
+	zeroChunks := make(map[uint64]struct{}, len(f.zeroChunks))
+	for i := range f.zeroChunks {
+		zeroChunks[i] = struct{}{}
+	}
+	return &file{
+		name:        name,
+		size:        f.size,
+		contracts:   contracts,
+		masterKey:   f.masterKey,
+		erasureCode: f.erasureCode,
+		pieceSize:   f.pieceSize,
+		mode:        f.mode,
+		hash:        f.hash,
+		zeroChunks:  zeroChunks,
+
+		customChunkSize: f.customChunkSize,
+	}
+}
+
+// resize returns a copy of f that is erasure-coded with code, which must have
+// the same minimum number of pieces as the erasure code of f. Pieces of f
+// beyond the number of pieces of code are dropped, along with any contract
+// that is left without pieces.
+func (f *file) resize(code modules.ErasureCoder) *file {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	contracts := make(map[types.FileContractID]fileContract, len(f.contracts))
+	for id, fc := range f.contracts {
+		var pieces []pieceData
+		for _, p := range fc.Pieces {
+			if p.Piece < uint64(code.NumPieces()) {
+				pieces = append(pieces, p)
+			}
+		}
+		if len(pieces) == 0 {
+			continue
+		}
+		fc.Pieces = pieces
+		contracts[id] = fc
 	}
+	zeroChunks := make(map[uint64]struct{}, len(f.zeroChunks))
+	for i := range f.zeroChunks {
+		zeroChunks[i] = struct{}{}
+	}
+	return &file{
+		name:        f.name,
+		size:        f.size,
+		contracts:   contracts,
+		masterKey:   f.masterKey,
+		erasureCode: code,
+		pieceSize:   f.pieceSize,
+		mode:        f.mode,
+		hash:        f.hash,
+		owner:       f.owner,
+		permissions: f.permissions,
+		zeroChunks:  zeroChunks,
+
+		customChunkSize: f.customChunkSize,
+	}
+}
+
+// rekey returns a copy of f under a new master key. The copy has no file
+// contracts, as none of the pieces of f can be decrypted with the new key.
+func (f *file) rekey() (*file, error) {
+	key, err := crypto.GenerateTwofishKey()
+	if err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return &file{
+		name:        f.name,
+		size:        f.size,
+		contracts:   make(map[types.FileContractID]fileContract),
+		masterKey:   key,
+		erasureCode: f.erasureCode,
+		pieceSize:   f.pieceSize,
+		mode:        f.mode,
+		hash:        f.hash,
+		owner:       f.owner,
+		permissions: f.permissions,
+		zeroChunks:  make(map[uint64]struct{}),
+
+		customChunkSize: f.customChunkSize,
+	}, nil
 }
 
-// DeleteFile removes a file entry from the renter.
+// DeleteFile removes a file entry from the renter. ErrFileBusy is returned if
+// the file is being uploaded or downloaded.
 func (r *Renter) DeleteFile(nickname string) error {
 	lockID := r.mu.Lock()
 	defer r.mu.Unlock(lockID)
@@ -146,6 +412,12 @@ func (r *Renter) DeleteFile(nickname string) error {
 	if !exists {
 		return ErrUnknownPath
 	}
+	f.mu.RLock()
+	busy := f.transfers != 0
+	f.mu.RUnlock()
+	if busy {
+		return ErrFileBusy
+	}
 	delete(r.files, nickname)
 
 	err := os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
@@ -156,32 +428,235 @@ func (r *Renter) DeleteFile(nickname string) error {
 	return r.save()
 }
 
+// expiresWithin returns true if the file described by 'fi' is not being
+// renewed, and its earliest contract expires within 'blocks' blocks of
+// 'height'. Files whose contracts have already expired are not included.
+func expiresWithin(fi modules.FileInfo, height, blocks types.BlockHeight) bool {
+	return !fi.Renewing && fi.Expiration > height && fi.Expiration <= height+blocks
+}
+
 // FileList returns all of the files that the renter has.
 func (r *Renter) FileList() []modules.FileInfo {
+	height := r.cs.Height()
 	lockID := r.mu.RLock()
 	defer r.mu.RUnlock(lockID)
 
 	files := make([]modules.FileInfo, 0, len(r.files))
 	for _, f := range r.files {
-		var renewing bool
+		var renewing, reduced bool
 		if meta, ok := r.tracking[f.name]; ok {
 			renewing = meta.Renew
+			reduced = meta.Reduced
 		}
-		files = append(files, modules.FileInfo{
-			SiaPath:        f.name,
-			Filesize:       f.size,
-			Available:      f.available(),
-			Renewing:       renewing,
-			UploadProgress: f.uploadProgress(),
-			Expiration:     f.expiration(),
-		})
+		fi := modules.FileInfo{
+			SiaPath:           f.name,
+			Filesize:          f.size,
+			Available:         f.available(),
+			Renewing:          renewing,
+			UploadProgress:    f.uploadProgress(),
+			Redundancy:        f.redundancy(),
+			Expiration:        f.expiration(),
+			ReducedRedundancy: reduced,
+		}
+		fi.ExpiringSoon = expiresWithin(fi, height, r.expiryWindow)
+		files = append(files, fi)
 	}
 	return files
 }
 
+// ExpiringFiles returns the files that are not being renewed, and whose
+// earliest contract expires within the next 'within' blocks. The files are
+// sorted by expiration, soonest first.
+func (r *Renter) ExpiringFiles(within types.BlockHeight) []modules.FileInfo {
+	height := r.cs.Height()
+	var expiring []modules.FileInfo
+	for _, fi := range r.FileList() {
+		if expiresWithin(fi, height, within) {
+			expiring = append(expiring, fi)
+		}
+	}
+	sort.Sort(fileInfoSlice{expiring, func(a, b modules.FileInfo) bool { return a.Expiration < b.Expiration }})
+	return expiring
+}
+
+// CheckConsistency cross-validates the files of the renter against the file
+// contracts known to the hostdb. It reports files that reference unknown
+// contracts, contracts that are referenced by no file, and chunks that have
+// fewer than the minimum number of pieces on known contracts. Issues are
+// sorted by file, then by chunk; issues concerning unused contracts come last.
+func (r *Renter) CheckConsistency() []modules.ConsistencyIssue {
+	known := make(map[types.FileContractID]bool)
+	for _, c := range r.hostDB.Contracts() {
+		known[c.ID] = false
+	}
+
+	lockID := r.mu.RLock()
+	files := make([]*file, 0, len(r.files))
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	r.mu.RUnlock(lockID)
+	sort.Sort(filesByName(files))
+
+	var issues []modules.ConsistencyIssue
+	for _, f := range files {
+		f.mu.RLock()
+		var unknown []types.FileContractID
+		numChunks := f.numChunks()
+		if f.empty() {
+			numChunks = 0 // no pieces are needed
+		}
+		chunkPieces := make([]map[uint64]struct{}, numChunks)
+		for i := range chunkPieces {
+			chunkPieces[i] = make(map[uint64]struct{})
+		}
+		for id, fc := range f.contracts {
+			if _, ok := known[id]; !ok {
+				unknown = append(unknown, id)
+				continue
+			}
+			known[id] = true
+			for _, p := range fc.Pieces {
+				if p.Chunk < uint64(len(chunkPieces)) {
+					chunkPieces[p.Chunk][p.Piece] = struct{}{}
+				}
+			}
+		}
+		sort.Sort(contractIDs(unknown))
+		for _, id := range unknown {
+			issues = append(issues, modules.ConsistencyIssue{
+				Kind:       modules.ConsistencyUnknownContract,
+				SiaPath:    f.name,
+				ContractID: id,
+			})
+		}
+		for chunk, pieces := range chunkPieces {
+			if len(pieces) < f.erasureCode.MinPieces() {
+				issues = append(issues, modules.ConsistencyIssue{
+					Kind:    modules.ConsistencyInsufficientPieces,
+					SiaPath: f.name,
+					Chunk:   uint64(chunk),
+				})
+			}
+		}
+		f.mu.RUnlock()
+	}
+
+	var unused []types.FileContractID
+	for id, used := range known {
+		if !used {
+			unused = append(unused, id)
+		}
+	}
+	sort.Sort(contractIDs(unused))
+	for _, id := range unused {
+		issues = append(issues, modules.ConsistencyIssue{
+			Kind:       modules.ConsistencyUnusedContract,
+			ContractID: id,
+		})
+	}
+	return issues
+}
+
+// filesByName sorts files by their path.
+type filesByName []*file
+
+func (fs filesByName) Len() int           { return len(fs) }
+func (fs filesByName) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
+func (fs filesByName) Less(i, j int) bool { return fs[i].name < fs[j].name }
+
+// contractIDs sorts file contract IDs by their bytes.
+type contractIDs []types.FileContractID
+
+func (ids contractIDs) Len() int           { return len(ids) }
+func (ids contractIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+func (ids contractIDs) Less(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 }
+
+// fileInfoSlice sorts a slice of FileInfo using a comparison function. Files
+// that compare equal are sorted by path, so that the order is deterministic.
+type fileInfoSlice struct {
+	files []modules.FileInfo
+	less  func(a, b modules.FileInfo) bool
+}
+
+func (fs fileInfoSlice) Len() int      { return len(fs.files) }
+func (fs fileInfoSlice) Swap(i, j int) { fs.files[i], fs.files[j] = fs.files[j], fs.files[i] }
+func (fs fileInfoSlice) Less(i, j int) bool {
+	a, b := fs.files[i], fs.files[j]
+	if fs.less(a, b) {
+		return true
+	} else if fs.less(b, a) {
+		return false
+	}
+	return a.SiaPath < b.SiaPath
+}
+
+// FileListPage returns up to 'limit' of the renter's files, starting at
+// 'offset', along with the total number of files. The files are sorted by
+// sortBy, which is one of the FileSort constants; unrecognized values sort by
+// name. A negative limit returns every file after offset.
+func (r *Renter) FileListPage(offset, limit int, sortBy string) ([]modules.FileInfo, int) {
+	files := r.FileList()
+	var less func(a, b modules.FileInfo) bool
+	switch sortBy {
+	case modules.FileSortSize:
+		less = func(a, b modules.FileInfo) bool { return a.Filesize < b.Filesize }
+	case modules.FileSortRedundancy:
+		less = func(a, b modules.FileInfo) bool { return a.Redundancy < b.Redundancy }
+	default:
+		less = func(a, b modules.FileInfo) bool { return a.SiaPath < b.SiaPath }
+	}
+	sort.Sort(fileInfoSlice{files, less})
+
+	total := len(files)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit >= 0 && limit < total-offset {
+		end = offset + limit
+	}
+	return files[offset:end], total
+}
+
+// ListDirectory treats the paths of the renter's files as a directory tree,
+// and returns the subdirectories and files directly under 'prefix', in the
+// manner of ls. An empty prefix lists the root of the tree. Both slices are
+// sorted by name, and subdirectories are returned without the prefix.
+func (r *Renter) ListDirectory(prefix string) ([]string, []modules.FileInfo) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var dirs []string
+	var files []modules.FileInfo
+	seen := make(map[string]bool)
+	for _, fi := range r.FileList() {
+		if !strings.HasPrefix(fi.SiaPath, prefix) {
+			continue
+		}
+		rest := fi.SiaPath[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			if dir := rest[:i]; !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+			continue
+		}
+		files = append(files, fi)
+	}
+	sort.Strings(dirs)
+	sort.Sort(fileInfoSlice{files, func(a, b modules.FileInfo) bool { return a.SiaPath < b.SiaPath }})
+	return dirs, files
+}
+
 // RenameFile takes an existing file and changes the nickname. The original
-// file must exist, and there must not be any file that already has the
-// replacement nickname.
+// file must exist and must not be in the middle of an upload or download, and
+// there must not be any file that already has the replacement nickname.
 func (r *Renter) RenameFile(currentName, newName string) error {
 	lockID := r.mu.Lock()
 	defer r.mu.Unlock(lockID)
@@ -196,8 +671,13 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 		return ErrPathOverload
 	}
 
-	// Modify the file and save it to disk.
+	// Modify the file and save it to disk. A file that is being transferred
+	// cannot be renamed, since the transfer refers to it by name.
 	file.mu.Lock()
+	if file.transfers != 0 {
+		file.mu.Unlock()
+		return ErrFileBusy
+	}
 	file.name = newName
 	err := r.saveFile(file)
 	file.mu.Unlock()
@@ -221,3 +701,165 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
 	return os.RemoveAll(oldPath)
 }
+
+// SetFileTracking changes whether a file is actively repaired by the renter,
+// and whether the file contracts of the file are renewed. Untracking a file
+// leaves the data on the network in place, but the renter stops repairing the
+// file until tracking is enabled again. The contracts of an untracked file are
+// still renewed if renew is set.
+func (r *Renter) SetFileTracking(nickname string, track bool, renew bool) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	_, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	meta, exists := r.tracking[nickname]
+	if !exists {
+		// Files loaded from a .sia file have no local copy that can be used
+		// for repairs.
+		return ErrNoRepairSource
+	}
+	meta.Paused = !track
+	meta.Renew = renew
+	r.tracking[nickname] = meta
+	return r.save()
+}
+
+// SetFilePriority sets the repair priority of a tracked file. When several
+// files need repair, files with a higher priority are repaired first. Files
+// have a priority of zero by default.
+func (r *Renter) SetFilePriority(nickname string, priority int) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	_, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	meta, exists := r.tracking[nickname]
+	if !exists {
+		return ErrNoRepairSource
+	}
+	meta.Priority = priority
+	r.tracking[nickname] = meta
+	return r.save()
+}
+
+// SetRepairPath changes the local copy of a tracked file that is used for
+// repairs, for example after the original file was moved. The new path must
+// be a file of the same size as the uploaded file.
+func (r *Renter) SetRepairPath(nickname, newPath string) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	meta, exists := r.tracking[nickname]
+	if !exists {
+		return ErrNoRepairSource
+	}
+	stat, err := os.Stat(newPath)
+	if err != nil {
+		return err
+	}
+	f.mu.RLock()
+	size := f.size
+	f.mu.RUnlock()
+	if stat.IsDir() || uint64(stat.Size()) != size {
+		return ErrSourceMismatch
+	}
+	meta.RepairPath = newPath
+	r.tracking[nickname] = meta
+	return r.save()
+}
+
+// SetFileOwner sets the owner and permission bits of a file. The renter does
+// not enforce access control; the metadata is stored with the file so that
+// front ends serving multiple users can enforce their own policy.
+func (r *Renter) SetFileOwner(nickname, owner string, permissions uint32) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.owner = owner
+	f.permissions = permissions
+	return r.saveFile(f)
+}
+
+// FileOwner returns the owner and permission bits of a file.
+func (r *Renter) FileOwner(nickname string) (owner string, permissions uint32, err error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return "", 0, ErrUnknownPath
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.owner, f.permissions, nil
+}
+
+// FileHosts returns the hosts that store pieces of a file. Each file contract
+// of the file is reported separately, sorted by host address, with its
+// pieces sorted by chunk and piece index.
+func (r *Renter) FileHosts(nickname string) ([]modules.FileHostInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	hosts := make([]modules.FileHostInfo, 0, len(f.contracts))
+	for _, fc := range f.contracts {
+		pieces := make([]modules.FilePiece, len(fc.Pieces))
+		for i, p := range fc.Pieces {
+			pieces[i] = modules.FilePiece{Chunk: p.Chunk, Piece: p.Piece}
+		}
+		sort.Sort(byChunkAndPiece(pieces))
+		hosts = append(hosts, modules.FileHostInfo{
+			ContractID:  fc.ID,
+			IP:          fc.IP,
+			Pieces:      pieces,
+			WindowStart: fc.WindowStart,
+		})
+	}
+	sort.Sort(byHostAddress(hosts))
+	return hosts, nil
+}
+
+// byChunkAndPiece sorts file pieces by chunk index, and then by piece index.
+type byChunkAndPiece []modules.FilePiece
+
+func (s byChunkAndPiece) Len() int      { return len(s) }
+func (s byChunkAndPiece) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byChunkAndPiece) Less(i, j int) bool {
+	if s[i].Chunk != s[j].Chunk {
+		return s[i].Chunk < s[j].Chunk
+	}
+	return s[i].Piece < s[j].Piece
+}
+
+// byHostAddress sorts file hosts by address, and then by contract ID.
+type byHostAddress []modules.FileHostInfo
+
+func (s byHostAddress) Len() int      { return len(s) }
+func (s byHostAddress) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byHostAddress) Less(i, j int) bool {
+	if s[i].IP != s[j].IP {
+		return s[i].IP < s[j].IP
+	}
+	return bytes.Compare(s[i].ContractID[:], s[j].ContractID[:]) < 0
+}
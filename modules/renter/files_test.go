@@ -1,10 +1,22 @@
 package renter
 
 import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -35,6 +47,54 @@ func TestFileNumChunks(t *testing.T) {
 	}
 }
 
+// pieceCountCode is a mock erasure coder that reports arbitrary piece counts.
+type pieceCountCode struct {
+	numPieces int
+	minPieces int
+}
+
+func (c pieceCountCode) NumPieces() int                            { return c.numPieces }
+func (c pieceCountCode) MinPieces() int                            { return c.minPieces }
+func (c pieceCountCode) Encode([]byte) ([][]byte, error)           { return nil, nil }
+func (c pieceCountCode) Recover([][]byte, uint64, io.Writer) error { return nil }
+
+// TestFileBadErasureCode checks that files cannot be created with an erasure
+// code that does not require any pieces or does not add redundancy, and that
+// the file accessors do not panic on such a code.
+func TestFileBadErasureCode(t *testing.T) {
+	codes := []modules.ErasureCoder{
+		nil,
+		pieceCountCode{numPieces: 2, minPieces: 0},
+		pieceCountCode{numPieces: 2, minPieces: -1},
+		pieceCountCode{numPieces: 2, minPieces: 2},
+		pieceCountCode{numPieces: 1, minPieces: 2},
+	}
+	for _, code := range codes {
+		_, err := newFile("foo", code, 64, 1000)
+		if err != ErrBadErasureCode {
+			t.Errorf("expected ErrBadErasureCode for %v, got %v", code, err)
+		}
+	}
+	_, err := newFile("foo", pieceCountCode{numPieces: 2, minPieces: 1}, 64, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &file{size: 1000, erasureCode: pieceCountCode{numPieces: 2, minPieces: 0}, pieceSize: 64}
+	if f.numChunks() != 0 {
+		t.Error("expected zero chunks, got", f.numChunks())
+	}
+	if f.available() {
+		t.Error("file with a zero-piece erasure code is available")
+	}
+	if f.redundancy() != 0 {
+		t.Error("expected zero redundancy, got", f.redundancy())
+	}
+	if f.uploadProgress() != 0 {
+		t.Error("expected zero upload progress, got", f.uploadProgress())
+	}
+}
+
 // TestFileAvailable probes the available method of the file type.
 func TestFileAvailable(t *testing.T) {
 	rsc, _ := NewRSCode(1, 10)
@@ -59,6 +119,64 @@ func TestFileAvailable(t *testing.T) {
 	}
 }
 
+// TestFileRedundancy probes the redundancy method of the file type.
+func TestFileRedundancy(t *testing.T) {
+	rsc, _ := NewRSCode(2, 4)
+	f := &file{
+		size:        1000,
+		erasureCode: rsc,
+		pieceSize:   100,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+	if r := f.redundancy(); r != 0 {
+		t.Error("file with no pieces should have no redundancy, got", r)
+	}
+
+	// Store the first two pieces of every chunk.
+	var fc fileContract
+	for i := uint64(0); i < f.numChunks(); i++ {
+		fc.Pieces = append(fc.Pieces, pieceData{Chunk: i, Piece: 0}, pieceData{Chunk: i, Piece: 1})
+	}
+	f.contracts[types.FileContractID{0}] = fc
+	if r := f.redundancy(); r != 1 {
+		t.Error("expected redundancy of 1, got", r)
+	}
+
+	// Storing duplicate pieces on another host should not add redundancy.
+	f.contracts[types.FileContractID{1}] = fc
+	if r := f.redundancy(); r != 1 {
+		t.Error("duplicate pieces should not add redundancy, got", r)
+	}
+
+	// Add a third piece to all but the last chunk. The redundancy is limited
+	// by the last chunk.
+	fc = fileContract{}
+	for i := uint64(0); i < f.numChunks()-1; i++ {
+		fc.Pieces = append(fc.Pieces, pieceData{Chunk: i, Piece: 2})
+	}
+	f.contracts[types.FileContractID{2}] = fc
+	if r := f.redundancy(); r != 1 {
+		t.Error("redundancy should be limited by the least redundant chunk, got", r)
+	}
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: f.numChunks() - 1, Piece: 2})
+	f.contracts[types.FileContractID{2}] = fc
+	if r := f.redundancy(); r != 1.5 {
+		t.Error("expected redundancy of 1.5, got", r)
+	}
+
+	// Pieces that do not belong to the file are ignored.
+	f.contracts[types.FileContractID{3}] = fileContract{Pieces: []pieceData{
+		{Chunk: f.numChunks(), Piece: 0},
+		{Chunk: 0, Piece: uint64(rsc.NumPieces())},
+	}}
+	if r := f.redundancy(); r != 1.5 {
+		t.Error("out-of-range pieces should be ignored, got", r)
+	}
+	if uint64(len(f.unhealthyChunks(&uploadHostDB{}))) != f.numChunks() {
+		t.Error("out-of-range pieces should be ignored by unhealthyChunks")
+	}
+}
+
 // TestFileExpiration probes the expiration method of the file type.
 func TestFileExpiration(t *testing.T) {
 	f := &file{
@@ -206,6 +324,252 @@ func TestRenterFileList(t *testing.T) {
 	}
 }
 
+// TestRenterFileListPage populates the renter with many files, and checks the
+// boundaries, ordering, and total count of the pages returned by
+// FileListPage.
+func TestRenterFileListPage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterFileListPage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add files whose sizes repeat, so that ties must be broken by name.
+	const numFiles = 25
+	rsc, _ := NewRSCode(1, 1)
+	for i := 0; i < numFiles; i++ {
+		f, err := newFile(fmt.Sprintf("file%02d", i), rsc, 64, uint64(100*(i%5)+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.renter.files[f.name] = f
+	}
+
+	// Page through the files by name.
+	var names []string
+	for offset := 0; offset < numFiles; offset += 10 {
+		page, total := rt.renter.FileListPage(offset, 10, modules.FileSortName)
+		if total != numFiles {
+			t.Fatal("wrong total:", total)
+		}
+		if expected := numFiles - offset; (expected > 10 && len(page) != 10) || (expected <= 10 && len(page) != expected) {
+			t.Fatalf("page at offset %v has %v files", offset, len(page))
+		}
+		for _, fi := range page {
+			names = append(names, fi.SiaPath)
+		}
+	}
+	for i, name := range names {
+		if name != fmt.Sprintf("file%02d", i) {
+			t.Fatalf("file %v is %v", i, name)
+		}
+	}
+
+	// Pages past the end are empty, and a negative limit returns the rest.
+	page, total := rt.renter.FileListPage(numFiles, 10, modules.FileSortName)
+	if len(page) != 0 || total != numFiles {
+		t.Error("page past the end is not empty:", len(page), total)
+	}
+	page, _ = rt.renter.FileListPage(20, -1, modules.FileSortName)
+	if len(page) != 5 {
+		t.Error("negative limit did not return the remaining files:", len(page))
+	}
+
+	// Sort by size and by redundancy. Both orders must be deterministic.
+	for _, sortBy := range []string{modules.FileSortSize, modules.FileSortRedundancy} {
+		all, _ := rt.renter.FileListPage(0, numFiles, sortBy)
+		for i := 1; i < len(all); i++ {
+			a, b := all[i-1], all[i]
+			var less, equal bool
+			if sortBy == modules.FileSortSize {
+				less, equal = a.Filesize < b.Filesize, a.Filesize == b.Filesize
+			} else {
+				less, equal = a.Redundancy < b.Redundancy, a.Redundancy == b.Redundancy
+			}
+			if !less && !(equal && a.SiaPath < b.SiaPath) {
+				t.Fatalf("files are out of order when sorted by %v: %v, %v", sortBy, a.SiaPath, b.SiaPath)
+			}
+		}
+		page, _ := rt.renter.FileListPage(3, 4, sortBy)
+		if !reflect.DeepEqual(page, all[3:7]) {
+			t.Errorf("page sorted by %v does not match the full listing", sortBy)
+		}
+	}
+}
+
+// TestRenterListDirectory adds files with nested paths, and checks that
+// ListDirectory splits the paths under a prefix into subdirectories and files.
+func TestRenterListDirectory(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterListDirectory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{
+		"readme",
+		"photos/a.jpg",
+		"photos/2020/x.jpg",
+		"photos/2020/y.jpg",
+		"photos/2021/z.jpg",
+		"photos2/b.jpg",
+		"videos/2020/v.mp4",
+	} {
+		f, err := newFile(name, rsc, 64, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.renter.files[f.name] = f
+	}
+
+	tests := []struct {
+		prefix string
+		dirs   []string
+		files  []string
+	}{
+		{"", []string{"photos", "photos2", "videos"}, []string{"readme"}},
+		{"photos", []string{"2020", "2021"}, []string{"photos/a.jpg"}},
+		{"photos/", []string{"2020", "2021"}, []string{"photos/a.jpg"}},
+		{"photos/2020", nil, []string{"photos/2020/x.jpg", "photos/2020/y.jpg"}},
+		{"videos", []string{"2020"}, nil},
+		{"music", nil, nil},
+	}
+	for _, test := range tests {
+		dirs, files := rt.renter.ListDirectory(test.prefix)
+		var names []string
+		for _, fi := range files {
+			names = append(names, fi.SiaPath)
+		}
+		if !reflect.DeepEqual(dirs, test.dirs) || !reflect.DeepEqual(names, test.files) {
+			t.Errorf("listing %q: expected %v and %v, got %v and %v", test.prefix, test.dirs, test.files, dirs, names)
+		}
+	}
+}
+
+// TestRenterExpiringFiles checks that files that are not being renewed are
+// flagged once their contracts expire within the expiry window.
+func TestRenterExpiringFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterExpiringFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.SetExpiryWindow(10)
+
+	// Add files whose contracts expire at different heights. Only "soon" is
+	// not renewed and expires within the window.
+	height := rt.renter.cs.Height()
+	rsc, _ := NewRSCode(1, 1)
+	for _, test := range []struct {
+		name   string
+		expiry types.BlockHeight
+		renew  bool
+	}{
+		{"soon", height + 5, false},
+		{"later", height + 50, false},
+		{"renewed", height + 5, true},
+	} {
+		f, err := newFile(test.name, rsc, 64, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.contracts[types.FileContractID{}] = fileContract{WindowStart: test.expiry}
+		rt.renter.files[f.name] = f
+		rt.renter.tracking[f.name] = trackedFile{Renew: test.renew}
+	}
+
+	for _, fi := range rt.renter.FileList() {
+		if fi.ExpiringSoon != (fi.SiaPath == "soon") {
+			t.Errorf("file %v has ExpiringSoon set to %v", fi.SiaPath, fi.ExpiringSoon)
+		}
+	}
+	expiring := rt.renter.ExpiringFiles(10)
+	if len(expiring) != 1 || expiring[0].SiaPath != "soon" {
+		t.Fatal("wrong files are expiring within 10 blocks:", expiring)
+	}
+	if expiring := rt.renter.ExpiringFiles(4); len(expiring) != 0 {
+		t.Fatal("files are expiring within 4 blocks:", expiring)
+	}
+	if expiring := rt.renter.ExpiringFiles(100); len(expiring) != 2 || expiring[0].SiaPath != "soon" {
+		t.Fatal("expected 2 expiring files, soonest first, got", expiring)
+	}
+}
+
+// contractsHostDB is a mocked hostDB that knows about a fixed set of file
+// contracts.
+type contractsHostDB struct {
+	offlineHostDB
+	contracts []modules.RenterContract
+}
+
+// Contracts returns the contracts of the contractsHostDB.
+func (hdb contractsHostDB) Contracts() []modules.RenterContract { return hdb.contracts }
+
+// TestRenterCheckConsistency checks that CheckConsistency reports files that
+// reference unknown contracts, contracts that no file references, and chunks
+// without enough pieces.
+func TestRenterCheckConsistency(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterCheckConsistency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.hostDB = contractsHostDB{
+		contracts: []modules.RenterContract{{ID: types.FileContractID{1}}, {ID: types.FileContractID{3}}},
+	}
+
+	// "good" is stored under a known contract. "dangling" references a
+	// contract that the hostdb has no record of, leaving its only chunk
+	// without any pieces on known contracts.
+	rsc, _ := NewRSCode(1, 1)
+	good, err := newFile("good", rsc, 64, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good.contracts[types.FileContractID{1}] = fileContract{
+		ID:     types.FileContractID{1},
+		Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}},
+	}
+	dangling, err := newFile("dangling", rsc, 64, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dangling.contracts[types.FileContractID{2}] = fileContract{
+		ID:     types.FileContractID{2},
+		Pieces: []pieceData{{Chunk: 0, Piece: 0}},
+	}
+	rt.renter.files[good.name] = good
+	rt.renter.files[dangling.name] = dangling
+
+	expected := []modules.ConsistencyIssue{
+		{Kind: modules.ConsistencyUnknownContract, SiaPath: "dangling", ContractID: types.FileContractID{2}},
+		{Kind: modules.ConsistencyInsufficientPieces, SiaPath: "dangling", Chunk: 0},
+		{Kind: modules.ConsistencyUnusedContract, ContractID: types.FileContractID{3}},
+	}
+	issues := rt.renter.CheckConsistency()
+	if !reflect.DeepEqual(issues, expected) {
+		t.Fatalf("expected issues %v, got %v", expected, issues)
+	}
+
+	// Checking consistency should not modify the files.
+	if len(dangling.contracts) != 1 || len(rt.renter.files) != 2 {
+		t.Fatal("CheckConsistency modified the renter")
+	}
+}
+
 // TestRenterRenameFile probes the rename method of the renter.
 func TestRenterRenameFile(t *testing.T) {
 	rt, err := newRenterTester("TestRenterRenameFile")
@@ -251,3 +615,366 @@ func TestRenterRenameFile(t *testing.T) {
 		t.Error("Expecting ErrPathOverload, got", err)
 	}
 }
+
+// blockingHostDB is a hostDB whose hosts serve a single piece over a pipe, but
+// only once release is closed.
+type blockingHostDB struct {
+	uploadHostDB
+	piece   []byte
+	release chan struct{}
+}
+
+// ActiveHosts reports the single host of the hostDB, which speaks the current
+// protocol version.
+func (hdb blockingHostDB) ActiveHosts() []modules.HostSettings {
+	return []modules.HostSettings{{NetAddress: "foo", ProtocolVersion: modules.ProtocolVersion}}
+}
+
+// AllHosts reports the single host of the hostDB.
+func (hdb blockingHostDB) AllHosts() []modules.HostSettings { return hdb.ActiveHosts() }
+
+// DialHost returns a connection to a simulated host that waits for release
+// before serving each piece. Downloads are free.
+func (hdb blockingHostDB) DialHost(modules.NetAddress) (net.Conn, error) {
+	renterConn, hostConn := net.Pipe()
+	go func() {
+		defer hostConn.Close()
+		var rpc types.Specifier
+		var fcid types.FileContractID
+		if encoding.ReadObject(hostConn, &rpc, 16) != nil || encoding.ReadObject(hostConn, &fcid, 32) != nil {
+			return
+		}
+		if rpc == modules.RPCPaidDownload && encoding.WriteObject(hostConn, types.ZeroCurrency) != nil {
+			return
+		}
+		for {
+			var req modules.DownloadRequest
+			if encoding.ReadObject(hostConn, &req, 16) != nil || req.Length == 0 {
+				return
+			}
+			<-hdb.release
+			if _, err := hostConn.Write(hdb.piece); err != nil {
+				return
+			}
+		}
+	}()
+	return renterConn, nil
+}
+
+// TestRenterRenameDuringDownload renames and deletes a file while it is being
+// downloaded, and checks that both are refused without disturbing the
+// download, and are allowed once the download has finished.
+func TestRenterRenameDuringDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterRenameDuringDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file stored on a single host.
+	const pieceSize = 64
+	data, err := crypto.RandBytes(pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("foo", rsc, pieceSize, pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := types.FileContractID{1}
+	f.contracts[fcid] = fileContract{ID: fcid, IP: "foo", Pieces: []pieceData{{Chunk: 0, Piece: 0}}}
+	piece, err := deriveKey(f.masterKey, 0, 0).EncryptBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := blockingHostDB{piece: piece, release: make(chan struct{})}
+	rt.renter.hostDB = hdb
+	lockID := rt.renter.mu.Lock()
+	rt.renter.files["foo"] = f
+	rt.renter.mu.Unlock(lockID)
+
+	// Start a download that blocks until the host is released.
+	var buf bytes.Buffer
+	errChan := make(chan error)
+	go func() {
+		errChan <- rt.renter.DownloadTo("foo", &buf)
+	}()
+	for i := 0; i < 50 && len(rt.renter.Downloads()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(rt.renter.Downloads()) != 1 {
+		t.Fatal("download is not active")
+	}
+
+	// The file cannot be renamed or deleted during the download.
+	err = rt.renter.RenameFile("foo", "bar")
+	if err != ErrFileBusy {
+		t.Fatal("expected ErrFileBusy when renaming, got", err)
+	}
+	err = rt.renter.DeleteFile("foo")
+	if err != ErrFileBusy {
+		t.Fatal("expected ErrFileBusy when deleting, got", err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "foo" {
+		t.Fatal("file was changed during the download:", files)
+	}
+
+	// The download should complete normally.
+	close(hdb.release)
+	select {
+	case err = <-errChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download did not complete")
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("downloaded data does not match the file")
+	}
+
+	// The file can be renamed once the download has finished.
+	err = rt.renter.RenameFile("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "bar" {
+		t.Fatal("file was not renamed:", files)
+	}
+}
+
+// TestRenterSetFileTracking checks that tracking can be toggled at runtime,
+// and that the repair loop skips files that are not being tracked.
+func TestRenterSetFileTracking(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterSetFileTracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Toggle tracking on a file that does not exist.
+	err = rt.renter.SetFileTracking("dne", false, false)
+	if err != ErrUnknownPath {
+		t.Error("Expected ErrUnknownPath:", err)
+	}
+
+	// Toggle tracking on a file that has no repair source.
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("untracked", rsc, 64, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files[f.name] = f
+	err = rt.renter.SetFileTracking(f.name, true, true)
+	if err != ErrNoRepairSource {
+		t.Error("Expected ErrNoRepairSource:", err)
+	}
+
+	// Add a tracked file whose repair source does not exist. Any repair
+	// attempt will fail to open the source and remove the file from the
+	// repair set.
+	f, err = newFile("tracked", rsc, 64, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{
+		RepairPath: filepath.Join(rt.renter.persistDir, "dne"),
+		Renew:      true,
+	}
+
+	// Untrack the file and run the repair, the file should be skipped.
+	err = rt.renter.SetFileTracking(f.name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.repairBatch([]repairingFile{{f.name, trackedFile{Renew: true}}}, make(map[types.FileContractID]types.FileContractID))
+	meta, exists := rt.renter.tracking[f.name]
+	if !exists {
+		t.Fatal("repair was attempted on an untracked file")
+	}
+	if !meta.Paused || !meta.Renew {
+		t.Error("tracking metadata was not updated")
+	}
+
+	// Track the file again and run the repair, the file should be repaired.
+	err = rt.renter.SetFileTracking(f.name, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.repairBatch([]repairingFile{{f.name, meta}}, make(map[types.FileContractID]types.FileContractID))
+	if _, exists := rt.renter.tracking[f.name]; exists {
+		t.Error("repair was not attempted on a tracked file")
+	}
+}
+
+// TestRenterSetRepairPath moves the local copy of a tracked file, rebinds the
+// repair path, and checks that the repair loop reads from the new location.
+func TestRenterSetRepairPath(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterSetRepairPath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.hostDB = &uploadHostDB{}
+
+	// Create a tracked file whose local copy is then moved.
+	data, err := crypto.RandBytes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(rt.renter.persistDir, "old.dat")
+	newPath := filepath.Join(rt.renter.persistDir, "new.dat")
+	err = ioutil.WriteFile(oldPath, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("moved", rsc, 64, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{RepairPath: oldPath, Renew: true}
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Try rebinding unknown files and invalid sources.
+	err = rt.renter.SetRepairPath("dne", newPath)
+	if err != ErrUnknownPath {
+		t.Error("Expected ErrUnknownPath:", err)
+	}
+	err = rt.renter.SetRepairPath(f.name, oldPath)
+	if !os.IsNotExist(err) {
+		t.Error("Expected a missing file error:", err)
+	}
+	err = ioutil.WriteFile(oldPath, data[:50], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.SetRepairPath(f.name, oldPath)
+	if err != ErrSourceMismatch {
+		t.Error("Expected ErrSourceMismatch:", err)
+	}
+	err = os.Remove(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rebind the repair path and run the repair. The file should be repaired
+	// from its new location.
+	err = rt.renter.SetRepairPath(f.name, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.repairBatch([]repairingFile{{f.name, rt.renter.tracking[f.name]}}, make(map[types.FileContractID]types.FileContractID))
+	meta, exists := rt.renter.tracking[f.name]
+	if !exists {
+		t.Fatal("repair could not open the new repair path")
+	}
+	if meta.RepairPath != newPath {
+		t.Error("repair path was not updated:", meta.RepairPath)
+	}
+	if len(f.incompleteChunks()) != 0 {
+		t.Error("file was not repaired from the new repair path")
+	}
+}
+
+// endHeightHost is a testHost whose contract ends at a configurable height.
+type endHeightHost struct {
+	*testHost
+	endHeight types.BlockHeight
+}
+
+// EndHeight returns the end height of the host's contract.
+func (h endHeightHost) EndHeight() types.BlockHeight { return h.endHeight }
+
+// TestRenterFileHosts uploads the chunks of a file across a set of hosts and
+// checks that FileHosts reports the pieces held by each host.
+func TestRenterFileHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterFileHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	_, err = rt.renter.FileHosts("dne")
+	if err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Upload each chunk of the file to the hosts in a different order, so
+	// that each host holds a different piece of each chunk.
+	rsc, err := NewRSCode(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pieceSize = 64
+	const numChunks = 3
+	f, err := newFile("foo", rsc, pieceSize, numChunks*pieceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make([]hostdb.Uploader, rsc.NumPieces())
+	for i := range hosts {
+		hosts[i] = endHeightHost{
+			testHost:  &testHost{ip: modules.NetAddress(fmt.Sprintf("host%d", i)), failRate: 1 << 30},
+			endHeight: types.BlockHeight(100 + i),
+		}
+	}
+	expected := make(map[modules.NetAddress][]modules.FilePiece)
+	for chunk := uint64(0); chunk < numChunks; chunk++ {
+		data := make([]byte, f.chunkSize())
+		rand.Read(data)
+		missingPieces := make([]uint64, len(hosts))
+		for i, h := range hosts {
+			piece := (chunk + uint64(i)) % uint64(len(hosts))
+			missingPieces[i] = piece
+			expected[h.Address()] = append(expected[h.Address()], modules.FilePiece{Chunk: chunk, Piece: piece})
+		}
+		err = f.uploadChunk(chunk, data, missingPieces, hosts, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockID := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(lockID)
+
+	fileHosts, err := rt.renter.FileHosts(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileHosts) != len(hosts) {
+		t.Fatalf("expected %v hosts, got %v", len(hosts), len(fileHosts))
+	}
+	for i, fh := range fileHosts {
+		h := hosts[i]
+		if fh.IP != h.Address() || fh.ContractID != h.ContractID() {
+			t.Errorf("host %v was reported as %v (%v)", h.Address(), fh.IP, fh.ContractID)
+		}
+		if fh.WindowStart != h.EndHeight() {
+			t.Errorf("host %v has window start %v, expected %v", fh.IP, fh.WindowStart, h.EndHeight())
+		}
+		if !reflect.DeepEqual(fh.Pieces, expected[h.Address()]) {
+			t.Errorf("host %v holds pieces %v, expected %v", fh.IP, fh.Pieces, expected[h.Address()])
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package hostdb
+
+// debug.go allows the state of the hostdb to be captured and loaded into a
+// separate HostDB, so that problems with host weighting and selection can be
+// reproduced offline.
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A HostSnapshot is the state of a single host entry. Reliability summarizes
+// the scan history of the host: it is reset to MaxReliability each time the
+// host responds to a scan, and is decremented each time the host does not.
+type HostSnapshot struct {
+	modules.HostSettings
+	Weight      types.Currency
+	Reliability types.Currency
+}
+
+// A ContractSnapshot is the state of a single host contract. The secret key
+// of the contract is omitted, so that a snapshot can be shared without
+// allowing the contract to be revised.
+type ContractSnapshot struct {
+	IP              modules.NetAddress
+	ID              types.FileContractID
+	FileContract    types.FileContract
+	LastRevision    types.FileContractRevision
+	LastRevisionTxn types.Transaction
+
+	Uploaded   uint64
+	Downloaded uint64
+	Spent      types.Currency
+
+	StartHeight types.BlockHeight
+	Renewed     bool
+}
+
+// A HostDBSnapshot is a copy of the full state of a hostdb.
+type HostDBSnapshot struct {
+	ActiveHosts []HostSnapshot
+	AllHosts    []HostSnapshot
+	TotalWeight types.Currency
+	BlockHeight types.BlockHeight
+	Contracts   map[types.FileContractID]ContractSnapshot
+}
+
+// snapshotEntry returns a snapshot of a host entry.
+func snapshotEntry(entry *hostEntry) HostSnapshot {
+	return HostSnapshot{
+		HostSettings: entry.HostSettings,
+		Weight:       entry.weight,
+		Reliability:  entry.reliability,
+	}
+}
+
+// snapshotContract returns a snapshot of a host contract.
+func snapshotContract(hc hostContract) ContractSnapshot {
+	return ContractSnapshot{
+		IP:              hc.IP,
+		ID:              hc.ID,
+		FileContract:    hc.FileContract,
+		LastRevision:    hc.LastRevision,
+		LastRevisionTxn: hc.LastRevisionTxn,
+		Uploaded:        hc.Uploaded,
+		Downloaded:      hc.Downloaded,
+		Spent:           hc.Spent,
+		StartHeight:     hc.StartHeight,
+		Renewed:         hc.Renewed,
+	}
+}
+
+// DebugState returns a snapshot of the hostdb, including the computed weight
+// of every host.
+func (hdb *HostDB) DebugState() HostDBSnapshot {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	s := HostDBSnapshot{
+		BlockHeight: hdb.blockHeight,
+		Contracts:   make(map[types.FileContractID]ContractSnapshot),
+	}
+	for _, node := range hdb.activeHosts {
+		s.ActiveHosts = append(s.ActiveHosts, snapshotEntry(node.hostEntry))
+	}
+	for _, entry := range hdb.allHosts {
+		s.AllHosts = append(s.AllHosts, snapshotEntry(entry))
+	}
+	if hdb.hostTree != nil {
+		s.TotalWeight = hdb.hostTree.weight
+	}
+	for id, hc := range hdb.contracts {
+		s.Contracts[id] = snapshotContract(hc)
+	}
+	return s
+}
+
+// LoadSnapshot creates a HostDB from a snapshot. The HostDB is only intended
+// for offline analysis: it is not connected to any other modules, does not
+// scan hosts, and does not persist anything to disk. Contracts are restored
+// without their secret keys, so they cannot be revised.
+func LoadSnapshot(s HostDBSnapshot) *HostDB {
+	hdb := &HostDB{
+		contracts:   make(map[types.FileContractID]hostContract),
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+
+		blockHeight: s.BlockHeight,
+	}
+	for _, hs := range s.AllHosts {
+		hdb.allHosts[hs.NetAddress] = &hostEntry{
+			HostSettings: hs.HostSettings,
+			weight:       hs.Weight,
+			reliability:  hs.Reliability,
+		}
+	}
+	// Active hosts share their entry with allHosts, as they do when inserted
+	// by the scanner.
+	for _, hs := range s.ActiveHosts {
+		entry, exists := hdb.allHosts[hs.NetAddress]
+		if !exists {
+			entry = &hostEntry{
+				HostSettings: hs.HostSettings,
+				weight:       hs.Weight,
+				reliability:  hs.Reliability,
+			}
+			hdb.allHosts[hs.NetAddress] = entry
+		}
+		hdb.insertNode(entry)
+	}
+	for id, cs := range s.Contracts {
+		hdb.contracts[id] = hostContract{
+			IP:              cs.IP,
+			ID:              cs.ID,
+			FileContract:    cs.FileContract,
+			LastRevision:    cs.LastRevision,
+			LastRevisionTxn: cs.LastRevisionTxn,
+			Uploaded:        cs.Uploaded,
+			Downloaded:      cs.Downloaded,
+			Spent:           cs.Spent,
+			StartHeight:     cs.StartHeight,
+			Renewed:         cs.Renewed,
+		}
+	}
+	return hdb
+}
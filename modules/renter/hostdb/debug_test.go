@@ -0,0 +1,103 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDebugState populates a hostdb, takes a snapshot, loads the snapshot
+// into a new hostdb, and checks that the host sets and weights match.
+func TestDebugState(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+		blockHeight: 12,
+	}
+
+	// Add five active hosts with differing prices, and two offline hosts.
+	for i := 0; i < 7; i++ {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{
+				NetAddress: fakeAddr(uint8(i)),
+				Price:      types.NewCurrency64(uint64(i + 1)),
+			},
+			reliability: types.NewCurrency64(uint64(10 * i)),
+		}
+		entry.weight = calculateHostWeight(*entry)
+		hdb.allHosts[entry.NetAddress] = entry
+		if i < 5 {
+			hdb.insertNode(entry)
+		}
+	}
+	hdb.contracts[types.FileContractID{1}] = hostContract{
+		IP:        fakeAddr(1),
+		ID:        types.FileContractID{1},
+		Uploaded:  100,
+		SecretKey: crypto.SecretKey{1},
+	}
+
+	s := hdb.DebugState()
+	if len(s.ActiveHosts) != 5 || len(s.AllHosts) != 7 {
+		t.Fatal("snapshot has wrong number of hosts:", len(s.ActiveHosts), len(s.AllHosts))
+	}
+	if s.TotalWeight.Cmp(hdb.hostTree.weight) != 0 {
+		t.Fatal("snapshot has wrong total weight")
+	}
+	if cs, ok := s.Contracts[types.FileContractID{1}]; !ok || cs.Uploaded != 100 {
+		t.Fatal("snapshot has wrong contracts:", s.Contracts)
+	}
+
+	restored := LoadSnapshot(s)
+	if restored.hostTree.weight.Cmp(hdb.hostTree.weight) != 0 {
+		t.Error("restored host tree has wrong weight")
+	}
+	if restored.blockHeight != hdb.blockHeight {
+		t.Error("restored hostdb has wrong block height")
+	}
+	if len(restored.activeHosts) != len(hdb.activeHosts) {
+		t.Fatal("restored hostdb has wrong number of active hosts")
+	}
+	for addr, node := range hdb.activeHosts {
+		rnode, exists := restored.activeHosts[addr]
+		if !exists {
+			t.Fatal("active host missing after restore:", addr)
+		}
+		if rnode.hostEntry.weight.Cmp(node.hostEntry.weight) != 0 {
+			t.Error("active host has wrong weight after restore:", addr)
+		}
+		if rnode.hostEntry != restored.allHosts[addr] {
+			t.Error("active host entry is not shared with allHosts:", addr)
+		}
+	}
+	if len(restored.allHosts) != len(hdb.allHosts) {
+		t.Fatal("restored hostdb has wrong number of hosts")
+	}
+	for addr, entry := range hdb.allHosts {
+		rentry, exists := restored.allHosts[addr]
+		if !exists {
+			t.Fatal("host missing after restore:", addr)
+		}
+		if rentry.Price.Cmp(entry.Price) != 0 ||
+			rentry.weight.Cmp(entry.weight) != 0 ||
+			rentry.reliability.Cmp(entry.reliability) != 0 {
+			t.Error("host entry does not match after restore:", addr)
+		}
+	}
+	if len(restored.contracts) != 1 || restored.contracts[types.FileContractID{1}].Uploaded != 100 {
+		t.Error("contracts were not restored")
+	}
+	if restored.contracts[types.FileContractID{1}].SecretKey != (crypto.SecretKey{}) {
+		t.Error("contract secret key was included in the snapshot")
+	}
+
+	// Selection from the restored hostdb should only return active hosts.
+	hosts := restored.randomHosts(10, nil)
+	if len(hosts) != 5 {
+		t.Error("wrong number of hosts selected from restored hostdb:", len(hosts))
+	}
+}
@@ -0,0 +1,75 @@
+package hostdb
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// downloadSaveInterval is the minimum time between saves of the hostdb
+// caused by download payments.
+var downloadSaveInterval = func() time.Duration {
+	switch build.Release {
+	case "testing":
+		return time.Second
+	default:
+		return 30 * time.Second
+	}
+}()
+
+// newDownloadRevision revises the current revision to pay the host 'cost' for
+// downloaded data. The stored data is unchanged.
+func newDownloadRevision(rev types.FileContractRevision, cost types.Currency) types.FileContractRevision {
+	return newRevision(rev, 0, rev.NewFileMerkleRoot, cost)
+}
+
+// PayDownload pays a host for 'n' bytes of downloaded data under a contract,
+// at the download price that the host sent at the start of the download. It
+// is called on the download connection after each download request is sent.
+// Nothing is sent if the host does not charge for downloads.
+//
+// The hostdb is saved at most once every downloadSaveInterval, rather than
+// after every payment, as a download makes a payment for each piece.
+func (hdb *HostDB) PayDownload(conn net.Conn, id types.FileContractID, price types.Currency, n uint64) error {
+	if price.IsZero() {
+		return nil
+	}
+	if price.Cmp(maxDownloadPrice) > 0 {
+		return errTooExpensive
+	}
+	hdb.mu.RLock()
+	hc, exists := hdb.contracts[id]
+	hdb.mu.RUnlock()
+	if !exists {
+		return errors.New("no record of that contract")
+	}
+	cost := price.Mul(types.NewCurrency64(n))
+	if cost.Cmp(hc.LastRevision.NewValidProofOutputs[0].Value) > 0 {
+		return errors.New("contract has insufficient funds to pay for download")
+	}
+	rev := newDownloadRevision(hc.LastRevision, cost)
+	signedTxn, err := negotiateRevision(conn, rev, nil, hc.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	// update host contract. Other revisions may have been made while the
+	// payment was negotiated, so only the revision and spending are updated.
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hc = hdb.contracts[id]
+	if rev.NewRevisionNumber > hc.LastRevision.NewRevisionNumber {
+		hc.LastRevision = rev
+		hc.LastRevisionTxn = signedTxn
+	}
+	hc.Spent = hc.Spent.Add(cost)
+	hdb.contracts[id] = hc
+	if time.Since(hdb.lastDownloadSave) < downloadSaveInterval {
+		return nil
+	}
+	hdb.lastDownloadSave = time.Now()
+	return hdb.save()
+}
@@ -0,0 +1,23 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPayDownloadPrice checks that nothing is paid to a host that does not
+// charge for downloads, and that a host quoting a price above the maximum is
+// refused.
+func TestPayDownloadPrice(t *testing.T) {
+	hdb := &HostDB{contracts: make(map[types.FileContractID]hostContract)}
+
+	err := hdb.PayDownload(nil, types.FileContractID{}, types.ZeroCurrency, 100)
+	if err != nil {
+		t.Fatal("free download was not allowed:", err)
+	}
+	err = hdb.PayDownload(nil, types.FileContractID{}, maxDownloadPrice.Add(types.NewCurrency64(1)), 100)
+	if err != errTooExpensive {
+		t.Fatal("expected errTooExpensive, got", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
@@ -17,8 +18,14 @@ import (
 const (
 	// scanPoolSize sets the buffer size of the channel that holds hosts which
 	// need to be scanned. A thread pool pulls from the scan pool to query
-	// hosts that are due for an update.
+	// hosts that are due for an update. Hosts that do not fit in the scan
+	// pool wait in the scan queue.
 	scanPoolSize = 1000
+
+	// sigCacheSize is the number of verified host settings signatures that
+	// are remembered, so that the settings of a host that have not changed
+	// since the last scan are not verified again.
+	sigCacheSize = 1000
 )
 
 var (
@@ -54,10 +61,47 @@ type HostDB struct {
 	// scan.
 	scanPool chan *hostEntry
 
+	// The scanQueue holds hosts that need to be scanned while the scanPool
+	// is full, so that the number of hosts waiting to be scanned can grow
+	// with the number of known hosts. While the queue is non-empty, a single
+	// goroutine moves hosts from the queue into the scanPool as room frees
+	// up. The queue is protected by scanMu rather than mu, as the goroutine
+	// blocks on the scanPool.
+	scanQueue   []*hostEntry
+	scanFeeding bool
+	scanMu      sync.Mutex
+
+	// subscribers receive an event each time the set of active hosts
+	// changes.
+	subscribers []chan HostEvent
+
+	// The dialer is used to connect to hosts when scanning. 'scanTimeout'
+	// bounds both the dial and the settings exchange of each probe.
+	dialer      dialer
+	scanTimeout time.Duration
+
+	// selectionRand is the source of randomness for weighted host
+	// selection. If nil, crypto/rand is used. Tests replace it with a seeded
+	// source, so that the hosts selected by a pool are reproducible.
+	selectionRand randSource
+
+	// sigCache remembers the settings signatures that have been verified.
+	// If nil, every signature is verified.
+	sigCache *crypto.SigCache
+
+	// The speed limits are shared by every connection used to upload or
+	// download file data, limiting their combined throughput.
+	uploadLimit   rateLimit
+	downloadLimit rateLimit
+
 	blockHeight   types.BlockHeight
 	contracts     map[types.FileContractID]hostContract
 	cachedAddress types.UnlockHash // to prevent excessive address creation
 
+	// lastDownloadSave is the time at which a download payment last saved
+	// the hostdb.
+	lastDownloadSave time.Time
+
 	persistDir string
 
 	log *log.Logger
@@ -73,6 +117,25 @@ type hostContract struct {
 	LastRevision    types.FileContractRevision
 	LastRevisionTxn types.Transaction
 	SecretKey       crypto.SecretKey
+
+	// usage statistics
+	Uploaded   uint64         // bytes uploaded under the contract
+	Downloaded uint64         // bytes downloaded under the contract
+	Spent      types.Currency // coins paid to the host
+
+	StartHeight types.BlockHeight // height at which the contract was formed
+	Renewed     bool              // whether the contract renewed an earlier contract
+}
+
+// tierDuration returns the duration that selects the host's price tier for
+// the contract. Hosts lock the tier in when the contract is formed, so it is
+// chosen by the original duration of the contract. Contracts that predate the
+// start height fall back to the duration remaining at 'height'.
+func (hc hostContract) tierDuration(height types.BlockHeight) types.BlockHeight {
+	if hc.StartHeight == 0 || hc.StartHeight >= hc.FileContract.WindowStart {
+		return hc.FileContract.WindowStart - height
+	}
+	return hc.FileContract.WindowStart - hc.StartHeight
 }
 
 // New creates and starts up a hostdb. The hostdb that gets returned will not
@@ -98,6 +161,10 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 		allHosts:    make(map[modules.NetAddress]*hostEntry),
 		scanPool:    make(chan *hostEntry, scanPoolSize),
 
+		dialer:      stdDialer{},
+		scanTimeout: defaultScanTimeout,
+		sigCache:    crypto.NewSigCache(sigCacheSize),
+
 		persistDir: persistDir,
 	}
 	err := hdb.initPersist()
@@ -115,3 +182,75 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 
 	return hdb, nil
 }
+
+// SetScanTimeout sets the amount of time that a probe may take to connect to
+// a host and retrieve its settings. Probes that take longer are treated as
+// failures.
+func (hdb *HostDB) SetScanTimeout(timeout time.Duration) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.scanTimeout = timeout
+}
+
+// Contracts returns the usage statistics of each contract formed by the
+// hostdb.
+func (hdb *HostDB) Contracts() (contracts []modules.RenterContract) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	for _, hc := range hdb.contracts {
+		rc := modules.RenterContract{
+			ID:         hc.ID,
+			IP:         hc.IP,
+			EndHeight:  hc.FileContract.WindowStart,
+			Uploaded:   hc.Uploaded,
+			Downloaded: hc.Downloaded,
+			Spent:      hc.Spent,
+
+			Size: hc.LastRevision.NewFileSize,
+		}
+		if len(hc.LastRevision.NewValidProofOutputs) != 0 {
+			rc.RenterFunds = hc.LastRevision.NewValidProofOutputs[0].Value
+		}
+		contracts = append(contracts, rc)
+	}
+	return
+}
+
+// SpendingReport summarizes the spending on the contracts that were formed at
+// or after the height 'since'.
+func (hdb *HostDB) SpendingReport(since types.BlockHeight) modules.SpendingSummary {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	var s modules.SpendingSummary
+	for _, hc := range hdb.contracts {
+		if hc.StartHeight < since {
+			continue
+		}
+		if hc.Renewed {
+			s.RenewalFunding = s.RenewalFunding.Add(hc.FileContract.Payout)
+		} else {
+			s.ContractFunding = s.ContractFunding.Add(hc.FileContract.Payout)
+		}
+		s.ContractFees = s.ContractFees.Add(types.Tax(hc.StartHeight, hc.FileContract.Payout))
+		s.StorageSpending = s.StorageSpending.Add(hc.Spent)
+		s.Uploaded += hc.Uploaded
+		s.Downloaded += hc.Downloaded
+	}
+	return s
+}
+
+// RecordDownload adds 'n' bytes to the download total of a contract. The
+// usage is not saved to disk until the contract is next revised.
+func (hdb *HostDB) RecordDownload(id types.FileContractID, n uint64) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	hc, exists := hdb.contracts[id]
+	if !exists {
+		return
+	}
+	hc.Downloaded += n
+	hdb.contracts[id] = hc
+}
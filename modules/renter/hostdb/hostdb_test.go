@@ -0,0 +1,62 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSpendingReport forms contracts at several heights, records usage
+// against them, and checks that the spending report only totals the contracts
+// formed within the requested window.
+func TestSpendingReport(t *testing.T) {
+	hdb := &HostDB{
+		contracts: make(map[types.FileContractID]hostContract),
+	}
+	addContract := func(id byte, height types.BlockHeight, payout, spent uint64, renewed bool) {
+		hdb.contracts[types.FileContractID{id}] = hostContract{
+			ID:           types.FileContractID{id},
+			FileContract: types.FileContract{Payout: types.NewCurrency64(payout)},
+			Uploaded:     spent / 10,
+			Spent:        types.NewCurrency64(spent),
+			StartHeight:  height,
+			Renewed:      renewed,
+		}
+	}
+	addContract(1, 10, 1e6, 1e3, false)
+	addContract(2, 50, 2e6, 2e3, false)
+	addContract(3, 60, 4e6, 4e3, true)
+	addContract(4, 80, 8e6, 0, false)
+	hdb.RecordDownload(types.FileContractID{1}, 100)
+	hdb.RecordDownload(types.FileContractID{3}, 300)
+
+	// The report since height 50 covers the last three contracts.
+	s := hdb.SpendingReport(50)
+	if s.ContractFunding.Cmp(types.NewCurrency64(10e6)) != 0 {
+		t.Error("wrong contract funding:", s.ContractFunding)
+	}
+	if s.RenewalFunding.Cmp(types.NewCurrency64(4e6)) != 0 {
+		t.Error("wrong renewal funding:", s.RenewalFunding)
+	}
+	expectedFees := types.Tax(50, types.NewCurrency64(2e6)).Add(types.Tax(60, types.NewCurrency64(4e6))).Add(types.Tax(80, types.NewCurrency64(8e6)))
+	if s.ContractFees.Cmp(expectedFees) != 0 {
+		t.Error("wrong contract fees:", s.ContractFees, expectedFees)
+	}
+	if s.StorageSpending.Cmp(types.NewCurrency64(6e3)) != 0 {
+		t.Error("wrong storage spending:", s.StorageSpending)
+	}
+	if s.Uploaded != 600 || s.Downloaded != 300 {
+		t.Error("wrong usage:", s.Uploaded, s.Downloaded)
+	}
+
+	// The report since height 0 covers every contract, and a report from
+	// after the last contract is empty.
+	s = hdb.SpendingReport(0)
+	if s.ContractFunding.Cmp(types.NewCurrency64(11e6)) != 0 || s.Downloaded != 400 {
+		t.Error("report since height 0 does not cover every contract:", s.ContractFunding, s.Downloaded)
+	}
+	s = hdb.SpendingReport(81)
+	if !s.ContractFunding.IsZero() || !s.RenewalFunding.IsZero() || s.Uploaded != 0 {
+		t.Error("expected an empty report, got", s)
+	}
+}
@@ -1,33 +1,56 @@
 package hostdb
 
 import (
+	"bytes"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// A hostEntry represents a host on the network.
+// A hostEntry represents a host on the network. If the host announced a
+// public key, the settings of the host must be signed by that key.
 type hostEntry struct {
 	modules.HostSettings
 	weight      types.Currency
 	reliability types.Currency
+	publicKey   types.SiaPublicKey
+}
+
+// samePublicKey returns true if a and b are the same public key.
+func samePublicKey(a, b types.SiaPublicKey) bool {
+	return a.Algorithm == b.Algorithm && bytes.Equal(a.Key, b.Key)
 }
 
-// insert adds a host entry to the state. The host will be inserted into the
-// set of all hosts, and if it is online and responding to requests it will be
-// put into the list of active hosts.
+// insertHost adds a host whose public key is not known to the state.
+func (hdb *HostDB) insertHost(host modules.HostSettings) {
+	hdb.insertAnnouncedHost(host, types.SiaPublicKey{})
+}
+
+// insertAnnouncedHost adds a host entry to the state. The host will be
+// inserted into the set of all hosts, and if it is online and responding to
+// requests it will be put into the list of active hosts.
 //
 // TODO: Function should return an error.
-func (hdb *HostDB) insertHost(host modules.HostSettings) {
-	// Remove garbage hosts and local hosts.
-	if !host.NetAddress.IsValid() {
+func (hdb *HostDB) insertAnnouncedHost(host modules.HostSettings, publicKey types.SiaPublicKey) {
+	// Remove garbage hosts and local hosts. The address is normalized so
+	// that different spellings of the same address share a single entry.
+	addr, err := host.NetAddress.Normalize()
+	if err != nil {
 		return
 	}
+	host.NetAddress = addr
 	if host.NetAddress.IsLoopback() && build.Release != "testing" {
 		return
 	}
-	// Don't do anything if we've already seen this host.
-	if _, exists := hdb.allHosts[host.NetAddress]; exists {
+	// If we've already seen this host, a new announcement replaces its
+	// public key, so that a host can change its key by announcing again. The
+	// host is scanned again to check its settings against the new key.
+	if entry, exists := hdb.allHosts[host.NetAddress]; exists {
+		if len(publicKey.Key) != 0 && !samePublicKey(entry.publicKey, publicKey) {
+			entry.publicKey = publicKey
+			hdb.scanHostEntry(entry)
+		}
 		return
 	}
 
@@ -37,6 +60,7 @@ func (hdb *HostDB) insertHost(host modules.HostSettings) {
 	hdb.scanHostEntry(&hostEntry{
 		HostSettings: host,
 		reliability:  DefaultReliability,
+		publicKey:    publicKey,
 	})
 }
 
@@ -49,6 +73,7 @@ func (hdb *HostDB) removeHost(addr modules.NetAddress) error {
 	if exists {
 		delete(hdb.activeHosts, addr)
 		node.removeNode()
+		hdb.notifySubscribers(HostOffline, node.hostEntry.HostSettings)
 	}
 
 	return nil
@@ -0,0 +1,88 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestInsertHostNormalization inserts two spellings of the same address into
+// the hostdb, and checks that they result in a single host entry.
+func TestInsertHostNormalization(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+	}
+
+	// Insert both spellings before either has been scanned.
+	hdb.insertHost(modules.HostSettings{NetAddress: "Foo.com:9982"})
+	hdb.insertHost(modules.HostSettings{NetAddress: " foo.com:9982 "})
+	hdb.insertHost(modules.HostSettings{NetAddress: "foo.com:notAPort"})
+
+	// Complete a successful scan of each queued entry.
+	for i := 0; i < 2; i++ {
+		entry := <-hdb.scanPool
+		if entry.NetAddress != "foo.com:9982" {
+			t.Fatal("host address was not normalized:", entry.NetAddress)
+		}
+		hdb.updateEntry(entry, modules.HostSettings{Price: types.NewCurrency64(1)}, nil)
+	}
+	select {
+	case entry := <-hdb.scanPool:
+		t.Fatal("invalid address was queued for scanning:", entry.NetAddress)
+	default:
+	}
+	if len(hdb.allHosts) != 1 || len(hdb.activeHosts) != 1 {
+		t.Fatal("expected a single host entry, got", len(hdb.allHosts), len(hdb.activeHosts))
+	}
+
+	// Once the host is known, further spellings are not queued.
+	hdb.insertHost(modules.HostSettings{NetAddress: "FOO.COM:9982"})
+	select {
+	case entry := <-hdb.scanPool:
+		t.Fatal("known host was queued for scanning:", entry.NetAddress)
+	default:
+	}
+}
+
+// TestInsertHostNewKey announces a known host with a new public key, and
+// checks that the new key replaces the old one and that the host is scanned
+// again.
+func TestInsertHostNewKey(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+	}
+	oldKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1}}
+	newKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{2}}
+
+	hdb.insertAnnouncedHost(modules.HostSettings{NetAddress: "foo.com:9982"}, oldKey)
+	hdb.updateEntry(<-hdb.scanPool, modules.HostSettings{}, nil)
+
+	// Announcing the same key again does nothing.
+	hdb.insertAnnouncedHost(modules.HostSettings{NetAddress: "foo.com:9982"}, oldKey)
+	select {
+	case <-hdb.scanPool:
+		t.Fatal("host was scanned again after announcing the same key")
+	default:
+	}
+
+	// A new key replaces the old one.
+	hdb.insertAnnouncedHost(modules.HostSettings{NetAddress: "foo.com:9982"}, newKey)
+	select {
+	case entry := <-hdb.scanPool:
+		if !samePublicKey(entry.publicKey, newKey) {
+			t.Fatal("host was scanned with the old key")
+		}
+	default:
+		t.Fatal("host was not scanned again after announcing a new key")
+	}
+	if !samePublicKey(hdb.allHosts["foo.com:9982"].publicKey, newKey) {
+		t.Fatal("new key did not replace the old key")
+	}
+}
@@ -3,6 +3,7 @@ package hostdb
 import (
 	"math/big"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -13,11 +14,31 @@ var (
 	baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(150), nil))
 )
 
+// weightPrice returns the price by which a host is weighed. A host with price
+// tiers must advertise the price of one of its tiers; if it does not, the
+// host is weighed by its most expensive tier, so that a host cannot appear
+// cheaper than the prices it charges.
+func weightPrice(settings modules.HostSettings) types.Currency {
+	if len(settings.PriceTiers) == 0 {
+		return settings.Price
+	}
+	var max types.Currency
+	for _, tier := range settings.PriceTiers {
+		if tier.Price.Cmp(settings.Price) == 0 {
+			return settings.Price
+		}
+		if tier.Price.Cmp(max) > 0 {
+			max = tier.Price
+		}
+	}
+	return max
+}
+
 // calculateHostWeight returns the weight of a host according to the settings of
 // the host database entry. Currently, only the price is considered.
 func calculateHostWeight(entry hostEntry) (weight types.Currency) {
 	// If the price is 0, just return the base weight to avoid divide by zero.
-	price := entry.Price
+	price := weightPrice(entry.HostSettings)
 	if price.IsZero() {
 		return baseWeight
 	}
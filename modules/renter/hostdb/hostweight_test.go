@@ -3,6 +3,7 @@ package hostdb
 import (
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -47,3 +48,21 @@ func TestHostWeightWithBothPricesZero(t *testing.T) {
 		t.Error("Weight of two zero-priced hosts should be equal.")
 	}
 }
+
+// TestHostWeightPriceTiers checks that a host whose price is not one of its
+// tiers is weighed by its most expensive tier.
+func TestHostWeightPriceTiers(t *testing.T) {
+	var entry hostEntry
+	entry.PriceTiers = []modules.PriceTier{
+		{MaxDuration: 10, Price: types.NewCurrency64(6)},
+		{MaxDuration: 20, Price: types.NewCurrency64(3)},
+	}
+	entry.Price = types.NewCurrency64(3)
+	if calculateHostWeight(entry).Cmp(calculateWeightFromUInt64Price(3)) != 0 {
+		t.Error("host advertising the price of a tier was not weighed by that price")
+	}
+	entry.Price = types.NewCurrency64(1)
+	if calculateHostWeight(entry).Cmp(calculateWeightFromUInt64Price(6)) != 0 {
+		t.Error("host advertising a price outside its tiers was not weighed by its most expensive tier")
+	}
+}
@@ -15,6 +15,9 @@ var (
 	// the hostdb will not form contracts above this price
 	maxPrice = types.SiacoinPrecision.Div(types.NewCurrency64(4320e9)).Mul(types.NewCurrency64(500)) // 500 SC / GB / Month
 
+	// the hostdb will not pay for downloads above this price
+	maxDownloadPrice = types.SiacoinPrecision.Div(types.NewCurrency64(1e9)).Mul(types.NewCurrency64(100)) // 100 SC / GB
+
 	errTooExpensive = errors.New("host price was too high")
 )
 
@@ -152,8 +155,14 @@ func negotiateContract(conn net.Conn, addr modules.NetAddress, fc types.FileCont
 // newContract negotiates an initial file contract with the specified host
 // and returns a hostContract. The contract is also saved by the HostDB.
 func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, duration types.BlockHeight) (hostContract, error) {
+	// reject hosts that speak an unsupported protocol version
+	if !modules.SupportedProtocol(host.ProtocolVersion) {
+		return hostContract{}, errUnsupportedProtocol
+	}
+
 	// reject hosts that are too expensive
-	if host.Price.Cmp(maxPrice) > 0 {
+	price := host.PriceForDuration(duration)
+	if price.Cmp(maxPrice) > 0 {
 		return hostContract{}, errTooExpensive
 	}
 
@@ -171,7 +180,7 @@ func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, durat
 	hdb.mu.Unlock()
 
 	// create file contract
-	renterCost := host.Price.Mul(types.NewCurrency64(filesize)).Mul(types.NewCurrency64(uint64(duration)))
+	renterCost := price.Mul(types.NewCurrency64(filesize)).Mul(types.NewCurrency64(uint64(duration)))
 	renterCost = renterCost.MulFloat(1.05) // extra buffer to guarantee we won't run out of money during revision
 	payout := renterCost                   // no collateral
 
@@ -221,6 +230,7 @@ func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, durat
 		return hostContract{}, err
 	}
 
+	contract.StartHeight = height
 	hdb.mu.Lock()
 	hdb.contracts[contract.ID] = contract
 	// clear the cached address
@@ -325,6 +335,8 @@ func (hdb *HostDB) Renew(fcid types.FileContractID, newEndHeight types.BlockHeig
 		return types.FileContractID{}, errors.New("no record of that contract")
 	} else if !eok {
 		return types.FileContractID{}, errors.New("no record of that host")
+	} else if !modules.SupportedProtocol(host.ProtocolVersion) {
+		return types.FileContractID{}, errUnsupportedProtocol
 	} else if newEndHeight < height {
 		return types.FileContractID{}, errors.New("cannot renew below current height")
 	}
@@ -342,7 +354,8 @@ func (hdb *HostDB) Renew(fcid types.FileContractID, newEndHeight types.BlockHeig
 	ourAddress := hdb.cachedAddress
 	hdb.mu.Unlock()
 
-	renterCost := host.Price.Mul(types.NewCurrency64(hc.LastRevision.NewFileSize)).Mul(types.NewCurrency64(uint64(newEndHeight - height)))
+	duration := newEndHeight - height
+	renterCost := host.PriceForDuration(duration).Mul(types.NewCurrency64(hc.LastRevision.NewFileSize)).Mul(types.NewCurrency64(uint64(duration)))
 	renterCost = renterCost.MulFloat(1.05) // extra buffer to guarantee we won't run out of money during revision
 	payout := renterCost                   // no collateral
 
@@ -390,7 +403,10 @@ func (hdb *HostDB) Renew(fcid types.FileContractID, newEndHeight types.BlockHeig
 		return types.FileContractID{}, err
 	}
 
-	// update host contract
+	// update host contract. The host is paid for the full renewal up front.
+	newContract.Spent = fc.ValidProofOutputs[1].Value
+	newContract.StartHeight = height
+	newContract.Renewed = true
 	hdb.mu.Lock()
 	hdb.contracts[newContract.ID] = newContract
 	hdb.cachedAddress = types.UnlockHash{} // clear cachedAddress
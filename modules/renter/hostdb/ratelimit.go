@@ -0,0 +1,126 @@
+package hostdb
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// rateLimitChunk is the largest read or write that a limitedConn passes
+	// to the underlying connection at once, so that concurrent transfers
+	// take turns rather than one transfer consuming the whole allowance.
+	rateLimitChunk = 1 << 14 // 16 KiB.
+)
+
+// A rateLimit is a token bucket that limits the combined throughput of every
+// connection sharing it. Transfers that exceed the available tokens reserve
+// tokens in advance and sleep until the reservation is covered, so that
+// concurrent transfers queue behind each other instead of each getting the
+// full rate. The zero value of a rateLimit is unlimited.
+type rateLimit struct {
+	rate   int64   // bytes per second, or zero if unlimited
+	tokens float64 // bytes that can be transferred without waiting
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// setRate changes the rate of the limit. The bucket starts empty, so that a
+// new limit is not exceeded by an initial burst.
+func (rl *rateLimit) setRate(rate int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate
+	rl.tokens = 0
+	rl.last = time.Now()
+}
+
+// wait blocks until 'n' bytes may be transferred. At most one second of
+// unused throughput is saved up for later transfers.
+func (rl *rateLimit) wait(n int) {
+	rl.mu.Lock()
+	if rl.rate <= 0 {
+		rl.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * float64(rl.rate)
+	if rl.tokens > float64(rl.rate) {
+		rl.tokens = float64(rl.rate)
+	}
+	rl.last = now
+	rl.tokens -= float64(n)
+	var delay time.Duration
+	if rl.tokens < 0 {
+		delay = time.Duration(-rl.tokens / float64(rl.rate) * float64(time.Second))
+	}
+	rl.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// A limitedConn is a connection whose writes are limited by 'up' and whose
+// reads are limited by 'down'.
+type limitedConn struct {
+	net.Conn
+	up   *rateLimit
+	down *rateLimit
+}
+
+// Read reads from the connection, waiting until the data read is allowed by
+// the download limit.
+func (lc *limitedConn) Read(b []byte) (int, error) {
+	if len(b) > rateLimitChunk {
+		b = b[:rateLimitChunk]
+	}
+	n, err := lc.Conn.Read(b)
+	lc.down.wait(n)
+	return n, err
+}
+
+// Write writes to the connection in chunks, waiting until each chunk is
+// allowed by the upload limit.
+func (lc *limitedConn) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > rateLimitChunk {
+			chunk = chunk[:rateLimitChunk]
+		}
+		lc.up.wait(len(chunk))
+		m, err := lc.Conn.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+// limitConn wraps a connection to a host in the speed limits of the hostdb.
+func (hdb *HostDB) limitConn(conn net.Conn) net.Conn {
+	return &limitedConn{
+		Conn: conn,
+		up:   &hdb.uploadLimit,
+		down: &hdb.downloadLimit,
+	}
+}
+
+// DialHost connects to a host for transferring file data. The throughput of
+// the connection counts towards the speed limits set by SetSpeedLimits.
+func (hdb *HostDB) DialHost(addr modules.NetAddress) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", string(addr), 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return hdb.limitConn(conn), nil
+}
+
+// SetSpeedLimits sets the maximum combined upload and download speed, in
+// bytes per second, of every connection used to transfer file data. A limit
+// of zero removes the limit.
+func (hdb *HostDB) SetSpeedLimits(up, down int64) {
+	hdb.uploadLimit.setRate(up)
+	hdb.downloadLimit.setRate(down)
+}
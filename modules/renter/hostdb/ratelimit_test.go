@@ -0,0 +1,73 @@
+package hostdb
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSpeedLimits runs two transfers in parallel in each direction over
+// connections that share the speed limits of a hostdb, and checks that the
+// limits apply to the combined throughput of the transfers.
+func TestSpeedLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	const limit = 1 << 17        // 128 KiB/s.
+	const transferSize = 1 << 16 // 64 KiB per transfer.
+	hdb := &HostDB{}
+
+	// transfer runs two transfers in parallel, limiting either the writing
+	// or the reading end of each pipe, and returns the time taken.
+	transfer := func(limitWriter bool) time.Duration {
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			var w io.WriteCloser
+			var r io.Reader
+			renterConn, hostConn := net.Pipe()
+			if limitWriter {
+				w, r = hdb.limitConn(renterConn), hostConn
+			} else {
+				w, r = hostConn, hdb.limitConn(renterConn)
+			}
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				w.Write(make([]byte, transferSize))
+				w.Close()
+			}()
+			go func() {
+				defer wg.Done()
+				n, err := io.Copy(ioutil.Discard, r)
+				if err != nil || n != transferSize {
+					t.Error("transfer failed:", n, err)
+				}
+			}()
+		}
+		wg.Wait()
+		return time.Since(start)
+	}
+
+	// Together, the transfers should take at least a second. Had each
+	// connection been limited separately, they would take half a second. The
+	// limits are set before each run, so that no unused throughput is saved
+	// up from the previous run.
+	hdb.SetSpeedLimits(limit, limit)
+	if elapsed := transfer(true); elapsed < 900*time.Millisecond {
+		t.Error("uploads exceeded the speed limit:", elapsed)
+	}
+	hdb.SetSpeedLimits(limit, limit)
+	if elapsed := transfer(false); elapsed < 900*time.Millisecond {
+		t.Error("downloads exceeded the speed limit:", elapsed)
+	}
+
+	// Without limits, the transfers should finish quickly.
+	hdb.SetSpeedLimits(0, 0)
+	if elapsed := transfer(true); elapsed > 500*time.Millisecond {
+		t.Error("unlimited uploads were slowed down:", elapsed)
+	}
+}
@@ -6,6 +6,7 @@ package hostdb
 
 import (
 	"crypto/rand"
+	"errors"
 	"math/big"
 	"net"
 	"time"
@@ -16,6 +17,21 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// v05HostSettings is the HostSettings type used by v0.5.0 hosts, prior to the
+// addition of the collateral ratio. It is preserved for compatibility with
+// those hosts.
+// COMPATv0.5
+type v05HostSettings struct {
+	NetAddress   modules.NetAddress
+	TotalStorage int64
+	MinDuration  types.BlockHeight
+	MaxDuration  types.BlockHeight
+	WindowSize   types.BlockHeight
+	Price        types.Currency
+	Collateral   types.Currency
+	UnlockHash   types.UnlockHash
+}
+
 // oldHostSettings is the HostSettings type used prior to v0.5.0. It is
 // preserved for compatibility with those hosts.
 // COMPATv0.4.8
@@ -42,7 +58,9 @@ const (
 
 	maxSettingsLen = 2e3
 
-	hostRequestTimeout = 5 * time.Second
+	// defaultScanTimeout is the default amount of time that a probe may take
+	// to connect to a host and retrieve its settings.
+	defaultScanTimeout = 5 * time.Second
 
 	// scanningThreads is the number of threads that will be probing hosts for
 	// their settings and checking for reliability.
@@ -50,19 +68,83 @@ const (
 )
 
 var (
+	// errUnsignedSettings is returned if a host that announced a public key
+	// responds with settings that are not signed.
+	errUnsignedSettings = errors.New("host did not sign its settings")
+
 	MaxReliability     = types.NewCurrency64(225) // Given the scanning defaults, about 3 weeks of survival.
 	DefaultReliability = types.NewCurrency64(75)  // Given the scanning defaults, about 1 week of survival.
 	UnreachablePenalty = types.NewCurrency64(1)
 )
 
-// addHostToScanPool creates a gofunc that adds a host to the scan pool. If the
-// scan pool is currently full, the blocking gofunc will not cause a deadlock.
-// The gofunc is created inside of this function to eliminate the burden of
-// needing to remember to call 'go addHostToScanPool'.
+// A dialer opens network connections to hosts.
+type dialer interface {
+	DialTimeout(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// stdDialer is the dialer used outside of testing, which dials using the net
+// package.
+type stdDialer struct{}
+
+// DialTimeout calls net.DialTimeout.
+func (stdDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, address, timeout)
+}
+
+// scanHostEntry adds a host to the scan pool. If the scan pool is full, the
+// host is added to the scan queue instead, and moved into the scan pool once
+// there is room. scanHostEntry never blocks.
 func (hdb *HostDB) scanHostEntry(entry *hostEntry) {
-	go func() {
+	hdb.scanMu.Lock()
+	defer hdb.scanMu.Unlock()
+
+	// Hosts may only skip the queue if it is empty, so that hosts are
+	// scanned in the order that they were added.
+	if len(hdb.scanQueue) == 0 {
+		select {
+		case hdb.scanPool <- entry:
+			return
+		default:
+		}
+	}
+	hdb.scanQueue = append(hdb.scanQueue, entry)
+	if !hdb.scanFeeding {
+		hdb.scanFeeding = true
+		go hdb.threadedFeedScanPool()
+	}
+}
+
+// threadedFeedScanPool moves hosts from the scan queue into the scan pool,
+// blocking until the scan pool has room for each host. It returns once the
+// queue is empty.
+func (hdb *HostDB) threadedFeedScanPool() {
+	for {
+		hdb.scanMu.Lock()
+		if len(hdb.scanQueue) == 0 {
+			hdb.scanFeeding = false
+			hdb.scanMu.Unlock()
+			return
+		}
+		entry := hdb.scanQueue[0]
+		hdb.scanMu.Unlock()
+
+		// The host stays at the front of the queue until it is in the scan
+		// pool, so that it is counted by ScanQueueDepth.
 		hdb.scanPool <- entry
-	}()
+
+		hdb.scanMu.Lock()
+		hdb.scanQueue[0] = nil
+		hdb.scanQueue = hdb.scanQueue[1:]
+		hdb.scanMu.Unlock()
+	}
+}
+
+// ScanQueueDepth returns the number of hosts that are waiting to be scanned. A
+// large depth indicates that scanning is falling behind.
+func (hdb *HostDB) ScanQueueDepth() int {
+	hdb.scanMu.Lock()
+	defer hdb.scanMu.Unlock()
+	return len(hdb.scanPool) + len(hdb.scanQueue)
 }
 
 // decrementReliability reduces the reliability of a node, moving it out of the
@@ -81,6 +163,7 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	if exists {
 		delete(hdb.activeHosts, entry.NetAddress)
 		node.removeNode()
+		hdb.notifySubscribers(HostOffline, entry.HostSettings)
 	}
 
 	// If the reliability has fallen to 0, remove the host from the
@@ -92,80 +175,154 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 
 // threadedProbeHost tries to fetch the settings of a host. If successful, the
 // host is put in the set of active hosts. If unsuccessful, the host id deleted
-// from the set of active hosts.
+// from the set of active hosts. Probes that exceed the scan timeout are
+// treated as unsuccessful.
 func (hdb *HostDB) threadedProbeHosts() {
 	for hostEntry := range hdb.scanPool {
 		// Request settings from the queued host entry.
-		var settings modules.HostSettings
-		err := func() error {
-			conn, err := net.DialTimeout("tcp", string(hostEntry.NetAddress), hostRequestTimeout)
-			if err != nil {
-				return err
-			}
-			defer conn.Close()
-			err = encoding.WriteObject(conn, modules.RPCSettings)
-			if err != nil {
-				return err
-			}
-			// COMPATv0.4.8 - If first decoding attempt fails, try decoding
-			// into the old HostSettings type. Because we decode twice, we
-			// must read the data into memory first.
-			settingsBytes, err := encoding.ReadPrefix(conn, maxSettingsLen)
-			if err != nil {
-				return err
-			}
-			err = encoding.Unmarshal(settingsBytes, &settings)
-			if err != nil {
-				var oldSettings oldHostSettings
-				err = encoding.Unmarshal(settingsBytes, &oldSettings)
-				if err != nil {
-					return err
-				}
-				// Convert the old type.
-				settings = modules.HostSettings{
-					NetAddress:   oldSettings.NetAddress,
-					TotalStorage: oldSettings.TotalStorage,
-					MinDuration:  oldSettings.MinDuration,
-					MaxDuration:  oldSettings.MaxDuration,
-					WindowSize:   oldSettings.WindowSize,
-					Price:        oldSettings.Price,
-					Collateral:   oldSettings.Collateral,
-					UnlockHash:   oldSettings.UnlockHash,
-				}
-			}
-			return nil
-		}()
+		settings, err := hdb.fetchSettings(hostEntry)
 
 		// Now that network communication is done, lock the hostdb to modify the
 		// host entry.
-		func() {
-			hdb.mu.Lock()
-			defer hdb.mu.Unlock()
+		hdb.mu.Lock()
+		hdb.updateEntry(hostEntry, settings, err)
+		hdb.mu.Unlock()
+	}
+}
 
-			// Regardless of whether the host responded, add it to allHosts.
-			if _, exists := hdb.allHosts[hostEntry.NetAddress]; !exists {
-				hdb.allHosts[hostEntry.NetAddress] = hostEntry
+// fetchSettings connects to a host and requests its settings. Both dialing and
+// the settings exchange are bounded by the hostdb's scan timeout. If the host
+// announced a public key, the settings must be signed by that key.
+func (hdb *HostDB) fetchSettings(entry *hostEntry) (settings modules.HostSettings, err error) {
+	hdb.mu.RLock()
+	d, timeout, publicKey := hdb.dialer, hdb.scanTimeout, entry.publicKey
+	hdb.mu.RUnlock()
+	conn, err := d.DialTimeout("tcp", string(entry.NetAddress), timeout)
+	if err != nil {
+		return settings, err
+	}
+	defer conn.Close()
+	// The deadline applies to the whole settings exchange, so that a host
+	// that accepts the connection but never responds cannot stall the
+	// probe.
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return settings, err
+	}
+	err = encoding.WriteObject(conn, modules.RPCSettings)
+	if err != nil {
+		return settings, err
+	}
+	// COMPATv0.4.8 - If first decoding attempt fails, try decoding
+	// into the old HostSettings type. Because we decode twice, we
+	// must read the data into memory first.
+	settingsBytes, err := encoding.ReadPrefix(conn, maxSettingsLen)
+	if err != nil {
+		return settings, err
+	}
+	if len(publicKey.Key) != 0 {
+		var ss modules.SignedHostSettings
+		err = encoding.Unmarshal(settingsBytes, &ss)
+		if err != nil {
+			return settings, errUnsignedSettings
+		}
+		err = ss.VerifyCached(publicKey, hdb.sigCache)
+		if err != nil {
+			return settings, err
+		}
+		return ss.Settings, nil
+	}
+	err = encoding.Unmarshal(settingsBytes, &settings)
+	if err != nil {
+		// COMPATv0.5 - try decoding into the v0.5.0 HostSettings
+		// type, which does not have a collateral ratio.
+		var v05Settings v05HostSettings
+		if encoding.Unmarshal(settingsBytes, &v05Settings) == nil {
+			settings = modules.HostSettings{
+				NetAddress:   v05Settings.NetAddress,
+				TotalStorage: v05Settings.TotalStorage,
+				MinDuration:  v05Settings.MinDuration,
+				MaxDuration:  v05Settings.MaxDuration,
+				WindowSize:   v05Settings.WindowSize,
+				Price:        v05Settings.Price,
+				Collateral:   v05Settings.Collateral,
+				UnlockHash:   v05Settings.UnlockHash,
 			}
+			return settings, nil
+		}
+		var oldSettings oldHostSettings
+		err = encoding.Unmarshal(settingsBytes, &oldSettings)
+		if err != nil {
+			return settings, err
+		}
+		// Convert the old type.
+		settings = modules.HostSettings{
+			NetAddress:   oldSettings.NetAddress,
+			TotalStorage: oldSettings.TotalStorage,
+			MinDuration:  oldSettings.MinDuration,
+			MaxDuration:  oldSettings.MaxDuration,
+			WindowSize:   oldSettings.WindowSize,
+			Price:        oldSettings.Price,
+			Collateral:   oldSettings.Collateral,
+			UnlockHash:   oldSettings.UnlockHash,
+		}
+	}
+	return settings, nil
+}
 
-			// If the scan was unsuccessful, decrement the host's reliability.
-			if err != nil {
-				hdb.decrementReliability(hostEntry.NetAddress, UnreachablePenalty)
-				return
-			}
+// updateEntry applies the result of probing a host to the host's entry. 'err'
+// is the error, if any, returned by the probe. Subscribers are notified if the
+// host comes online, goes offline, or changes its settings.
+func (hdb *HostDB) updateEntry(entry *hostEntry, settings modules.HostSettings, err error) {
+	// Regardless of whether the host responded, add it to allHosts. If the
+	// host was queued more than once before its first scan completed, the
+	// existing entry is updated instead, so that each address has only one
+	// entry.
+	if existing, exists := hdb.allHosts[entry.NetAddress]; !exists {
+		hdb.allHosts[entry.NetAddress] = entry
+	} else {
+		// The probe checked the settings against the key of the queued
+		// entry, which comes from the later announcement.
+		if len(entry.publicKey.Key) != 0 {
+			existing.publicKey = entry.publicKey
+		}
+		entry = existing
+	}
 
-			// Update the host settings, reliability, and weight. The old NetAddress
-			// must be preserved.
-			settings.NetAddress = hostEntry.HostSettings.NetAddress
-			hostEntry.HostSettings = settings
-			hostEntry.reliability = MaxReliability
-			hostEntry.weight = calculateHostWeight(*hostEntry)
-
-			// If 'MaxActiveHosts' has not been reached, add the host to the
-			// activeHosts tree.
-			if _, exists := hdb.activeHosts[hostEntry.NetAddress]; !exists && len(hdb.activeHosts) < MaxActiveHosts {
-				hdb.insertNode(hostEntry)
-			}
-		}()
+	// If the scan was unsuccessful, decrement the host's reliability.
+	if err != nil {
+		hdb.decrementReliability(entry.NetAddress, UnreachablePenalty)
+		return
+	}
+
+	// Update the host settings, reliability, and weight. The old NetAddress
+	// must be preserved.
+	oldSettings := entry.HostSettings
+	settings.NetAddress = entry.HostSettings.NetAddress
+	entry.HostSettings = settings
+	entry.reliability = MaxReliability
+	entry.weight = calculateHostWeight(*entry)
+
+	// Hosts that speak an unsupported protocol version are kept in allHosts,
+	// but are removed from the activeHosts tree, so that they are never
+	// selected for uploads.
+	node, active := hdb.activeHosts[entry.NetAddress]
+	if !modules.SupportedProtocol(entry.ProtocolVersion) {
+		if active {
+			delete(hdb.activeHosts, entry.NetAddress)
+			node.removeNode()
+			hdb.notifySubscribers(HostOffline, entry.HostSettings)
+		}
+		return
+	}
+
+	// If 'MaxActiveHosts' has not been reached, add the host to the
+	// activeHosts tree.
+	if !active && len(hdb.activeHosts) < MaxActiveHosts {
+		hdb.insertNode(entry)
+		hdb.notifySubscribers(HostOnline, entry.HostSettings)
+	} else if active && settingsChanged(oldSettings, entry.HostSettings) {
+		hdb.notifySubscribers(HostSettingsChanged, entry.HostSettings)
 	}
 }
 
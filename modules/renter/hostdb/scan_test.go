@@ -0,0 +1,185 @@
+package hostdb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// blockingDialer is a dialer whose connections are never answered, simulating
+// a host that accepts connections but hangs during the settings exchange.
+type blockingDialer struct {
+	conns []net.Conn
+}
+
+// DialTimeout returns one end of a pipe whose other end is never read or
+// written.
+func (d *blockingDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ours, theirs := net.Pipe()
+	d.conns = append(d.conns, theirs)
+	return ours, nil
+}
+
+// TestProbeTimeout probes a host that never responds and checks that the
+// probe is recorded as a failure once the scan timeout passes.
+func TestProbeTimeout(t *testing.T) {
+	d := new(blockingDialer)
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+
+		dialer:      d,
+		scanTimeout: 50 * time.Millisecond,
+	}
+	go hdb.threadedProbeHosts()
+	defer close(hdb.scanPool)
+
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{NetAddress: "foo.com:9982"},
+		reliability:  DefaultReliability,
+	}
+	hdb.scanPool <- entry
+
+	// Wait for the probe to fail.
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		hdb.mu.RLock()
+		reliability := entry.reliability
+		active := len(hdb.activeHosts)
+		hdb.mu.RUnlock()
+		if reliability.Cmp(DefaultReliability) < 0 {
+			if reliability.Cmp(DefaultReliability.Sub(UnreachablePenalty)) != 0 {
+				t.Fatal("probe failure applied the wrong penalty:", reliability)
+			}
+			if active != 0 {
+				t.Fatal("unresponsive host was made active")
+			}
+			return
+		}
+	}
+	t.Fatal("probe of an unresponsive host did not time out")
+}
+
+// responseDialer is a dialer whose connections are answered with a fixed
+// settings response, simulating a host responding to a settings request.
+type responseDialer struct {
+	response interface{}
+}
+
+// DialTimeout returns one end of a pipe, the other end of which reads the
+// settings request and writes the dialer's response.
+func (d responseDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ours, theirs := net.Pipe()
+	go func() {
+		defer theirs.Close()
+		var rpc types.Specifier
+		if encoding.ReadObject(theirs, &rpc, types.SpecifierLen) != nil {
+			return
+		}
+		encoding.WriteObject(theirs, d.response)
+	}()
+	return ours, nil
+}
+
+// TestSignedSettings checks that settings fetched from a host that announced
+// a public key are only accepted if they are signed by that key.
+func TestSignedSettings(t *testing.T) {
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{NetAddress: "foo.com:9982"},
+		publicKey: types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       pk[:],
+		},
+	}
+	settings := modules.HostSettings{
+		NetAddress: "foo.com:9982",
+		Price:      types.NewCurrency64(100),
+	}
+	ss, err := modules.SignHostSettings(settings, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := &HostDB{scanTimeout: time.Second}
+
+	// Genuine signed settings should verify.
+	hdb.dialer = responseDialer{ss}
+	fetched, err := hdb.fetchSettings(entry)
+	if err != nil {
+		t.Fatal("genuine settings were rejected:", err)
+	}
+	if fetched.Price.Cmp(settings.Price) != 0 {
+		t.Error("fetched the wrong settings:", fetched)
+	}
+
+	// Settings that were tampered with in transit should be rejected.
+	tampered := ss
+	tampered.Settings.Price = types.NewCurrency64(1)
+	hdb.dialer = responseDialer{tampered}
+	_, err = hdb.fetchSettings(entry)
+	if err == nil {
+		t.Error("tampered settings were accepted")
+	}
+
+	// Unsigned settings should be rejected.
+	hdb.dialer = responseDialer{settings}
+	_, err = hdb.fetchSettings(entry)
+	if err != errUnsignedSettings {
+		t.Error("expected errUnsignedSettings, got", err)
+	}
+
+	// Hosts that did not announce a public key are not verified.
+	entry.publicKey = types.SiaPublicKey{}
+	_, err = hdb.fetchSettings(entry)
+	if err != nil {
+		t.Error("settings of a host without a public key were rejected:", err)
+	}
+}
+
+// TestScanQueueOverflow adds more hosts than fit in the scan pool and checks
+// that adding them does not block, and that every host is eventually scanned
+// in the order that it was added.
+func TestScanQueueOverflow(t *testing.T) {
+	hdb := &HostDB{
+		scanPool: make(chan *hostEntry, scanPoolSize),
+	}
+
+	// Add the hosts without anything pulling from the scan pool.
+	const numHosts = 3*scanPoolSize + 10
+	entries := make([]*hostEntry, numHosts)
+	for i := range entries {
+		entries[i] = new(hostEntry)
+		hdb.scanHostEntry(entries[i])
+	}
+	if depth := hdb.ScanQueueDepth(); depth != numHosts {
+		t.Fatalf("expected a scan queue depth of %v, got %v", numHosts, depth)
+	}
+
+	// Drain the scan pool.
+	for i := range entries {
+		select {
+		case entry := <-hdb.scanPool:
+			if entry != entries[i] {
+				t.Fatal("host", i, "was scanned out of order")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("host", i, "was never scanned")
+		}
+	}
+	for i := 0; i < 100 && hdb.ScanQueueDepth() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if depth := hdb.ScanQueueDepth(); depth != 0 {
+		t.Fatal("expected an empty scan queue, got a depth of", depth)
+	}
+}
@@ -0,0 +1,105 @@
+package hostdb
+
+// subscribe.go allows callers to be notified as the scanner discovers hosts
+// coming online, going offline, or changing their settings.
+
+import (
+	"bytes"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// hostEventBufferSize is the number of events that will be buffered for
+	// each subscriber. Once the buffer is full, the oldest event is dropped
+	// to make room for the new one, so that a slow subscriber never blocks
+	// the scanner.
+	hostEventBufferSize = 64
+)
+
+// A HostEventType indicates what happened to a host.
+type HostEventType int
+
+const (
+	// HostOnline indicates that a host was added to the set of active hosts.
+	HostOnline HostEventType = iota
+
+	// HostOffline indicates that a host was removed from the set of active
+	// hosts.
+	HostOffline
+
+	// HostSettingsChanged indicates that an active host has announced new
+	// settings.
+	HostSettingsChanged
+)
+
+// String returns a human-readable name for the event type.
+func (t HostEventType) String() string {
+	switch t {
+	case HostOnline:
+		return "online"
+	case HostOffline:
+		return "offline"
+	case HostSettingsChanged:
+		return "settings changed"
+	default:
+		return "unknown"
+	}
+}
+
+// A HostEvent describes a change in the set of active hosts. Settings contains
+// the most recent settings of the host.
+type HostEvent struct {
+	Type     HostEventType
+	Settings modules.HostSettings
+}
+
+// Subscribe returns a channel that receives a HostEvent each time the set of
+// active hosts changes, along with a function that ends the subscription and
+// closes the channel.
+func (hdb *HostDB) Subscribe() (<-chan HostEvent, func()) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	events := make(chan HostEvent, hostEventBufferSize)
+	hdb.subscribers = append(hdb.subscribers, events)
+	unsubscribe := func() {
+		hdb.mu.Lock()
+		defer hdb.mu.Unlock()
+		for i := range hdb.subscribers {
+			if hdb.subscribers[i] == events {
+				hdb.subscribers = append(hdb.subscribers[:i], hdb.subscribers[i+1:]...)
+				close(events)
+				return
+			}
+		}
+	}
+	return events, unsubscribe
+}
+
+// notifySubscribers sends an event to every subscriber. If the buffer of a
+// subscriber is full, the oldest event in the buffer is dropped.
+func (hdb *HostDB) notifySubscribers(t HostEventType, settings modules.HostSettings) {
+	e := HostEvent{Type: t, Settings: settings}
+	for _, events := range hdb.subscribers {
+		for sent := false; !sent; {
+			select {
+			case events <- e:
+				sent = true
+			default:
+				// Drop the oldest event. The subscriber may have emptied the
+				// buffer in the meantime, so the receive must not block.
+				select {
+				case <-events:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// settingsChanged returns true if the two sets of settings differ.
+func settingsChanged(old, new modules.HostSettings) bool {
+	return !bytes.Equal(encoding.Marshal(old), encoding.Marshal(new))
+}
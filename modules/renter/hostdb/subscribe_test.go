@@ -0,0 +1,103 @@
+package hostdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSubscribe checks that subscribers are notified when a probe brings a
+// host online, changes its settings, or takes it offline.
+func TestSubscribe(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+	}
+	events, unsubscribe := hdb.Subscribe()
+
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{NetAddress: fakeAddr(1)},
+		reliability:  DefaultReliability,
+	}
+	settings := modules.HostSettings{Price: types.NewCurrency64(10)}
+	expectEvent := func(t HostEventType) error {
+		select {
+		case e := <-events:
+			if e.Type != t {
+				return errors.New("expected " + t.String() + " event, got " + e.Type.String())
+			}
+			if e.Settings.NetAddress != entry.NetAddress {
+				return errors.New("event is for the wrong host")
+			}
+		default:
+			return errors.New("expected " + t.String() + " event, got nothing")
+		}
+		return nil
+	}
+
+	// A successful probe brings the host online.
+	hdb.mu.Lock()
+	hdb.updateEntry(entry, settings, nil)
+	hdb.mu.Unlock()
+	if err := expectEvent(HostOnline); err != nil {
+		t.Fatal(err)
+	}
+
+	// Probing again with the same settings should not produce an event.
+	hdb.mu.Lock()
+	hdb.updateEntry(entry, settings, nil)
+	hdb.mu.Unlock()
+	if len(events) != 0 {
+		t.Fatal("unchanged host produced an event")
+	}
+
+	// New settings produce a settings event.
+	settings.Price = types.NewCurrency64(20)
+	hdb.mu.Lock()
+	hdb.updateEntry(entry, settings, nil)
+	hdb.mu.Unlock()
+	if err := expectEvent(HostSettingsChanged); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed probe takes the host offline.
+	hdb.mu.Lock()
+	hdb.updateEntry(entry, settings, errors.New("probe failed"))
+	hdb.mu.Unlock()
+	if err := expectEvent(HostOffline); err != nil {
+		t.Fatal(err)
+	}
+
+	// After unsubscribing, the channel is closed and no more events are sent.
+	unsubscribe()
+	hdb.mu.Lock()
+	hdb.updateEntry(entry, settings, nil)
+	hdb.mu.Unlock()
+	if _, ok := <-events; ok {
+		t.Fatal("received an event after unsubscribing")
+	}
+}
+
+// TestSubscribeDropOldest checks that a subscriber that does not keep up
+// loses the oldest events rather than blocking the hostdb.
+func TestSubscribeDropOldest(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+	}
+	events, unsubscribe := hdb.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < hostEventBufferSize+10; i++ {
+		hdb.notifySubscribers(HostOnline, modules.HostSettings{TotalStorage: int64(i)})
+	}
+	if len(events) != hostEventBufferSize {
+		t.Fatal("expected a full buffer, got", len(events))
+	}
+	if e := <-events; e.Settings.TotalStorage != 10 {
+		t.Fatal("oldest events were not dropped:", e.Settings.TotalStorage)
+	}
+}
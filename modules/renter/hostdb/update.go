@@ -9,7 +9,7 @@ import (
 // findHostAnnouncements returns a list of the host announcements found within
 // a given block. No check is made to see that the ip address found in the
 // announcement is actually a valid ip address.
-func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings) {
+func findHostAnnouncements(b types.Block) (announcements []modules.HostAnnouncement) {
 	for _, t := range b.Transactions {
 		// the HostAnnouncement must be prefaced by the standard host
 		// announcement string
@@ -24,13 +24,26 @@ func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings)
 			var ha modules.HostAnnouncement
 			err := encoding.Unmarshal(arb[types.SpecifierLen:], &ha)
 			if err != nil {
-				continue
+				// COMPATv0.5 - announcements made before hosts announced
+				// their protocol version only contain an address and a
+				// public key, and older announcements only contain an
+				// address.
+				var keyHA struct {
+					IPAddress modules.NetAddress
+					PublicKey types.SiaPublicKey
+				}
+				var oldHA struct{ IPAddress modules.NetAddress }
+				if encoding.Unmarshal(arb[types.SpecifierLen:], &keyHA) == nil {
+					ha = modules.HostAnnouncement{IPAddress: keyHA.IPAddress, PublicKey: keyHA.PublicKey}
+				} else if encoding.Unmarshal(arb[types.SpecifierLen:], &oldHA) == nil {
+					ha = modules.HostAnnouncement{IPAddress: oldHA.IPAddress}
+				} else {
+					continue
+				}
 			}
 
 			// Add the announcement to the slice being returned.
-			announcements = append(announcements, modules.HostSettings{
-				NetAddress: ha.IPAddress,
-			})
+			announcements = append(announcements, ha)
 		}
 	}
 
@@ -50,8 +63,8 @@ func (hdb *HostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
 
 	// Add hosts announced in blocks that were applied.
 	for _, block := range cc.AppliedBlocks {
-		for _, host := range findHostAnnouncements(block) {
-			hdb.insertHost(host)
+		for _, ha := range findHostAnnouncements(block) {
+			hdb.insertAnnouncedHost(modules.HostSettings{NetAddress: ha.IPAddress, ProtocolVersion: ha.ProtocolVersion}, ha.PublicKey)
 		}
 	}
 }
@@ -24,6 +24,45 @@ func TestFindHostAnnouncements(t *testing.T) {
 		t.Error("host announcement not found in block")
 	}
 
+	// Announcements without a public key should still be found.
+	oldAnnouncement := append(modules.PrefixHostAnnouncement[:], encoding.Marshal(struct{ IPAddress modules.NetAddress }{"foo.com:9982"})...)
+	oldBlock := types.Block{
+		Transactions: []types.Transaction{{
+			ArbitraryData: [][]byte{oldAnnouncement},
+		}},
+	}
+	announcements = findHostAnnouncements(oldBlock)
+	if len(announcements) != 1 || announcements[0].IPAddress != "foo.com:9982" {
+		t.Error("announcement without a public key not found in block")
+	}
+
+	// Announcements without a protocol version should keep their public key,
+	// and announcements with one should report it.
+	pk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1, 2, 3}}
+	keyAnnouncement := append(modules.PrefixHostAnnouncement[:], encoding.Marshal(struct {
+		IPAddress modules.NetAddress
+		PublicKey types.SiaPublicKey
+	}{"foo.com:9982", pk})...)
+	versionAnnouncement := append(modules.PrefixHostAnnouncement[:], encoding.Marshal(modules.HostAnnouncement{
+		IPAddress:       "bar.com:9982",
+		PublicKey:       pk,
+		ProtocolVersion: modules.ProtocolVersion,
+	})...)
+	announcements = findHostAnnouncements(types.Block{
+		Transactions: []types.Transaction{{
+			ArbitraryData: [][]byte{keyAnnouncement, versionAnnouncement},
+		}},
+	})
+	if len(announcements) != 2 {
+		t.Fatal("expected 2 announcements, got", len(announcements))
+	}
+	if announcements[0].IPAddress != "foo.com:9982" || string(announcements[0].PublicKey.Key) != string(pk.Key) || announcements[0].ProtocolVersion != "" {
+		t.Error("announcement without a protocol version was decoded incorrectly:", announcements[0])
+	}
+	if announcements[1].IPAddress != "bar.com:9982" || announcements[1].ProtocolVersion != modules.ProtocolVersion {
+		t.Error("announcement with a protocol version was decoded incorrectly:", announcements[1])
+	}
+
 	// Try with an altered prefix
 	b.Transactions[0].ArbitraryData[0][0]++
 	announcements = findHostAnnouncements(b)
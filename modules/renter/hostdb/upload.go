@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"errors"
 	"net"
-	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -12,6 +11,16 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	// errUnavailableHost is returned by NewPool if a pool is pinned to a host
+	// that is not an active host.
+	errUnavailableHost = errors.New("pinned host is not an active host")
+
+	// errUnsupportedProtocol is returned when forming a contract with a host
+	// that speaks a protocol version that the renter does not support.
+	errUnsupportedProtocol = errors.New("host speaks an unsupported protocol version")
+)
+
 // An Uploader uploads data to a host.
 type Uploader interface {
 	// Upload revises the underlying contract to store the new data. It
@@ -36,7 +45,7 @@ type Uploader interface {
 // in serial.
 type hostUploader struct {
 	// constants
-	price types.Currency
+	settings modules.HostSettings
 
 	// updated after each revision
 	tree     crypto.MerkleTree
@@ -80,11 +89,17 @@ func (hu *hostUploader) Upload(data []byte) (uint64, error) {
 	// calculate price
 	hu.hdb.mu.RLock()
 	height := hu.hdb.blockHeight
+	// downloads may have paid the host with newer revisions
+	if hc, ok := hu.hdb.contracts[hu.contract.ID]; ok && hc.LastRevision.NewRevisionNumber > hu.contract.LastRevision.NewRevisionNumber {
+		hu.contract.LastRevision = hc.LastRevision
+		hu.contract.LastRevisionTxn = hc.LastRevisionTxn
+	}
 	hu.hdb.mu.RUnlock()
 	if height > hu.contract.FileContract.WindowStart {
 		return 0, errors.New("contract has already ended")
 	}
-	piecePrice := types.NewCurrency64(uint64(len(data))).Mul(types.NewCurrency64(uint64(hu.contract.FileContract.WindowStart - height))).Mul(hu.price)
+	duration := hu.contract.FileContract.WindowStart - height
+	piecePrice := types.NewCurrency64(uint64(len(data))).Mul(types.NewCurrency64(uint64(duration))).Mul(hu.settings.PriceForDuration(hu.contract.tierDuration(height)))
 	piecePrice = piecePrice.MulFloat(1.02) // COMPATv0.4.8 -- hosts reject exact prices
 
 	// calculate new merkle root (no error possible with bytes.Reader)
@@ -98,10 +113,17 @@ func (hu *hostUploader) Upload(data []byte) (uint64, error) {
 		return 0, err
 	}
 
-	// update host contract
+	// update host contract. The download total may have been updated by the
+	// renter since the uploader was created, so the saved contract is
+	// updated rather than replaced.
+	paid := rev.NewValidProofOutputs[1].Value.Sub(hu.contract.LastRevision.NewValidProofOutputs[1].Value)
 	hu.contract.LastRevision = rev
 	hu.contract.LastRevisionTxn = signedTxn
 	hu.hdb.mu.Lock()
+	hc := hu.hdb.contracts[hu.contract.ID]
+	hu.contract.Uploaded = hc.Uploaded + uint64(len(data))
+	hu.contract.Downloaded = hc.Downloaded
+	hu.contract.Spent = hc.Spent.Add(paid)
 	hu.hdb.contracts[hu.contract.ID] = hu.contract
 	hu.hdb.save()
 	hu.hdb.mu.Unlock()
@@ -121,7 +143,7 @@ func (hdb *HostDB) newHostUploader(hc hostContract) (*hostUploader, error) {
 	// TODO: check for excessive price again?
 
 	// initiate revision loop
-	conn, err := net.DialTimeout("tcp", string(hc.IP), 15*time.Second)
+	conn, err := hdb.DialHost(hc.IP)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +158,7 @@ func (hdb *HostDB) newHostUploader(hc hostContract) (*hostUploader, error) {
 
 	hu := &hostUploader{
 		contract: hc,
-		price:    settings.Price,
+		settings: settings.HostSettings,
 
 		tree: crypto.NewTree(),
 
@@ -166,6 +188,8 @@ type pool struct {
 
 	hosts     []*hostUploader
 	blacklist []modules.NetAddress
+	pinned    []modules.NetAddress // if non-empty, the only hosts that are used
+	diverse   bool                 // if set, pieces of a chunk are spread across subnets
 	hdb       *HostDB
 }
 
@@ -183,12 +207,36 @@ func (p *pool) Close() error {
 // new contracts if more hosts are required. Note that this latter case
 // requires network I/O, so the caller should always assume that UniqueHosts
 // will block.
+//
+// If the pool is diverse, each host returned is in a different subnet from
+// the other hosts returned and from the hosts in 'exclude'. Hosts that share
+// a subnet are only returned if there are not enough hosts in distinct
+// subnets.
 func (p *pool) UniqueHosts(n int, exclude []modules.NetAddress) (hosts []Uploader) {
 	if n == 0 {
 		return
 	}
 
-	// First reuse existing connections.
+	// Track the subnets that are already in use.
+	subnets := make(map[string]bool)
+	if p.diverse {
+		for _, addr := range exclude {
+			subnets[subnet(addr)] = true
+		}
+	}
+	diverse := func(addr modules.NetAddress) bool {
+		return !p.diverse || !subnets[subnet(addr)]
+	}
+	add := func(h Uploader) {
+		hosts = append(hosts, h)
+		if p.diverse {
+			subnets[subnet(h.Address())] = true
+		}
+	}
+
+	// First reuse existing connections. Connections to hosts in a subnet
+	// that is already in use are set aside.
+	var sameSubnet []Uploader
 outer:
 	for _, h := range p.hosts {
 		for _, ip := range exclude {
@@ -196,7 +244,11 @@ outer:
 				continue outer
 			}
 		}
-		hosts = append(hosts, h)
+		if !diverse(h.Address()) {
+			sameSubnet = append(sameSubnet, h)
+			continue
+		}
+		add(h)
 		if len(hosts) >= n {
 			return hosts
 		}
@@ -210,38 +262,66 @@ outer:
 	}
 
 	// Ask the hostdb for random hosts. We always ask for at least 10, to
-	// avoid selecting the same uncooperative hosts over and over.
+	// avoid selecting the same uncooperative hosts over and over. If the pool
+	// is pinned to a set of hosts, only those hosts are considered.
 	ask := n
 	if ask < 10 {
 		ask = 10
 	}
 	p.hdb.mu.Lock()
-	randHosts := p.hdb.randomHosts(ask, exclude)
+	var randHosts []modules.HostSettings
+	if len(p.pinned) != 0 {
+		randHosts = p.pinnedHosts(exclude)
+	} else {
+		randHosts = p.hdb.randomHosts(ask, exclude)
+	}
 	p.hdb.mu.Unlock()
 
-	// Form new contracts with the randomly-picked hosts. If a contract can't
-	// be formed, add the host to the pool's blacklist.
+	// Form new contracts with the randomly-picked hosts. Hosts in a subnet
+	// that is already in use are set aside.
 	var errs []error
+	var attempts int
+	var deferred []modules.HostSettings
 	for _, host := range randHosts {
-		contract, err := p.hdb.newContract(host, p.filesize, p.duration)
-		if err != nil {
-			p.blacklist = append(p.blacklist, host.NetAddress)
-			errs = append(errs, err)
+		if len(hosts) >= n {
+			break
+		}
+		if !diverse(host.NetAddress) {
+			deferred = append(deferred, host)
 			continue
 		}
-		hu, err := p.hdb.newHostUploader(contract)
+		attempts++
+		hu, err := p.connect(host)
 		if err != nil {
-			p.blacklist = append(p.blacklist, host.NetAddress)
+			errs = append(errs, err)
 			continue
 		}
-		hosts = append(hosts, hu)
-		p.hosts = append(p.hosts, hu)
+		add(hu)
+	}
+
+	// If there were not enough hosts in distinct subnets, fall back to the
+	// hosts that were set aside.
+	for _, h := range sameSubnet {
 		if len(hosts) >= n {
 			break
 		}
+		add(h)
+	}
+	for _, host := range deferred {
+		if len(hosts) >= n {
+			break
+		}
+		attempts++
+		hu, err := p.connect(host)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		add(hu)
 	}
+
 	// If all attempts failed, log the error.
-	if len(errs) == len(randHosts) && len(errs) > 0 {
+	if len(errs) == attempts && len(errs) > 0 {
 		// Log the last error, since early errors are more likely to be
 		// host-specific.
 		p.hdb.log.Printf("couldn't form any host contracts: %v", errs[len(errs)-1])
@@ -249,17 +329,87 @@ outer:
 	return hosts
 }
 
+// connect forms a new contract with a host and adds the connection to the
+// pool. If a contract can't be formed, the host is added to the pool's
+// blacklist.
+func (p *pool) connect(host modules.HostSettings) (*hostUploader, error) {
+	contract, err := p.hdb.newContract(host, p.filesize, p.duration)
+	if err != nil {
+		p.blacklist = append(p.blacklist, host.NetAddress)
+		return nil, err
+	}
+	hu, err := p.hdb.newHostUploader(contract)
+	if err != nil {
+		p.blacklist = append(p.blacklist, host.NetAddress)
+		return nil, err
+	}
+	p.hosts = append(p.hosts, hu)
+	return hu, nil
+}
+
+// subnet returns the subnet of a host address: the /24 subnet of an IPv4
+// address, or the /64 subnet of an IPv6 address. Hosts that are identified by
+// a hostname are treated as being in a subnet of their own.
+func subnet(addr modules.NetAddress) string {
+	ip := net.ParseIP(addr.Host())
+	if ip == nil {
+		return addr.Host()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// pinnedHosts returns the settings of the pool's pinned hosts that are not in
+// 'exclude'. Pinned hosts that are no longer active are skipped.
+func (p *pool) pinnedHosts(exclude []modules.NetAddress) (hosts []modules.HostSettings) {
+outer:
+	for _, addr := range p.pinned {
+		for _, ip := range exclude {
+			if addr == ip {
+				continue outer
+			}
+		}
+		node, exists := p.hdb.activeHosts[addr]
+		if !exists {
+			continue
+		}
+		hosts = append(hosts, node.hostEntry.HostSettings)
+	}
+	return hosts
+}
+
 // NewPool returns an empty HostPool, unless the HostDB contains no hosts at
-// all.
-func (hdb *HostDB) NewPool(filesize uint64, duration types.BlockHeight) (HostPool, error) {
+// all. If hosts is non-empty, the pool only forms contracts with the
+// specified hosts, and errUnavailableHost is returned if any of them is not
+// an active host, or errUnsupportedProtocol if any of them speaks a protocol
+// version that the renter does not support. Otherwise, such hosts are never
+// selected, as they do not enter the tree of active hosts. If diverse is set,
+// the pool avoids returning hosts that share a subnet from a single call to
+// UniqueHosts.
+func (hdb *HostDB) NewPool(filesize uint64, duration types.BlockHeight, hosts []modules.NetAddress, diverse bool) (HostPool, error) {
 	hdb.mu.RLock()
 	defer hdb.mu.RUnlock()
 	if hdb.isEmpty() {
 		return nil, errors.New("HostDB is empty")
 	}
+	for _, addr := range hosts {
+		if _, exists := hdb.activeHosts[addr]; exists {
+			continue
+		}
+		// hosts that speak an unsupported protocol version are known, but
+		// never active
+		if entry, exists := hdb.allHosts[addr]; exists && !modules.SupportedProtocol(entry.ProtocolVersion) {
+			return nil, errUnsupportedProtocol
+		}
+		return nil, errUnavailableHost
+	}
 	return &pool{
 		filesize: filesize,
 		duration: duration,
+		pinned:   hosts,
+		diverse:  diverse,
 		hdb:      hdb,
 	}, nil
 }
@@ -0,0 +1,358 @@
+package hostdb
+
+import (
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// acceptRevisions plays the part of a host that accepts every revision sent
+// over conn, each carrying a piece of size 'pieceLen'.
+func acceptRevisions(conn net.Conn, pieceLen int) {
+	defer conn.Close()
+	for {
+		var txn types.Transaction
+		if err := encoding.ReadObject(conn, &txn, types.BlockSizeLimit); err != nil {
+			return
+		}
+		if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, pieceLen)); err != nil {
+			return
+		}
+		if err := encoding.WriteObject(conn, txn); err != nil {
+			return
+		}
+	}
+}
+
+// TestUploadUsage checks that uploading over a contract updates the usage
+// statistics of the contract.
+func TestUploadUsage(t *testing.T) {
+	persistDir := build.TempDir("hostdb", "TestUploadUsage")
+	err := os.MkdirAll(persistDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := &HostDB{
+		contracts:  make(map[types.FileContractID]hostContract),
+		persistDir: persistDir,
+	}
+
+	// Create a contract with a host that accepts every revision.
+	sk, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := []types.SiacoinOutput{{Value: types.NewCurrency64(1e9)}, {Value: types.ZeroCurrency}}
+	hc := hostContract{
+		IP:           "foo",
+		ID:           types.FileContractID{1},
+		FileContract: types.FileContract{WindowStart: 100},
+		LastRevision: types.FileContractRevision{
+			ParentID:              types.FileContractID{1},
+			NewWindowStart:        100,
+			NewValidProofOutputs:  outputs,
+			NewMissedProofOutputs: outputs,
+		},
+		SecretKey: sk,
+	}
+	hdb.contracts[hc.ID] = hc
+
+	const pieceLen = 64
+	renterConn, hostConn := net.Pipe()
+	go acceptRevisions(hostConn, pieceLen)
+	hu := &hostUploader{
+		settings: modules.HostSettings{Price: types.NewCurrency64(1)},
+		tree:     crypto.NewTree(),
+		contract: hc,
+		conn:     renterConn,
+		hdb:      hdb,
+	}
+	defer renterConn.Close()
+
+	// Upload two pieces, checking that the counters increase each time.
+	var lastSpent types.Currency
+	for i := 1; i <= 2; i++ {
+		_, err = hu.Upload(make([]byte, pieceLen))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contracts := hdb.Contracts()
+		if len(contracts) != 1 {
+			t.Fatal("expected 1 contract, got", len(contracts))
+		}
+		if contracts[0].Uploaded != uint64(i*pieceLen) {
+			t.Error("wrong upload total:", contracts[0].Uploaded)
+		}
+		if contracts[0].Spent.Cmp(lastSpent) <= 0 {
+			t.Error("spend did not increase:", contracts[0].Spent)
+		}
+		if contracts[0].Spent.Cmp(hu.contract.LastRevision.NewValidProofOutputs[1].Value) != 0 {
+			t.Error("spend does not match the payment to the host")
+		}
+		if contracts[0].RenterFunds.Cmp(hu.contract.LastRevision.NewValidProofOutputs[0].Value) != 0 {
+			t.Error("remaining funds do not match the latest revision")
+		}
+		if contracts[0].Size != uint64(i*pieceLen) {
+			t.Error("wrong contract size:", contracts[0].Size)
+		}
+		lastSpent = contracts[0].Spent
+	}
+
+	// Downloads recorded by the renter should survive further uploads.
+	hdb.RecordDownload(hc.ID, 100)
+	_, err = hu.Upload(make([]byte, pieceLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contracts := hdb.Contracts(); contracts[0].Downloaded != 100 {
+		t.Error("wrong download total:", contracts[0].Downloaded)
+	}
+}
+
+// TestPinnedPool checks that a pool pinned to a set of hosts only selects
+// those hosts, and that a pool cannot be pinned to an unavailable host.
+func TestPinnedPool(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+	}
+	for i := 0; i < 5; i++ {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{NetAddress: fakeAddr(uint8(i))},
+			weight:       types.NewCurrency64(1),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+
+	// pinning an unknown host should fail
+	_, err := hdb.NewPool(1, 1, []modules.NetAddress{fakeAddr(1), fakeAddr(9)}, false)
+	if err != errUnavailableHost {
+		t.Fatal("expected errUnavailableHost, got", err)
+	}
+
+	// only the pinned hosts should be selected
+	pinned := []modules.NetAddress{fakeAddr(1), fakeAddr(3)}
+	hp, err := hdb.NewPool(1, 1, pinned, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := hp.(*pool)
+	hosts := p.pinnedHosts(nil)
+	if len(hosts) != 2 || hosts[0].NetAddress != pinned[0] || hosts[1].NetAddress != pinned[1] {
+		t.Fatal("pool selected the wrong hosts:", hosts)
+	}
+	hosts = p.pinnedHosts([]modules.NetAddress{fakeAddr(1)})
+	if len(hosts) != 1 || hosts[0].NetAddress != pinned[1] {
+		t.Fatal("pool selected an excluded host:", hosts)
+	}
+}
+
+// TestUnsupportedProtocol checks that a host that advertises an unsupported
+// protocol version never becomes active, and that the renter declines to
+// form contracts with it.
+func TestUnsupportedProtocol(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+	}
+	supported := &hostEntry{HostSettings: modules.HostSettings{NetAddress: fakeAddr(1)}}
+	hdb.updateEntry(supported, modules.HostSettings{Price: types.NewCurrency64(1)}, nil)
+	entry := &hostEntry{HostSettings: modules.HostSettings{NetAddress: fakeAddr(0)}}
+	hdb.updateEntry(entry, modules.HostSettings{Price: types.NewCurrency64(1), ProtocolVersion: "99.0"}, nil)
+	if _, active := hdb.activeHosts[entry.NetAddress]; active {
+		t.Fatal("host with an unsupported protocol became active")
+	}
+	if _, known := hdb.allHosts[entry.NetAddress]; !known {
+		t.Fatal("host with an unsupported protocol was forgotten")
+	}
+
+	// pinning the host should fail
+	_, err := hdb.NewPool(1, 1, []modules.NetAddress{entry.NetAddress}, false)
+	if err != errUnsupportedProtocol {
+		t.Fatal("expected errUnsupportedProtocol, got", err)
+	}
+
+	// a host that switches to an unsupported version is no longer active
+	hdb.updateEntry(supported, modules.HostSettings{Price: types.NewCurrency64(1), ProtocolVersion: "99.0"}, nil)
+	if _, active := hdb.activeHosts[supported.NetAddress]; active {
+		t.Fatal("host that switched to an unsupported protocol is still active")
+	}
+	if !hdb.isEmpty() {
+		t.Fatal("hostdb should have no hosts to select")
+	}
+
+	// forming a contract directly should fail
+	_, err = hdb.newContract(entry.HostSettings, 1, 1)
+	if err != errUnsupportedProtocol {
+		t.Fatal("expected errUnsupportedProtocol, got", err)
+	}
+
+	// hosts that predate protocol versions, and hosts that speak the current
+	// version, are supported
+	for _, version := range []string{"", modules.ProtocolVersion, modules.MinProtocolVersion} {
+		if !modules.SupportedProtocol(version) {
+			t.Errorf("protocol version %q should be supported", version)
+		}
+	}
+	for _, version := range []string{"99.0", "0.1", "foo"} {
+		if modules.SupportedProtocol(version) {
+			t.Errorf("protocol version %q should not be supported", version)
+		}
+	}
+}
+
+// seededRandSource is a randSource that produces the same sequence of values
+// for the same seed.
+type seededRandSource struct {
+	*mathrand.Rand
+}
+
+// Int returns a random value in [0, max) drawn from the seeded source.
+func (s seededRandSource) Int(max *big.Int) (*big.Int, error) {
+	return new(big.Int).Rand(s.Rand, max), nil
+}
+
+// TestSeededPool checks that pools select the same hosts when host selection
+// is seeded with the same value.
+func TestSeededPool(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:   make(map[types.FileContractID]hostContract),
+	}
+	for i := 0; i < 20; i++ {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{NetAddress: fakeAddr(uint8(i))},
+			weight:       types.NewCurrency64(uint64(i + 1)),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+
+	// selectHosts creates a pool seeded with 'seed', and returns the hosts
+	// that the pool would form contracts with.
+	selectHosts := func(seed int64) []modules.HostSettings {
+		hdb.selectionRand = seededRandSource{mathrand.New(mathrand.NewSource(seed))}
+		hp, err := hdb.NewPool(1, 1, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := hp.(*pool)
+		p.hdb.mu.Lock()
+		defer p.hdb.mu.Unlock()
+		return p.hdb.randomHosts(10, nil)
+	}
+	first := selectHosts(1)
+	if len(first) != 10 {
+		t.Fatal("expected 10 hosts, got", len(first))
+	}
+	if second := selectHosts(1); !reflect.DeepEqual(first, second) {
+		t.Fatal("pools with the same seed selected different hosts:", first, second)
+	}
+	if other := selectHosts(2); reflect.DeepEqual(first, other) {
+		t.Fatal("pools with different seeds selected the same hosts")
+	}
+}
+
+// TestSubnet checks that host addresses are grouped by subnet.
+func TestSubnet(t *testing.T) {
+	tests := []struct {
+		a, b modules.NetAddress
+		same bool
+	}{
+		{"10.0.1.1:9982", "10.0.1.200:9982", true},
+		{"10.0.1.1:9982", "10.0.2.1:9982", false},
+		{"[2001:db8::1]:9982", "[2001:db8::2]:9982", true},
+		{"[2001:db8::1]:9982", "[2001:db8:0:1::1]:9982", false},
+		{"foo.com:9982", "foo.com:9983", true},
+		{"foo.com:9982", "bar.com:9982", false},
+	}
+	for _, test := range tests {
+		if (subnet(test.a) == subnet(test.b)) != test.same {
+			t.Errorf("expected subnet(%v) == subnet(%v) to be %v", test.a, test.b, test.same)
+		}
+	}
+}
+
+// TestUniqueHostsDiverse checks that a diverse pool spreads the hosts it
+// returns across distinct subnets, and falls back to hosts that share a subnet
+// when there are not enough subnets.
+func TestUniqueHostsDiverse(t *testing.T) {
+	// Create a pool connected to two hosts in each of three subnets.
+	addrs := []modules.NetAddress{
+		"10.0.1.1:9982", "10.0.1.2:9982",
+		"10.0.2.1:9982", "10.0.2.2:9982",
+		"10.0.3.1:9982", "10.0.3.2:9982",
+	}
+	p := &pool{
+		diverse: true,
+		hdb:     &HostDB{},
+	}
+	for _, addr := range addrs {
+		p.hosts = append(p.hosts, &hostUploader{contract: hostContract{IP: addr}})
+	}
+
+	// distinctSubnets reports whether each of the hosts is in a different
+	// subnet.
+	distinctSubnets := func(hosts []Uploader) bool {
+		seen := make(map[string]bool)
+		for _, h := range hosts {
+			if seen[subnet(h.Address())] {
+				return false
+			}
+			seen[subnet(h.Address())] = true
+		}
+		return true
+	}
+
+	hosts := p.UniqueHosts(3, nil)
+	if len(hosts) != 3 {
+		t.Fatal("expected 3 hosts, got", len(hosts))
+	}
+	if !distinctSubnets(hosts) {
+		t.Error("hosts share a subnet")
+	}
+
+	// Hosts in the same subnet as an excluded host should not be used.
+	hosts = p.UniqueHosts(2, []modules.NetAddress{"10.0.1.1:9982"})
+	if len(hosts) != 2 {
+		t.Fatal("expected 2 hosts, got", len(hosts))
+	}
+	for _, h := range hosts {
+		if subnet(h.Address()) == subnet("10.0.1.1:9982") {
+			t.Error("host shares a subnet with an excluded host:", h.Address())
+		}
+	}
+	if !distinctSubnets(hosts) {
+		t.Error("hosts share a subnet")
+	}
+
+	// If there are not enough subnets, hosts that share a subnet should be
+	// used after a host from each subnet.
+	hosts = p.UniqueHosts(5, nil)
+	if len(hosts) != 5 {
+		t.Fatal("expected 5 hosts, got", len(hosts))
+	}
+	if !distinctSubnets(hosts[:3]) {
+		t.Error("hosts share a subnet before every subnet was used")
+	}
+}
@@ -7,6 +7,7 @@ package hostdb
 import (
 	"crypto/rand"
 	"errors"
+	"math/big"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
@@ -17,6 +18,21 @@ var (
 	ErrOverweight = errors.New("requested a too-heavy weight")
 )
 
+// A randSource provides the randomness used for weighted host selection.
+type randSource interface {
+	// Int returns a uniform random value in [0, max).
+	Int(max *big.Int) (*big.Int, error)
+}
+
+// stdRandSource is the randSource used outside of testing, which draws from
+// crypto/rand.
+type stdRandSource struct{}
+
+// Int calls rand.Int with rand.Reader.
+func (stdRandSource) Int(max *big.Int) (*big.Int, error) {
+	return rand.Int(rand.Reader, max)
+}
+
 // hostNode is the node of an unsorted, balanced, weighted binary tree. When
 // inserting elements, elements are inserted on the side of the tree with the
 // fewest elements. When removing, the node is just made empty but the tree is
@@ -149,6 +165,15 @@ func (hn *hostNode) removeNode() {
 	}
 }
 
+// restoreNode undoes removeNode, returning the host entry of the node to its
+// original place in the tree.
+func (hn *hostNode) restoreNode() {
+	hn.taken = true
+	for current := hn; current != nil; current = current.parent {
+		current.weight = current.weight.Add(hn.hostEntry.weight)
+	}
+}
+
 // isEmpty returns whether the hostTree contains no entries.
 func (hdb *HostDB) isEmpty() bool {
 	return hdb.hostTree == nil || hdb.hostTree.weight.IsZero()
@@ -164,8 +189,11 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 		return
 	}
 
-	// These will be restored after selection is finished.
-	var removedEntries []*hostEntry
+	// These will be restored after selection is finished. The nodes are
+	// restored in place rather than reinserted, so that selection does not
+	// change the shape of the tree, and the same random values always select
+	// the same hosts.
+	var removedNodes []*hostNode
 
 	// Remove hosts that we want to ignore.
 	for _, addr := range ignore {
@@ -175,13 +203,17 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 		}
 		node.removeNode()
 		delete(hdb.activeHosts, addr)
-		removedEntries = append(removedEntries, node.hostEntry)
+		removedNodes = append(removedNodes, node)
 	}
 
 	// Pick a host, remove it from the tree, and repeat until we have n hosts
 	// or the tree is empty.
+	src := hdb.selectionRand
+	if src == nil {
+		src = stdRandSource{}
+	}
 	for len(hosts) < n && !hdb.isEmpty() {
-		randWeight, err := rand.Int(rand.Reader, hdb.hostTree.weight.Big())
+		randWeight, err := src.Int(hdb.hostTree.weight.Big())
 		if err != nil {
 			break
 		}
@@ -193,12 +225,13 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 
 		node.removeNode()
 		delete(hdb.activeHosts, node.hostEntry.NetAddress)
-		removedEntries = append(removedEntries, node.hostEntry)
+		removedNodes = append(removedNodes, node)
 	}
 
 	// Add back all of the entries that got removed.
-	for i := range removedEntries {
-		hdb.insertNode(removedEntries[i])
+	for _, node := range removedNodes {
+		node.restoreNode()
+		hdb.activeHosts[node.hostEntry.NetAddress] = node
 	}
 	return hosts
 }
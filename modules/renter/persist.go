@@ -5,11 +5,14 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -20,6 +23,11 @@ import (
 const (
 	PersistFilename = "renter.json"
 	ShareExtension  = ".sia"
+
+	// orphanExtension is appended to .sia files that Compact finds in the
+	// persist folder but that do not hold a file of the renter. The renter
+	// does not load them, but they are kept so that they can be recovered.
+	orphanExtension = ".orphan"
 )
 
 var (
@@ -27,9 +35,23 @@ var (
 	ErrNonShareSuffix = errors.New("suffix of file must be " + ShareExtension)
 	ErrBadFile        = errors.New("not a .sia file")
 	ErrIncompatible   = errors.New("file is not compatible with current version")
+	ErrMalformedFile  = errors.New(".sia file contains a malformed file")
 
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
-	shareVersion = "0.4"
+	shareVersion = "0.8"
+
+	// COMPATv0.4 - .sia files created before file hashes were introduced.
+	compatShareVersion04 = "0.4"
+
+	// COMPATv0.5 - .sia files created before file owners were introduced.
+	compatShareVersion05 = "0.5"
+
+	// COMPATv0.6 - .sia files created before zero chunks were recorded.
+	compatShareVersion06 = "0.6"
+
+	// COMPATv0.7 - .sia files created before custom chunk sizes were
+	// introduced.
+	compatShareVersion07 = "0.7"
 
 	saveMetadata = persist.Metadata{
 		Header:  "Renter Persistence",
@@ -55,28 +77,23 @@ func (f *file) MarshalSia(w io.Writer) error {
 	}
 	// COMPATv0.4.3 - encode the bytesUploaded and chunksUploaded fields
 	// TODO: the resulting .sia file may confuse old clients.
-	err = enc.EncodeAll(f.pieceSize*f.numChunks()*uint64(f.erasureCode.NumPieces()), f.numChunks())
+	err = enc.EncodeAll(f.chunkPieceSize()*f.numChunks()*uint64(f.erasureCode.NumPieces()), f.numChunks())
 	if err != nil {
 		return err
 	}
 
 	// encode erasureCode
-	switch code := f.erasureCode.(type) {
-	case *rsCode:
-		err = enc.EncodeAll(
-			"Reed-Solomon",
-			uint64(code.dataPieces),
-			uint64(code.numPieces-code.dataPieces),
-		)
-		if err != nil {
-			return err
-		}
-	default:
+	code, ok := f.erasureCode.(RegisteredErasureCoder)
+	if !ok {
 		if build.DEBUG {
 			panic("unknown erasure code")
 		}
 		return errors.New("unknown erasure code")
 	}
+	err = enc.EncodeAll(code.ErasureCoderID(), code)
+	if err != nil {
+		return err
+	}
 	// encode contracts
 	if err := enc.Encode(uint64(len(f.contracts))); err != nil {
 		return err
@@ -86,12 +103,111 @@ func (f *file) MarshalSia(w io.Writer) error {
 			return err
 		}
 	}
-	return nil
+	// encode hash and access metadata
+	err = enc.EncodeAll(f.hash, f.owner, f.permissions)
+	if err != nil {
+		return err
+	}
+	// encode zero chunks, in ascending order
+	var zeroChunks []uint64
+	for i := uint64(0); i < f.numChunks(); i++ {
+		if _, ok := f.zeroChunks[i]; ok {
+			zeroChunks = append(zeroChunks, i)
+		}
+	}
+	return enc.EncodeAll(zeroChunks, f.customChunkSize)
 }
 
 // UnmarshalSia implements the encoding.SiaUnmarshaller interface,
 // reconstructing a file from the encoded bytes read from r.
 func (f *file) UnmarshalSia(r io.Reader) error {
+	return f.unmarshalSia(r, shareVersion)
+}
+
+// compatFile04 decodes a file that was encoded by a v0.4 .sia file.
+//
+// COMPATv0.4 - v0.4 .sia files do not contain file hashes.
+type compatFile04 struct {
+	*file
+}
+
+// UnmarshalSia implements the encoding.SiaUnmarshaller interface.
+func (cf compatFile04) UnmarshalSia(r io.Reader) error {
+	return cf.file.unmarshalSia(r, compatShareVersion04)
+}
+
+// compatFile05 decodes a file that was encoded by a v0.5 .sia file.
+//
+// COMPATv0.5 - v0.5 .sia files do not contain file owners or permissions.
+type compatFile05 struct {
+	*file
+}
+
+// UnmarshalSia implements the encoding.SiaUnmarshaller interface.
+func (cf compatFile05) UnmarshalSia(r io.Reader) error {
+	return cf.file.unmarshalSia(r, compatShareVersion05)
+}
+
+// compatFile06 decodes a file that was encoded by a v0.6 .sia file.
+//
+// COMPATv0.6 - v0.6 .sia files do not record which chunks are all zeros.
+type compatFile06 struct {
+	*file
+}
+
+// UnmarshalSia implements the encoding.SiaUnmarshaller interface.
+func (cf compatFile06) UnmarshalSia(r io.Reader) error {
+	return cf.file.unmarshalSia(r, compatShareVersion06)
+}
+
+// compatFile07 decodes a file that was encoded by a v0.7 .sia file.
+//
+// COMPATv0.7 - v0.7 .sia files do not contain custom chunk sizes.
+type compatFile07 struct {
+	*file
+}
+
+// UnmarshalSia implements the encoding.SiaUnmarshaller interface.
+func (cf compatFile07) UnmarshalSia(r io.Reader) error {
+	return cf.file.unmarshalSia(r, compatShareVersion07)
+}
+
+// validate checks that the metadata of a decoded file is consistent, so that
+// a corrupted .sia file cannot introduce a file that fails later, for example
+// during a download.
+func (f *file) validate() error {
+	if f.pieceSize == 0 {
+		return errors.New("piece size is zero")
+	}
+	if err := checkErasureCode(f.erasureCode); err != nil {
+		return err
+	}
+	if err := f.checkChunkSize(f.customChunkSize); err != nil {
+		return err
+	}
+	numChunks := f.numChunks()
+	numPieces := uint64(f.erasureCode.NumPieces())
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if p.Chunk >= numChunks {
+				return fmt.Errorf("contract %v holds a piece of chunk %v, but the file has only %v chunks", fc.ID, p.Chunk, numChunks)
+			}
+			if p.Piece >= numPieces {
+				return fmt.Errorf("contract %v holds piece %v of chunk %v, but the erasure code has only %v pieces", fc.ID, p.Piece, p.Chunk, numPieces)
+			}
+		}
+	}
+	for chunk := range f.zeroChunks {
+		if chunk >= numChunks {
+			return fmt.Errorf("chunk %v is marked as zero, but the file has only %v chunks", chunk, numChunks)
+		}
+	}
+	return nil
+}
+
+// unmarshalSia decodes a file that was encoded using the provided .sia
+// version.
+func (f *file) unmarshalSia(r io.Reader, version string) error {
 	dec := encoding.NewDecoder(r)
 
 	// COMPATv0.4.3 - decode bytesUploaded and chunksUploaded into dummy vars.
@@ -116,24 +232,14 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 	if err := dec.Decode(&codeType); err != nil {
 		return err
 	}
-	switch codeType {
-	case "Reed-Solomon":
-		var nData, nParity uint64
-		err = dec.DecodeAll(
-			&nData,
-			&nParity,
-		)
-		if err != nil {
-			return err
-		}
-		rsc, err := NewRSCode(int(nData), int(nParity))
-		if err != nil {
-			return err
-		}
-		f.erasureCode = rsc
-	default:
+	load, exists := erasureCoderLoader(codeType)
+	if !exists {
 		return errors.New("unrecognized erasure code type: " + codeType)
 	}
+	f.erasureCode, err = load(dec)
+	if err != nil {
+		return err
+	}
 
 	// decode contracts
 	var nContracts uint64
@@ -148,7 +254,42 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 		}
 		f.contracts[contract.ID] = contract
 	}
-	return nil
+
+	f.zeroChunks = make(map[uint64]struct{})
+
+	// decode hash
+	if version == compatShareVersion04 {
+		return nil
+	}
+	if err := dec.Decode(&f.hash); err != nil {
+		return err
+	}
+
+	// decode access metadata
+	if version == compatShareVersion05 {
+		return nil
+	}
+	if err := dec.DecodeAll(&f.owner, &f.permissions); err != nil {
+		return err
+	}
+
+	// decode zero chunks
+	if version == compatShareVersion06 {
+		return nil
+	}
+	var zeroChunks []uint64
+	if err := dec.Decode(&zeroChunks); err != nil {
+		return err
+	}
+	for _, i := range zeroChunks {
+		f.zeroChunks[i] = struct{}{}
+	}
+
+	// decode custom chunk size
+	if version == compatShareVersion07 {
+		return nil
+	}
+	return dec.Decode(&f.customChunkSize)
 }
 
 // saveFile saves a file to the renter directory.
@@ -243,6 +384,94 @@ func (r *Renter) load() error {
 	return nil
 }
 
+// Compact rewrites the persistence of the renter, producing the smallest
+// on-disk state that is consistent with the renter. Tracking entries of files
+// that no longer exist are dropped, .sia files that do not hold a file of the
+// renter are moved aside, folders left empty by deleted files are removed,
+// and every remaining file is saved again.
+func (r *Renter) Compact() error {
+	// Drop orphaned tracking entries, and collect the files to rewrite.
+	lockID := r.mu.Lock()
+	for name := range r.tracking {
+		if _, exists := r.files[name]; !exists {
+			delete(r.tracking, name)
+		}
+	}
+	files := make([]*file, 0, len(r.files))
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	err := r.save()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+
+	// Rewrite the remaining files.
+	for _, f := range files {
+		f.mu.RLock()
+		err := r.saveFile(f)
+		f.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Move aside .sia files that do not belong to any file, which may have
+	// been left behind by a failed delete or rename. They are not removed,
+	// because they may also hold files that the renter could not load, such
+	// as malformed files or files written by a newer version. Folders are
+	// collected so that empty ones can be removed afterwards.
+	var dirs []string
+	err = filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != r.persistDir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ShareExtension {
+			return nil
+		}
+		rel, err := filepath.Rel(r.persistDir, path)
+		if err != nil {
+			return err
+		}
+		// The file is checked and moved under lock, so that a file added
+		// since the walk began is not moved aside.
+		lockID := r.mu.RLock()
+		defer r.mu.RUnlock(lockID)
+		if _, exists := r.files[filepath.ToSlash(strings.TrimSuffix(rel, ShareExtension))]; exists {
+			return nil
+		}
+		r.log.Println("WARN: moving aside .sia file that does not hold a file of the renter:", rel)
+		return os.Rename(path, path+orphanExtension)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Walk visits a folder before its contents, so the folders are checked in
+	// reverse to also remove folders that only contained empty folders. A
+	// folder is removed under lock, so that a file being saved into it is
+	// not lost.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		lockID := r.mu.Lock()
+		contents, err := ioutil.ReadDir(dirs[i])
+		if err == nil && len(contents) == 0 {
+			err = os.Remove(dirs[i])
+		}
+		r.mu.Unlock(lockID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // shareFiles writes the specified files to w. First a header is written,
 // followed by the gzipped concatenation of each file.
 func shareFiles(files []*file, w io.Writer) error {
@@ -346,7 +575,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		return nil, err
 	} else if header != shareHeader {
 		return nil, ErrBadFile
-	} else if version != shareVersion {
+	} else if version != shareVersion && version != compatShareVersion04 && version != compatShareVersion05 && version != compatShareVersion06 && version != compatShareVersion07 {
 		return nil, ErrIncompatible
 	}
 
@@ -361,10 +590,29 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	files := make([]*file, numFiles)
 	for i := range files {
 		files[i] = new(file)
-		err := dec.Decode(files[i])
+		switch version {
+		case compatShareVersion04:
+			// COMPATv0.4
+			err = dec.Decode(&compatFile04{files[i]})
+		case compatShareVersion05:
+			// COMPATv0.5
+			err = dec.Decode(&compatFile05{files[i]})
+		case compatShareVersion06:
+			// COMPATv0.6
+			err = dec.Decode(&compatFile06{files[i]})
+		case compatShareVersion07:
+			// COMPATv0.7
+			err = dec.Decode(&compatFile07{files[i]})
+		default:
+			err = dec.Decode(files[i])
+		}
 		if err != nil {
 			return nil, err
 		}
+		err = files[i].validate()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", ErrMalformedFile, err)
+		}
 
 		// Make sure the file's name does not conflict with existing files.
 		dupCount := 0
@@ -6,11 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // newTestingFile initializes a file object with random parameters.
@@ -26,7 +28,8 @@ func newTestingFile() *file {
 		size:        encoding.DecUint64(data[1:5]),
 		masterKey:   key,
 		erasureCode: rsc,
-		pieceSize:   encoding.DecUint64(data[6:8]),
+		pieceSize:   encoding.DecUint64(data[6:8]) + 1, // must be non-zero
+		hash:        crypto.HashBytes(data),
 	}
 }
 
@@ -47,6 +50,12 @@ func equalFiles(f1, f2 *file) error {
 	if f1.pieceSize != f2.pieceSize {
 		return fmt.Errorf("pieceSizes do not match: %v %v", f1.pieceSize, f2.pieceSize)
 	}
+	if f1.hash != f2.hash {
+		return fmt.Errorf("hashes do not match: %v %v", f1.hash, f2.hash)
+	}
+	if f1.owner != f2.owner || f1.permissions != f2.permissions {
+		return fmt.Errorf("owners do not match: %v %o %v %o", f1.owner, f1.permissions, f2.owner, f2.permissions)
+	}
 	return nil
 }
 
@@ -137,6 +146,64 @@ func TestFileShareLoad(t *testing.T) {
 	}
 }
 
+// TestFileShareLoadMalformed shares files with inconsistent metadata, and
+// checks that they are rejected when the share is loaded.
+func TestFileShareLoadMalformed(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestFileShareLoadMalformed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	tests := []struct {
+		name      string
+		pieceSize uint64
+		piece     pieceData
+	}{
+		{"valid", 64, pieceData{Chunk: 1, Piece: 1}},
+		{"zeropiecesize", 0, pieceData{Chunk: 0, Piece: 0}},
+		{"badchunk", 64, pieceData{Chunk: 2, Piece: 0}},
+		{"badpiece", 64, pieceData{Chunk: 0, Piece: 2}},
+	}
+	for _, test := range tests {
+		// Create a file of two chunks, and share it.
+		f, err := newFile(test.name, rsc, 64, 128)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.pieceSize = test.pieceSize
+		f.contracts[types.FileContractID{1}] = fileContract{
+			ID:     types.FileContractID{1},
+			Pieces: []pieceData{test.piece},
+		}
+		rt.renter.files[f.name] = f
+		ascii, err := rt.renter.ShareFilesAscii([]string{f.name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		delete(rt.renter.files, f.name)
+
+		// Load the file back into the renter.
+		_, err = rt.renter.LoadSharedFilesAscii(ascii)
+		if test.name == "valid" {
+			if err != nil {
+				t.Fatal("valid file was rejected:", err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), ErrMalformedFile.Error()) {
+			t.Errorf("%v: expected ErrMalformedFile, got %v", test.name, err)
+		}
+		if _, exists := rt.renter.files[f.name]; exists {
+			t.Errorf("%v: malformed file was loaded", test.name)
+		}
+	}
+}
+
 // TestFileShareLoadASCII tests the ASCII sharing/loading functions.
 func TestFileShareLoadASCII(t *testing.T) {
 	if testing.Short() {
@@ -311,3 +378,140 @@ func TestSiafileCompatibility(t *testing.T) {
 		t.Fatal("nickname not loaded properly:", names)
 	}
 }
+
+// TestFileOwnerPersistence sets the owner of a file and checks that the owner
+// survives a reload of the renter.
+func TestFileOwnerPersistence(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestFileOwnerPersistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	rt.renter.files[f.name] = f
+	err = rt.renter.SetFileOwner("dne", "alice", 0640)
+	if err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	err = rt.renter.SetFileOwner(f.name, "alice", 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload the renter from disk.
+	delete(rt.renter.files, f.name)
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	owner, perm, err := rt.renter.FileOwner(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "alice" || perm != 0640 {
+		t.Fatalf("owner was not persisted: %v %o", owner, perm)
+	}
+}
+
+// TestRenterCompact deletes most of the files of a renter, compacts the
+// persistence of the renter, and checks that the persisted data shrinks while
+// the remaining files still load.
+func TestRenterCompact(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterCompact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// persistedSize returns the combined size of the .sia files and the
+	// metadata of the renter.
+	persistedSize := func() (size int64) {
+		filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && (filepath.Ext(path) == ShareExtension || filepath.Base(path) == PersistFilename) {
+				size += info.Size()
+			}
+			return nil
+		})
+		return size
+	}
+
+	// Add files in separate folders, each of them tracked.
+	for i := 0; i < 20; i++ {
+		f := newTestingFile()
+		f.name = "folder" + strconv.Itoa(i) + "/file"
+		r.files[f.name] = f
+		r.tracking[f.name] = trackedFile{RepairPath: "/home/user/" + f.name, Renew: true}
+		err = r.saveFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Add a .sia file that does not belong to the renter.
+	orphan := newTestingFile()
+	orphan.name = "orphan"
+	err = r.saveFile(orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete most of the files.
+	for i := 5; i < 20; i++ {
+		err = r.DeleteFile("folder" + strconv.Itoa(i) + "/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	remaining := make(map[string]*file)
+	for name, f := range r.files {
+		remaining[name] = f
+	}
+
+	before := persistedSize()
+	err = r.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := persistedSize(); after >= before {
+		t.Fatalf("compacting did not shrink the persisted data: %v bytes before, %v bytes after", before, after)
+	}
+	if len(r.tracking) != len(remaining) {
+		t.Errorf("expected %v tracked files, got %v", len(remaining), len(r.tracking))
+	}
+	if _, err := os.Stat(filepath.Join(r.persistDir, orphan.name+ShareExtension)); !os.IsNotExist(err) {
+		t.Error("orphaned .sia file was not moved aside:", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.persistDir, orphan.name+ShareExtension+orphanExtension)); err != nil {
+		t.Error("orphaned .sia file was not kept:", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.persistDir, "folder19")); !os.IsNotExist(err) {
+		t.Error("empty folder was not removed:", err)
+	}
+
+	// Reload the renter from disk.
+	id := r.mu.Lock()
+	r.files = make(map[string]*file)
+	r.tracking = make(map[string]trackedFile)
+	err = r.load()
+	r.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.files) != len(remaining) || len(r.tracking) != len(remaining) {
+		t.Fatalf("expected %v files after reloading, got %v files and %v tracked files", len(remaining), len(r.files), len(r.tracking))
+	}
+	for name, f := range remaining {
+		if err := equalFiles(f, r.files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,14 +1,43 @@
 package renter
 
 import (
+	"context"
 	"log"
+	"net"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
 	"github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// hostPollInterval is the amount of time between checks of the active hosts
+// while waiting for the hostdb to find enough hosts.
+var hostPollInterval = func() time.Duration {
+	if build.Release == "testing" {
+		return 10 * time.Millisecond
+	}
+	return time.Second
+}()
+
+// defaultExpiryWindow is the number of blocks before the contracts of a file
+// that is not being renewed expire that the file is reported as expiring
+// soon.
+var defaultExpiryWindow = func() types.BlockHeight {
+	if build.Release == "testing" {
+		return 10
+	}
+	if build.Release == "standard" {
+		return 1008 // 1 week.
+	}
+	if build.Release == "dev" {
+		return 36
+	}
+	panic("unrecognized release constant in renter")
+}()
+
 // A hostDB is a database of hosts that the renter can use for figuring out who
 // to upload to, and download from.
 type hostDB interface {
@@ -24,11 +53,37 @@ type hostDB interface {
 
 	// NewPool returns a new HostPool, which can negotiate contracts with
 	// hosts. The size and duration of these contracts are supplied as
-	// arguments.
-	NewPool(filesize uint64, duration types.BlockHeight) (hostdb.HostPool, error)
+	// arguments. If hosts is non-empty, the pool only forms contracts with
+	// the specified hosts.
+	NewPool(filesize uint64, duration types.BlockHeight, hosts []modules.NetAddress, diverse bool) (hostdb.HostPool, error)
 
 	// Renew renews a file contract, returning the new contract ID.
 	Renew(id types.FileContractID, newHeight types.BlockHeight) (types.FileContractID, error)
+
+	// Contracts returns the usage statistics of each file contract.
+	Contracts() []modules.RenterContract
+
+	// SpendingReport summarizes the spending on the file contracts formed at
+	// or after the given height.
+	SpendingReport(since types.BlockHeight) modules.SpendingSummary
+
+	// RecordDownload adds 'n' bytes to the download total of a contract.
+	RecordDownload(id types.FileContractID, n uint64)
+
+	// PayDownload pays a host for 'n' bytes of downloaded data at 'price'
+	// per byte, by revising the contract over the download connection.
+	PayDownload(conn net.Conn, id types.FileContractID, price types.Currency, n uint64) error
+
+	// DialHost connects to a host for transferring file data, subject to
+	// the speed limits set by SetSpeedLimits.
+	DialHost(addr modules.NetAddress) (net.Conn, error)
+
+	// SetSpeedLimits sets the maximum combined upload and download speed
+	// of all file transfers, in bytes per second.
+	SetSpeedLimits(up, down int64)
+
+	// ScanQueueDepth returns the number of hosts waiting to be scanned.
+	ScanQueueDepth() int
 }
 
 // A trackedFile contains metadata about files being tracked by the Renter.
@@ -42,6 +97,16 @@ type trackedFile struct {
 	EndHeight types.BlockHeight
 	// whether the file should be renewed (overrides EndHeight if true)
 	Renew bool
+	// whether repair of the file has been paused by the user
+	Paused bool
+	// hosts that the file is pinned to, if any
+	Hosts []modules.NetAddress
+	// whether the pieces of each chunk should be placed in distinct subnets
+	Diverse bool
+	// files with a higher priority are repaired first
+	Priority int
+	// whether the erasure code was reduced because too few hosts were available
+	Reduced bool
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -59,6 +124,20 @@ type Renter struct {
 	files         map[string]*file
 	tracking      map[string]trackedFile // map from nickname to metadata
 	downloadQueue []*download
+	minHosts      int // number of active hosts required before uploading
+	maxRetries    int // number of additional hosts tried for a failed piece
+	uploadWorkers int // number of concurrent piece uploads per chunk
+
+	// maxDownloads is the number of downloads that may run at once, or zero
+	// if there is no limit. 'downloadSlot' is closed and replaced whenever a
+	// queued download may be able to start.
+	maxDownloads    int
+	activeDownloads int
+	downloadSlot    chan struct{}
+
+	// Files that are not being renewed are reported as expiring soon once
+	// their contracts expire within 'expiryWindow' blocks.
+	expiryWindow types.BlockHeight
 
 	// constants
 	persistDir string
@@ -81,6 +160,11 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 		files:    make(map[string]*file),
 		tracking: make(map[string]trackedFile),
 
+		maxRetries:    defaultDownloadRetries,
+		expiryWindow:  defaultExpiryWindow,
+		uploadWorkers: defaultUploadWorkers,
+		downloadSlot:  make(chan struct{}),
+
 		persistDir: persistDir,
 		mu:         sync.New(modules.SafeMutexDelay, 1),
 	}
@@ -94,9 +178,107 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 	return r, nil
 }
 
+// SetMinimumHosts sets the number of active hosts that the hostdb must know
+// about before the renter will upload or repair files. Uploading to a sparse
+// network would produce files without enough redundancy to be recovered.
+func (r *Renter) SetMinimumHosts(n int) {
+	lockID := r.mu.Lock()
+	r.minHosts = n
+	r.mu.Unlock(lockID)
+}
+
+// SetDownloadRetries sets the number of additional hosts that a download will
+// try when a host fails to serve a piece. Only hosts that hold the same piece
+// of the chunk are tried.
+func (r *Renter) SetDownloadRetries(n int) {
+	lockID := r.mu.Lock()
+	r.maxRetries = n
+	r.mu.Unlock(lockID)
+}
+
+// SetMaxConcurrentDownloads sets the number of downloads that may run at once.
+// Further downloads wait in the download queue until a running download
+// finishes. A limit of zero removes the limit.
+func (r *Renter) SetMaxConcurrentDownloads(n int) {
+	if n < 0 {
+		n = 0
+	}
+	lockID := r.mu.Lock()
+	r.maxDownloads = n
+	r.notifyDownloadSlot()
+	r.mu.Unlock(lockID)
+}
+
+// SetExpiryWindow sets the number of blocks before the contracts of a file
+// expire that FileList reports the file as expiring soon. Only files that are
+// not being renewed are reported.
+func (r *Renter) SetExpiryWindow(blocks types.BlockHeight) {
+	lockID := r.mu.Lock()
+	r.expiryWindow = blocks
+	r.mu.Unlock(lockID)
+}
+
+// SetUploadWorkers sets the number of pieces of a chunk that are uploaded to
+// hosts concurrently. At least one piece is always uploaded at a time.
+func (r *Renter) SetUploadWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	lockID := r.mu.Lock()
+	r.uploadWorkers = n
+	r.mu.Unlock(lockID)
+}
+
+// SetSpeedLimits sets the maximum combined upload and download speed, in bytes
+// per second, of all uploads, downloads, and repairs. The limits apply to the
+// total throughput of every connection to hosts, rather than to each
+// connection separately. A limit of zero removes the limit.
+func (r *Renter) SetSpeedLimits(up, down int64) {
+	if up < 0 {
+		up = 0
+	}
+	if down < 0 {
+		down = 0
+	}
+	r.hostDB.SetSpeedLimits(up, down)
+}
+
+// HostDBReady indicates whether the hostdb knows about enough active hosts for
+// the renter to upload, which is at least one host and no fewer than the
+// minimum set by SetMinimumHosts.
+func (r *Renter) HostDBReady() bool {
+	lockID := r.mu.RLock()
+	minHosts := r.minHosts
+	r.mu.RUnlock(lockID)
+	if minHosts < 1 {
+		minHosts = 1
+	}
+	return len(r.hostDB.ActiveHosts()) >= minHosts
+}
+
+// WaitForHosts blocks until the hostdb knows about at least 'minHosts' active
+// hosts, returning the context's error if the context is cancelled first. The
+// hostdb scans hosts in the background after the renter is created, so early
+// callers can use WaitForHosts instead of polling ActiveHosts.
+func (r *Renter) WaitForHosts(ctx context.Context, minHosts int) error {
+	for len(r.hostDB.ActiveHosts()) < minHosts {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hostPollInterval):
+		}
+	}
+	return nil
+}
+
 // hostdb passthroughs
 func (r *Renter) ActiveHosts() []modules.HostSettings { return r.hostDB.ActiveHosts() }
 func (r *Renter) AllHosts() []modules.HostSettings    { return r.hostDB.AllHosts() }
+func (r *Renter) Contracts() []modules.RenterContract { return r.hostDB.Contracts() }
+func (r *Renter) ScanQueueDepth() int                 { return r.hostDB.ScanQueueDepth() }
+func (r *Renter) SpendingReport(since types.BlockHeight) modules.SpendingSummary {
+	return r.hostDB.SpendingReport(since)
+}
 
 // enforce that Renter satisfies the modules.Renter interface
 var _ modules.Renter = (*Renter)(nil)
@@ -1,7 +1,11 @@
 package renter
 
 import (
+	"context"
 	"path/filepath"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -96,3 +100,66 @@ func newRenterTester(name string) (*renterTester, error) {
 	}
 	return rt, nil
 }
+
+// scanningHostDB is a streamHostDB whose active hosts are added over time, as
+// if they were found by a scan.
+type scanningHostDB struct {
+	streamHostDB
+	active []modules.HostSettings
+	mu     sync.Mutex
+}
+
+// ActiveHosts returns the hosts that have been found so far.
+func (hdb *scanningHostDB) ActiveHosts() []modules.HostSettings {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	return append([]modules.HostSettings(nil), hdb.active...)
+}
+
+// TestWaitForHosts checks that WaitForHosts returns once enough hosts are
+// active, and that it can be cancelled.
+func TestWaitForHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestWaitForHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	hdb := new(scanningHostDB)
+	rt.renter.hostDB = hdb
+	if rt.renter.HostDBReady() {
+		t.Fatal("hostdb should not be ready without any hosts")
+	}
+
+	// Waiting should be cancelled by the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err = rt.renter.WaitForHosts(ctx, 3)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+
+	// Activate hosts in the background, one at a time.
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			hdb.mu.Lock()
+			hdb.active = append(hdb.active, modules.HostSettings{})
+			hdb.mu.Unlock()
+		}
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = rt.renter.WaitForHosts(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.ActiveHosts()) < 3 {
+		t.Fatal("WaitForHosts returned before enough hosts were active")
+	}
+	if !rt.renter.HostDBReady() {
+		t.Error("hostdb should be ready once hosts are active")
+	}
+}
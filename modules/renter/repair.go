@@ -1,8 +1,11 @@
 package renter
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,8 +17,29 @@ import (
 )
 
 const (
-	// repairThreads is the number of repairs that can run concurrently.
+	// repairThreads is the number of chunks that can be repaired
+	// concurrently.
 	repairThreads = 10
+
+	// repairBatchSize is the number of files whose repair jobs are prepared
+	// at once. Each prepared job holds open the local copy of its file and a
+	// host pool, so the jobs of a repair pass are prepared and finished in
+	// batches rather than all at once.
+	repairBatchSize = 2 * repairThreads
+)
+
+var (
+	// errRepairIncomplete is returned by RepairFile if the file could not be
+	// restored to full redundancy.
+	errRepairIncomplete = errors.New("could not restore the file to full redundancy")
+
+	// errRepairInProgress is returned by RepairFile if the file is already
+	// being repaired.
+	errRepairInProgress = errors.New("the file is already being repaired")
+
+	// errNotResizable is returned by SetFileRedundancy if the erasure code of
+	// the file cannot be extended with more pieces.
+	errNotResizable = errors.New("the redundancy of files with this erasure code cannot be changed")
 )
 
 // When a file contract is within 'renewThreshold' blocks of expiring, the renter
@@ -32,14 +56,33 @@ var renewThreshold = func() types.BlockHeight {
 }()
 
 // repair attempts to repair a file chunk by uploading its pieces to more
-// hosts.
-func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt, hosts []hostdb.Uploader) error {
-	// read chunk data and encode
+// hosts, using at most 'workers' concurrent transfers.
+func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt, hosts []hostdb.Uploader, workers int) error {
+	// read chunk data
 	chunk := make([]byte, f.chunkSize())
 	_, err := r.ReadAt(chunk, int64(chunkIndex*f.chunkSize()))
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return err
 	}
+	return f.uploadChunk(chunkIndex, chunk, missingPieces, hosts, workers)
+}
+
+// uploadChunk erasure-codes and encrypts the data of a chunk, and uploads the
+// specified pieces of the chunk, one piece per host. Pieces are uploaded in
+// parallel, with at most 'workers' transfers in progress at once so that
+// large erasure codes do not exhaust the available connections.
+func (f *file) uploadChunk(chunkIndex uint64, chunk []byte, missingPieces []uint64, hosts []hostdb.Uploader, workers int) error {
+	// Record whether the chunk is entirely zeros, so that downloads to
+	// sparse files can skip it.
+	if isZero(chunk) {
+		f.mu.Lock()
+		if f.zeroChunks == nil {
+			f.zeroChunks = make(map[uint64]struct{})
+		}
+		f.zeroChunks[chunkIndex] = struct{}{}
+		f.mu.Unlock()
+	}
+
 	pieces, err := f.erasureCode.Encode(chunk)
 	if err != nil {
 		return err
@@ -58,14 +101,22 @@ func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt,
 	if len(hosts) < numPieces {
 		numPieces = len(hosts)
 	}
+	if workers < 1 {
+		workers = 1
+	}
+	// A worker must acquire a token before starting a transfer, and returns
+	// the token when the transfer has finished.
+	tokens := make(chan struct{}, workers)
 	var wg sync.WaitGroup
 	wg.Add(numPieces)
 	for i := 0; i < numPieces; i++ {
 		// each goroutine gets a different host, index, and piece, so there
 		// are no data race concerns
 		pIndex := missingPieces[i]
+		tokens <- struct{}{} // acquire token
 		go func(host hostdb.Uploader, pieceIndex uint64, piece []byte) {
 			defer wg.Done()
+			defer func() { <-tokens }() // return token
 
 			// upload data to host
 			offset, err := host.Upload(piece)
@@ -99,11 +150,24 @@ func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt,
 	return nil
 }
 
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // incompleteChunks returns a map of chunks containing pieces that have not
 // been uploaded.
 func (f *file) incompleteChunks() map[uint64][]uint64 {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
+	if f.empty() {
+		return nil
+	}
 
 	present := make([][]bool, f.numChunks())
 	for i := range present {
@@ -203,19 +267,58 @@ func (f *file) offlineChunks(hdb hostDB) map[uint64][]uint64 {
 	return filtered
 }
 
+// unhealthyChunks returns a map of chunks containing pieces that are not
+// stored on any host that is online. Unlike offlineChunks, every chunk that is
+// below full redundancy is returned.
+func (f *file) unhealthyChunks(hdb hostDB) map[uint64][]uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.empty() {
+		return nil
+	}
+
+	// A host is considered offline if it is in AllHosts but not ActiveHosts,
+	// in the same manner as offlineChunks.
+	hostSet := make(map[modules.NetAddress]bool)
+	for _, host := range hdb.AllHosts() {
+		hostSet[host.NetAddress] = false
+	}
+	for _, host := range hdb.ActiveHosts() {
+		hostSet[host.NetAddress] = true
+	}
+
+	present := make([][]bool, f.numChunks())
+	for i := range present {
+		present[i] = make([]bool, f.erasureCode.NumPieces())
+	}
+	for _, fc := range f.contracts {
+		if active, exists := hostSet[fc.IP]; exists && !active {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			// skip pieces that do not belong to the file
+			if p.Chunk >= uint64(len(present)) || p.Piece >= uint64(len(present[p.Chunk])) {
+				continue
+			}
+			present[p.Chunk][p.Piece] = true
+		}
+	}
+
+	unhealthy := make(map[uint64][]uint64)
+	for chunkIndex, pieceBools := range present {
+		for pieceIndex, ok := range pieceBools {
+			if !ok {
+				unhealthy[uint64(chunkIndex)] = append(unhealthy[uint64(chunkIndex)], uint64(pieceIndex))
+			}
+		}
+	}
+	return unhealthy
+}
+
 // threadedRepairLoop improves the health of files tracked by the renter by
 // reuploading their missing pieces. Multiple repair attempts may be necessary
 // before the file reaches full redundancy.
 func (r *Renter) threadedRepairLoop() {
-	// Files are repaired concurrently. A repair worker must acquire a 'token'
-	// in order to run, and returns the token to the pool when it has
-	// finished.
-	tokenPool := make(chan struct{}, repairThreads)
-	// fill the tokenPool with tokens
-	for i := 0; i < repairThreads; i++ {
-		tokenPool <- struct{}{}
-	}
-
 	for {
 		time.Sleep(5 * time.Second)
 
@@ -223,32 +326,98 @@ func (r *Renter) threadedRepairLoop() {
 			continue
 		}
 
-		// make copy of repair set under lock
-		repairing := make(map[string]trackedFile)
-		id := r.mu.RLock()
-		for name, meta := range r.tracking {
-			repairing[name] = meta
+		// Repair the tracked files in batches, in order of priority.
+		queue := r.repairQueue()
+		renewed := make(map[types.FileContractID]types.FileContractID)
+		for len(queue) != 0 {
+			n := repairBatchSize
+			if n > len(queue) {
+				n = len(queue)
+			}
+			r.repairBatch(queue[:n], renewed)
+			queue = queue[n:]
 		}
-		r.mu.RUnlock(id)
+	}
+}
 
-		var wg sync.WaitGroup
-		wg.Add(len(repairing))
-		for name, meta := range repairing {
-			go func(name string, meta trackedFile) {
-				defer wg.Done()
-				t := <-tokenPool                 // acquire token
-				r.threadedRepairFile(name, meta) // repair
-				tokenPool <- t                   // return token
-			}(name, meta)
+// repairBatch prepares a repair job for each file of the batch that needs
+// work, repairs the chunks of every file together, then finishes the jobs.
+// Contracts renewed by the batch are recorded in renewed.
+func (r *Renter) repairBatch(batch []repairingFile, renewed map[types.FileContractID]types.FileContractID) {
+	var jobs []*repairJob
+	for _, rf := range batch {
+		if job := r.prepareRepair(rf.name, rf.meta); job != nil {
+			job.renewed = renewed
+			jobs = append(jobs, job)
 		}
-		// wait for all repairs to complete before looping; otherwise we risk
-		// spawning multiple repair threads for the same file.
-		wg.Wait()
 	}
+	r.repairJobs(jobs, repairThreads)
+	for _, job := range jobs {
+		r.finishRepair(job)
+	}
+}
+
+// A repairingFile is a tracked file that is queued for repair.
+type repairingFile struct {
+	name string
+	meta trackedFile
+}
+
+// repairQueue returns the tracked files, ordered from highest to lowest
+// priority. Files of equal priority are ordered by name. Paused files are
+// included so that their contracts are still renewed.
+func (r *Renter) repairQueue() []repairingFile {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	var queue []repairingFile
+	for name, meta := range r.tracking {
+		queue = append(queue, repairingFile{name, meta})
+	}
+	sort.Sort(byPriority(queue))
+	return queue
+}
+
+// byPriority sorts repairingFiles from highest to lowest priority.
+type byPriority []repairingFile
+
+func (q byPriority) Len() int      { return len(q) }
+func (q byPriority) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q byPriority) Less(i, j int) bool {
+	if q[i].meta.Priority != q[j].meta.Priority {
+		return q[i].meta.Priority > q[j].meta.Priority
+	}
+	return q[i].name < q[j].name
+}
+
+// A repairJob is the repair of a single tracked file. The chunks of the file
+// are repaired one at a time, as the hosts of the pool cannot upload
+// concurrently, and the expiring contracts of the file are renewed once the
+// chunks have been repaired.
+type repairJob struct {
+	name     string
+	meta     trackedFile
+	f        *file
+	height   types.BlockHeight
+	expiring []fileContract
+
+	// renewed maps the contracts renewed by the jobs of a repair pass to
+	// their renewals. Files that share contracts, such as aliases, use the
+	// same renewal rather than renewing the contract again.
+	renewed map[types.FileContractID]types.FileContractID
+
+	handle  *os.File
+	pool    hostdb.HostPool
+	chunks  []uint64            // chunks that remain to be repaired, in order
+	pieces  map[uint64][]uint64 // missing pieces of each chunk
+	workers int
 }
 
-// threadedRepairFile repairs and saves an individual file.
-func (r *Renter) threadedRepairFile(name string, meta trackedFile) {
+// prepareRepair determines the work needed to repair a tracked file, opening
+// the local copy of the file and a host pool if any chunks need repair. A nil
+// job is returned if there is nothing to do, or if the file is already being
+// repaired. Otherwise, a transfer and a repair of the file are in progress
+// until the job is finished.
+func (r *Renter) prepareRepair(name string, meta trackedFile) (job *repairJob) {
 	// helper function
 	logAndRemove := func(fmt string, args ...interface{}) {
 		r.log.Printf(fmt, args...)
@@ -259,88 +428,318 @@ func (r *Renter) threadedRepairFile(name string, meta trackedFile) {
 
 	id := r.mu.RLock()
 	f, ok := r.files[name]
+	current, tracked := r.tracking[name]
+	workers := r.uploadWorkers
+	if ok {
+		f.beginTransfer()
+	}
 	r.mu.RUnlock(id)
 	if !ok {
 		logAndRemove("removing %v from repair set: no longer tracking that file", name)
-		return
+		return nil
 	}
+	defer func() {
+		if job == nil {
+			f.endTransfer()
+		}
+	}()
+
+	// tracking may have been changed since the repair set was copied
+	if !tracked {
+		return nil
+	}
+	meta = current
+
+	// the file may already be being repaired by RepairFile
+	if !f.beginRepair() {
+		return nil
+	}
+	defer func() {
+		if job == nil {
+			f.endRepair()
+		}
+	}()
 
 	// check for expiration
 	height := r.cs.Height()
 	if !meta.Renew && meta.EndHeight < height {
 		logAndRemove("removing %v from repair set: storage period has ended", name)
-		return
+		return nil
 	}
 
-	// determine if there is any work to do
-	incChunks := f.incompleteChunks()
-	offlineChunks := f.offlineChunks(r.hostDB)
-	expContracts := f.expiringContracts(height)
-	if len(incChunks) == 0 && len(offlineChunks) == 0 && (!meta.Renew || len(expContracts) == 0) {
-		return
+	// determine if there is any work to do. Files without a local copy, such
+	// as files uploaded from a stream, cannot be repaired, and the repair of
+	// paused files is skipped, but the contracts of both can still be
+	// renewed. Pieces that are missing and pieces that are stored on offline
+	// hosts are repaired together.
+	pieces := make(map[uint64][]uint64)
+	if meta.RepairPath != "" && !meta.Paused {
+		incChunks := f.incompleteChunks()
+		offlineChunks := f.offlineChunks(r.hostDB)
+		if len(incChunks) != 0 {
+			r.log.Printf("INFO: repairing %v chunks of %v", len(incChunks), f.name)
+		}
+		if len(offlineChunks) != 0 {
+			r.log.Printf("reuploading %v offline chunks of %v", len(offlineChunks), f.name)
+		}
+		for _, chunks := range []map[uint64][]uint64{incChunks, offlineChunks} {
+			for chunk, missing := range chunks {
+				pieces[chunk] = mergePieces(pieces[chunk], missing)
+			}
+		}
+	}
+	var expiring []fileContract
+	if meta.Renew {
+		expiring = f.expiringContracts(height)
+	}
+	if len(pieces) == 0 && len(expiring) == 0 {
+		return nil
+	}
+
+	job = &repairJob{
+		name:     name,
+		meta:     meta,
+		f:        f,
+		height:   height,
+		expiring: expiring,
+		pieces:   pieces,
+		workers:  workers,
+	}
+	if len(pieces) == 0 {
+		return job
 	}
 
 	// open file handle
 	handle, err := os.Open(meta.RepairPath)
 	if err != nil {
 		logAndRemove("removing %v from repair set: %v", name, err)
+		return nil
+	}
+	job.handle = handle
+
+	// create host pool
+	var duration types.BlockHeight
+	if meta.Renew {
+		duration = defaultDuration
+	} else {
+		duration = meta.EndHeight - height
+	}
+	contractSize := (f.chunkPieceSize() + crypto.TwofishOverhead) * uint64(len(pieces)) // each host gets one piece of each chunk
+	job.pool, err = r.newPool(contractSize, duration, meta.Hosts, meta.Diverse)
+	if err != nil {
+		r.log.Printf("failed to repair %v: %v", f.name, err)
+		return job
+	}
+	for chunk := range pieces {
+		job.chunks = append(job.chunks, chunk)
+	}
+	sort.Sort(chunkSlice(job.chunks))
+	return job
+}
+
+// repairNextChunk repairs the next chunk of a repair job. If the chunk cannot
+// be repaired, the remaining chunks of the job are abandoned.
+func (r *Renter) repairNextChunk(job *repairJob) {
+	chunk := job.chunks[0]
+	job.chunks = job.chunks[1:]
+	pieces := job.pieces[chunk]
+
+	// Determine host set. We want one host for each missing piece, and no
+	// repeats of other hosts of this chunk.
+	hosts := job.pool.UniqueHosts(len(pieces), job.f.chunkHosts(chunk))
+	if len(hosts) == 0 {
+		r.log.Printf("aborting repair of %v: not enough hosts", job.f.name)
+		job.chunks = nil
 		return
 	}
-	defer handle.Close()
+	// upload to new hosts
+	err := job.f.repair(chunk, pieces, job.handle, hosts, job.workers)
+	if err != nil {
+		r.log.Printf("aborting repair of %v: %v", job.f.name, err)
+		job.chunks = nil
+	}
+}
 
-	// repair incomplete chunks
-	if len(incChunks) != 0 {
-		r.log.Printf("repairing %v chunks of %v", len(incChunks), f.name)
-		var duration types.BlockHeight
-		if meta.Renew {
-			duration = defaultDuration
-		} else {
-			duration = meta.EndHeight - height
+// repairJobs repairs the chunks of each job, repairing up to 'threads' chunks
+// at a time. Each job has at most one chunk in progress, so chunks of
+// different files are repaired concurrently. A thread is released each time a
+// chunk is repaired, and the next chunk is taken from the highest-priority job
+// that is waiting. Jobs of equal priority take turns, so that a large file
+// does not hold up the repair of the files queued behind it.
+func (r *Renter) repairJobs(jobs []*repairJob, threads int) {
+	var waiting []*repairJob
+	for _, job := range jobs {
+		if len(job.chunks) != 0 {
+			waiting = append(waiting, job)
 		}
-		r.repairChunks(f, handle, incChunks, duration)
 	}
 
-	// repair offline chunks
-	if len(offlineChunks) != 0 {
-		r.log.Printf("reuploading %v offline chunks of %v", len(offlineChunks), f.name)
-		var duration types.BlockHeight
-		if meta.Renew {
-			duration = defaultDuration
-		} else {
-			duration = meta.EndHeight - height
+	done := make(chan *repairJob)
+	var active int
+	for len(waiting) != 0 || active != 0 {
+		for active < threads && len(waiting) != 0 {
+			job := waiting[0]
+			waiting = waiting[1:]
+			active++
+			go func() {
+				r.repairNextChunk(job)
+				done <- job
+			}()
+		}
+
+		// Requeue the job behind the waiting jobs of the same or higher
+		// priority.
+		job := <-done
+		active--
+		if len(job.chunks) == 0 {
+			continue
 		}
-		r.repairChunks(f, handle, offlineChunks, duration)
+		i := sort.Search(len(waiting), func(i int) bool {
+			return waiting[i].meta.Priority < job.meta.Priority
+		})
+		waiting = append(waiting, nil)
+		copy(waiting[i+1:], waiting[i:])
+		waiting[i] = job
+	}
+}
+
+// finishRepair renews the expiring contracts of a repair job, releases the
+// resources of the job, and saves the repaired file.
+func (r *Renter) finishRepair(job *repairJob) {
+	if job.pool != nil {
+		job.pool.Close()
+	}
+	if job.handle != nil {
+		job.handle.Close()
 	}
 
 	// renew expiring contracts
-	if meta.Renew && len(expContracts) != 0 {
-		r.log.Printf("renewing %v contracts of %v", len(expContracts), f.name)
-		newHeight := height + defaultDuration
-		r.renewContracts(f, expContracts, newHeight)
+	if len(job.expiring) != 0 {
+		r.log.Printf("renewing %v contracts of %v", len(job.expiring), job.f.name)
+		newHeight := job.height + defaultDuration
+		r.renewContracts(job.f, job.expiring, newHeight, job.renewed)
+	}
+
+	// save the repaired file data, unless the file was replaced during the
+	// repair, e.g. by a key rotation or a change of redundancy. The renter
+	// lock is held so that the file cannot be replaced while it is saved.
+	lockID := r.mu.RLock()
+	if r.files[job.name] == job.f {
+		job.f.mu.RLock()
+		err := r.saveFile(job.f)
+		job.f.mu.RUnlock()
+		if err != nil {
+			// definitely bad, but we probably shouldn't delete from the
+			// repair set if this happens
+			r.log.Printf("failed to save repaired file %v: %v", job.name, err)
+		}
 	}
+	r.mu.RUnlock(lockID)
+	job.f.endRepair()
+	job.f.endTransfer()
+}
+
+// mergePieces returns the union of two lists of piece indices.
+func mergePieces(a, b []uint64) []uint64 {
+	merged := append([]uint64(nil), a...)
+	for _, p := range b {
+		found := false
+		for _, q := range a {
+			if p == q {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// chunkSlice sorts chunk indices in ascending order.
+type chunkSlice []uint64
+
+func (s chunkSlice) Len() int           { return len(s) }
+func (s chunkSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s chunkSlice) Less(i, j int) bool { return s[i] < s[j] }
+
+// RepairFile immediately uploads every piece of a tracked file that is missing
+// or stored on an offline host, instead of waiting for the repair loop.
+// RepairFile returns once the file has been restored to full redundancy, or
+// returns errRepairIncomplete if not enough hosts could be found. If the repair
+// loop is already repairing the file, errRepairInProgress is returned.
+func (r *Renter) RepairFile(nickname string) error {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	meta, tracked := r.tracking[nickname]
+	if exists {
+		f.beginTransfer()
+	}
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return ErrUnknownPath
+	}
+	defer f.endTransfer()
+	if !tracked || meta.RepairPath == "" {
+		return ErrNoRepairSource
+	}
+	if !f.beginRepair() {
+		return errRepairInProgress
+	}
+	defer f.endRepair()
+
+	chunks := f.unhealthyChunks(r.hostDB)
+	if len(chunks) == 0 {
+		return nil
+	}
+	handle, err := os.Open(meta.RepairPath)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	var duration types.BlockHeight
+	if meta.Renew {
+		duration = defaultDuration
+	} else {
+		height := r.cs.Height()
+		if meta.EndHeight < height {
+			return errors.New("storage period of the file has ended")
+		}
+		duration = meta.EndHeight - height
+	}
+	r.log.Printf("repairing %v chunks of %v", len(chunks), f.name)
+	r.repairChunks(f, handle, chunks, duration, meta.Hosts, meta.Diverse)
 
-	// save the repaired file data
 	f.mu.RLock()
 	err = r.saveFile(f)
 	f.mu.RUnlock()
 	if err != nil {
-		// definitely bad, but we probably shouldn't delete from the
-		// repair set if this happens
-		r.log.Printf("failed to save repaired file %v: %v", name, err)
+		return err
+	}
+	if len(f.unhealthyChunks(r.hostDB)) != 0 {
+		return errRepairIncomplete
 	}
+	return nil
 }
 
-// repairChunks uploads missing chunks of f to new hosts.
-func (r *Renter) repairChunks(f *file, handle io.ReaderAt, chunks map[uint64][]uint64, duration types.BlockHeight) {
+// repairChunks uploads missing chunks of f to new hosts. If pinned is
+// non-empty, only the specified hosts are used. If diverse is set, the pieces
+// of each chunk are placed in distinct subnets where possible.
+func (r *Renter) repairChunks(f *file, handle io.ReaderAt, chunks map[uint64][]uint64, duration types.BlockHeight, pinned []modules.NetAddress, diverse bool) {
 	// create host pool
-	contractSize := (f.pieceSize + crypto.TwofishOverhead) * uint64(len(chunks)) // each host gets one piece of each chunk
-	pool, err := r.hostDB.NewPool(contractSize, duration)
+	contractSize := (f.chunkPieceSize() + crypto.TwofishOverhead) * uint64(len(chunks)) // each host gets one piece of each chunk
+	pool, err := r.newPool(contractSize, duration, pinned, diverse)
 	if err != nil {
 		r.log.Printf("failed to repair %v: %v", f.name, err)
 		return
 	}
 	defer pool.Close() // heh
 
+	lockID := r.mu.RLock()
+	workers := r.uploadWorkers
+	r.mu.RUnlock(lockID)
 	for chunk, pieces := range chunks {
 		// Determine host set. We want one host for each missing piece, and no
 		// repeats of other hosts of this chunk.
@@ -350,7 +749,7 @@ func (r *Renter) repairChunks(f *file, handle io.ReaderAt, chunks map[uint64][]u
 			return
 		}
 		// upload to new hosts
-		err = f.repair(chunk, pieces, handle, hosts)
+		err = f.repair(chunk, pieces, handle, hosts, workers)
 		if err != nil {
 			r.log.Printf("aborting repair of %v: %v", f.name, err)
 			return
@@ -359,13 +758,22 @@ func (r *Renter) repairChunks(f *file, handle io.ReaderAt, chunks map[uint64][]u
 }
 
 // renewContracts renews each of the supplied contracts, replacing their entry
-// in f with the new contract.
-func (r *Renter) renewContracts(f *file, contracts []fileContract, newHeight types.BlockHeight) {
+// in f with the new contract. Contracts found in renewed have already been
+// renewed, and are replaced by their renewal. If renewed is not nil, the new
+// renewals are added to it.
+func (r *Renter) renewContracts(f *file, contracts []fileContract, newHeight types.BlockHeight, renewed map[types.FileContractID]types.FileContractID) {
 	for _, c := range contracts {
-		newID, err := r.hostDB.Renew(c.ID, newHeight)
-		if err != nil {
-			r.log.Printf("failed to renew contract %v: %v", c.ID, err)
-			continue
+		newID, ok := renewed[c.ID]
+		if !ok {
+			var err error
+			newID, err = r.hostDB.Renew(c.ID, newHeight)
+			if err != nil {
+				r.log.Printf("failed to renew contract %v: %v", c.ID, err)
+				continue
+			}
+			if renewed != nil {
+				renewed[c.ID] = newID
+			}
 		}
 		f.mu.Lock()
 		f.contracts[newID] = fileContract{
@@ -380,3 +788,122 @@ func (r *Renter) renewContracts(f *file, contracts []fileContract, newHeight typ
 		f.mu.Unlock()
 	}
 }
+
+// SetFileRedundancy changes the number of pieces that each chunk of a file is
+// erasure-coded into, keeping the minimum number of pieces needed to recover
+// the chunk. Raising the number of pieces downloads enough pieces of each
+// chunk to recover it, re-encodes the chunk, and uploads the additional
+// pieces to new hosts; the original data is not needed. Lowering the number
+// of pieces forgets the pieces beyond the new number. If not every additional
+// piece could be uploaded, the new erasure code is kept and
+// errRepairIncomplete is returned.
+func (r *Renter) SetFileRedundancy(nickname string, newNumPieces int) error {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return ErrUnknownPath
+	}
+
+	// The pieces of a Reed-Solomon code do not depend on the number of parity
+	// pieces, so the existing pieces remain valid under the new code.
+	if _, ok := f.erasureCode.(*rsCode); !ok {
+		return errNotResizable
+	}
+	minPieces := f.erasureCode.MinPieces()
+	if newNumPieces <= minPieces {
+		return ErrBadErasureCode
+	}
+	if newNumPieces == f.erasureCode.NumPieces() {
+		return nil
+	}
+	code, err := NewRSCode(minPieces, newNumPieces-minPieces)
+	if err != nil {
+		return err
+	}
+	if newNumPieces < f.erasureCode.NumPieces() {
+		return r.managedSetFileRedundancy(f, code, nil)
+	}
+
+	cf, hfs, err := r.connectHosts(nickname)
+	if err != nil {
+		return err
+	}
+	defer cf.endTransfer()
+	hosts := make([]fetcher, len(hfs))
+	for i, hf := range hfs {
+		defer hf.Close()
+		hosts[i] = hf
+	}
+	return r.managedSetFileRedundancy(f, code, hosts)
+}
+
+// managedSetFileRedundancy replaces f with a copy of f that is erasure-coded
+// with code. Any pieces that the copy is missing are recovered from the
+// provided hosts and uploaded to new hosts.
+func (r *Renter) managedSetFileRedundancy(f *file, code modules.ErasureCoder, hosts []fetcher) error {
+	resized := f.resize(code)
+	var missing []uint64
+	for i := f.erasureCode.NumPieces(); i < code.NumPieces(); i++ {
+		missing = append(missing, uint64(i))
+	}
+
+	if len(missing) != 0 && !f.empty() {
+		meta, duration, err := r.remainingDuration(f)
+		if err != nil {
+			return err
+		}
+		contractSize := (f.chunkPieceSize() + crypto.TwofishOverhead) * f.numChunks() // each host gets one piece of each chunk
+		pool, err := r.newPool(contractSize, duration, meta.Hosts, meta.Diverse)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		lockID := r.mu.RLock()
+		workers := r.uploadWorkers
+		r.mu.RUnlock(lockID)
+		d := f.newDownload(hosts, "")
+		chunk := new(bytes.Buffer)
+		for i := uint64(0); i < f.numChunks(); i++ {
+			pieces, err := d.getChunk(i)
+			if err != nil {
+				return err
+			}
+			chunk.Reset()
+			err = f.erasureCode.Recover(pieces, f.chunkSize(), chunk)
+			if err != nil {
+				return err
+			}
+			uploaders := pool.UniqueHosts(len(missing), resized.chunkHosts(i))
+			if len(uploaders) == 0 {
+				break
+			}
+			err = resized.uploadChunk(i, chunk.Bytes(), missing, uploaders, workers)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Replace the file, unless it was changed in the meantime.
+	lockID := r.mu.Lock()
+	if r.files[resized.name] != f {
+		r.mu.Unlock(lockID)
+		return errors.New("file was renamed or deleted while its redundancy was being changed")
+	}
+	r.files[resized.name] = resized
+	r.mu.Unlock(lockID)
+	r.log.Printf("changed the erasure code of %v to %v pieces", resized.name, code.NumPieces())
+
+	resized.mu.RLock()
+	err := r.saveFile(resized)
+	resized.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if len(resized.incompleteChunks()) != 0 {
+		return errRepairIncomplete
+	}
+	return nil
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"crypto/rand"
 	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
@@ -91,10 +96,13 @@ func TestRepair(t *testing.T) {
 	hosts[1].(*testHost).failRate = 1
 
 	// upload data to hosts
-	f := newFile("foo", rsc, pieceSize, dataSize)
+	f, err := newFile("foo", rsc, pieceSize, dataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
 	r := bytes.NewReader(data)
 	for chunk, pieces := range f.incompleteChunks() {
-		err = f.repair(chunk, pieces, r, hosts)
+		err = f.repair(chunk, pieces, r, hosts, defaultUploadWorkers)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -176,7 +184,7 @@ func (hdb offlineHostDB) AveragePrice() types.Currency {
 }
 
 // NewPool is a stub implementation of the NewPool method.
-func (hdb offlineHostDB) NewPool(uint64, types.BlockHeight) (hostdb.HostPool, error) {
+func (hdb offlineHostDB) NewPool(uint64, types.BlockHeight, []modules.NetAddress, bool) (hostdb.HostPool, error) {
 	return nil, nil
 }
 
@@ -185,6 +193,35 @@ func (hdb offlineHostDB) Renew(types.FileContractID, types.BlockHeight) (types.F
 	return types.FileContractID{}, nil
 }
 
+// Contracts is a stub implementation of the Contracts method.
+func (hdb offlineHostDB) Contracts() []modules.RenterContract {
+	return nil
+}
+
+// RecordDownload is a stub implementation of the RecordDownload method.
+func (hdb offlineHostDB) RecordDownload(types.FileContractID, uint64) {}
+
+// PayDownload is a stub implementation of the PayDownload method.
+func (hdb offlineHostDB) PayDownload(net.Conn, types.FileContractID, types.Currency, uint64) error {
+	return nil
+}
+
+// DialHost is a stub implementation of the DialHost method.
+func (hdb offlineHostDB) DialHost(modules.NetAddress) (net.Conn, error) {
+	return nil, errors.New("host is offline")
+}
+
+// ScanQueueDepth is a stub implementation of the ScanQueueDepth method.
+func (hdb offlineHostDB) ScanQueueDepth() int { return 0 }
+
+// SetSpeedLimits is a stub implementation of the SetSpeedLimits method.
+func (hdb offlineHostDB) SetSpeedLimits(up, down int64) {}
+
+// SpendingReport is a stub implementation of the SpendingReport method.
+func (hdb offlineHostDB) SpendingReport(types.BlockHeight) modules.SpendingSummary {
+	return modules.SpendingSummary{}
+}
+
 // TestOfflineChunks tests the offlineChunks method of the file type.
 func TestOfflineChunks(t *testing.T) {
 	// Create a mock hostdb.
@@ -216,3 +253,502 @@ func TestOfflineChunks(t *testing.T) {
 		}
 	}
 }
+
+// TestRepairFile drops pieces from a file, and checks that RepairFile
+// restores the file to full redundancy.
+func TestRepairFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRepairFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.hostDB = &uploadHostDB{}
+
+	// Create a tracked file with a local copy.
+	data, err := crypto.RandBytes(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(rt.renter.persistDir, "foo.dat")
+	err = ioutil.WriteFile(source, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(2, 2)
+	f, err := newFile("foo", rsc, 64, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{RepairPath: source, Renew: true}
+
+	// Repairing an unknown file should fail.
+	err = rt.renter.RepairFile("dne")
+	if err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Upload the file and check that it is at full redundancy.
+	err = rt.renter.RepairFile(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.unhealthyChunks(rt.renter.hostDB)) != 0 {
+		t.Fatal("file is not at full redundancy after being uploaded")
+	}
+
+	// Drop half of the pieces of the file.
+	for id, fc := range f.contracts {
+		fc.Pieces = fc.Pieces[:len(fc.Pieces)/2]
+		f.contracts[id] = fc
+	}
+	if len(f.unhealthyChunks(rt.renter.hostDB)) == 0 {
+		t.Fatal("file is still at full redundancy after dropping pieces")
+	}
+
+	// A file that is already being repaired is not repaired again.
+	f.beginRepair()
+	err = rt.renter.RepairFile(f.name)
+	f.endRepair()
+	if err != errRepairInProgress {
+		t.Fatal("expected errRepairInProgress, got", err)
+	}
+	if job := rt.renter.prepareRepair(f.name, rt.renter.tracking[f.name]); job == nil {
+		t.Fatal("repair loop did not prepare a repair of the file")
+	} else if err := rt.renter.RepairFile(f.name); err != errRepairInProgress {
+		t.Fatal("expected errRepairInProgress during a prepared repair, got", err)
+	} else {
+		rt.renter.finishRepair(job)
+	}
+
+	// Without any hosts, the file cannot be repaired.
+	rt.renter.hostDB = &streamHostDB{}
+	err = rt.renter.RepairFile(f.name)
+	if err != errRepairIncomplete {
+		t.Fatal("expected errRepairIncomplete, got", err)
+	}
+
+	// With hosts available, the file should be restored.
+	rt.renter.hostDB = &uploadHostDB{}
+	err = rt.renter.RepairFile(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.unhealthyChunks(rt.renter.hostDB)) != 0 || len(f.incompleteChunks()) != 0 {
+		t.Fatal("RepairFile did not restore the file to full redundancy")
+	}
+}
+
+// TestRepairPriority checks that tracked files are queued for repair in order
+// of priority, and that the priority of a file persists.
+func TestRepairPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRepairPriority")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create two degraded files, neither of which has been uploaded.
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"a", "b"} {
+		f, err := newFile(name, rsc, 10, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.renter.files[name] = f
+		rt.renter.tracking[name] = trackedFile{RepairPath: name, EndHeight: 1000}
+	}
+	err = rt.renter.SetFilePriority("dne", 1)
+	if err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Without priorities, files are repaired in order of name.
+	queue := rt.renter.repairQueue()
+	if len(queue) != 2 || queue[0].name != "a" || queue[1].name != "b" {
+		t.Fatal("wrong repair order:", queue)
+	}
+
+	// A higher-priority file is repaired first.
+	err = rt.renter.SetFilePriority("b", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue = rt.renter.repairQueue()
+	if len(queue) != 2 || queue[0].name != "b" || queue[1].name != "a" {
+		t.Fatal("higher-priority file was not repaired first:", queue)
+	}
+
+	// Reload the renter from disk; the priority should persist.
+	rt.renter.tracking = make(map[string]trackedFile)
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if rt.renter.tracking["b"].Priority != 5 {
+		t.Fatal("priority was not persisted:", rt.renter.tracking["b"].Priority)
+	}
+}
+
+// TestRepairPausedFile checks that the chunks of a paused file are not
+// repaired, while its expiring contracts are still renewed.
+func TestRepairPausedFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRepairPausedFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a degraded file with an expiring contract.
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("foo", rsc, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.contracts[types.FileContractID{1}] = fileContract{ID: types.FileContractID{1}, WindowStart: renewThreshold}
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{RepairPath: "foo", Renew: true, Paused: true}
+
+	queue := rt.renter.repairQueue()
+	if len(queue) != 1 {
+		t.Fatal("paused file was not queued:", queue)
+	}
+	job := rt.renter.prepareRepair(queue[0].name, queue[0].meta)
+	if job == nil {
+		t.Fatal("expiring contracts of a paused file were not renewed")
+	}
+	defer f.endTransfer()
+	if len(job.pieces) != 0 || job.pool != nil || job.handle != nil {
+		t.Error("chunks of a paused file were queued for repair")
+	}
+	if len(job.expiring) != 1 {
+		t.Error("expected 1 expiring contract, got", len(job.expiring))
+	}
+}
+
+// renewHostDB is a mocked hostDB that counts the contracts it renews.
+type renewHostDB struct {
+	uploadHostDB
+	renewals int
+}
+
+// Renew returns a new contract ID for each renewal.
+func (hdb *renewHostDB) Renew(types.FileContractID, types.BlockHeight) (types.FileContractID, error) {
+	hdb.renewals++
+	return types.FileContractID{byte(hdb.renewals)}, nil
+}
+
+// TestRenewSharedContracts renews the contracts of a file and of its alias in
+// the same pass, and checks that the shared contract is renewed only once.
+func TestRenewSharedContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenewSharedContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	hdb := new(renewHostDB)
+	rt.renter.hostDB = hdb
+
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("foo", rsc, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID := types.FileContractID{100}
+	f.contracts[oldID] = fileContract{ID: oldID, Pieces: []pieceData{{}}, WindowStart: renewThreshold}
+	alias := f.alias("bar")
+
+	renewed := make(map[types.FileContractID]types.FileContractID)
+	rt.renter.renewContracts(f, f.expiringContracts(renewThreshold), 100, renewed)
+	rt.renter.renewContracts(alias, alias.expiringContracts(renewThreshold), 100, renewed)
+	if hdb.renewals != 1 {
+		t.Fatal("expected the shared contract to be renewed once, got", hdb.renewals)
+	}
+	newID := renewed[oldID]
+	for _, file := range []*file{f, alias} {
+		if _, ok := file.contracts[newID]; !ok || len(file.contracts) != 1 {
+			t.Error("file does not refer to the renewed contract:", file.contracts)
+		}
+	}
+}
+
+// orderedHostDB is a mocked hostDB, hostdb.HostPool, and hostdb.Uploader that
+// records the size of each uploaded piece, in the order of the uploads.
+type orderedHostDB struct {
+	uploadHostDB
+	uploads []int
+	mu      sync.Mutex
+}
+
+// NewPool returns the orderedHostDB itself.
+func (hdb *orderedHostDB) NewPool(uint64, types.BlockHeight, []modules.NetAddress, bool) (hostdb.HostPool, error) {
+	return hdb, nil
+}
+
+// UniqueHosts returns n copies of the orderedHostDB.
+func (hdb *orderedHostDB) UniqueHosts(n int, _ []modules.NetAddress) (ups []hostdb.Uploader) {
+	for i := 0; i < n; i++ {
+		ups = append(ups, hdb)
+	}
+	return
+}
+
+// Upload records the size of the uploaded piece.
+func (hdb *orderedHostDB) Upload(data []byte) (uint64, error) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.uploads = append(hdb.uploads, len(data))
+	return 0, nil
+}
+
+// TestRepairInterleaving repairs a large file and a small file with a single
+// repair thread, and checks that the chunks of the small file are repaired in
+// turn with the chunks of the large file, rather than after them.
+func TestRepairInterleaving(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRepairInterleaving")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	hdb := new(orderedHostDB)
+	rt.renter.hostDB = hdb
+
+	// Create two degraded files, neither of which has been uploaded. The
+	// files use different piece sizes, so that their uploads can be told
+	// apart.
+	dir := build.TempDir("renter", "TestRepairInterleaving")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	const largeChunks, smallChunks = 20, 2
+	const largePieceSize, smallPieceSize = 64, 32
+	for _, file := range []struct {
+		name      string
+		pieceSize uint64
+		numChunks uint64
+	}{
+		{"large", largePieceSize, largeChunks},
+		{"small", smallPieceSize, smallChunks},
+	} {
+		data := make([]byte, file.pieceSize*file.numChunks)
+		rand.Read(data)
+		path := filepath.Join(dir, file.name)
+		err = ioutil.WriteFile(path, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := newFile(file.name, rsc, file.pieceSize, uint64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.renter.files[f.name] = f
+		rt.renter.tracking[f.name] = trackedFile{RepairPath: path, EndHeight: 1000}
+	}
+
+	// Repair both files using a single thread.
+	var jobs []*repairJob
+	for _, rf := range rt.renter.repairQueue() {
+		job := rt.renter.prepareRepair(rf.name, rf.meta)
+		if job == nil {
+			t.Fatal("no repair needed for", rf.name)
+		}
+		jobs = append(jobs, job)
+	}
+	rt.renter.repairJobs(jobs, 1)
+	for _, job := range jobs {
+		rt.renter.finishRepair(job)
+		if len(job.f.incompleteChunks()) != 0 {
+			t.Fatal(job.name, "was not fully repaired")
+		}
+	}
+
+	// The small file should have finished while most of the large file was
+	// still waiting to be repaired.
+	lastSmall := -1
+	for i, size := range hdb.uploads {
+		if size == smallPieceSize+crypto.TwofishOverhead {
+			lastSmall = i
+		}
+	}
+	var largeAfter int
+	for _, size := range hdb.uploads[lastSmall+1:] {
+		if size == largePieceSize+crypto.TwofishOverhead {
+			largeAfter++
+		}
+	}
+	if expected := (largeChunks - smallChunks) * rsc.NumPieces(); largeAfter != expected {
+		t.Fatalf("expected %v pieces of the large file to be repaired after the small file, got %v", expected, largeAfter)
+	}
+}
+
+// TestSetFileRedundancy raises the redundancy of a file, checking that the
+// additional pieces are uploaded to new hosts and can be used to recover the
+// file, and then lowers it again.
+func TestSetFileRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestSetFileRedundancy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, err := NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHosts := new(streamHostDB)
+	newHosts := new(streamHostDB)
+	for i := 0; i < 6; i++ {
+		h := &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		}
+		if i < rsc.NumPieces() {
+			oldHosts.hosts = append(oldHosts.hosts, h)
+		} else {
+			newHosts.hosts = append(newHosts.hosts, h)
+		}
+	}
+	rt.renter.hostDB = oldHosts
+
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+
+	// Raise the number of pieces from 4 to 6, uploading the new pieces to the
+	// new hosts.
+	fetchers, err := decryptedFetchers(f, oldHosts.hosts, f.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.hostDB = newHosts
+	err = rt.renter.managedSetFileRedundancy(f, code, fetchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = rt.renter.mu.RLock()
+	resized := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if resized.erasureCode.NumPieces() != 6 || resized.erasureCode.MinPieces() != 2 {
+		t.Fatal("erasure code was not updated:", resized.erasureCode.NumPieces(), resized.erasureCode.MinPieces())
+	}
+	if len(resized.incompleteChunks()) != 0 {
+		t.Fatal("not every piece of the new erasure code was uploaded")
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].Redundancy != 3 {
+		t.Fatal("expected a redundancy of 3, got", files)
+	}
+
+	// The new pieces alone are enough to recover the file.
+	fetchers, err = decryptedFetchers(resized, newHosts.hosts, resized.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = resized.newDownload(fetchers, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("data recovered from the new pieces does not match the original")
+	}
+
+	// Lower the number of pieces to 3, which drops the pieces beyond it.
+	err = rt.renter.SetFileRedundancy("foo", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = rt.renter.mu.RLock()
+	resized = rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if resized.erasureCode.NumPieces() != 3 {
+		t.Fatal("expected 3 pieces, got", resized.erasureCode.NumPieces())
+	}
+	for _, fc := range resized.contracts {
+		for _, p := range fc.Pieces {
+			if p.Piece >= 3 {
+				t.Fatal("file still references a dropped piece:", p)
+			}
+		}
+	}
+
+	// The number of pieces must stay above the minimum.
+	err = rt.renter.SetFileRedundancy("foo", 2)
+	if err != ErrBadErasureCode {
+		t.Fatal("expected ErrBadErasureCode, got", err)
+	}
+	err = rt.renter.SetFileRedundancy("bar", 6)
+	if err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+}
+
+// TestRepairReplacedFile checks that a repair does not save a file that was
+// replaced while it was being repaired, which would overwrite the .sia file of
+// the replacement.
+func TestRepairReplacedFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRepairReplacedFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	f.name = "foo"
+	f.beginTransfer()
+	job := &repairJob{name: f.name, f: f}
+
+	// Replace the file before the repair is finished.
+	replacement := newTestingFile()
+	replacement.name = f.name
+	lockID := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = replacement
+	rt.renter.mu.Unlock(lockID)
+
+	rt.renter.finishRepair(job)
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, f.name+ShareExtension)); !os.IsNotExist(err) {
+		t.Fatal("the replaced file was saved:", err)
+	}
+	if f.transfers != 0 {
+		t.Fatal("the transfer of the replaced file did not end")
+	}
+}
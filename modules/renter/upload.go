@@ -2,12 +2,15 @@ package renter
 
 import (
 	"errors"
+	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -18,6 +21,15 @@ const (
 	// property, revisions break the file's Merkle root.
 	defaultPieceSize = 1<<22 - crypto.TwofishOverhead // 4 MiB
 	smallPieceSize   = 1<<16 - crypto.TwofishOverhead // 64 KiB
+
+	// defaultUploadWorkers is the default number of pieces of a chunk that
+	// are uploaded concurrently.
+	defaultUploadWorkers = 10
+
+	// estimatePercentile is the percentile of active host prices used when
+	// estimating the cost of an upload. Hosts are selected at random, so the
+	// estimate is based on a price above the median to avoid underestimating.
+	estimatePercentile = 75
 )
 
 var (
@@ -52,19 +64,26 @@ var (
 	}()
 )
 
-// checkWalletBalance looks at an upload and determines if there is enough
-// money in the wallet to support such an upload. An error is returned if it is
-// determined that there is not enough money.
-func (r *Renter) checkWalletBalance(up modules.FileUploadParams) error {
+var (
+	errIncompleteUpload  = errors.New("couldn't upload enough pieces to recover the file")
+	errTooFewActiveHosts = errors.New("not enough active hosts to upload; wait for more hosts to be found or lower the minimum")
+	errShortStream       = errors.New("stream ended before the full file was read")
+	errNoParityHosts     = errors.New("redundancy cannot be reduced without a host for a parity piece; at least one more host than the minimum number of pieces is needed")
+	errStorageEnded      = errors.New("storage period of the file has ended")
+	errRotationConflict  = errors.New("file was renamed or deleted while its key was being rotated")
+
+	errPinnedHostUnavailable = errors.New("pinned host is not an active host")
+	errPinnedHostUnsupported = errors.New("pinned host speaks an unsupported protocol version")
+)
+
+// checkWalletBalance looks at an upload of 'size' bytes and determines if
+// there is enough money in the wallet to support such an upload. An error is
+// returned if it is determined that there is not enough money.
+func (r *Renter) checkWalletBalance(up modules.FileUploadParams, size uint64) error {
 	if !r.wallet.Unlocked() {
 		return errors.New("wallet is locked")
 	}
-	// Get the size of the file.
-	fileInfo, err := os.Stat(up.Source)
-	if err != nil {
-		return err
-	}
-	curSize := types.NewCurrency64(uint64(fileInfo.Size()))
+	curSize := types.NewCurrency64(size)
 
 	averagePrice := r.hostDB.AveragePrice()
 	estimatedCost := averagePrice.Mul(types.NewCurrency64(uint64(up.Duration))).Mul(curSize)
@@ -77,6 +96,176 @@ func (r *Renter) checkWalletBalance(up modules.FileUploadParams) error {
 	return nil
 }
 
+// pricePercentile returns the price at percentile p of the provided hosts. The
+// zero price is returned if no hosts are provided.
+func pricePercentile(hosts []modules.HostSettings, p int) types.Currency {
+	if len(hosts) == 0 {
+		return types.ZeroCurrency
+	}
+	prices := make([]types.Currency, len(hosts))
+	for i, h := range hosts {
+		prices[i] = h.Price
+	}
+	sort.Sort(currencySlice(prices))
+	return prices[(len(prices)-1)*p/100]
+}
+
+// currencySlice implements sort.Interface for a slice of currencies.
+type currencySlice []types.Currency
+
+func (cs currencySlice) Len() int           { return len(cs) }
+func (cs currencySlice) Less(i, j int) bool { return cs[i].Cmp(cs[j]) < 0 }
+func (cs currencySlice) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+
+// EstimateUploadCost estimates the amount that will be paid to hosts to store
+// a file of 'size' bytes for 'duration' blocks. The estimate accounts for the
+// redundancy and padding of the erasure code and the encryption overhead of
+// each piece, and prices the storage at the estimatePercentile of the prices
+// of the active hosts. Missing upload params are filled with the defaults used
+// by Upload. If duration is zero, the duration of the upload params is used.
+// An error is returned if the erasure code or chunk size of the upload params
+// is invalid.
+func (r *Renter) EstimateUploadCost(size uint64, up modules.FileUploadParams, duration types.BlockHeight) (types.Currency, error) {
+	if duration != 0 {
+		up.Duration = duration
+	}
+	fillUploadDefaults(&up, size)
+
+	// Each piece of each chunk is stored, encrypted, on a separate host.
+	f, err := newFile("", up.ErasureCode, up.PieceSize, size)
+	if err != nil {
+		return types.ZeroCurrency, err
+	}
+	if err := f.setChunkSize(up.ChunkSize); err != nil {
+		return types.ZeroCurrency, err
+	}
+	storedBytes := (f.chunkPieceSize() + crypto.TwofishOverhead) * f.numChunks() * uint64(f.erasureCode.NumPieces())
+
+	price := pricePercentile(r.hostDB.ActiveHosts(), estimatePercentile)
+	return price.Mul(types.NewCurrency64(storedBytes)).Mul(types.NewCurrency64(uint64(up.Duration))), nil
+}
+
+// checkActiveHosts returns an error if the hostdb knows about fewer active
+// hosts than the minimum set by SetMinimumHosts.
+func (r *Renter) checkActiveHosts() error {
+	lockID := r.mu.RLock()
+	minHosts := r.minHosts
+	r.mu.RUnlock(lockID)
+	if len(r.hostDB.ActiveHosts()) < minHosts {
+		return errTooFewActiveHosts
+	}
+	return nil
+}
+
+// checkPinnedHosts returns an error if any of the hosts that an upload is
+// pinned to is not an active host, so that the upload is refused when it is
+// submitted rather than failing once it starts.
+func (r *Renter) checkPinnedHosts(hosts []modules.NetAddress) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	active := make(map[modules.NetAddress]struct{})
+	for _, host := range r.hostDB.ActiveHosts() {
+		active[host.NetAddress] = struct{}{}
+	}
+	known := make(map[modules.NetAddress]modules.HostSettings)
+	for _, host := range r.hostDB.AllHosts() {
+		known[host.NetAddress] = host
+	}
+	for _, addr := range hosts {
+		if _, exists := active[addr]; exists {
+			continue
+		}
+		if host, exists := known[addr]; exists && !modules.SupportedProtocol(host.ProtocolVersion) {
+			return errPinnedHostUnsupported
+		}
+		return errPinnedHostUnavailable
+	}
+	return nil
+}
+
+// newPool returns a new HostPool from the hostdb, provided that the hostdb
+// knows about enough active hosts. If hosts is non-empty, the pool only forms
+// contracts with the specified hosts. If diverse is set, the pool places the
+// pieces of a chunk on hosts in distinct subnets where possible.
+func (r *Renter) newPool(filesize uint64, duration types.BlockHeight, hosts []modules.NetAddress, diverse bool) (hostdb.HostPool, error) {
+	err := r.checkActiveHosts()
+	if err != nil {
+		return nil, err
+	}
+	return r.hostDB.NewPool(filesize, duration, hosts, diverse)
+}
+
+// fillUploadDefaults fills in any missing upload params with sensible
+// defaults for a file of the provided size.
+func fillUploadDefaults(up *modules.FileUploadParams, size uint64) {
+	if up.Duration == 0 {
+		up.Duration = defaultDuration
+	}
+	if up.ErasureCode == nil {
+		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
+	}
+	if up.PieceSize == 0 {
+		if size > defaultPieceSize {
+			up.PieceSize = defaultPieceSize
+		} else {
+			up.PieceSize = smallPieceSize
+		}
+	}
+}
+
+// reduceRedundancy replaces the erasure code of up with a Reed-Solomon code
+// that has one piece per available host, if up.ReduceRedundancy is set and
+// fewer hosts are available than the code has pieces. The minimum number of
+// pieces is kept, along with at least one parity piece, so at least one more
+// host than the minimum number of pieces must be available. reduceRedundancy
+// reports whether the erasure code was replaced, so that the reduction can be
+// reported with the file.
+func (r *Renter) reduceRedundancy(name string, up *modules.FileUploadParams) (bool, error) {
+	if !up.ReduceRedundancy {
+		return false, nil
+	}
+	available := len(up.Hosts)
+	if available == 0 {
+		available = len(r.hostDB.ActiveHosts())
+	}
+	minPieces, numPieces := up.ErasureCode.MinPieces(), up.ErasureCode.NumPieces()
+	if available >= numPieces {
+		return false, nil
+	}
+	if available < minPieces {
+		return false, errTooFewActiveHosts
+	}
+	if available == minPieces {
+		return false, errNoParityHosts
+	}
+	code, err := NewRSCode(minPieces, available-minPieces)
+	if err != nil {
+		return false, err
+	}
+	r.log.Printf("WARN: only %v hosts are available; reducing the redundancy of %v from %v to %v pieces", available, name, numPieces, code.NumPieces())
+	up.ErasureCode = code
+	return true, nil
+}
+
+// hashFile returns the hash of the file at path.
+func hashFile(path string) (crypto.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	defer file.Close()
+
+	h := crypto.NewHash()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	var hash crypto.Hash
+	copy(hash[:], h.Sum(nil))
+	return hash, nil
+}
+
 // Upload instructs the renter to start tracking a file. The renter will
 // automatically upload and repair tracked files using a background loop.
 func (r *Renter) Upload(up modules.FileUploadParams) error {
@@ -84,6 +273,9 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if strings.HasPrefix(up.SiaPath, "/") {
 		return errors.New("nicknames cannot begin with /")
 	}
+	if err := r.checkPinnedHosts(up.Hosts); err != nil {
+		return err
+	}
 
 	// Check for a nickname conflict.
 	lockID := r.mu.RLock()
@@ -93,35 +285,70 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		return ErrPathOverload
 	}
 
-	// Fill in any missing upload params with sensible defaults.
+	// Hash the file so that downloads can be verified, and so that files
+	// that were already uploaded can be detected.
 	fileInfo, err := os.Stat(up.Source)
 	if err != nil {
 		return err
 	}
-	if up.Duration == 0 {
-		up.Duration = defaultDuration
+	hash, err := hashFile(up.Source)
+	if err != nil {
+		return err
 	}
-	endHeight := r.cs.Height() + up.Duration
-	if up.ErasureCode == nil {
-		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
+	// Empty files are never considered duplicates, since there is nothing
+	// to share between them.
+	empty := fileInfo.Size() == 0
+	var original *file
+	if !empty {
+		lockID = r.mu.RLock()
+		original = r.findDuplicate(hash)
+		r.mu.RUnlock(lockID)
 	}
-	if up.PieceSize == 0 {
-		if fileInfo.Size() > defaultPieceSize {
-			up.PieceSize = defaultPieceSize
-		} else {
-			up.PieceSize = smallPieceSize
+	if original != nil {
+		if !up.Alias {
+			r.log.Printf("WARN: %v has the same contents as %v, which was already uploaded", up.SiaPath, original.name)
+			return ErrDuplicateUpload
+		}
+		return r.uploadAlias(up, original)
+	}
+
+	// Check that there are enough hosts to upload to. An empty file is not
+	// uploaded to any hosts.
+	if !empty {
+		err = r.checkActiveHosts()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fill in any missing upload params with sensible defaults.
+	fillUploadDefaults(&up, uint64(fileInfo.Size()))
+	var reduced bool
+	if !empty {
+		reduced, err = r.reduceRedundancy(up.SiaPath, &up)
+		if err != nil {
+			return err
 		}
 	}
+	endHeight := r.cs.Height() + up.Duration
 
 	// Check that we have enough money to finance the upload.
-	err = r.checkWalletBalance(up)
+	err = r.checkWalletBalance(up, uint64(fileInfo.Size()))
 	if err != nil {
 		return err
 	}
 
 	// Create file object.
-	f := newFile(up.SiaPath, up.ErasureCode, up.PieceSize, uint64(fileInfo.Size()))
+	f, err := newFile(up.SiaPath, up.ErasureCode, up.PieceSize, uint64(fileInfo.Size()))
+	if err != nil {
+		return err
+	}
+	err = f.setChunkSize(up.ChunkSize)
+	if err != nil {
+		return err
+	}
 	f.mode = uint32(fileInfo.Mode())
+	f.hash = hash
 
 	// Add file to renter.
 	lockID = r.mu.Lock()
@@ -130,6 +357,9 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		RepairPath: up.Source,
 		EndHeight:  endHeight,
 		Renew:      up.Renew,
+		Hosts:      up.Hosts,
+		Diverse:    up.Diverse,
+		Reduced:    reduced,
 	}
 	r.save()
 	r.mu.Unlock(lockID)
@@ -142,3 +372,291 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 
 	return nil
 }
+
+// findDuplicate returns the file whose contents have the provided hash, or nil
+// if no such file has been uploaded.
+func (r *Renter) findDuplicate(hash crypto.Hash) *file {
+	if hash == (crypto.Hash{}) {
+		return nil
+	}
+	for _, f := range r.files {
+		if f.hash == hash {
+			return f
+		}
+	}
+	return nil
+}
+
+// uploadAlias adds the file described by up as an alias of original, which
+// has identical contents. The alias appears as its own file, but shares the
+// file contracts and pieces of original, so nothing is uploaded.
+func (r *Renter) uploadAlias(up modules.FileUploadParams, original *file) error {
+	f := original.alias(up.SiaPath)
+
+	lockID := r.mu.Lock()
+	if _, exists := r.files[up.SiaPath]; exists {
+		r.mu.Unlock(lockID)
+		return ErrPathOverload
+	}
+	meta := r.tracking[original.name]
+	r.files[up.SiaPath] = f
+	r.tracking[up.SiaPath] = trackedFile{
+		RepairPath: up.Source,
+		EndHeight:  meta.EndHeight,
+		Renew:      up.Renew,
+		Hosts:      meta.Hosts,
+		Diverse:    meta.Diverse,
+	}
+	r.save()
+	r.mu.Unlock(lockID)
+	r.log.Printf("INFO: added %v as an alias of %v", up.SiaPath, original.name)
+
+	return r.saveFile(f)
+}
+
+// UploadStream uploads a file of 'size' bytes that is read from stream. The
+// stream is read one chunk at a time, and each chunk is erasure-coded,
+// encrypted, and uploaded before the next chunk is read, so the stream is
+// never held in memory in full. The nickname takes the place of up.SiaPath,
+// and up.Source is not used.
+//
+// Because the renter does not have a local copy of the file, the file cannot
+// be repaired after the upload completes. If up.Renew is set, the contracts of
+// the file are still renewed.
+//
+// If the upload fails after some chunks were uploaded, the partial file is
+// kept and tracked like a complete file, so that the contracts formed for it
+// are not orphaned. The partial file is not available for download; deleting
+// it releases the contracts.
+func (r *Renter) UploadStream(nickname string, stream io.Reader, size uint64, up modules.FileUploadParams) error {
+	// Enforce nickname rules.
+	if strings.HasPrefix(nickname, "/") {
+		return errors.New("nicknames cannot begin with /")
+	}
+	if err := r.checkPinnedHosts(up.Hosts); err != nil {
+		return err
+	}
+
+	// Fill in any missing upload params with sensible defaults, and check
+	// that we have enough money to finance the upload.
+	fillUploadDefaults(&up, size)
+	var reduced bool
+	if size != 0 {
+		var err error
+		reduced, err = r.reduceRedundancy(nickname, &up)
+		if err != nil {
+			return err
+		}
+	}
+	endHeight := r.cs.Height() + up.Duration
+	err := r.checkWalletBalance(up, size)
+	if err != nil {
+		return err
+	}
+
+	// Reserve the nickname while the file is uploaded.
+	f, err := newFile(nickname, up.ErasureCode, up.PieceSize, size)
+	if err != nil {
+		return err
+	}
+	err = f.setChunkSize(up.ChunkSize)
+	if err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	if _, exists := r.files[nickname]; exists {
+		r.mu.Unlock(lockID)
+		return ErrPathOverload
+	}
+	r.files[nickname] = f
+	f.beginTransfer()
+	r.mu.Unlock(lockID)
+	defer f.endTransfer()
+
+	uploadErr := r.uploadStream(f, stream, up.Duration, up.Hosts, up.Diverse)
+	f.mu.RLock()
+	uploaded := len(f.contracts) != 0
+	f.mu.RUnlock()
+	if uploadErr != nil && !uploaded {
+		lockID = r.mu.Lock()
+		delete(r.files, nickname)
+		r.mu.Unlock(lockID)
+		return uploadErr
+	}
+
+	// Track the file so that its contracts are renewed.
+	lockID = r.mu.Lock()
+	r.tracking[nickname] = trackedFile{
+		EndHeight: endHeight,
+		Renew:     up.Renew,
+		Hosts:     up.Hosts,
+		Diverse:   up.Diverse,
+		Reduced:   reduced,
+	}
+	r.save()
+	r.mu.Unlock(lockID)
+
+	// Save the .sia file to the renter directory.
+	f.mu.RLock()
+	err = r.saveFile(f)
+	f.mu.RUnlock()
+	if uploadErr != nil {
+		r.log.Printf("WARN: stream upload of %v failed, keeping the partial file: %v", nickname, uploadErr)
+		return uploadErr
+	}
+	return err
+}
+
+// uploadStream reads the chunks of f from stream, uploading each chunk before
+// the next chunk is read. The final chunk is padded with zeros. If hosts is
+// non-empty, the chunks are only uploaded to the specified hosts. If diverse
+// is set, the pieces of each chunk are placed in distinct subnets where
+// possible.
+func (r *Renter) uploadStream(f *file, stream io.Reader, duration types.BlockHeight, hosts []modules.NetAddress, diverse bool) error {
+	// An empty file has no data to upload.
+	if f.empty() {
+		f.mu.Lock()
+		copy(f.hash[:], crypto.NewHash().Sum(nil))
+		f.mu.Unlock()
+		return nil
+	}
+
+	// create host pool
+	contractSize := (f.chunkPieceSize() + crypto.TwofishOverhead) * f.numChunks() // each host gets one piece of each chunk
+	pool, err := r.newPool(contractSize, duration, hosts, diverse)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	lockID := r.mu.RLock()
+	workers := r.uploadWorkers
+	r.mu.RUnlock(lockID)
+	pieces := make([]uint64, f.erasureCode.NumPieces())
+	for i := range pieces {
+		pieces[i] = uint64(i)
+	}
+	h := crypto.NewHash()
+	stream = io.TeeReader(io.LimitReader(stream, int64(f.size)), h)
+	chunk := make([]byte, f.chunkSize())
+	for i := uint64(0); i < f.numChunks(); i++ {
+		n, err := io.ReadFull(stream, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// Only the final chunk may be short, and only by its padding. A
+		// chunk missing data is not uploaded, so that a partial file never
+		// holds chunks of the wrong data.
+		if want := f.size - i*f.chunkSize(); uint64(n) < want && uint64(n) < f.chunkSize() {
+			return errShortStream
+		}
+		for j := n; j < len(chunk); j++ {
+			chunk[j] = 0
+		}
+
+		hosts := pool.UniqueHosts(len(pieces), nil)
+		if len(hosts) == 0 {
+			return errIncompleteUpload
+		}
+		err = f.uploadChunk(i, chunk, pieces, hosts, workers)
+		if err != nil {
+			return err
+		}
+	}
+	if !f.available() {
+		return errIncompleteUpload
+	}
+
+	f.mu.Lock()
+	copy(f.hash[:], h.Sum(nil))
+	f.mu.Unlock()
+	return nil
+}
+
+// RotateFileKey re-encrypts a file under a new master key. The file is
+// downloaded from its hosts and uploaded again under the new key, to new file
+// contracts which replace the contracts of the file once the upload has
+// completed. The old key is discarded; the pieces encrypted under it remain on
+// their hosts until the old contracts expire, but are no longer referenced by
+// the file.
+func (r *Renter) RotateFileKey(nickname string) error {
+	f, hfs, err := r.connectHosts(nickname)
+	if err != nil {
+		return err
+	}
+	defer f.endTransfer()
+	hosts := make([]fetcher, len(hfs))
+	for i, hf := range hfs {
+		defer hf.Close()
+		hosts[i] = hf
+	}
+	return r.managedRotateFileKey(f, hosts)
+}
+
+// managedRotateFileKey downloads f from the provided hosts, streaming the
+// contents into an upload of a copy of f under a new master key, and then
+// replaces f with the copy.
+func (r *Renter) managedRotateFileKey(f *file, hosts []fetcher) error {
+	rotated, err := f.rekey()
+	if err != nil {
+		return err
+	}
+	meta, duration, err := r.remainingDuration(f)
+	if err != nil {
+		return err
+	}
+
+	// Stream the download into the upload. If the upload fails, closing the
+	// pipe with its error stops the download.
+	pr, pw := io.Pipe()
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := r.managedDownload(f, hosts, "", pw)
+		pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+	err = r.uploadStream(rotated, pr, duration, meta.Hosts, meta.Diverse)
+	pr.CloseWithError(err)
+	if dErr := <-downloadErr; dErr != nil {
+		return dErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Replace the file, unless it was changed during the rotation.
+	lockID := r.mu.Lock()
+	if r.files[rotated.name] != f {
+		r.mu.Unlock(lockID)
+		return errRotationConflict
+	}
+	r.files[rotated.name] = rotated
+	r.mu.Unlock(lockID)
+	r.log.Printf("INFO: rotated the key of %v", rotated.name)
+
+	rotated.mu.RLock()
+	defer rotated.mu.RUnlock()
+	return r.saveFile(rotated)
+}
+
+// remainingDuration returns the tracking metadata of f, along with the
+// duration of new contracts formed for f. The new contracts cover the
+// remaining storage period of the file, or a full period if the file is
+// renewed.
+func (r *Renter) remainingDuration(f *file) (trackedFile, types.BlockHeight, error) {
+	lockID := r.mu.RLock()
+	meta, tracked := r.tracking[f.name]
+	r.mu.RUnlock(lockID)
+	if tracked && meta.Renew {
+		return meta, defaultDuration, nil
+	}
+	endHeight := f.expiration()
+	if tracked {
+		endHeight = meta.EndHeight
+	}
+	height := r.cs.Height()
+	if endHeight <= height {
+		return meta, 0, errStorageEnded
+	}
+	return meta, endHeight - height, nil
+}
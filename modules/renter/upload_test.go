@@ -1,12 +1,18 @@
 package renter
 
 import (
+	"bytes"
+	"crypto/rand"
 	"io/ioutil"
+	"net"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
 	"github.com/NebulousLabs/Sia/types"
@@ -18,7 +24,7 @@ type uploadHostDB struct{}
 
 // NewPool returns a new mock HostPool. Since uploadHostDB implements the
 // HostPool interface, it can simply return itself.
-func (hdb uploadHostDB) NewPool(uint64, types.BlockHeight) (hostdb.HostPool, error) {
+func (hdb uploadHostDB) NewPool(uint64, types.BlockHeight, []modules.NetAddress, bool) (hostdb.HostPool, error) {
 	return hdb, nil
 }
 
@@ -47,6 +53,19 @@ func (uploadHostDB) AveragePrice() types.Currency        { return types.Currency
 func (uploadHostDB) Renew(types.FileContractID, types.BlockHeight) (types.FileContractID, error) {
 	return types.FileContractID{}, nil
 }
+func (uploadHostDB) Contracts() []modules.RenterContract         { return nil }
+func (uploadHostDB) RecordDownload(types.FileContractID, uint64) {}
+func (uploadHostDB) ScanQueueDepth() int                         { return 0 }
+func (uploadHostDB) SetSpeedLimits(up, down int64)               {}
+func (uploadHostDB) DialHost(addr modules.NetAddress) (net.Conn, error) {
+	return net.Dial("tcp", string(addr))
+}
+func (uploadHostDB) SpendingReport(types.BlockHeight) modules.SpendingSummary {
+	return modules.SpendingSummary{}
+}
+func (uploadHostDB) PayDownload(net.Conn, types.FileContractID, types.Currency, uint64) error {
+	return nil
+}
 
 // TestUpload tests the uploading and repairing functions. The hostDB is
 // mocked, isolating the upload/repair logic from the negotation logic.
@@ -87,3 +106,918 @@ func TestUpload(t *testing.T) {
 		time.Sleep(time.Second)
 	}
 }
+
+// streamHostDB is a mocked hostDB and hostdb.HostPool that hands out a fixed
+// set of testHosts. It is used for testing streaming uploads.
+type streamHostDB struct {
+	uploadHostDB
+	hosts []hostdb.Uploader
+}
+
+// NewPool returns the streamHostDB itself.
+func (hdb *streamHostDB) NewPool(uint64, types.BlockHeight, []modules.NetAddress, bool) (hostdb.HostPool, error) {
+	return hdb, nil
+}
+
+// UniqueHosts returns up to n of the testHosts.
+func (hdb *streamHostDB) UniqueHosts(n int, _ []modules.NetAddress) []hostdb.Uploader {
+	if n > len(hdb.hosts) {
+		n = len(hdb.hosts)
+	}
+	return hdb.hosts[:n]
+}
+
+// ActiveHosts returns the settings of each of the testHosts.
+func (hdb *streamHostDB) ActiveHosts() []modules.HostSettings {
+	hosts := make([]modules.HostSettings, len(hdb.hosts))
+	for i, h := range hdb.hosts {
+		hosts[i].NetAddress = h.Address()
+	}
+	return hosts
+}
+
+// TestUploadStream uploads a file from a stream and checks that the file can
+// be downloaded again.
+func TestUploadStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// create renter
+	rt, err := newRenterTester("TestUploadStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// swap in a hostdb of reliable test hosts
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := new(streamHostDB)
+	for i := 0; i < rsc.NumPieces(); i++ {
+		hdb.hosts = append(hdb.hosts, &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		})
+	}
+	rt.renter.hostDB = hdb
+
+	// upload data whose size is not a multiple of the chunk size
+	const pieceSize = 64
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "foo" || !files[0].Available {
+		t.Fatal("streamed file is not available:", files)
+	}
+
+	// the nickname is now taken
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{})
+	if err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	// a stream that ends early is rejected, but the chunks uploaded before
+	// the end are kept, so that their contracts are not orphaned
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data[:dataSize/2]), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+		Renew:       true,
+	})
+	if err != errShortStream {
+		t.Fatal("expected errShortStream, got", err)
+	}
+	files = rt.renter.FileList()
+	if len(files) != 2 {
+		t.Fatal("partial file from a short stream was not kept:", files)
+	}
+	for _, fi := range files {
+		if fi.SiaPath == "bar" && fi.Available {
+			t.Fatal("partial file from a short stream is available")
+		}
+	}
+	lockID := rt.renter.mu.RLock()
+	_, tracked := rt.renter.tracking["bar"]
+	rt.renter.mu.RUnlock(lockID)
+	if !tracked {
+		t.Fatal("partial file from a short stream is not tracked")
+	}
+
+	// decrypt the pieces held by each host and download the file
+	lockID = rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	fetchers, err := decryptedFetchers(f, hdb.hosts, f.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = f.newDownload(fetchers, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("downloaded data does not match the stream")
+	}
+}
+
+// TestUploadStreamChunkSize uploads a file with a custom chunk size and checks
+// that the file is split into chunks of that size and can be downloaded again.
+func TestUploadStreamChunkSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadStreamChunkSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := new(streamHostDB)
+	for i := 0; i < rsc.NumPieces(); i++ {
+		hdb.hosts = append(hdb.hosts, &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		})
+	}
+	rt.renter.hostDB = hdb
+
+	// A chunk size that is not a multiple of the piece size times the
+	// minimum number of pieces is rejected.
+	const pieceSize = 64
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+		ChunkSize:   3 * pieceSize,
+	})
+	if err != ErrBadChunkSize {
+		t.Fatal("expected ErrBadChunkSize, got", err)
+	}
+
+	// Upload the data in chunks of four pieces per required piece.
+	const chunkSize = 4 * 2 * pieceSize
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+		ChunkSize:   chunkSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if f.chunkSize() != chunkSize || f.numChunks() != 2 {
+		t.Fatalf("expected 2 chunks of %v bytes, got %v chunks of %v bytes", chunkSize, f.numChunks(), f.chunkSize())
+	}
+
+	// decrypt the pieces held by each host and download the file
+	fetchers, err := decryptedFetchers(f, hdb.hosts, f.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = f.newDownload(fetchers, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("downloaded data does not match the stream")
+	}
+
+	// The chunk size is kept when the file is shared.
+	ascii, err := rt.renter.ShareFilesAscii([]string{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(rt.renter.files, "foo")
+	_, err = rt.renter.LoadSharedFilesAscii(ascii)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := rt.renter.files["foo"]; loaded.chunkSize() != chunkSize {
+		t.Error("chunk size was not kept when sharing:", loaded.chunkSize())
+	}
+}
+
+// activeHostDB is a streamHostDB that reports a configurable set of active
+// hosts.
+type activeHostDB struct {
+	streamHostDB
+	active []modules.HostSettings
+}
+
+// ActiveHosts returns the configured set of active hosts.
+func (hdb *activeHostDB) ActiveHosts() []modules.HostSettings { return hdb.active }
+
+// TestMinimumHosts checks that uploads are rejected while the hostdb knows
+// about fewer active hosts than the renter's minimum, and succeed once enough
+// hosts are present.
+func TestMinimumHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// create renter
+	rt, err := newRenterTester("TestMinimumHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// swap in a hostdb of reliable test hosts, only some of which are active
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := new(activeHostDB)
+	for i := 0; i < rsc.NumPieces(); i++ {
+		hdb.hosts = append(hdb.hosts, &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		})
+	}
+	hdb.active = make([]modules.HostSettings, rsc.NumPieces()-1)
+	rt.renter.hostDB = hdb
+	rt.renter.SetMinimumHosts(rsc.NumPieces())
+
+	// uploads should be rejected
+	source := filepath.Join(build.SiaTestingDir, "renter", "TestMinimumHosts", "test.dat")
+	err = ioutil.WriteFile(source, []byte{1, 2, 3}, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:  source,
+		SiaPath: "foo",
+	})
+	if err != errTooFewActiveHosts {
+		t.Fatal("expected errTooFewActiveHosts, got", err)
+	}
+	const pieceSize = 64
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	up := modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+	}
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data), dataSize, up)
+	if err != errTooFewActiveHosts {
+		t.Fatal("expected errTooFewActiveHosts, got", err)
+	}
+	if len(rt.renter.FileList()) != 0 {
+		t.Fatal("rejected upload was kept")
+	}
+
+	// once enough hosts are active, uploads should succeed
+	hdb.active = append(hdb.active, modules.HostSettings{})
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data), dataSize, up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:  source,
+		SiaPath: "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.FileList()) != 2 {
+		t.Fatal("expected 2 files, got", len(rt.renter.FileList()))
+	}
+}
+
+// concurrencyTracker records the largest number of uploads that were in
+// progress at once across a set of concurrencyHosts.
+type concurrencyTracker struct {
+	active    int
+	maxActive int
+	mu        sync.Mutex
+}
+
+// A concurrencyHost is a testHost that reports its uploads to a
+// concurrencyTracker.
+type concurrencyHost struct {
+	*testHost
+	tracker *concurrencyTracker
+}
+
+// Upload uploads data to the testHost, recording the upload as in progress
+// for its duration.
+func (h concurrencyHost) Upload(data []byte) (uint64, error) {
+	h.tracker.mu.Lock()
+	h.tracker.active++
+	if h.tracker.active > h.tracker.maxActive {
+		h.tracker.maxActive = h.tracker.active
+	}
+	h.tracker.mu.Unlock()
+	defer func() {
+		h.tracker.mu.Lock()
+		h.tracker.active--
+		h.tracker.mu.Unlock()
+	}()
+	return h.testHost.Upload(data)
+}
+
+// TestUploadWorkers uploads a file with a bounded number of upload workers,
+// and checks that pieces are uploaded concurrently without exceeding the
+// bound, and that every piece of the file lands on a host.
+func TestUploadWorkers(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// create renter
+	rt, err := newRenterTester("TestUploadWorkers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// swap in a hostdb of slow but reliable test hosts
+	rsc, err := NewRSCode(2, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := new(concurrencyTracker)
+	hdb := new(streamHostDB)
+	for i := 0; i < rsc.NumPieces(); i++ {
+		hdb.hosts = append(hdb.hosts, concurrencyHost{
+			testHost: &testHost{
+				ip:       modules.NetAddress(strconv.Itoa(i)),
+				delay:    20 * time.Millisecond,
+				failRate: 1 << 30,
+			},
+			tracker: tracker,
+		})
+	}
+	rt.renter.hostDB = hdb
+	const workers = 3
+	rt.renter.SetUploadWorkers(workers)
+
+	// upload a multi-chunk file
+	const pieceSize = 64
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   pieceSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracker.maxActive > workers {
+		t.Fatal("upload exceeded the worker limit:", tracker.maxActive)
+	}
+	if tracker.maxActive < 2 {
+		t.Fatal("pieces were not uploaded concurrently")
+	}
+
+	// every piece of every chunk should be on a host
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if len(f.incompleteChunks()) != 0 {
+		t.Fatal("not all pieces were uploaded:", f.incompleteChunks())
+	}
+	for _, h := range hdb.hosts {
+		if pieces := len(f.contracts[h.ContractID()].Pieces); uint64(pieces) != f.numChunks() {
+			t.Fatalf("host %v has %v pieces, expected %v", h.Address(), pieces, f.numChunks())
+		}
+	}
+	if progress := f.uploadProgress(); progress != 100 {
+		t.Fatal("expected upload progress of 100, got", progress)
+	}
+}
+
+// pinnedHostDB is a streamHostDB whose pools only hand out the hosts that
+// they are pinned to.
+type pinnedHostDB struct {
+	streamHostDB
+}
+
+// NewPool returns a pool of the testHosts whose addresses are in 'hosts'.
+func (hdb *pinnedHostDB) NewPool(_ uint64, _ types.BlockHeight, hosts []modules.NetAddress, _ bool) (hostdb.HostPool, error) {
+	p := new(streamHostDB)
+	for _, h := range hdb.hosts {
+		for _, addr := range hosts {
+			if h.Address() == addr {
+				p.hosts = append(p.hosts, h)
+			}
+		}
+	}
+	return p, nil
+}
+
+// TestUploadPinnedHosts uploads a file pinned to two hosts, and checks that
+// the file's contracts are with exactly those hosts.
+func TestUploadPinnedHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// create renter
+	rt, err := newRenterTester("TestUploadPinnedHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// swap in a hostdb of reliable test hosts
+	hdb := new(pinnedHostDB)
+	for i := 0; i < 5; i++ {
+		hdb.hosts = append(hdb.hosts, &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		})
+	}
+	rt.renter.hostDB = hdb
+
+	// upload a file pinned to two of the hosts
+	rsc, err := NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := []modules.NetAddress{"1", "3"}
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+
+	// an upload pinned to an unknown host is refused when it is submitted
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   64,
+		Hosts:       []modules.NetAddress{"1", "7"},
+	})
+	if err != errPinnedHostUnavailable {
+		t.Fatal("expected errPinnedHostUnavailable, got", err)
+	}
+	if len(rt.renter.FileList()) != 0 {
+		t.Fatal("refused upload was added to the renter")
+	}
+
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   64,
+		Hosts:       pinned,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file's contracts should reference exactly the pinned hosts
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	hosts := rt.renter.tracking["foo"].Hosts
+	rt.renter.mu.RUnlock(lockID)
+	if len(hosts) != len(pinned) {
+		t.Fatal("pinned hosts were not tracked:", hosts)
+	}
+	addrs := make(map[modules.NetAddress]struct{})
+	for _, fc := range f.contracts {
+		addrs[fc.IP] = struct{}{}
+	}
+	if len(addrs) != len(pinned) {
+		t.Fatal("file has contracts with the wrong hosts:", addrs)
+	}
+	for _, addr := range pinned {
+		if _, exists := addrs[addr]; !exists {
+			t.Fatal("file has no contract with pinned host", addr)
+		}
+	}
+}
+
+// TestEstimateUploadCost checks the upload cost estimate against a
+// hand-computed value for a known set of host prices and erasure code.
+func TestEstimateUploadCost(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestEstimateUploadCost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// With no active hosts, nothing can be estimated.
+	hdb := new(activeHostDB)
+	rt.renter.hostDB = hdb
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   64,
+	}
+	if cost, err := rt.renter.EstimateUploadCost(1000, up, 10); err != nil || !cost.IsZero() {
+		t.Fatal("expected a zero estimate with no hosts, got", cost, err)
+	}
+
+	// The 75th percentile of the prices 10, 20, 30, 40, and 50 is 40.
+	for _, price := range []uint64{30, 10, 50, 20, 40} {
+		hdb.active = append(hdb.active, modules.HostSettings{Price: types.NewCurrency64(price)})
+	}
+
+	// 1000 bytes in chunks of 2*64 bytes is 8 chunks. Each chunk is stored
+	// as 6 encrypted pieces of 64+TwofishOverhead bytes.
+	storedBytes := uint64(8 * 6 * (64 + crypto.TwofishOverhead))
+	expected := types.NewCurrency64(40 * storedBytes * 10)
+	if cost, err := rt.renter.EstimateUploadCost(1000, up, 10); err != nil || cost.Cmp(expected) != 0 {
+		t.Fatalf("expected an estimate of %v, got %v (%v)", expected, cost, err)
+	}
+
+	// Without an explicit duration, the duration of the params is used.
+	up.Duration = 20
+	if cost, err := rt.renter.EstimateUploadCost(1000, up, 0); err != nil || cost.Cmp(expected.Mul(types.NewCurrency64(2))) != 0 {
+		t.Fatal("duration of the upload params was not used:", cost, err)
+	}
+
+	// Invalid params are rejected rather than estimated at zero.
+	up.ChunkSize = 100
+	if _, err := rt.renter.EstimateUploadCost(1000, up, 10); err != ErrBadChunkSize {
+		t.Fatal("expected ErrBadChunkSize, got", err)
+	}
+	up.ChunkSize = 0
+	up.ErasureCode = pieceCountCode{numPieces: 2, minPieces: 2}
+	if _, err := rt.renter.EstimateUploadCost(1000, up, 10); err != ErrBadErasureCode {
+		t.Fatal("expected ErrBadErasureCode, got", err)
+	}
+}
+
+// TestUploadDuplicate uploads identical content under two nicknames, and checks
+// that the second upload is refused unless it is added as an alias, in which
+// case it shares the contracts of the first file.
+func TestUploadDuplicate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadDuplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.hostDB = &uploadHostDB{}
+
+	// Add a file that has already been uploaded.
+	data := []byte{1, 2, 3}
+	source := filepath.Join(rt.renter.persistDir, "test.dat")
+	err = ioutil.WriteFile(source, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	f, err := newFile("foo", rsc, 64, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hash = crypto.HashBytes(data)
+	fcid := types.FileContractID{1}
+	f.contracts[fcid] = fileContract{
+		ID:     fcid,
+		IP:     "foo",
+		Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}},
+	}
+	lockID := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{RepairPath: source, EndHeight: 100}
+	rt.renter.mu.Unlock(lockID)
+
+	// Uploading the same contents again should be refused.
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:  source,
+		SiaPath: "bar",
+	})
+	if err != ErrDuplicateUpload {
+		t.Fatal("expected ErrDuplicateUpload, got", err)
+	}
+	if len(rt.renter.FileList()) != 1 {
+		t.Fatal("duplicate upload was added to the renter")
+	}
+
+	// Uploading with alias set should add a file that shares the contracts
+	// of the existing file.
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:  source,
+		SiaPath: "bar",
+		Alias:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 2 {
+		t.Fatal("expected 2 files, got", len(files))
+	}
+	lockID = rt.renter.mu.RLock()
+	alias, exists := rt.renter.files["bar"]
+	meta := rt.renter.tracking["bar"]
+	rt.renter.mu.RUnlock(lockID)
+	if !exists {
+		t.Fatal("alias was not added to the renter")
+	}
+	alias.mu.RLock()
+	defer alias.mu.RUnlock()
+	if len(alias.contracts) != 1 || len(alias.contracts[fcid].Pieces) != 2 {
+		t.Error("alias does not share the contracts of the existing file:", alias.contracts)
+	}
+	if alias.masterKey != f.masterKey || alias.hash != f.hash || alias.size != f.size {
+		t.Error("alias does not share the pieces of the existing file")
+	}
+	if meta.RepairPath != source || meta.EndHeight != 100 {
+		t.Error("alias was not tracked correctly:", meta)
+	}
+}
+
+// TestUploadReduceRedundancy uploads a file to fewer hosts than its erasure
+// code has pieces, and checks that the upload succeeds at the redundancy that
+// the hosts allow.
+func TestUploadReduceRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadReduceRedundancy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Only 3 hosts are available for a code of 6 pieces.
+	rsc, err := NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb := new(streamHostDB)
+	for i := 0; i < 3; i++ {
+		hdb.hosts = append(hdb.hosts, &testHost{
+			ip:       modules.NetAddress(strconv.Itoa(i)),
+			failRate: 1 << 30,
+		})
+	}
+	rt.renter.hostDB = hdb
+
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode:      rsc,
+		PieceSize:        64,
+		ReduceRedundancy: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if f.erasureCode.MinPieces() != 2 || f.erasureCode.NumPieces() != 3 {
+		t.Fatalf("expected a 2-of-3 erasure code, got %v-of-%v", f.erasureCode.MinPieces(), f.erasureCode.NumPieces())
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || !files[0].Available || files[0].UploadProgress != 100 {
+		t.Fatal("file was not fully uploaded at reduced redundancy:", files)
+	}
+	if files[0].Redundancy != 1.5 {
+		t.Fatal("expected a redundancy of 1.5, got", files[0].Redundancy)
+	}
+	if !files[0].ReducedRedundancy {
+		t.Fatal("reduced redundancy was not reported")
+	}
+
+	// A parity piece is always kept, so the minimum number of hosts is not
+	// enough.
+	hdb.hosts = hdb.hosts[:2]
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode:      rsc,
+		PieceSize:        64,
+		ReduceRedundancy: true,
+	})
+	if err != errNoParityHosts {
+		t.Fatal("expected errNoParityHosts, got", err)
+	}
+
+	// The redundancy cannot drop below the minimum number of pieces.
+	hdb.hosts = hdb.hosts[:1]
+	err = rt.renter.UploadStream("bar", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode:      rsc,
+		PieceSize:        64,
+		ReduceRedundancy: true,
+	})
+	if err != errTooFewActiveHosts {
+		t.Fatal("expected errTooFewActiveHosts, got", err)
+	}
+}
+
+// decryptedFetchers returns a testFetcher for each host storing pieces of f,
+// holding the pieces of the host decrypted with key.
+func decryptedFetchers(f *file, hosts []hostdb.Uploader, key crypto.TwofishKey) ([]fetcher, error) {
+	pieceSize := f.chunkPieceSize()
+	var fetchers []fetcher
+	for _, h := range hosts {
+		contract, exists := f.contracts[h.ContractID()]
+		if !exists {
+			continue
+		}
+		tf := &testFetcher{
+			pieceMap:  make(map[uint64][]pieceData),
+			pieceSize: pieceSize,
+			failRate:  1 << 30,
+		}
+		for _, p := range contract.Pieces {
+			encPiece := h.(*testHost).data[p.Offset : p.Offset+pieceSize+crypto.TwofishOverhead]
+			piece, err := deriveKey(key, p.Chunk, p.Piece).DecryptBytes(encPiece)
+			if err != nil {
+				return nil, err
+			}
+			tf.pieceMap[p.Chunk] = append(tf.pieceMap[p.Chunk], pieceData{
+				Chunk:  p.Chunk,
+				Piece:  p.Piece,
+				Offset: uint64(len(tf.data)),
+			})
+			tf.data = append(tf.data, piece...)
+		}
+		fetchers = append(fetchers, tf)
+	}
+	return fetchers, nil
+}
+
+// TestRotateFileKey rotates the key of a file, and checks that the file is
+// uploaded again under a new key that replaces the old one.
+func TestRotateFileKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRotateFileKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, err := NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHostDB := func(first int) *streamHostDB {
+		hdb := new(streamHostDB)
+		for i := first; i < first+rsc.NumPieces(); i++ {
+			hdb.hosts = append(hdb.hosts, &testHost{
+				ip:       modules.NetAddress(strconv.Itoa(i)),
+				failRate: 1 << 30,
+			})
+		}
+		return hdb
+	}
+	oldHosts := newHostDB(0)
+	rt.renter.hostDB = oldHosts
+
+	const dataSize = 1000
+	data := make([]byte, dataSize)
+	rand.Read(data)
+	err = rt.renter.UploadStream("foo", bytes.NewReader(data), dataSize, modules.FileUploadParams{
+		ErasureCode: rsc,
+		PieceSize:   64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := rt.renter.mu.RLock()
+	f := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	oldKey := f.masterKey
+
+	// Rotate the key, uploading the file to a new set of hosts.
+	fetchers, err := decryptedFetchers(f, oldHosts.hosts, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHosts := newHostDB(rsc.NumPieces())
+	rt.renter.hostDB = newHosts
+	err = rt.renter.managedRotateFileKey(f, fetchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = rt.renter.mu.RLock()
+	rotated := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(lockID)
+	if rotated == f || rotated.masterKey == oldKey {
+		t.Fatal("file key was not rotated")
+	}
+	for id := range f.contracts {
+		if _, exists := rotated.contracts[id]; exists {
+			t.Fatal("rotated file still references an old contract")
+		}
+	}
+
+	// The new pieces cannot be decrypted with the old key, and the new key
+	// recovers the original data.
+	_, err = decryptedFetchers(rotated, newHosts.hosts, oldKey)
+	if err == nil {
+		t.Fatal("old key decrypted the pieces of the rotated file")
+	}
+	fetchers, err = decryptedFetchers(rotated, newHosts.hosts, rotated.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = rotated.newDownload(fetchers, "").run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("downloaded data does not match the original")
+	}
+
+	// Rotating a file that is not known to the renter fails.
+	err = rt.renter.RotateFileKey("bar")
+	if err == nil {
+		t.Fatal("expected an error rotating an unknown file")
+	}
+}
+
+// TestUploadEmptyFile uploads and downloads files that contain no data, which
+// should succeed without forming any file contracts.
+func TestUploadEmptyFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestUploadEmptyFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.renter.hostDB = &uploadHostDB{}
+
+	// Upload two empty files. They should not be considered duplicates.
+	source := filepath.Join(rt.renter.persistDir, "empty.dat")
+	err = ioutil.WriteFile(source, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo", "bar"} {
+		err = rt.renter.Upload(modules.FileUploadParams{
+			Source:  source,
+			SiaPath: name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = rt.renter.UploadStream("baz", bytes.NewReader(nil), 0, modules.FileUploadParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 3 {
+		t.Fatal("expected 3 files, got", len(files))
+	}
+	for _, fi := range files {
+		if !fi.Available || fi.UploadProgress != 100 {
+			t.Error("empty file should be available and fully uploaded:", fi)
+		}
+	}
+
+	// Downloading an empty file should produce an empty file.
+	dest := filepath.Join(rt.renter.persistDir, "empty.out")
+	err = ioutil.WriteFile(dest, []byte{1, 2, 3}, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.Download("foo", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatal("downloaded empty file contains data:", data)
+	}
+	var buf bytes.Buffer
+	err = rt.renter.DownloadTo("baz", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("downloaded empty file contains data:", buf.Bytes())
+	}
+}
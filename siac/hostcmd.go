@@ -26,7 +26,12 @@ Available settings:
 	minduration
 	maxduration
 	windowsize
-	price (in SC per GB per month)`,
+	price (in SC per GB per month)
+	downloadbandwidthprice (in SC per GB)
+	collateralratio (collateral as a percentage of revenue)
+	minrevisionsize (in bytes)
+	mincontractsize (in bytes)
+	maxrevisionrate (revisions per minute, per contract)`,
 		Run: wrap(hostconfigcmd),
 	}
 
@@ -36,7 +41,9 @@ Available settings:
 		Long: `Announce yourself as a host on the network.
 You may also supply a specific address to be announced, e.g.:
 	siac host announce my-host-domain.com:9001
-Doing so will override the standard connectivity checks.`,
+Doing so will override the standard connectivity checks.
+An address that was announced recently will not be announced again unless
+--force is supplied.`,
 		Run: hostannouncecmd,
 	}
 )
@@ -52,8 +59,18 @@ func hostconfigcmd(param, value string) {
 		p.Mul(p, big.NewRat(1e24/1e9, 4320))
 		value = new(big.Int).Div(p.Num(), p.Denom()).String()
 	}
+	// convert download price to hastings/byte
+	if param == "downloadbandwidthprice" {
+		p, ok := new(big.Rat).SetString(value)
+		if !ok {
+			fmt.Println("could not parse download price")
+			return
+		}
+		p.Mul(p, big.NewRat(1e24/1e9, 1))
+		value = new(big.Int).Div(p.Num(), p.Denom()).String()
+	}
 	// parse sizes of form 10GB, 10TB, 1TiB etc
-	if param == "totalstorage" {
+	if param == "totalstorage" || param == "minrevisionsize" || param == "mincontractsize" {
 		var err error
 		value, err = parseSize(value)
 		if err != nil {
@@ -69,12 +86,13 @@ func hostconfigcmd(param, value string) {
 }
 
 func hostannouncecmd(cmd *cobra.Command, args []string) {
+	force := fmt.Sprintf("force=%t", announceForce)
 	var err error
 	switch len(args) {
 	case 0:
-		err = post("/host/announce", "")
+		err = post("/host/announce", force)
 	case 1:
-		err = post("/host/announce", "netaddress="+args[0])
+		err = post("/host/announce", force+"&netaddress="+args[0])
 	default:
 		cmd.Usage()
 		return
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/spf13/cobra"
 
@@ -9,6 +10,15 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// blocksPerMonth is the number of blocks in a 30 day month, assuming a
+	// block is found every 10 minutes.
+	blocksPerMonth = 30 * 144
+
+	// bytesPerGB is the number of bytes in a gigabyte.
+	bytesPerGB = 1e9
+)
+
 var (
 	hostdbCmd = &cobra.Command{
 		Use:   "hostdb",
@@ -18,7 +28,20 @@ var (
 	}
 )
 
+// storagePrice converts a host price, which is given in hastings per byte per
+// block, into the number of siacoins needed to store a gigabyte for the given
+// number of months. The number of blocks is computed with big integers, so
+// that a long duration cannot overflow.
+func storagePrice(price types.Currency, months uint64) types.Currency {
+	byteBlocks := new(big.Int).Mul(big.NewInt(bytesPerGB*blocksPerMonth), new(big.Int).SetUint64(months))
+	return price.Mul(types.NewCurrency(byteBlocks)).Div(types.SiacoinPrecision)
+}
+
 func hostdbhostscmd() {
+	if priceMonths == 0 {
+		fmt.Println("Duration must be at least one month")
+		return
+	}
 	info := new(api.ActiveHosts)
 	err := getAPI("/renter/hosts/active", info)
 	if err != nil {
@@ -29,8 +52,12 @@ func hostdbhostscmd() {
 		fmt.Println("No known active hosts")
 		return
 	}
+	period := "Mo"
+	if priceMonths != 1 {
+		period = fmt.Sprintf("%v Mo", priceMonths)
+	}
 	fmt.Println("Active hosts:")
 	for _, host := range info.Hosts {
-		fmt.Printf("\t%v - %v SC / GB / Mo\n", host.NetAddress, host.Price.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision))
+		fmt.Printf("\t%v - %v SC / GB / %v\n", host.NetAddress, storagePrice(host.Price, priceMonths), period)
 	}
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestStoragePrice(t *testing.T) {
+	// 1 SC per GB per block.
+	price := types.SiacoinPrecision.Div(types.NewCurrency64(bytesPerGB))
+	tests := []struct {
+		months uint64
+		out    string
+	}{
+		{0, "0"},
+		{1, "4320"},
+		{2, "8640"},
+		{12, "51840"},
+	}
+	for _, test := range tests {
+		res := storagePrice(price, test.months)
+		if res.String() != test.out {
+			t.Errorf("storagePrice(%v, %v): expected %v, got %v", price, test.months, test.out, res)
+		}
+	}
+
+	// A duration too long for the number of blocks to fit in a uint64 should
+	// not overflow.
+	months := uint64(1) << 40
+	expected := types.NewCurrency64(4320).Mul(types.NewCurrency64(months))
+	if res := storagePrice(price, months); res.Cmp(expected) != 0 {
+		t.Errorf("storagePrice(%v, %v): expected %v, got %v", price, months, expected, res)
+	}
+
+	// The default host price of 100 SC / GB / Mo should be displayed as just
+	// under 100 SC due to rounding.
+	defaultPrice := types.SiacoinPrecision.Div(types.NewCurrency64(4320e9)).Mul(types.NewCurrency64(100))
+	if res := storagePrice(defaultPrice, 1); res.String() != "99" {
+		t.Error("wrong price displayed for the default host price:", res)
+	}
+}
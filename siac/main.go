@@ -18,9 +18,15 @@ import (
 
 // flags
 var (
-	addr         string // override default API address
-	initPassword bool   // supply a custom password when creating a wallet
-	hostVerbose  bool   // display additional host info
+	addr          string // override default API address
+	initPassword  bool   // supply a custom password when creating a wallet
+	hostVerbose   bool   // display additional host info
+	announceForce bool   // announce even if the address was recently announced
+	uploadAlias   bool   // add duplicate uploads as aliases of the existing file
+	uploadDiverse bool   // place the pieces of each chunk in distinct subnets
+	priceMonths   uint64 // number of months to display host prices over
+
+	renterContractsJSON bool // print renter contracts as JSON
 )
 
 // apiGet wraps a GET request with a status code check, such that if the GET does
@@ -172,6 +178,8 @@ func main() {
 	root.AddCommand(hostdbCmd)
 	hostCmd.AddCommand(hostdbCmd)
 	hostCmd.Flags().BoolVarP(&hostVerbose, "verbose", "v", false, "Display detailed host info")
+	hostAnnounceCmd.Flags().BoolVarP(&announceForce, "force", "f", false, "Announce even if the address was recently announced")
+	hostdbCmd.Flags().Uint64VarP(&priceMonths, "duration", "d", 1, "Number of months to display host prices over")
 
 	root.AddCommand(minerCmd)
 	minerCmd.AddCommand(minerStartCmd, minerStopCmd, minerStatusCmd)
@@ -185,9 +193,13 @@ func main() {
 	walletSendCmd.AddCommand(walletSendSiacoinsCmd, walletSendSiafundsCmd)
 
 	root.AddCommand(renterCmd)
-	renterCmd.AddCommand(renterDownloadQueueCmd, renterFilesDeleteCmd, renterFilesDownloadCmd,
-		renterFilesListCmd, renterFilesLoadCmd, renterFilesLoadASCIICmd, renterFilesRenameCmd,
-		renterFilesShareCmd, renterFilesShareASCIICmd, renterFilesUploadCmd)
+	renterCmd.AddCommand(renterContractsCmd, renterDownloadQueueCmd, renterFilesDeleteCmd,
+		renterFilesDownloadCmd, renterFilesHealthCmd, renterFilesListCmd, renterFilesLoadCmd,
+		renterFilesLoadASCIICmd, renterFilesPriorityCmd, renterFilesRenameCmd, renterFilesShareCmd,
+		renterFilesShareASCIICmd, renterFilesUploadCmd)
+	renterFilesUploadCmd.Flags().BoolVarP(&uploadAlias, "alias", "", false, "If the file was already uploaded, add it as an alias of the existing file")
+	renterFilesUploadCmd.Flags().BoolVarP(&uploadDiverse, "diverse", "", false, "Place the pieces of each chunk on hosts in distinct subnets")
+	renterContractsCmd.Flags().BoolVarP(&renterContractsJSON, "json", "", false, "Print the contracts as JSON")
 
 	root.AddCommand(gatewayCmd)
 	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayStatusCmd)
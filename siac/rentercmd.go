@@ -1,13 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
+	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // filesize returns a string that displays a filesize in human-readable units.
@@ -20,6 +27,13 @@ func filesizeUnits(size int64) string {
 	return fmt.Sprintf("%.*f %s", i, float64(size)/math.Pow10(3*i), sizes[i])
 }
 
+// siacoinUnits returns a string that displays an amount of hastings in
+// siacoins.
+func siacoinUnits(amount types.Currency) string {
+	sc := new(big.Rat).SetFrac(amount.Big(), types.SiacoinPrecision.Big())
+	return sc.FloatString(2) + " SC"
+}
+
 var (
 	renterCmd = &cobra.Command{
 		Use:   "renter",
@@ -28,6 +42,14 @@ var (
 		Run:   wrap(renterfileslistcmd),
 	}
 
+	renterContractsCmd = &cobra.Command{
+		Use:   "contracts",
+		Short: "View the renter's contracts",
+		Long: `View the host, remaining funds, size, and end height of each file contract
+formed by the renter, along with the total amount spent on the contracts.`,
+		Run: wrap(rentercontractscmd),
+	}
+
 	renterDownloadQueueCmd = &cobra.Command{
 		Use:   "queue",
 		Short: "View the download queue",
@@ -49,6 +71,15 @@ var (
 		Run:   wrap(renterfilesdownloadcmd),
 	}
 
+	renterFilesHealthCmd = &cobra.Command{
+		Use:   "health",
+		Short: "View the health of all files",
+		Long: `View the upload progress, redundancy, and expiration of all files, least
+redundant first. Files with a redundancy below 1 cannot be downloaded, and are
+flagged as at risk.`,
+		Run: wrap(renterfileshealthcmd),
+	}
+
 	renterFilesListCmd = &cobra.Command{
 		Use:   "list",
 		Short: "List the status of all files",
@@ -70,6 +101,13 @@ var (
 		Run:   wrap(renterfilesloadasciicmd),
 	}
 
+	renterFilesPriorityCmd = &cobra.Command{
+		Use:   "priority [path] [priority]",
+		Short: "Set the repair priority of a file",
+		Long:  "Set the repair priority of a file. Files with a higher priority are repaired first.",
+		Run:   wrap(renterfilesprioritycmd),
+	}
+
 	renterFilesRenameCmd = &cobra.Command{
 		Use:   "rename [path] [newpath]",
 		Short: "Rename a file",
@@ -110,6 +148,60 @@ func abs(path string) string {
 	return abspath
 }
 
+// byEndHeight sorts contracts by their end height, earliest first.
+type byEndHeight []modules.RenterContract
+
+func (cs byEndHeight) Len() int      { return len(cs) }
+func (cs byEndHeight) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
+func (cs byEndHeight) Less(i, j int) bool {
+	if cs[i].EndHeight != cs[j].EndHeight {
+		return cs[i].EndHeight < cs[j].EndHeight
+	}
+	return cs[i].IP < cs[j].IP
+}
+
+// printContracts writes a table of contracts to w, earliest expiring first,
+// followed by the total amount spent on the contracts. If asJSON is set, the
+// contracts are written as JSON instead.
+func printContracts(w io.Writer, contracts []modules.RenterContract, asJSON bool) error {
+	sort.Sort(byEndHeight(contracts))
+	if asJSON {
+		enc, err := json.MarshalIndent(api.RenterContracts{Contracts: contracts}, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", enc)
+		return err
+	}
+
+	var spent, remaining types.Currency
+	fmt.Fprintf(w, "%-21s  %14s  %13s  %10s\n", "Host", "Remaining", "Size", "End Height")
+	for _, c := range contracts {
+		fmt.Fprintf(w, "%-21s  %14s  %13s  %10d\n", c.IP, siacoinUnits(c.RenterFunds), filesizeUnits(int64(c.Size)), c.EndHeight)
+		spent = spent.Add(c.Spent)
+		remaining = remaining.Add(c.RenterFunds)
+	}
+	_, err := fmt.Fprintf(w, "Total spent: %v across %v contracts (%v remaining)\n", siacoinUnits(spent), len(contracts), siacoinUnits(remaining))
+	return err
+}
+
+func rentercontractscmd() {
+	var rc api.RenterContracts
+	err := getAPI("/renter/contracts", &rc)
+	if err != nil {
+		fmt.Println("Could not get contracts:", err)
+		return
+	}
+	if len(rc.Contracts) == 0 && !renterContractsJSON {
+		fmt.Println("No contracts have been formed.")
+		return
+	}
+	err = printContracts(os.Stdout, rc.Contracts, renterContractsJSON)
+	if err != nil {
+		fmt.Println("Could not print contracts:", err)
+	}
+}
+
 func renterdownloadqueuecmd() {
 	var queue api.RenterDownloadQueue
 	err := getAPI("/renter/downloads", &queue)
@@ -145,6 +237,45 @@ func renterfilesdownloadcmd(path, destination string) {
 	fmt.Printf("Downloaded '%s' to %s.\n", path, abs(destination))
 }
 
+// byRedundancy sorts files from least to most redundant.
+type byRedundancy []modules.FileInfo
+
+func (fs byRedundancy) Len() int      { return len(fs) }
+func (fs byRedundancy) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs byRedundancy) Less(i, j int) bool {
+	if fs[i].Redundancy != fs[j].Redundancy {
+		return fs[i].Redundancy < fs[j].Redundancy
+	}
+	return fs[i].SiaPath < fs[j].SiaPath
+}
+
+// printFileHealth writes the health of each file to w, least redundant first.
+func printFileHealth(w io.Writer, files []modules.FileInfo) {
+	sort.Sort(byRedundancy(files))
+	fmt.Fprintf(w, "%13s  %8s  %10s  %10s  %s\n", "Size", "Uploaded", "Redundancy", "Expiration", "Path")
+	for _, file := range files {
+		fmt.Fprintf(w, "%13s  %7.2f%%  %10.2f  %10d  %s", filesizeUnits(int64(file.Filesize)), file.UploadProgress, file.Redundancy, file.Expiration, file.SiaPath)
+		if file.Redundancy < 1 {
+			fmt.Fprint(w, " (at risk)")
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func renterfileshealthcmd() {
+	var rf api.RenterFiles
+	err := getAPI("/renter/files", &rf)
+	if err != nil {
+		fmt.Println("Could not get file list:", err)
+		return
+	}
+	if len(rf.Files) == 0 {
+		fmt.Println("No files have been uploaded.")
+		return
+	}
+	printFileHealth(os.Stdout, rf.Files)
+}
+
 func renterfileslistcmd() {
 	var rf api.RenterFiles
 	err := getAPI("/renter/files", &rf)
@@ -192,6 +323,15 @@ func renterfilesloadasciicmd(ascii string) {
 	}
 }
 
+func renterfilesprioritycmd(path, priority string) {
+	err := post("/renter/priority/"+path, "priority="+priority)
+	if err != nil {
+		fmt.Println("Could not set file priority:", err)
+		return
+	}
+	fmt.Printf("Set the priority of %s to %s\n", path, priority)
+}
+
 func renterfilesrenamecmd(path, newpath string) {
 	err := post("/renter/rename/"+path, "newsiapath="+newpath)
 	if err != nil {
@@ -221,7 +361,7 @@ func renterfilesshareasciicmd(path string) {
 }
 
 func renterfilesuploadcmd(source, path string) {
-	err := post("/renter/upload/"+path, "source="+abs(source))
+	err := post("/renter/upload/"+path, fmt.Sprintf("source=%s&alias=%t&diverse=%t", abs(source), uploadAlias, uploadDiverse))
 	if err != nil {
 		fmt.Println("Could not upload file:", err)
 		return
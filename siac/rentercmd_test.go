@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPrintFileHealth checks that files are listed least redundant first, and
+// that files which cannot be recovered are flagged.
+func TestPrintFileHealth(t *testing.T) {
+	files := []modules.FileInfo{
+		{SiaPath: "healthy", Filesize: 1000, UploadProgress: 100, Redundancy: 3, Expiration: 500},
+		{SiaPath: "degraded", Filesize: 1000, UploadProgress: 60, Redundancy: 1.5, Expiration: 400},
+		{SiaPath: "atrisk", Filesize: 1000, UploadProgress: 20, Redundancy: 0.5, Expiration: 300},
+	}
+	buf := new(bytes.Buffer)
+	printFileHealth(buf, files)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatal("expected a header and three files, got", lines)
+	}
+	for i, name := range []string{"atrisk", "degraded", "healthy"} {
+		if !strings.Contains(lines[i+1], name) {
+			t.Errorf("expected %v on line %v, got %q", name, i+1, lines[i+1])
+		}
+	}
+	if !strings.HasSuffix(lines[1], "(at risk)") {
+		t.Error("file with redundancy below 1 was not flagged:", lines[1])
+	}
+	for _, line := range lines[2:] {
+		if strings.Contains(line, "at risk") {
+			t.Error("redundant file was flagged:", line)
+		}
+	}
+}
+
+// TestPrintContracts checks the table and JSON output of the renter's
+// contracts.
+func TestPrintContracts(t *testing.T) {
+	contracts := []modules.RenterContract{
+		{IP: "host2:9982", EndHeight: 2000, Spent: types.SiacoinPrecision.Mul(types.NewCurrency64(3)), RenterFunds: types.SiacoinPrecision.Mul(types.NewCurrency64(7)), Size: 2e9},
+		{IP: "host1:9982", EndHeight: 1000, Spent: types.SiacoinPrecision.Div(types.NewCurrency64(2)), RenterFunds: types.SiacoinPrecision, Size: 5e6},
+	}
+
+	buf := new(bytes.Buffer)
+	err := printContracts(buf, contracts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"Host                        Remaining           Size  End Height",
+		"host1:9982                    1.00 SC        5.00 MB        1000",
+		"host2:9982                    7.00 SC       2.000 GB        2000",
+		"Total spent: 3.50 SC across 2 contracts (8.00 SC remaining)",
+	}
+	if len(lines) != len(expected) {
+		t.Fatal("wrong number of lines:", lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %v: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+
+	buf.Reset()
+	err = printContracts(buf, contracts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rc api.RenterContracts
+	err = json.Unmarshal(buf.Bytes(), &rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rc.Contracts, contracts) {
+		t.Fatal("JSON output does not match the contracts:", rc.Contracts)
+	}
+}